@@ -0,0 +1,63 @@
+package appautoscalingclient
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling/applicationautoscalingiface"
+)
+
+// Client is the Application Auto Scaling behaviour skipper's commands depend on,
+// implemented by Appautoscalingclient
+type Client interface {
+	ServiceBounds(cluster, service string) (*Bounds, error)
+}
+
+// Appautoscalingclient looks up how ECS services are scaled
+type Appautoscalingclient struct {
+	svc applicationautoscalingiface.ApplicationAutoScalingAPI
+}
+
+// Bounds are the least and most tasks auto scaling keeps a service at
+type Bounds struct {
+	Min int64
+	Max int64
+}
+
+// New Constructor
+func New() *Appautoscalingclient {
+	return NewWithClient(applicationautoscaling.New(session.New()))
+}
+
+// NewWithClient constructs an Appautoscalingclient on top of the given Application Auto
+// Scaling API implementation
+func NewWithClient(svc applicationautoscalingiface.ApplicationAutoScalingAPI) *Appautoscalingclient {
+	return &Appautoscalingclient{
+		svc: svc,
+	}
+}
+
+// ServiceResourceID returns the resource id of the desired count of a service
+func ServiceResourceID(cluster, service string) string {
+	return fmt.Sprintf("service/%s/%s", cluster, service)
+}
+
+// ServiceBounds returns the bounds of the service's desired count, or nil if the
+// service is not scaled automatically
+func (c *Appautoscalingclient) ServiceBounds(cluster, service string) (*Bounds, error) {
+	output, err := c.svc.DescribeScalableTargets(&applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+		ResourceIds:       []*string{aws.String(ServiceResourceID(cluster, service))},
+		ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.ScalableTargets) == 0 {
+		return nil, nil
+	}
+	t := output.ScalableTargets[0]
+	return &Bounds{Min: aws.Int64Value(t.MinCapacity), Max: aws.Int64Value(t.MaxCapacity)}, nil
+}
@@ -0,0 +1,141 @@
+package cloudwatchlogsclient
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+)
+
+// Client is the CloudWatch Logs behaviour skipper's commands depend on, implemented by Cloudwatchlogsclient
+type Client interface {
+	Tail(group, streamPrefix string, since time.Time) *Tail
+}
+
+// Cloudwatchlogsclient follows log streams by polling FilterLogEvents
+type Cloudwatchlogsclient struct {
+	svc          cloudwatchlogsiface.CloudWatchLogsAPI
+	pollInterval time.Duration
+}
+
+// Event is one log event of a stream
+type Event struct {
+	Stream    string
+	Timestamp time.Time
+	Message   string
+}
+
+// Tail is a running poller of log events, it has to be stopped with Stop
+type Tail struct {
+	// Events receives the events in the order they were logged, it is closed when
+	// the tail stops or fails
+	Events <-chan *Event
+
+	stop chan struct{}
+	done chan struct{}
+	err  error
+}
+
+// New Constructor
+func New() *Cloudwatchlogsclient {
+	return NewWithClient(cloudwatchlogs.New(session.New()))
+}
+
+// NewWithClient constructs a Cloudwatchlogsclient on top of the given CloudWatch Logs API implementation
+func NewWithClient(svc cloudwatchlogsiface.CloudWatchLogsAPI) *Cloudwatchlogsclient {
+	return &Cloudwatchlogsclient{
+		svc:          svc,
+		pollInterval: time.Second * 2,
+	}
+}
+
+// SetPollInterval sets how often Tail looks for new events, 2s by default
+func (c *Cloudwatchlogsclient) SetPollInterval(interval time.Duration) {
+	c.pollInterval = interval
+}
+
+// Tail polls the events of the streams of the group starting with streamPrefix,
+// beginning at since, until Stop is called
+func (c *Cloudwatchlogsclient) Tail(group, streamPrefix string, since time.Time) *Tail {
+	events := make(chan *Event)
+	t := &Tail{
+		Events: events,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		defer close(events)
+		t.err = c.poll(group, streamPrefix, since, events, t.stop)
+	}()
+	return t
+}
+
+// Stop ends the polling and returns the error it failed with, if any
+func (t *Tail) Stop() error {
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+	<-t.done
+	return t.err
+}
+
+func (c *Cloudwatchlogsclient) poll(group, streamPrefix string, since time.Time, events chan<- *Event, stop <-chan struct{}) error {
+	start := aws.TimeUnixMilli(since)
+	// events logged in the same millisecond as the last one are returned again by the
+	// next poll, seen holds their ids
+	seen := make(map[string]bool)
+	for {
+		var nextToken *string
+		last := start
+		for {
+			resp, err := c.svc.FilterLogEvents(&cloudwatchlogs.FilterLogEventsInput{
+				LogGroupName:        aws.String(group),
+				LogStreamNamePrefix: aws.String(streamPrefix),
+				StartTime:           aws.Int64(start),
+				Interleaved:         aws.Bool(true),
+				NextToken:           nextToken,
+			})
+			if err != nil {
+				return err
+			}
+			for _, e := range resp.Events {
+				id := aws.StringValue(e.EventId)
+				if seen[id] {
+					continue
+				}
+				timestamp := aws.Int64Value(e.Timestamp)
+				if timestamp > last {
+					last = timestamp
+					seen = make(map[string]bool)
+				}
+				seen[id] = true
+				event := &Event{
+					Stream:    aws.StringValue(e.LogStreamName),
+					Timestamp: time.Unix(0, timestamp*int64(time.Millisecond)),
+					Message:   aws.StringValue(e.Message),
+				}
+				select {
+				case events <- event:
+				case <-stop:
+					return nil
+				}
+			}
+			if resp.NextToken == nil {
+				break
+			}
+			nextToken = resp.NextToken
+		}
+		start = last
+
+		select {
+		case <-time.After(c.pollInterval):
+		case <-stop:
+			return nil
+		}
+	}
+}
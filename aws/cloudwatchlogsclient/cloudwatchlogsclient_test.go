@@ -0,0 +1,109 @@
+package cloudwatchlogsclient
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/blinkist/skipper/aws/fake"
+)
+
+// countingLogs counts the FilterLogEvents calls made by a tail
+type countingLogs struct {
+	*fake.CloudWatchLogs
+	calls int32
+}
+
+func (c *countingLogs) FilterLogEvents(input *cloudwatchlogs.FilterLogEventsInput) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return c.CloudWatchLogs.FilterLogEvents(input)
+}
+
+func newTestClient(backend *fake.Backend) (*Cloudwatchlogsclient, *countingLogs) {
+	svc := &countingLogs{CloudWatchLogs: backend.CloudWatchLogs()}
+	c := NewWithClient(svc)
+	c.SetPollInterval(10 * time.Millisecond)
+	return c, svc
+}
+
+func receive(t *testing.T, tail *Tail) *Event {
+	select {
+	case event, ok := <-tail.Events:
+		if !ok {
+			t.Fatal("expected an event, the tail stopped")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+func TestTail(t *testing.T) {
+	backend := fake.New()
+	backend.PageSize = 1
+	backend.AddLogEvents("/ecs/api", "api/api/task-1", "first", "second")
+	backend.AddLogEvents("/ecs/api", "api/api/task-2", "other task")
+	c, _ := newTestClient(backend)
+
+	tail := c.Tail("/ecs/api", "api/api/task-1", time.Now().Add(-time.Minute))
+	for _, expected := range []string{"first", "second"} {
+		if event := receive(t, tail); event.Message != expected || event.Stream != "api/api/task-1" {
+			t.Errorf("expected %q of api/api/task-1, got %q of %s", expected, event.Message, event.Stream)
+		}
+	}
+	backend.AddLogEvents("/ecs/api", "api/api/task-1", "third")
+	if event := receive(t, tail); event.Message != "third" {
+		t.Errorf("expected the event logged after the first poll, got %q", event.Message)
+	}
+	select {
+	case event := <-tail.Events:
+		t.Errorf("expected no event to be sent twice, got %q", event.Message)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := tail.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-tail.Events; ok {
+		t.Error("expected the events to be closed")
+	}
+}
+
+func TestTailStop(t *testing.T) {
+	backend := fake.New()
+	backend.AddLogEvents("/ecs/api", "api/api/task-1", "first")
+	c, svc := newTestClient(backend)
+
+	tail := c.Tail("/ecs/api", "api/api/task-1", time.Now().Add(-time.Minute))
+	receive(t, tail)
+	time.Sleep(50 * time.Millisecond)
+	// the event is not received, stopping must not block on sending it
+	backend.AddLogEvents("/ecs/api", "api/api/task-1", "second")
+	time.Sleep(50 * time.Millisecond)
+	if err := tail.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	calls := atomic.LoadInt32(&svc.calls)
+	time.Sleep(50 * time.Millisecond)
+	if after := atomic.LoadInt32(&svc.calls); after != calls {
+		t.Errorf("expected no poll after Stop, got %d more", after-calls)
+	}
+	if err := tail.Stop(); err != nil {
+		t.Errorf("expected a second Stop to return nil, got %s", err)
+	}
+}
+
+func TestTailMissingGroup(t *testing.T) {
+	c, _ := newTestClient(fake.New())
+
+	tail := c.Tail("/ecs/missing", "api", time.Now())
+	if _, ok := <-tail.Events; ok {
+		t.Fatal("expected the events to be closed")
+	}
+	err := tail.Stop()
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != cloudwatchlogs.ErrCodeResourceNotFoundException {
+		t.Errorf("expected %s, got %v", cloudwatchlogs.ErrCodeResourceNotFoundException, err)
+	}
+}
@@ -9,9 +9,9 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 )
 
 var (
@@ -19,11 +19,22 @@ var (
 	once     sync.Once
 )
 
+// Client is the EC2 behaviour skipper's commands depend on, implemented by Ec2client
+type Client interface {
+	CreateKeypair(pairName *string) (*ec2.CreateKeyPairOutput, error)
+	KeypairExists(pairName *string) bool
+	DeleteKeypair(pairName *string)
+	DescribeInstanceAttribute(instance *string, attribute *string) (*ec2.DescribeInstanceAttributeOutput, error)
+	GetInstancesWithTagName(name *string) []*ec2.Instance
+	DescribeInstances(instances []*string) []*ec2.Instance
+	StartInstance(startInstanceInput *StartInstanceInput) (*ec2.Instance, error)
+	TerminateInstance(instance *ec2.Instance) error
+	DescribeInstance(instanceId *string) (*ec2.Instance, error)
+}
+
 // Ec2client type
 type Ec2client struct {
-	session     *session.Session
-	svc         *ec2.EC2
-	creds       *credentials.Credentials
+	svc         ec2iface.EC2API
 	logger      *log.Logger
 	clusterArns map[string]string
 	timeout     int
@@ -31,15 +42,17 @@ type Ec2client struct {
 
 // New Constructor, takes the default region
 func New() *Ec2client {
-	sess := session.New()
-	svc := ec2.New(sess)
+	return NewWithClient(ec2.New(session.New()))
+}
+
+// NewWithClient constructs an Ec2client on top of the given EC2 API implementation
+func NewWithClient(svc ec2iface.EC2API) *Ec2client {
 	logger := log.New(os.Stderr, " - ", log.LstdFlags)
 
 	return &Ec2client{
 		clusterArns: nil,
 		svc:         svc,
 		logger:      logger,
-		session:     sess,
 		timeout:     300,
 	}
 }
@@ -92,7 +105,7 @@ func (c *Ec2client) DeleteKeypair(pairName *string) {
 	})
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidKeyPair.Duplicate" {
-			fmt.Printf("Key pair %q does not exist.", pairName)
+			fmt.Printf("Key pair %q does not exist.", *pairName)
 			os.Exit(1)
 		}
 		fmt.Printf("Unable to delete key pair: %s, %v", *pairName, err)
@@ -130,12 +143,7 @@ func (c *Ec2client) GetInstancesWithTagName(name *string) []*ec2.Instance {
 		},
 	}
 
-	res, _ := c.svc.DescribeInstances(params)
-	if len(res.Reservations) == 0 {
-		return []*ec2.Instance{}
-	}
-
-	return res.Reservations[0].Instances
+	return c.describeInstancesPages(params)
 }
 
 // DescribeInstances returns a list of isntances for a list of intanceIds
@@ -145,22 +153,22 @@ func (c *Ec2client) DescribeInstances(instances []*string) []*ec2.Instance {
 		InstanceIds: instances,
 	}
 
-	res, err := c.svc.DescribeInstances(params)
-	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
-	}
+	return c.describeInstancesPages(params)
+}
 
-	if res.NextToken != nil {
-		fmt.Println("Pagination not implemented")
-		os.Exit(1)
-	}
+// describeInstancesPages collects the instances of all reservations on all pages
+func (c *Ec2client) describeInstancesPages(params *ec2.DescribeInstancesInput) []*ec2.Instance {
 	allInstances := make([]*ec2.Instance, 0)
 
-	for _, r := range res.Reservations {
-		for _, i := range r.Instances {
-			allInstances = append(allInstances, i)
+	err := c.svc.DescribeInstancesPages(params, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, r := range page.Reservations {
+			allInstances = append(allInstances, r.Instances...)
 		}
+		return !lastPage
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
 	}
 	return allInstances
 }
@@ -0,0 +1,153 @@
+package ec2client
+
+import (
+	b64 "encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/fake"
+)
+
+func TestKeypair(t *testing.T) {
+	backend := fake.New()
+	c := NewWithClient(backend.EC2())
+	name := "skipper-test"
+
+	if c.KeypairExists(&name) {
+		t.Fatal("expected the keypair not to exist yet")
+	}
+	out, err := c.CreateKeypair(&name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(out.KeyName) != name || !strings.Contains(aws.StringValue(out.KeyMaterial), "PRIVATE KEY") {
+		t.Errorf("expected the key material of %s, got %s", name, aws.StringValue(out.KeyName))
+	}
+	if !c.KeypairExists(&name) {
+		t.Error("expected the keypair to exist")
+	}
+	if _, err := c.CreateKeypair(&name); err == nil {
+		t.Error("expected creating the keypair twice to fail")
+	}
+
+	c.DeleteKeypair(&name)
+	if c.KeypairExists(&name) {
+		t.Error("expected the keypair to be deleted")
+	}
+}
+
+func TestStartInstance(t *testing.T) {
+	backend := fake.New()
+	backend.AddCluster("DEBUG")
+	c := NewWithClient(backend.EC2())
+	name := "skipper-test"
+	if _, err := c.CreateKeypair(&name); err != nil {
+		t.Fatal(err)
+	}
+
+	userData := "#!/bin/bash\necho ECS_CLUSTER=DEBUG >> /etc/ecs/ecs.config\n"
+	instance, err := c.StartInstance(&StartInstanceInput{
+		IamInstanceProfileArn: aws.String("arn:aws:iam::123456789012:instance-profile/ecsInstanceRole"),
+		ImageID:               aws.String("ami-12345678"),
+		InstanceType:          aws.String("t2.small"),
+		KeyName:               &name,
+		SecurityGroupIds:      aws.StringSlice([]string{"sg-12345678"}),
+		SubnetID:              aws.String("subnet-12345678"),
+		TagValue:              &name,
+		UserData:              &userData,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	described, err := c.DescribeInstance(instance.InstanceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(described.ImageId) != "ami-12345678" || aws.StringValue(described.KeyName) != name || aws.StringValue(described.SubnetId) != "subnet-12345678" {
+		t.Errorf("expected the instance to be launched as requested, got %s", described)
+	}
+	tagged := c.GetInstancesWithTagName(&name)
+	if len(tagged) != 1 || *tagged[0].InstanceId != *instance.InstanceId {
+		t.Errorf("expected to find %s by its Name tag, got %d instances", *instance.InstanceId, len(tagged))
+	}
+
+	attribute, err := c.DescribeInstanceAttribute(instance.InstanceId, aws.String("userData"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := b64.StdEncoding.DecodeString(aws.StringValue(attribute.UserData.Value))
+	if err != nil || string(decoded) != userData {
+		t.Errorf("expected the user data to be %q, got %q (%v)", userData, decoded, err)
+	}
+
+	// the user data makes the instance join the debug cluster
+	containerInstances, err := backend.ECS().ListContainerInstances(&ecs.ListContainerInstancesInput{Cluster: aws.String("DEBUG")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containerInstances.ContainerInstanceArns) != 1 {
+		t.Errorf("expected the instance to join the cluster DEBUG, got %d container instances", len(containerInstances.ContainerInstanceArns))
+	}
+
+	if err := c.TerminateInstance(instance); err != nil {
+		t.Fatal(err)
+	}
+	described, err = c.DescribeInstance(instance.InstanceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(described.State.Name) != "terminated" {
+		t.Errorf("expected the instance to be terminated, got %s", aws.StringValue(described.State.Name))
+	}
+}
+
+func TestStartInstanceWithoutKeypair(t *testing.T) {
+	c := NewWithClient(fake.New().EC2())
+	_, err := c.StartInstance(&StartInstanceInput{
+		IamInstanceProfileArn: aws.String("arn:aws:iam::123456789012:instance-profile/ecsInstanceRole"),
+		ImageID:               aws.String("ami-12345678"),
+		InstanceType:          aws.String("t2.small"),
+		KeyName:               aws.String("missing"),
+		TagValue:              aws.String("missing"),
+		UserData:              aws.String(""),
+	})
+	if err == nil || !strings.Contains(err.Error(), "InvalidKeyPair.NotFound") {
+		t.Errorf("expected the missing keypair to fail the launch, got %v", err)
+	}
+}
+
+func TestDescribeInstancesPages(t *testing.T) {
+	backend := fake.New()
+	backend.PageSize = 2
+	c := NewWithClient(backend.EC2())
+	name := "skipper-test"
+	if _, err := c.CreateKeypair(&name); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]*string, 0, 5)
+	for i := 0; i < 5; i++ {
+		instance, err := c.StartInstance(&StartInstanceInput{
+			IamInstanceProfileArn: aws.String("arn:aws:iam::123456789012:instance-profile/ecsInstanceRole"),
+			ImageID:               aws.String("ami-12345678"),
+			InstanceType:          aws.String("t2.small"),
+			KeyName:               &name,
+			TagValue:              &name,
+			UserData:              aws.String(""),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, instance.InstanceId)
+	}
+
+	if instances := c.DescribeInstances(ids); len(instances) != 5 {
+		t.Errorf("expected 5 instances by id, got %d", len(instances))
+	}
+	if instances := c.GetInstancesWithTagName(&name); len(instances) != 5 {
+		t.Errorf("expected 5 instances by tag, got %d", len(instances))
+	}
+}
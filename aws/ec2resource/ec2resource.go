@@ -11,13 +11,13 @@ import (
 
 // Ec2resource 'Class' struct
 type Ec2resource struct {
-	ec2client   *ec2client.Ec2client
+	ec2client   ec2client.Client
 	ec2instance *ec2.Instance
 	instanceID  *string
 }
 
 // New is the constructor of the Ec2resource
-func New(argInstanceId *string, ec2client *ec2client.Ec2client) *Ec2resource {
+func New(argInstanceId *string, ec2client ec2client.Client) *Ec2resource {
 	return &Ec2resource{
 		instanceID: argInstanceId,
 		ec2client:  ec2client,
@@ -3,15 +3,120 @@ package ecrclient
 import (
 	"encoding/base64"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/fsouza/go-dockerclient"
 )
 
+// Client is the ECR behaviour skipper's commands depend on, implemented by Ecrclient
+type Client interface {
+	ImageExists(image *Image) (bool, error)
+}
+
+// Ecrclient looks up images in ECR, in the region of their registry
+type Ecrclient struct {
+	svc     ecriface.ECRAPI
+	session *session.Session
+	regions map[string]ecriface.ECRAPI
+}
+
+// New Constructor
+func New() *Ecrclient {
+	sess := session.New()
+	return &Ecrclient{
+		svc:     ecr.New(sess),
+		session: sess,
+		regions: make(map[string]ecriface.ECRAPI),
+	}
+}
+
+// NewWithClient constructs an Ecrclient on top of the given ECR API implementation,
+// which is used for the registries of all regions
+func NewWithClient(svc ecriface.ECRAPI) *Ecrclient {
+	return &Ecrclient{
+		svc: svc,
+	}
+}
+
+// client returns the ECR client of the region, created on first use
+func (c *Ecrclient) client(region string) ecriface.ECRAPI {
+	if c.session == nil || region == "" || region == aws.StringValue(c.session.Config.Region) {
+		return c.svc
+	}
+	svc, ok := c.regions[region]
+	if !ok {
+		svc = ecr.New(c.session, &aws.Config{Region: aws.String(region)})
+		c.regions[region] = svc
+	}
+	return svc
+}
+
+// registryHost matches ECR registries like 123456789012.dkr.ecr.eu-central-1.amazonaws.com
+var registryHost = regexp.MustCompile(`^(\d{12})\.dkr\.ecr\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// Image is a parsed ECR image uri
+type Image struct {
+	RegistryID string
+	Region     string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseImage parses an image uri, returning false if it is not in an ECR registry
+func ParseImage(uri string) (*Image, bool) {
+	parts := strings.SplitN(uri, "/", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+	m := registryHost.FindStringSubmatch(parts[0])
+	if m == nil {
+		return nil, false
+	}
+
+	image := &Image{RegistryID: m[1], Region: m[2], Repository: parts[1]}
+	if i := strings.Index(image.Repository, "@"); i >= 0 {
+		image.Repository, image.Digest = image.Repository[:i], image.Repository[i+1:]
+	} else if i := strings.LastIndex(image.Repository, ":"); i >= 0 {
+		image.Repository, image.Tag = image.Repository[:i], image.Repository[i+1:]
+	}
+	if image.Tag == "" && image.Digest == "" {
+		image.Tag = "latest"
+	}
+	return image, true
+}
+
+// ImageExists checks if the tag or digest of the image is in the repository, asking the
+// registry's region
+func (c *Ecrclient) ImageExists(image *Image) (bool, error) {
+	id := &ecr.ImageIdentifier{}
+	if image.Digest != "" {
+		id.ImageDigest = aws.String(image.Digest)
+	} else {
+		id.ImageTag = aws.String(image.Tag)
+	}
+
+	output, err := c.client(image.Region).DescribeImages(&ecr.DescribeImagesInput{
+		RegistryId:     aws.String(image.RegistryID),
+		RepositoryName: aws.String(image.Repository),
+		ImageIds:       []*ecr.ImageIdentifier{id},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ecr.ErrCodeImageNotFoundException {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(output.ImageDetails) > 0, nil
+}
+
 type Auth struct {
 	Token         string
 	User          string
@@ -0,0 +1,47 @@
+package ecrclient
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/blinkist/skipper/aws/fake"
+)
+
+func TestImageExists(t *testing.T) {
+	backend := fake.New()
+	repository := backend.AddImage("api", "v1")
+	client := NewWithClient(backend.ECR())
+
+	for uri, expected := range map[string]bool{repository + ":v1": true, repository + ":v2": false} {
+		image, ok := ParseImage(uri)
+		if !ok {
+			t.Fatalf("expected %s to be an ECR image", uri)
+		}
+		exists, err := client.ImageExists(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != expected {
+			t.Errorf("expected %s to exist: %t, got %t", uri, expected, exists)
+		}
+	}
+}
+
+func TestClientRegion(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("eu-central-1")}))
+	c := &Ecrclient{svc: ecr.New(sess), session: sess, regions: make(map[string]ecriface.ECRAPI)}
+
+	if c.client("eu-central-1") != c.svc || c.client("") != c.svc {
+		t.Error("expected the session's region to use the default client")
+	}
+	svc, ok := c.client("us-east-1").(*ecr.ECR)
+	if !ok || aws.StringValue(svc.Client.Config.Region) != "us-east-1" {
+		t.Fatal("expected a client of us-east-1")
+	}
+	if c.client("us-east-1") != svc {
+		t.Error("expected the client of us-east-1 to be reused")
+	}
+}
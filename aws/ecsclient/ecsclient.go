@@ -6,44 +6,196 @@ import (
 	"log"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
 )
 
+// Client is the ECS behaviour skipper's commands depend on, implemented by Ecsclient
+type Client interface {
+	ScaleService(cluster string, service string, desiredCount int) (*ecs.Service, error)
+	ListServices(cluster *string) ([]string, error)
+	FindService(cluster *string, service *string) (*ecs.Service, error)
+	DescribeServices(cluster *string, services []string) ([]*ecs.Service, error)
+	StartTaskOnContainerInstance(cluster *string, taskdefinition *string, container *string, rolearn *string, startedBy *string, networkConfiguration *ecs.NetworkConfiguration) (*ecs.StartTaskOutput, error)
+	RunFargateTask(cluster *string, taskdefinition *string, rolearn *string, startedBy *string, networkConfiguration *ecs.NetworkConfiguration) (*ecs.RunTaskOutput, error)
+	StopTask(cluster *string, taskarn *string) (bool, error)
+	ExecuteCommand(cluster *string, taskarn *string, container *string, command *string) (*ecs.Session, error)
+	GetClusterNames() ([]string, error)
+	RegisterTaskDefinition(task *string, rdi *RegisterTaskDefinitionInput) (string, error)
+	ProposeTaskDefinition(task *string, rdi *RegisterTaskDefinitionInput) (*ecs.TaskDefinition, *ecs.TaskDefinition, error)
+	RegisterTaskDefinitionRevision(td *ecs.TaskDefinition) (string, error)
+	Wait(cluster, service, arn *string) error
+	WaitWithEvents(cluster, service, arn *string, events chan<- *Event) error
+	GetDeployment(cluster, service, arn *string) (*ecs.Deployment, error)
+	GetContainerImage(cluster *string, service *string) *string
+	GetTaskDefinition(task *string) (*ecs.TaskDefinition, error)
+	ListTaskDefinitionRevisions(family *string) ([]string, error)
+	GetContainerDefinitions(task *string) ([]*ecs.ContainerDefinition, error)
+	GetContainerNetworkMode(task *string) (*string, error)
+	GetTaskRoleArn(task *string) (*string, error)
+	GetTaskVolumes(task *string) ([]*ecs.Volume, error)
+	GetTaskPlacementConstraints(task *string) ([]*ecs.TaskDefinitionPlacementConstraint, error)
+	RestartService(cluster *string, service *string)
+	UpdateService(cluster, service *string, image *string, count *int64, argWait bool, changes *map[string]string, unsets *map[string]struct{}, targetGroup *string)
+	WaitForTaskRunning(cluster *string, taskArn *string) error
+	UpdateServiceWithTaskDefinition(cluster *string, service *string, count *int64, arn *string) error
+	GetClusterTasksWithDefinition(cluster *string, taskdefinition *string) ([]*ecs.Task, error)
+	GetClusterTasks(cluster *string) ([]*ecs.Task, error)
+	GetContainerInstances(cluster *string, service *string) ([]*TaskInfo, error)
+	GetServiceTasks(cluster *string, service *string) ([]*TaskInfo, error)
+	DescribeContainerInstances(cluster *string, instances []*ec2.Instance) ([]*ecs.ContainerInstance, error)
+	GetClusterContainerInstances(cluster *string) ([]*ecs.ContainerInstance, error)
+	GetInstanceIDForContainerArn(cluster *string, containerinstancearn *string) (*string, error)
+	GetTaskArnsForService(cluster *string, service *string) ([]*string, error)
+}
+
 // Ecsclient type
 type Ecsclient struct {
-	session      *session.Session
-	svc          *ecs.ECS
-	creds        *credentials.Credentials
+	svc          ecsiface.ECSAPI
+	ec2svc       ec2iface.EC2API
 	logger       *log.Logger
 	pollInterval time.Duration
 	timeout      int
 }
 
-// TaskInfo holds flattened Task Information in one struct
+// TaskInfo holds flattened Task Information in one struct. Tasks using the awsvpc
+// network mode report the private IP of their ENI as IpAddress, Fargate tasks have
+// no ContainerInstanceArn and no Ec2InstanceId.
 type TaskInfo struct {
 	TaskRoleArn          *string
 	TaskDefinitionArn    *string
 	TaskArn              *string
+	ClusterArn           *string
+	Group                *string
+	LaunchType           *string
 	ContainerInstanceArn *string
-	ContainerPort0       *int64
-	Hostport0            *int64
-	Proto0               *string
-	AwsLogGroup          *string
 	Ec2InstanceId        *string
 	IpAddress            *string
-	Cpu0                 *int64
-	Softmem0             *int64
-	Hardmem0             *int64
+	NetworkInterfaceId   *string
+	SubnetId             *string
+	LastStatus           *string
+	HealthStatus         *string
+	StartedAt            *time.Time
+	Containers           []*ContainerInfo
+}
+
+// ContainerInfo holds the definition and runtime state of one container of a task
+type ContainerInfo struct {
+	Name            *string
+	Image           *string
+	Essential       *bool
+	Cpu             *int64
+	Softmem         *int64
+	Hardmem         *int64
+	NetworkBindings []*ecs.NetworkBinding
+	LogDriver       *string
+	LogOptions      map[string]*string
+	AwsLogGroup     *string
+	// AwsLogPrefix is the awslogs-stream-prefix option, streams are named
+	// prefix/container/task-id when it is set and task-id otherwise
+	AwsLogPrefix *string
+	LastStatus   *string
+	HealthStatus *string
+	HealthCheck  *ecs.HealthCheck
+}
+
+// IsFargate returns true if the task does not run on a container instance
+func (ti *TaskInfo) IsFargate() bool {
+	return aws.StringValue(ti.LaunchType) == ecs.LaunchTypeFargate
+}
+
+// ServiceName returns the name of the service which started the task, or an
+// empty string if it was not started by a service
+func (ti *TaskInfo) ServiceName() string {
+	group := aws.StringValue(ti.Group)
+	if !strings.HasPrefix(group, "service:") {
+		return ""
+	}
+	return strings.TrimPrefix(group, "service:")
 }
 
+// Container returns the container with the given name or nil
+func (ti *TaskInfo) Container(name string) *ContainerInfo {
+	for _, ci := range ti.Containers {
+		if aws.StringValue(ci.Name) == name {
+			return ci
+		}
+	}
+	return nil
+}
+
+// ContainerNames returns the names of all containers of the task
+func (ti *TaskInfo) ContainerNames() []string {
+	names := make([]string, len(ti.Containers))
+	for i, ci := range ti.Containers {
+		names[i] = aws.StringValue(ci.Name)
+	}
+	return names
+}
+
+// Endpoints returns host:port for every network binding of the container,
+// or just the host if it does not publish any ports
+func (ti *TaskInfo) Endpoints(ci *ContainerInfo) []string {
+	host := aws.StringValue(ti.IpAddress)
+	if len(ci.NetworkBindings) == 0 {
+		return []string{host}
+	}
+	endpoints := make([]string, len(ci.NetworkBindings))
+	for i, nb := range ci.NetworkBindings {
+		endpoints[i] = fmt.Sprintf("%s:%d/%s", host, aws.Int64Value(nb.HostPort), aws.StringValue(nb.Protocol))
+	}
+	return endpoints
+}
+
+// Describe returns a one line summary of the container's ports and health
+func (ti *TaskInfo) Describe(ci *ContainerInfo) string {
+	health := aws.StringValue(ci.HealthStatus)
+	if health == "" {
+		health = ecs.HealthStatusUnknown
+	}
+	return fmt.Sprintf("%s [%s] %s %s", aws.StringValue(ci.Name), strings.Join(ti.Endpoints(ci), ","), aws.StringValue(ci.LastStatus), health)
+}
+
+// Target returns the id and port the task is registered with in the target group of the
+// load balancer: the ip of its ENI and the container port for awsvpc tasks, the instance
+// and host port otherwise. It returns false if the task does not publish the port.
+func (ti *TaskInfo) Target(lb *ecs.LoadBalancer) (string, int64, bool) {
+	if ti.NetworkInterfaceId != nil {
+		return aws.StringValue(ti.IpAddress), aws.Int64Value(lb.ContainerPort), ti.IpAddress != nil
+	}
+	ci := ti.Container(aws.StringValue(lb.ContainerName))
+	if ci == nil || ti.Ec2InstanceId == nil {
+		return "", 0, false
+	}
+	for _, nb := range ci.NetworkBindings {
+		if aws.Int64Value(nb.ContainerPort) == aws.Int64Value(lb.ContainerPort) {
+			return *ti.Ec2InstanceId, aws.Int64Value(nb.HostPort), true
+		}
+	}
+	return "", 0, false
+}
+
+// maxDescribeBatch is the most tasks or container instances one Describe call accepts
+const maxDescribeBatch = 100
+
+// maxDescribeServices is the most services one DescribeServices call accepts
+const maxDescribeServices = 10
+
+// failureMissing is the reason of the failures of Describe calls for resources which
+// do not exist
+const failureMissing = "MISSING"
+
 var (
 	instance *Ecsclient
 	once     sync.Once
@@ -52,18 +204,27 @@ var (
 // New Constructor
 func New() *Ecsclient {
 	sess := session.New()
-	svc := ecs.New(sess)
+	return NewWithClients(ecs.New(sess), ec2.New(sess))
+}
+
+// NewWithClients constructs an Ecsclient on top of the given ECS and EC2 API implementations
+func NewWithClients(svc ecsiface.ECSAPI, ec2svc ec2iface.EC2API) *Ecsclient {
 	logger := log.New(os.Stderr, " - ", log.LstdFlags)
 
 	return &Ecsclient{
 		svc:          svc,
+		ec2svc:       ec2svc,
 		pollInterval: time.Second * 5,
 		logger:       logger,
-		session:      sess,
 		timeout:      300,
 	}
 }
 
+// SetPollInterval sets how often Wait looks at a deployment, 5s by default
+func (c *Ecsclient) SetPollInterval(d time.Duration) {
+	c.pollInterval = d
+}
+
 // Singleton method
 func GetInstance() *Ecsclient {
 	once.Do(func() {
@@ -116,25 +277,91 @@ func (c *Ecsclient) FindService(cluster *string, service *string) (*ecs.Service,
 	if len(result.Services) == 1 {
 		return result.Services[0], nil
 	}
-	return nil, fmt.Errorf("did not find one (%d) services matching name %s in %s cluster, unable to continue", len(result.Services), *service, *cluster)
+	return nil, &ServiceNotFoundError{Cluster: *cluster, Service: *service}
 }
 
-// Start Task on Container Instance
-func (c *Ecsclient) StartTaskOnContainerInstance(cluster *string, taskdefinition *string, container *string, rolearn *string, startedBy *string) (*ecs.StartTaskOutput, error) {
+// ServiceNotFoundError is returned by FindService if the cluster has no such service
+type ServiceNotFoundError struct {
+	Cluster string
+	Service string
+}
+
+func (e *ServiceNotFoundError) Error() string {
+	return fmt.Sprintf("service %s not found in cluster %s", e.Service, e.Cluster)
+}
+
+// NotFound tells the error is about a service which does not exist
+func (e *ServiceNotFoundError) NotFound() bool {
+	return true
+}
+
+// DescribeServices describes the services of the cluster with their tags, in batches
+// of maxDescribeServices
+func (c *Ecsclient) DescribeServices(cluster *string, services []string) ([]*ecs.Service, error) {
+	out := make([]*ecs.Service, 0, len(services))
+	for start := 0; start < len(services); start += maxDescribeServices {
+		end := start + maxDescribeServices
+		if end > len(services) {
+			end = len(services)
+		}
+		result, err := c.svc.DescribeServices(&ecs.DescribeServicesInput{
+			Cluster:  cluster,
+			Services: aws.StringSlice(services[start:end]),
+			Include:  []*string{aws.String(ecs.ServiceFieldTags)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Failures) > 0 {
+			return nil, fmt.Errorf("could not describe service %s: %s", aws.StringValue(result.Failures[0].Arn), aws.StringValue(result.Failures[0].Reason))
+		}
+		out = append(out, result.Services...)
+	}
+	return out, nil
+}
+
+// Start Task on Container Instance, networkConfiguration is required for task definitions using awsvpc
+func (c *Ecsclient) StartTaskOnContainerInstance(cluster *string, taskdefinition *string, container *string, rolearn *string, startedBy *string, networkConfiguration *ecs.NetworkConfiguration) (*ecs.StartTaskOutput, error) {
 
 	sti := &ecs.StartTaskInput{
-		StartedBy:          aws.String(*startedBy),
-		TaskDefinition:     aws.String(*taskdefinition),
-		Cluster:            aws.String(*cluster),
-		ContainerInstances: []*string{container},
-		Overrides: &ecs.TaskOverride{
-			TaskRoleArn: aws.String(*rolearn),
-		},
+		StartedBy:            aws.String(*startedBy),
+		TaskDefinition:       aws.String(*taskdefinition),
+		Cluster:              aws.String(*cluster),
+		ContainerInstances:   []*string{container},
+		NetworkConfiguration: networkConfiguration,
+		Overrides:            taskRoleOverride(rolearn),
 	}
 	sto, err := c.svc.StartTask(sti)
 	return sto, err
 }
 
+// RunFargateTask runs one task with the FARGATE launch type and ECS Exec enabled
+func (c *Ecsclient) RunFargateTask(cluster *string, taskdefinition *string, rolearn *string, startedBy *string, networkConfiguration *ecs.NetworkConfiguration) (*ecs.RunTaskOutput, error) {
+	if networkConfiguration == nil || networkConfiguration.AwsvpcConfiguration == nil {
+		return nil, errors.New("fargate tasks need an awsvpc network configuration")
+	}
+
+	rti := &ecs.RunTaskInput{
+		StartedBy:            aws.String(*startedBy),
+		TaskDefinition:       aws.String(*taskdefinition),
+		Cluster:              aws.String(*cluster),
+		Count:                aws.Int64(1),
+		LaunchType:           aws.String(ecs.LaunchTypeFargate),
+		NetworkConfiguration: networkConfiguration,
+		Overrides:            taskRoleOverride(rolearn),
+		EnableExecuteCommand: aws.Bool(true),
+	}
+	return c.svc.RunTask(rti)
+}
+
+// taskRoleOverride returns the overrides starting a task with the given role, if any
+func taskRoleOverride(rolearn *string) *ecs.TaskOverride {
+	if rolearn == nil {
+		return nil
+	}
+	return &ecs.TaskOverride{TaskRoleArn: aws.String(*rolearn)}
+}
+
 // Stop Task on cluster
 func (c *Ecsclient) StopTask(cluster *string, taskarn *string) (bool, error) {
 	_, err := c.svc.StopTask(&ecs.StopTaskInput{
@@ -148,33 +375,51 @@ func (c *Ecsclient) StopTask(cluster *string, taskarn *string) (bool, error) {
 	return true, nil
 }
 
+// ExecuteCommand starts an interactive ECS Exec session running command in the container of the task
+func (c *Ecsclient) ExecuteCommand(cluster *string, taskarn *string, container *string, command *string) (*ecs.Session, error) {
+	output, err := c.svc.ExecuteCommand(&ecs.ExecuteCommandInput{
+		Cluster:     aws.String(*cluster),
+		Task:        aws.String(*taskarn),
+		Container:   aws.String(*container),
+		Command:     aws.String(*command),
+		Interactive: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if output.Session == nil || output.Session.StreamUrl == nil || output.Session.TokenValue == nil {
+		return nil, fmt.Errorf("no session returned for task %s", *taskarn)
+	}
+	return output.Session, nil
+}
+
 // GetClusterNames returns a list of names of available clusters
 func (c *Ecsclient) GetClusterNames() ([]string, error) {
 	retCluster := make([]string, 0)
 
-	listclustersOutput, err := c.svc.ListClusters(&ecs.ListClustersInput{})
-
+	err := c.svc.ListClustersPages(&ecs.ListClustersInput{}, func(page *ecs.ListClustersOutput, lastPage bool) bool {
+		for _, arn := range page.ClusterArns {
+			tmp := strings.Split(*arn, "/")
+			retCluster = append(retCluster, tmp[len(tmp)-1])
+		}
+		return !lastPage
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if listclustersOutput.NextToken != nil {
-		return nil, errors.New("pagination not implemented")
-	}
-
-	for _, arn := range listclustersOutput.ClusterArns {
-		tmp := strings.Split(*arn, "/")
-		retCluster = append(retCluster, tmp[len(tmp)-1])
-	}
-
 	return retCluster, nil
 }
 
-// Input for RegisterTaskDefinition
+// Input for RegisterTaskDefinition. Cpu, Softmem, Hardmem, Secrets and a new Image or
+// Tag alone are applied to Container only if it is set, otherwise to all containers.
+// Secrets maps variable names to the parameters they are read from, see SecretValueFrom,
+// SecretUnsets are secrets to remove from the same containers.
 type RegisterTaskDefinitionInput struct {
 	Image                *string
 	Tag                  *string
 	ContainerInstanceArn *string
+	Container            *string
 	Cpu                  *int64
 	Hostport0            *int64
 	Softmem              *int64
@@ -183,131 +428,252 @@ type RegisterTaskDefinitionInput struct {
 	TargetGroup          *string
 	Changes              *map[string]string
 	Unsets               *map[string]struct{}
+	Secrets              *map[string]string
+	SecretUnsets         *map[string]struct{}
 }
 
-// RegisterTaskDefinition updates the existing task definition's image.
+// RegisterTaskDefinition registers a new revision of the task definition, which may be
+// a family or an arn, with the changes of rdi applied.
 func (c *Ecsclient) RegisterTaskDefinition(task *string, rdi *RegisterTaskDefinitionInput) (string, error) {
-
-	defs, err := c.GetContainerDefinitions(task)
+	_, proposed, err := c.ProposeTaskDefinition(task, rdi)
 	if err != nil {
 		return "", err
 	}
+	return c.RegisterTaskDefinitionRevision(proposed)
+}
 
-	for i, d := range defs {
-
-		if rdi.Cpu != nil {
-			d.Cpu = rdi.Cpu
-		}
-
-		if rdi.Tag != nil && rdi.Image != nil && strings.HasPrefix(*d.Image, *rdi.Image) {
-			i := fmt.Sprintf("%s:%s", *rdi.Image, *rdi.Tag)
-			d.Image = &i
-		}
-
-		if rdi.Cpu != nil {
-			d.Cpu = rdi.Cpu
-		}
+// ProposeTaskDefinition returns the current task definition and a copy of it with the
+// changes of rdi applied, without registering anything.
+func (c *Ecsclient) ProposeTaskDefinition(task *string, rdi *RegisterTaskDefinitionInput) (*ecs.TaskDefinition, *ecs.TaskDefinition, error) {
+	current, err := c.GetTaskDefinition(task)
+	if err != nil {
+		return nil, nil, err
+	}
+	td := awsutil.CopyOf(current).(*ecs.TaskDefinition)
 
-		if rdi.Hardmem != nil {
-			d.Memory = rdi.Hardmem
-		}
+	for _, d := range td.ContainerDefinitions {
 
-		if rdi.Softmem != nil {
-			d.MemoryReservation = rdi.Softmem
+		if image := containerImage(d, rdi); image != nil {
+			d.Image = image
 		}
 
-		var hasChanged bool
-		if rdi.Changes != nil {
-
-			envvars := make([]*ecs.KeyValuePair, 0, len(d.Environment))
+		if rdi.Container == nil || *rdi.Container == *d.Name {
+			if rdi.Cpu != nil {
+				d.Cpu = rdi.Cpu
+			}
 
-			currentChanges := make(map[string]string, len(*rdi.Changes))
-			for k, v := range *rdi.Changes {
-				currentChanges[k] = v
+			if rdi.Hardmem != nil {
+				d.Memory = rdi.Hardmem
 			}
 
-			for _, envvar := range d.Environment {
-				newValue, ok := currentChanges[*envvar.Name]
-				if ok {
-					if !strings.EqualFold(*envvar.Value, newValue) {
-						envvar.SetValue(newValue)
-						hasChanged = true
-					}
+			if rdi.Softmem != nil {
+				d.MemoryReservation = rdi.Softmem
+			}
+		}
 
-					delete(currentChanges, *envvar.Name)
-				}
+		if rdi.Changes != nil || rdi.Unsets != nil {
+			d.Environment = applyEnvironment(d.Environment, rdi.Changes, rdi.Unsets)
+			d.Secrets = applySecrets(d.Secrets, nil, rdi.Unsets)
+		}
 
-				if _, ok = (*rdi.Unsets)[*envvar.Name]; ok {
-					hasChanged = true
-					continue
+		if (rdi.Secrets != nil || rdi.SecretUnsets != nil) && (rdi.Container == nil || *rdi.Container == *d.Name) {
+			secrets := make(map[string]string)
+			names := make(map[string]struct{})
+			if rdi.Secrets != nil {
+				for name, valueFrom := range *rdi.Secrets {
+					secrets[name] = SecretValueFrom(aws.StringValue(current.TaskDefinitionArn), valueFrom)
+					names[name] = struct{}{}
 				}
-
-				envvars = append(envvars, envvar)
 			}
+			d.Secrets = applySecrets(d.Secrets, &secrets, rdi.SecretUnsets)
+			// a secret replaces the plain variable of the same name
+			d.Environment = applyEnvironment(d.Environment, nil, &names)
+		}
+	}
 
-			if len(currentChanges) > 0 {
-				// Some fields that didn't exist need to be add
-				hasChanged = true
+	if rdi.TargetGroup != nil && *rdi.TargetGroup != "" {
+		targetGroupChanged := false
+		expression := fmt.Sprintf("attribute:group == %s", *rdi.TargetGroup)
+		for i, constraint := range td.PlacementConstraints {
+			if strings.HasPrefix(aws.StringValue(constraint.Expression), "attribute:group") {
+				td.PlacementConstraints[i].Expression = &expression
+				targetGroupChanged = true
 			}
+		}
 
-			for name, value := range currentChanges {
-				envvars = append(envvars, &ecs.KeyValuePair{
-					Name:  aws.String(name),
-					Value: aws.String(value),
+		if targetGroupChanged == false {
+			td.PlacementConstraints = append(td.PlacementConstraints,
+				&ecs.TaskDefinitionPlacementConstraint{
+					Expression: aws.String(expression),
+					Type:       aws.String("memberOf"),
 				})
-			}
-			defs[i].Environment = envvars
-			fmt.Println(hasChanged)
 		}
 	}
 
-	taskRoleArn, err := c.GetTaskRoleArn(task)
-	//	fmt.Println(taskRoleArn)
-	if err != nil {
-		return "", err
+	return current, td, nil
+}
+
+// containerImage returns the image rdi points the container at, or nil if it stays the
+// same. Image and Tag together retag all containers running Image, Image alone replaces
+// the image and Tag alone the tag of the selected containers.
+func containerImage(d *ecs.ContainerDefinition, rdi *RegisterTaskDefinitionInput) *string {
+	selected := rdi.Container == nil || *rdi.Container == *d.Name
+	switch {
+	case rdi.Image != nil && rdi.Tag != nil:
+		if strings.HasPrefix(aws.StringValue(d.Image), *rdi.Image) {
+			return aws.String(fmt.Sprintf("%s:%s", *rdi.Image, *rdi.Tag))
+		}
+	case rdi.Image != nil && selected:
+		return rdi.Image
+	case rdi.Tag != nil && selected:
+		return aws.String(ReplaceImageTag(aws.StringValue(d.Image), *rdi.Tag))
 	}
+	return nil
+}
 
-	placementConstraints, err := c.GetTaskPlacementConstraints(task)
-	if err != nil {
-		return "", err
+// ReplaceImageTag returns the image with its tag or digest replaced by tag
+func ReplaceImageTag(image, tag string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	} else if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
 	}
+	return image + ":" + tag
+}
 
-	if rdi.TargetGroup != nil {
-		targetGroupChanged := false
-		expression := fmt.Sprintf("attribute:group == %s", *rdi.TargetGroup)
-		for i, constraint := range placementConstraints {
-			if (*constraint.Expression)[0:16] == "attribute:group" {
+// applyEnvironment sets the changed variables, keeping the order of existing ones and
+// adding new ones sorted by name, and removes the unset ones
+func applyEnvironment(environment []*ecs.KeyValuePair, changes *map[string]string, unsets *map[string]struct{}) []*ecs.KeyValuePair {
+	currentChanges := make(map[string]string)
+	if changes != nil {
+		for k, v := range *changes {
+			currentChanges[k] = v
+		}
+	}
+	removes := make(map[string]struct{})
+	if unsets != nil {
+		removes = *unsets
+	}
 
-				placementConstraints[i].Expression = &expression
-				targetGroupChanged = true
+	envvars := make([]*ecs.KeyValuePair, 0, len(environment)+len(currentChanges))
+	for _, envvar := range environment {
+		if newValue, ok := currentChanges[*envvar.Name]; ok {
+			if !strings.EqualFold(aws.StringValue(envvar.Value), newValue) {
+				envvar.SetValue(newValue)
 			}
+			delete(currentChanges, *envvar.Name)
 		}
 
-		if targetGroupChanged == false {
-			placementConstraints = append(placementConstraints,
-				&ecs.TaskDefinitionPlacementConstraint{
-					Expression: aws.String(expression),
-					Type:       aws.String("memberOf"),
-				})
+		if _, ok := removes[*envvar.Name]; ok {
+			continue
 		}
+
+		envvars = append(envvars, envvar)
 	}
 
-	volumes, err := c.GetTaskVolumes(task)
-	if err != nil {
-		return "", err
+	names := make([]string, 0, len(currentChanges))
+	for name := range currentChanges {
+		names = append(names, name)
 	}
-	networkMode, err := c.GetContainerNetworkMode(task)
-	if err != nil {
-		return "", err
+	sort.Strings(names)
+	for _, name := range names {
+		envvars = append(envvars, &ecs.KeyValuePair{
+			Name:  aws.String(name),
+			Value: aws.String(currentChanges[name]),
+		})
 	}
+	return envvars
+}
+
+// applySecrets points the changed secrets at their new parameters, keeping the order of
+// existing ones and adding new ones sorted by name, and removes the unset ones
+func applySecrets(secrets []*ecs.Secret, changes *map[string]string, unsets *map[string]struct{}) []*ecs.Secret {
+	currentChanges := make(map[string]string)
+	if changes != nil {
+		for k, v := range *changes {
+			currentChanges[k] = v
+		}
+	}
+	removes := make(map[string]struct{})
+	if unsets != nil {
+		removes = *unsets
+	}
+
+	updated := make([]*ecs.Secret, 0, len(secrets)+len(currentChanges))
+	for _, secret := range secrets {
+		if valueFrom, ok := currentChanges[*secret.Name]; ok {
+			secret.SetValueFrom(valueFrom)
+			delete(currentChanges, *secret.Name)
+		}
+		if _, ok := removes[*secret.Name]; ok {
+			continue
+		}
+		updated = append(updated, secret)
+	}
+
+	names := make([]string, 0, len(currentChanges))
+	for name := range currentChanges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		updated = append(updated, &ecs.Secret{
+			Name:      aws.String(name),
+			ValueFrom: aws.String(currentChanges[name]),
+		})
+	}
+	if len(updated) == 0 {
+		return nil
+	}
+	return updated
+}
+
+// SecretValueFrom returns the ARN of the SSM parameter of a secret given as its path, like
+// /application/api/DATABASE_URL, in the partition, region and account of the task
+// definition. ARNs and names of parameters the ARN can not be told for are kept.
+func SecretValueFrom(taskDefinitionArn, valueFrom string) string {
+	if !strings.HasPrefix(valueFrom, "/") {
+		return valueFrom
+	}
+	parts := strings.SplitN(taskDefinitionArn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return valueFrom
+	}
+	return fmt.Sprintf("arn:%s:ssm:%s:%s:parameter%s", parts[1], parts[3], parts[4], valueFrom)
+}
 
+// RegisterTaskDefinitionRevision registers the task definition as the next revision of its
+// family. The tags of the revision it was described from are kept.
+func (c *Ecsclient) RegisterTaskDefinitionRevision(td *ecs.TaskDefinition) (string, error) {
 	input := &ecs.RegisterTaskDefinitionInput{
-		Family:               task,
-		ContainerDefinitions: defs,
-		TaskRoleArn:          taskRoleArn,
-		PlacementConstraints: placementConstraints,
-		Volumes:              volumes,
-		NetworkMode:          networkMode,
+		Family:                  td.Family,
+		ContainerDefinitions:    td.ContainerDefinitions,
+		TaskRoleArn:             td.TaskRoleArn,
+		ExecutionRoleArn:        td.ExecutionRoleArn,
+		PlacementConstraints:    td.PlacementConstraints,
+		Volumes:                 td.Volumes,
+		NetworkMode:             td.NetworkMode,
+		RequiresCompatibilities: td.RequiresCompatibilities,
+		Cpu:                     td.Cpu,
+		Memory:                  td.Memory,
+		ProxyConfiguration:      td.ProxyConfiguration,
+		EphemeralStorage:        td.EphemeralStorage,
+		RuntimePlatform:         td.RuntimePlatform,
+		PidMode:                 td.PidMode,
+		IpcMode:                 td.IpcMode,
+		InferenceAccelerators:   td.InferenceAccelerators,
+	}
+	if td.TaskDefinitionArn != nil {
+		described, err := c.svc.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: td.TaskDefinitionArn,
+			Include:        aws.StringSlice([]string{ecs.TaskDefinitionFieldTags}),
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(described.Tags) > 0 {
+			input.Tags = described.Tags
+		}
 	}
 
 	resp, err := c.svc.RegisterTaskDefinition(input)
@@ -319,27 +685,18 @@ func (c *Ecsclient) RegisterTaskDefinition(task *string, rdi *RegisterTaskDefini
 	return *resp.TaskDefinition.TaskDefinitionArn, nil
 }
 
-// Wait waits for the service to finish being updated.
-func (c *Ecsclient) Wait(cluster, service, arn *string) error {
-	t := time.NewTicker(c.pollInterval)
-	start := time.Now()
-	for {
-		select {
-		case <-t.C:
-			s, err := c.GetDeployment(cluster, service, arn)
-			if err != nil {
-				return err
-			}
-			c.logger.Printf("[info] --> desired: %d, pending: %d, running: %dm, elapsed secs: %s", *s.DesiredCount, *s.PendingCount, *s.RunningCount, time.Since(start))
-			if *s.RunningCount == *s.DesiredCount {
-				return nil
-			}
-			if time.Now().Unix() > start.Add(time.Second*time.Duration(c.timeout)).Unix() {
-				c.logger.Printf("[info] --> desired:%d - %d", time.Now().Unix(), start.Add(time.Second*time.Duration(c.timeout)).Unix())
-				return errors.New("waiting timed out")
-			}
-		}
-	}
+// maxStoppedTasks is the number of stopped tasks after which Wait gives up on a deployment
+const maxStoppedTasks = 3
+
+// DeploymentError is returned by Wait if a deployment does not become stable: it timed
+// out, its tasks keep stopping or fail their health checks
+type DeploymentError struct {
+	TaskDefinition string
+	Reason         string
+}
+
+func (e *DeploymentError) Error() string {
+	return e.Reason
 }
 
 // GetDeployment gets the deployment for the arn.
@@ -366,8 +723,51 @@ func (c *Ecsclient) GetDeployment(cluster, service, arn *string) (*ecs.Deploymen
 // GetContainerDefinitions get container definitions of the service.
 func (c *Ecsclient) GetContainerImage(cluster *string, service *string) *string {
 	tcs, _ := c.GetContainerInstances(cluster, service)
-	a, _ := c.GetContainerDefinitions(tcs[0].TaskDefinitionArn)
-	return a[0].Image
+	if len(tcs) == 0 || len(tcs[0].Containers) == 0 {
+		return nil
+	}
+	return tcs[0].Containers[0].Image
+}
+
+// GetTaskDefinition describes a task definition by family, family:revision or arn.
+func (c *Ecsclient) GetTaskDefinition(task *string) (*ecs.TaskDefinition, error) {
+	output, err := c.svc.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: task,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.TaskDefinition, nil
+}
+
+// ListTaskDefinitionRevisions returns the arns of the active revisions of the family,
+// oldest first
+func (c *Ecsclient) ListTaskDefinitionRevisions(family *string) ([]string, error) {
+	input := &ecs.ListTaskDefinitionsInput{
+		FamilyPrefix: family,
+		Status:       aws.String(ecs.TaskDefinitionStatusActive),
+		Sort:         aws.String(ecs.SortOrderAsc),
+	}
+
+	arns := make([]string, 0)
+	err := c.svc.ListTaskDefinitionsPages(input, func(page *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
+		for _, arn := range page.TaskDefinitionArns {
+			// the prefix also matches other families like family-worker
+			if TaskDefinitionFamily(*arn) == *family {
+				arns = append(arns, *arn)
+			}
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	return arns, nil
+}
+
+// TaskDefinitionFamily returns the family of a task definition arn or family:revision
+func TaskDefinitionFamily(arn string) string {
+	return strings.SplitN(path.Base(arn), ":", 2)[0]
 }
 
 // GetContainerDefinitions get container definitions of the service.
@@ -527,152 +927,341 @@ func (c *Ecsclient) GetClusterTasks(cluster *string) ([]*ecs.Task, error) {
 	input := &ecs.ListTasksInput{}
 	input.SetCluster(*cluster)
 
-	result, err := c.svc.ListTasks(input)
+	taskArns, err := c.listTasks(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.describeTasks(cluster, taskArns)
+}
+
+// listTasks returns the arns of all tasks matching the input, following NextToken
+func (c *Ecsclient) listTasks(input *ecs.ListTasksInput) ([]*string, error) {
+	taskArns := make([]*string, 0)
+	err := c.svc.ListTasksPages(input, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		taskArns = append(taskArns, page.TaskArns...)
+		return !lastPage
+	})
 	if err != nil {
 		return nil, err
 	}
-	if result.NextToken != nil {
-		fmt.Println("Pagination not implemented")
-		os.Exit(1)
+	return taskArns, nil
+}
+
+// describeTasks describes the tasks in batches of maxDescribeBatch. Tasks which are gone
+// since they were listed, like stopped tasks ECS forgot, are left out.
+func (c *Ecsclient) describeTasks(cluster *string, taskArns []*string) ([]*ecs.Task, error) {
+	tasks := make([]*ecs.Task, 0, len(taskArns))
+	for _, batch := range batches(taskArns) {
+		input := &ecs.DescribeTasksInput{}
+		input.SetCluster(*cluster)
+		input.SetTasks(batch)
+
+		result, err := c.svc.DescribeTasks(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range result.Failures {
+			if aws.StringValue(f.Reason) != failureMissing {
+				return nil, fmt.Errorf("could not describe task %s: %s", aws.StringValue(f.Arn), aws.StringValue(f.Reason))
+			}
+		}
+		tasks = append(tasks, result.Tasks...)
 	}
-	input2 := &ecs.DescribeTasksInput{}
-	input2.SetCluster(*cluster)
-	input2.SetTasks(result.TaskArns)
-	result2, err := c.svc.DescribeTasks(input2)
+	return tasks, nil
+}
+
+// describeContainerInstances describes the container instances in batches of maxDescribeBatch
+func (c *Ecsclient) describeContainerInstances(cluster *string, containerInstanceArns []*string) ([]*ecs.ContainerInstance, error) {
+	containerInstances := make([]*ecs.ContainerInstance, 0, len(containerInstanceArns))
+	for _, batch := range batches(containerInstanceArns) {
+		input := &ecs.DescribeContainerInstancesInput{}
+		input.SetCluster(*cluster)
+		input.SetContainerInstances(batch)
 
-	return result2.Tasks, nil
+		result, err := c.svc.DescribeContainerInstances(input)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Failures) > 0 {
+			return nil, fmt.Errorf("could not describe container instance %s: %s", aws.StringValue(result.Failures[0].Arn), aws.StringValue(result.Failures[0].Reason))
+		}
+		containerInstances = append(containerInstances, result.ContainerInstances...)
+	}
+	return containerInstances, nil
+}
+
+// describeEc2Instances returns the EC2 instances with the given ids, following NextToken
+func (c *Ecsclient) describeEc2Instances(instanceIds []*string) ([]*ec2.Instance, error) {
+	instances := make([]*ec2.Instance, 0, len(instanceIds))
+	if len(instanceIds) == 0 {
+		return instances, nil
+	}
+	input := &ec2.DescribeInstancesInput{}
+	input.SetInstanceIds(instanceIds)
+	err := c.ec2svc.DescribeInstancesPages(input, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, r := range page.Reservations {
+			instances = append(instances, r.Instances...)
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
 }
 
-// GetContainerInstances returns the container instances of a cluster
+// batches splits arns into chunks the Describe calls accept
+func batches(arns []*string) [][]*string {
+	out := make([][]*string, 0, len(arns)/maxDescribeBatch+1)
+	for len(arns) > maxDescribeBatch {
+		out = append(out, arns[:maxDescribeBatch])
+		arns = arns[maxDescribeBatch:]
+	}
+	if len(arns) > 0 {
+		out = append(out, arns)
+	}
+	return out
+}
+
+// uniqueStrings removes duplicate and nil entries, keeping the order
+func uniqueStrings(list []*string) []*string {
+	seen := make(map[string]struct{}, len(list))
+	out := make([]*string, 0, len(list))
+	for _, s := range list {
+		if s == nil {
+			continue
+		}
+		if _, ok := seen[*s]; ok {
+			continue
+		}
+		seen[*s] = struct{}{}
+		out = append(out, s)
+	}
+	return out
+}
+
+// GetContainerInstances returns the running tasks of a service
 func (c *Ecsclient) GetContainerInstances(cluster *string, service *string) ([]*TaskInfo, error) {
+	return c.serviceTasks(cluster, service, true)
+}
+
+// GetServiceTasks returns all tasks of a service which are meant to run, including the
+// ones which are still PROVISIONING or PENDING
+func (c *Ecsclient) GetServiceTasks(cluster *string, service *string) ([]*TaskInfo, error) {
+	return c.serviceTasks(cluster, service, false)
+}
+
+// serviceTasks returns the tasks of a service whose desired status is RUNNING, only the
+// ones which already run if running is set
+func (c *Ecsclient) serviceTasks(cluster *string, service *string, running bool) ([]*TaskInfo, error) {
 
 	input := &ecs.ListTasksInput{}
 	input.SetCluster(*cluster)
 	input.SetServiceName(*service)
 
-	result, err := c.svc.ListTasks(input)
+	taskArns, err := c.listTasks(input)
 	if err != nil {
 		return nil, err
 	}
 
-	input2 := &ecs.DescribeTasksInput{}
-	input2.SetCluster(*cluster)
-	input2.SetTasks(result.TaskArns)
-
-	result2, err := c.svc.DescribeTasks(input2)
+	tasks, err := c.describeTasks(cluster, taskArns)
 	if err != nil {
 		return nil, err
 	}
 	instances := make([]*string, 0)
 
 	var mytaskinstances []*TaskInfo
+	definitions := make(map[string][]*ecs.ContainerDefinition)
 
-	for _, t := range result2.Tasks {
-		fmt.Println(t.TaskDefinitionArn)
-		//for a, b := range result2.Tasks {
-		var awsloggroup *string
-
-		defs, err := c.GetContainerDefinitions(t.TaskDefinitionArn)
-		if err != nil {
-			return nil, err
-		}
-		if len(defs) < 1 {
-			return nil, errors.New("no container definitions found in task instance")
+	for _, t := range tasks {
+		if running && aws.StringValue(t.LastStatus) != "RUNNING" {
+			continue
 		}
 
-		//		fmt.Println(defs[0])
-		if defs[0].LogConfiguration != nil {
-			for k, v := range defs[0].LogConfiguration.Options {
-				if k == "awslogs-group" {
-					awsloggroup = v
-				}
+		defs, ok := definitions[*t.TaskDefinitionArn]
+		if !ok {
+			defs, err = c.GetContainerDefinitions(t.TaskDefinitionArn)
+			if err != nil {
+				return nil, err
+			}
+			if len(defs) < 1 {
+				return nil, errors.New("no container definitions found in task instance")
 			}
+			definitions[*t.TaskDefinitionArn] = defs
 		}
-		if *t.LastStatus == "RUNNING" {
-			tc := TaskInfo{TaskDefinitionArn: t.TaskDefinitionArn,
-				Cpu0:                 defs[0].Cpu,
-				Hardmem0:             defs[0].Memory,
-				Softmem0:             defs[0].MemoryReservation,
-				TaskArn:              t.TaskArn,
-				AwsLogGroup:          awsloggroup,
-				ContainerInstanceArn: t.ContainerInstanceArn,
-				ContainerPort0:       t.Containers[0].NetworkBindings[0].ContainerPort,
-				Hostport0:            t.Containers[0].NetworkBindings[0].HostPort,
-				Proto0:               t.Containers[0].NetworkBindings[0].Protocol}
-
-			mytaskinstances = append(mytaskinstances, &tc)
+
+		tc := TaskInfo{TaskDefinitionArn: t.TaskDefinitionArn,
+			TaskArn:              t.TaskArn,
+			ClusterArn:           t.ClusterArn,
+			Group:                t.Group,
+			LaunchType:           t.LaunchType,
+			ContainerInstanceArn: t.ContainerInstanceArn,
+			LastStatus:           t.LastStatus,
+			HealthStatus:         t.HealthStatus,
+			StartedAt:            t.StartedAt}
+		if t.Overrides != nil {
+			tc.TaskRoleArn = t.Overrides.TaskRoleArn
+		}
+		eni := networkInterfaceDetails(t)
+		tc.IpAddress = eni["privateIPv4Address"]
+		tc.NetworkInterfaceId = eni["networkInterfaceId"]
+		tc.SubnetId = eni["subnetId"]
+		tc.Containers = containerInfos(defs, t.Containers, tc.NetworkInterfaceId != nil)
+
+		mytaskinstances = append(mytaskinstances, &tc)
+		if t.ContainerInstanceArn != nil {
 			instances = append(instances, t.ContainerInstanceArn)
 		}
 	}
 
-	instanceInput := &ecs.DescribeContainerInstancesInput{}
-	instanceInput.SetCluster(*cluster)
-	instanceInput.SetContainerInstances(instances)
-	result3, err := c.svc.DescribeContainerInstances(instanceInput)
+	containerInstances, err := c.describeContainerInstances(cluster, uniqueStrings(instances))
 	if err != nil {
 		return nil, err
 	}
 
-	ec2svc := ec2.New(c.session, &aws.Config{Credentials: c.creds})
-
-	iinput := &ec2.DescribeInstancesInput{}
-	ec2instances := make([]*string, len(result3.ContainerInstances))
+	ec2instances := make([]*string, len(containerInstances))
 
-	for i, ci := range result3.ContainerInstances {
+	for i, ci := range containerInstances {
 		for _, ti := range mytaskinstances {
-			if *ti.ContainerInstanceArn == *ci.ContainerInstanceArn {
+			if ti.ContainerInstanceArn != nil && *ti.ContainerInstanceArn == *ci.ContainerInstanceArn {
 				ti.Ec2InstanceId = ci.Ec2InstanceId
 			}
 		}
 		ec2instances[i] = ci.Ec2InstanceId
 	}
 
-	iinput.SetInstanceIds(ec2instances)
-	result4, err := ec2svc.DescribeInstances(iinput)
-
+	ec2Instances, err := c.describeEc2Instances(uniqueStrings(ec2instances))
 	if err != nil {
 		return nil, err
 	}
 
-	dnsNames := make([]string, len(result4.Reservations))
-	for i, r := range result4.Reservations {
-		dnsNames[i] = *r.Instances[0].PrivateIpAddress
+	for _, inst := range ec2Instances {
 		for _, ti := range mytaskinstances {
-
-			if *ti.Ec2InstanceId == *r.Instances[0].InstanceId {
-				ti.IpAddress = r.Instances[0].PrivateIpAddress
+			if ti.IpAddress == nil && ti.Ec2InstanceId != nil && *ti.Ec2InstanceId == *inst.InstanceId {
+				ti.IpAddress = inst.PrivateIpAddress
 			}
 		}
 	}
 	return mytaskinstances, nil
 }
 
-// Describe container instances
-func (c *Ecsclient) DescribeContainerInstances(cluster *string, instances []*ec2.Instance) ([]*ecs.ContainerInstance, error) {
+// TaskPrivateIPv4Address returns the private IP of the ENI of an awsvpc task, or nil
+func TaskPrivateIPv4Address(t *ecs.Task) *string {
+	return networkInterfaceDetails(t)["privateIPv4Address"]
+}
 
-	ec2instances := make([]*string, 0)
-	for _, inst := range instances {
-		ec2instances = append(ec2instances, inst.InstanceId)
+// networkInterfaceDetails returns the details of the ENI attachment of an awsvpc task
+func networkInterfaceDetails(t *ecs.Task) map[string]*string {
+	details := make(map[string]*string)
+	for _, a := range t.Attachments {
+		if aws.StringValue(a.Type) != "ElasticNetworkInterface" {
+			continue
+		}
+		for _, d := range a.Details {
+			details[aws.StringValue(d.Name)] = d.Value
+		}
 	}
+	return details
+}
 
-	listInput := &ecs.ListContainerInstancesInput{}
-	listInput.SetCluster(*cluster)
-	res, err := c.svc.ListContainerInstances(listInput)
-	if err != nil {
-		return nil, err
+// containerInfos merges the container definitions of a task with the state of its running containers.
+// Containers of awsvpc tasks have no network bindings, their ports are reachable on the task's ENI.
+func containerInfos(defs []*ecs.ContainerDefinition, containers []*ecs.Container, awsvpc bool) []*ContainerInfo {
+	infos := make([]*ContainerInfo, 0, len(defs))
+	for _, def := range defs {
+		ci := &ContainerInfo{
+			Name:      def.Name,
+			Image:     def.Image,
+			Essential: def.Essential,
+			Cpu:       def.Cpu,
+			Softmem:   def.MemoryReservation,
+			Hardmem:   def.Memory,
+		}
+		ci.HealthCheck = def.HealthCheck
+		if def.LogConfiguration != nil {
+			ci.LogDriver = def.LogConfiguration.LogDriver
+			ci.LogOptions = def.LogConfiguration.Options
+			ci.AwsLogGroup = def.LogConfiguration.Options["awslogs-group"]
+			ci.AwsLogPrefix = def.LogConfiguration.Options["awslogs-stream-prefix"]
+		}
+		for _, container := range containers {
+			if aws.StringValue(container.Name) == aws.StringValue(def.Name) {
+				ci.NetworkBindings = container.NetworkBindings
+				ci.LastStatus = container.LastStatus
+				ci.HealthStatus = container.HealthStatus
+			}
+		}
+		if awsvpc && len(ci.NetworkBindings) == 0 {
+			for _, pm := range def.PortMappings {
+				protocol := pm.Protocol
+				if protocol == nil {
+					protocol = aws.String(ecs.TransportProtocolTcp)
+				}
+				ci.NetworkBindings = append(ci.NetworkBindings, &ecs.NetworkBinding{
+					ContainerPort: pm.ContainerPort,
+					HostPort:      pm.ContainerPort,
+					Protocol:      protocol,
+				})
+			}
+		}
+		infos = append(infos, ci)
 	}
+	return infos
+}
 
-	instanceInput := &ecs.DescribeContainerInstancesInput{}
-	instanceInput.SetCluster(*cluster)
-	instanceInput.SetContainerInstances(res.ContainerInstanceArns)
+// IsFargateTaskDefinition reports whether the task definition requires Fargate
+func IsFargateTaskDefinition(td *ecs.TaskDefinition) bool {
+	for _, c := range td.RequiresCompatibilities {
+		if *c == ecs.CompatibilityFargate {
+			return true
+		}
+	}
+	return false
+}
 
-	result3, err := c.svc.DescribeContainerInstances(instanceInput)
+// TaskResources returns the CPU units and MB of memory ECS reserves for a task of the
+// definition, the hard memory limit of a container counting if it has no soft limit
+func TaskResources(td *ecs.TaskDefinition) (int64, int64) {
+	var cpu, memory int64
+	for _, d := range td.ContainerDefinitions {
+		cpu += aws.Int64Value(d.Cpu)
+		if d.MemoryReservation != nil {
+			memory += *d.MemoryReservation
+		} else {
+			memory += aws.Int64Value(d.Memory)
+		}
+	}
+	return cpu, memory
+}
+
+// TaskSize returns the task level CPU units and MB of memory of the definition, 0 if unset
+func TaskSize(td *ecs.TaskDefinition) (int64, int64) {
+	cpu, _ := strconv.ParseInt(aws.StringValue(td.Cpu), 10, 64)
+	memory, _ := strconv.ParseInt(aws.StringValue(td.Memory), 10, 64)
+	return cpu, memory
+}
+
+// ResourceValue returns the integer value of the named resource, e.g. CPU or MEMORY
+func ResourceValue(resources []*ecs.Resource, name string) int64 {
+	for _, r := range resources {
+		if aws.StringValue(r.Name) == name {
+			return aws.Int64Value(r.IntegerValue)
+		}
+	}
+	return 0
+}
+
+// Describe container instances
+func (c *Ecsclient) DescribeContainerInstances(cluster *string, instances []*ec2.Instance) ([]*ecs.ContainerInstance, error) {
+
+	containerInstances, err := c.GetClusterContainerInstances(cluster)
 	if err != nil {
 		return nil, err
 	}
 
 	out := make([]*ecs.ContainerInstance, 0)
-	for _, ci := range result3.ContainerInstances {
+	for _, ci := range containerInstances {
 		for _, inst := range instances {
 			if *ci.Ec2InstanceId == *inst.InstanceId {
 				out = append(out, ci)
@@ -683,6 +1272,22 @@ func (c *Ecsclient) DescribeContainerInstances(cluster *string, instances []*ec2
 	return out, nil
 }
 
+// GetClusterContainerInstances describes all container instances registered in the cluster
+func (c *Ecsclient) GetClusterContainerInstances(cluster *string) ([]*ecs.ContainerInstance, error) {
+	listInput := &ecs.ListContainerInstancesInput{}
+	listInput.SetCluster(*cluster)
+	containerInstanceArns := make([]*string, 0)
+	err := c.svc.ListContainerInstancesPages(listInput, func(page *ecs.ListContainerInstancesOutput, lastPage bool) bool {
+		containerInstanceArns = append(containerInstanceArns, page.ContainerInstanceArns...)
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.describeContainerInstances(cluster, containerInstanceArns)
+}
+
 // check if string exists in slice
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
@@ -0,0 +1,334 @@
+package ecsclient
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/fake"
+)
+
+// newTestClient returns a client on top of a backend with the cluster production, two
+// container instances and the task definition web:1, polling deployments every 10ms
+func newTestClient(t *testing.T) (*fake.Backend, *Ecsclient) {
+	backend := fake.New()
+	backend.AddCluster("production")
+	for i := 0; i < 2; i++ {
+		if _, err := backend.AddContainerInstance("production"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registerWeb(t, backend, "api:1")
+
+	c := NewWithClients(backend.ECS(), backend.EC2())
+	c.SetPollInterval(10 * time.Millisecond)
+	return backend, c
+}
+
+// registerWeb registers a revision of the web family running the image as app
+func registerWeb(t *testing.T, backend *fake.Backend, image string) string {
+	out, err := backend.ECS().RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family: aws.String("web"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{{
+			Name:        aws.String("app"),
+			Image:       aws.String(image),
+			Memory:      aws.Int64(128),
+			Environment: []*ecs.KeyValuePair{{Name: aws.String("LOG_LEVEL"), Value: aws.String("info")}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *out.TaskDefinition.TaskDefinitionArn
+}
+
+func TestListPages(t *testing.T) {
+	backend, c := newTestClient(t)
+	backend.PageSize = 2
+
+	for i := 0; i < 4; i++ {
+		backend.AddCluster(fmt.Sprintf("cluster-%d", i))
+	}
+	services := make([]string, 5)
+	for i := range services {
+		services[i] = fmt.Sprintf("service-%d", i)
+		if _, err := backend.AddService("production", services[i], "web:1", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 2; i <= 5; i++ {
+		registerWeb(t, backend, fmt.Sprintf("api:%d", i))
+	}
+	if _, err := backend.ECS().RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family:               aws.String("web-worker"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{{Name: aws.String("worker"), Image: aws.String("api:1"), Memory: aws.Int64(128)}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := c.GetClusterNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(clusters, ",") != "production,cluster-0,cluster-1,cluster-2,cluster-3" {
+		t.Errorf("expected all 5 clusters, got %v", clusters)
+	}
+
+	names, err := c.ListServices(aws.String("production"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != strings.Join(services, ",") {
+		t.Errorf("expected the services %v, got %v", services, names)
+	}
+
+	revisions, err := c.ListTaskDefinitionRevisions(aws.String("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 5 {
+		t.Fatalf("expected 5 revisions, got %v", revisions)
+	}
+	for i, arn := range revisions {
+		if path.Base(arn) != fmt.Sprintf("web:%d", i+1) {
+			t.Errorf("expected revision %d at %d, got %s", i+1, i, arn)
+		}
+	}
+}
+
+func TestRegisterAndWait(t *testing.T) {
+	backend, c := newTestClient(t)
+	cluster, service := "production", "web"
+	if _, err := backend.AddService(cluster, service, "web:1", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	serviceObj, err := c.FindService(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := map[string]string{"LOG_LEVEL": "debug", "PORT": "8080"}
+	current, proposed, err := c.ProposeTaskDefinition(serviceObj.TaskDefinition, &RegisterTaskDefinitionInput{
+		Tag:     aws.String("v2"),
+		Changes: &changes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(current.ContainerDefinitions[0].Image) != "api:1" {
+		t.Errorf("expected the current task definition to stay unchanged, got %s", aws.StringValue(current.ContainerDefinitions[0].Image))
+	}
+	diff := DiffTaskDefinitions(current, proposed)
+	if len(diff) != 3 {
+		t.Errorf("expected the image and two variables to change, got %d changes", len(diff))
+	}
+
+	arn, err := c.RegisterTaskDefinitionRevision(proposed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Base(arn) != "web:2" {
+		t.Errorf("expected web:2 to be registered, got %s", arn)
+	}
+	if err := c.UpdateServiceWithTaskDefinition(&cluster, &service, nil, &arn); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Wait(&cluster, &service, &arn); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := c.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("expected 2 running tasks, got %d", len(tasks))
+	}
+	for _, task := range tasks {
+		if *task.TaskDefinitionArn != arn || aws.StringValue(task.Containers[0].Image) != "api:v2" || task.Ec2InstanceId == nil {
+			t.Errorf("expected task %s to run api:v2 of %s on an instance, got %s of %s", *task.TaskArn, arn, aws.StringValue(task.Containers[0].Image), *task.TaskDefinitionArn)
+		}
+	}
+}
+
+func TestWaitFailedDeployment(t *testing.T) {
+	backend, c := newTestClient(t)
+	cluster, service := "production", "web"
+	if _, err := backend.AddService(cluster, service, "web:1", 2); err != nil {
+		t.Fatal(err)
+	}
+	arn := registerWeb(t, backend, "api:broken")
+	backend.FailTaskDefinition(arn, "Essential container in task exited")
+
+	if err := c.UpdateServiceWithTaskDefinition(&cluster, &service, nil, &arn); err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan *Event, 100)
+	err := c.WaitWithEvents(&cluster, &service, &arn, events)
+	close(events)
+
+	de, ok := err.(*DeploymentError)
+	if !ok {
+		t.Fatalf("expected a DeploymentError, got %v", err)
+	}
+	if de.TaskDefinition != arn || !strings.Contains(de.Reason, "Essential container in task exited") {
+		t.Errorf("expected %s to fail with the reason of its stopped tasks, got %s: %s", arn, de.TaskDefinition, de.Reason)
+	}
+
+	seen := make(map[EventType]int)
+	for e := range events {
+		seen[e.Type]++
+	}
+	if seen[EventTaskStopped] < maxStoppedTasks || seen[EventDeploymentFailed] != 1 || seen[EventSteadyState] != 0 {
+		t.Errorf("expected %d stopped tasks and the failed deployment, got %v", maxStoppedTasks, seen)
+	}
+}
+
+func TestWaitUnhealthyDeployment(t *testing.T) {
+	backend, c := newTestClient(t)
+	cluster, service := "production", "web"
+	if _, err := backend.AddService(cluster, service, "web:1", 2); err != nil {
+		t.Fatal(err)
+	}
+	arn := registerWeb(t, backend, "api:unhealthy")
+	backend.SetUnhealthy(arn)
+
+	if err := c.UpdateServiceWithTaskDefinition(&cluster, &service, nil, &arn); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := c.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) == 0 {
+		t.Fatal("expected the new tasks to run")
+	}
+	for _, task := range tasks {
+		if aws.StringValue(task.HealthStatus) != ecs.HealthStatusUnhealthy {
+			t.Errorf("expected task %s to be unhealthy, got %s", *task.TaskArn, aws.StringValue(task.HealthStatus))
+		}
+	}
+
+	err = c.Wait(&cluster, &service, &arn)
+	if de, ok := err.(*DeploymentError); !ok || !strings.Contains(de.Reason, "unhealthy") {
+		t.Errorf("expected an unhealthy DeploymentError, got %v", err)
+	}
+}
+
+func TestRegisterTaskDefinitionRevisionRoundTrip(t *testing.T) {
+	backend, c := newTestClient(t)
+	out, err := backend.ECS().RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family:                  aws.String("mesh"),
+		ContainerDefinitions:    []*ecs.ContainerDefinition{{Name: aws.String("app"), Image: aws.String("api:1"), Memory: aws.Int64(128)}},
+		NetworkMode:             aws.String(ecs.NetworkModeAwsvpc),
+		RequiresCompatibilities: aws.StringSlice([]string{ecs.CompatibilityEc2}),
+		Cpu:                     aws.String("256"),
+		Memory:                  aws.String("512"),
+		ProxyConfiguration: &ecs.ProxyConfiguration{
+			Type:          aws.String(ecs.ProxyConfigurationTypeAppmesh),
+			ContainerName: aws.String("envoy"),
+			Properties:    []*ecs.KeyValuePair{{Name: aws.String("AppPorts"), Value: aws.String("8080")}},
+		},
+		EphemeralStorage:      &ecs.EphemeralStorage{SizeInGiB: aws.Int64(30)},
+		RuntimePlatform:       &ecs.RuntimePlatform{CpuArchitecture: aws.String(ecs.CPUArchitectureArm64)},
+		PidMode:               aws.String(ecs.PidModeTask),
+		IpcMode:               aws.String(ecs.IpcModeTask),
+		InferenceAccelerators: []*ecs.InferenceAccelerator{{DeviceName: aws.String("device1"), DeviceType: aws.String("eia2.medium")}},
+		Tags:                  []*ecs.Tag{{Key: aws.String("team"), Value: aws.String("platform")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, proposed, err := c.ProposeTaskDefinition(out.TaskDefinition.TaskDefinitionArn, &RegisterTaskDefinitionInput{Tag: aws.String("2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	arn, err := c.RegisterTaskDefinitionRevision(proposed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	described, err := backend.ECS().DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: &arn,
+		Include:        aws.StringSlice([]string{ecs.TaskDefinitionFieldTags}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered := described.TaskDefinition
+	if path.Base(arn) != "mesh:2" || aws.StringValue(registered.ContainerDefinitions[0].Image) != "api:2" {
+		t.Fatalf("expected mesh:2 to run api:2, got %s running %s", arn, aws.StringValue(registered.ContainerDefinitions[0].Image))
+	}
+	for name, pair := range map[string][2]interface{}{
+		"ProxyConfiguration":    {current.ProxyConfiguration, registered.ProxyConfiguration},
+		"EphemeralStorage":      {current.EphemeralStorage, registered.EphemeralStorage},
+		"RuntimePlatform":       {current.RuntimePlatform, registered.RuntimePlatform},
+		"PidMode":               {current.PidMode, registered.PidMode},
+		"IpcMode":               {current.IpcMode, registered.IpcMode},
+		"InferenceAccelerators": {current.InferenceAccelerators, registered.InferenceAccelerators},
+		"Cpu":                   {current.Cpu, registered.Cpu},
+		"Memory":                {current.Memory, registered.Memory},
+		"NetworkMode":           {current.NetworkMode, registered.NetworkMode},
+	} {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			t.Errorf("expected %s to be kept, got %v instead of %v", name, pair[1], pair[0])
+		}
+	}
+	if len(described.Tags) != 1 || aws.StringValue(described.Tags[0].Key) != "team" || aws.StringValue(described.Tags[0].Value) != "platform" {
+		t.Errorf("expected the tag team=platform to be kept, got %v", described.Tags)
+	}
+}
+
+// expiringECS lists a task which is gone by the time it is described, and fails to
+// describe tasks for reason if it is set
+type expiringECS struct {
+	*fake.ECS
+	gone   string
+	reason string
+}
+
+func (e *expiringECS) ListTasksPages(input *ecs.ListTasksInput, fn func(*ecs.ListTasksOutput, bool) bool) error {
+	return e.ECS.ListTasksPages(input, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		if lastPage {
+			page.TaskArns = append(page.TaskArns, aws.String(e.gone))
+		}
+		return fn(page, lastPage)
+	})
+}
+
+func (e *expiringECS) DescribeTasks(input *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error) {
+	out, err := e.ECS.DescribeTasks(input)
+	if err == nil && e.reason != "" {
+		out.Failures = append(out.Failures, &ecs.Failure{Arn: input.Tasks[0], Reason: aws.String(e.reason)})
+	}
+	return out, err
+}
+
+func TestServiceTasksMissing(t *testing.T) {
+	backend, _ := newTestClient(t)
+	cluster, service := "production", "web"
+	if _, err := backend.AddService(cluster, service, "web:1", 2); err != nil {
+		t.Fatal(err)
+	}
+	svc := &expiringECS{ECS: backend.ECS(), gone: "arn:aws:ecs:eu-central-1:123456789012:task/gone"}
+	c := NewWithClients(svc, backend.EC2())
+
+	tasks, err := c.GetServiceTasks(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 {
+		t.Errorf("expected the 2 tasks which still exist, got %d", len(tasks))
+	}
+
+	svc.reason = "ACCESS_DENIED"
+	if _, err := c.GetServiceTasks(&cluster, &service); err == nil || !strings.Contains(err.Error(), "ACCESS_DENIED") {
+		t.Errorf("expected other failures to fail the call, got %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package ecsclient
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// EventType tells what happened during a deployment
+type EventType string
+
+// Events sent by WaitWithEvents
+const (
+	EventDeploymentStarted EventType = "deployment_started"
+	EventTaskPlaced        EventType = "task_placed"
+	EventTaskStopped       EventType = "task_stopped"
+	EventServiceMessage    EventType = "service_event"
+	EventProgress          EventType = "progress"
+	EventSteadyState       EventType = "steady_state"
+	EventTimeout           EventType = "timeout"
+	EventDeploymentFailed  EventType = "deployment_failed"
+)
+
+// Events of a rotating restart
+const (
+	EventTargetDeregistered EventType = "target_deregistered"
+	EventTargetDrained      EventType = "target_drained"
+	EventTaskHealthy        EventType = "task_healthy"
+)
+
+// Event is one step of a deployment. Desired, Pending and Running are the counts of
+// the deployment when the event was seen. Task is set for task events, Target and
+// TargetGroup for target events, Reason for stopped tasks and failures and Message for
+// service events.
+type Event struct {
+	Type           EventType `json:"type"`
+	Time           time.Time `json:"time"`
+	Cluster        string    `json:"cluster"`
+	Service        string    `json:"service"`
+	TaskDefinition string    `json:"task_definition,omitempty"`
+	Deployment     string    `json:"deployment,omitempty"`
+	Task           string    `json:"task,omitempty"`
+	Target         string    `json:"target,omitempty"`
+	TargetGroup    string    `json:"target_group,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	Message        string    `json:"message,omitempty"`
+	Desired        int64     `json:"desired"`
+	Pending        int64     `json:"pending"`
+	Running        int64     `json:"running"`
+}
+
+// String describes the event in one line
+func (e *Event) String() string {
+	revision := path.Base(e.TaskDefinition)
+	switch e.Type {
+	case EventDeploymentStarted:
+		return fmt.Sprintf("deployment %s of %s started", e.Deployment, revision)
+	case EventTaskPlaced:
+		return fmt.Sprintf("task %s of %s placed", path.Base(e.Task), revision)
+	case EventTaskStopped:
+		if e.Message != "" {
+			return fmt.Sprintf("task %s stopped: %s (%s)", path.Base(e.Task), e.Reason, e.Message)
+		}
+		return fmt.Sprintf("task %s stopped: %s", path.Base(e.Task), e.Reason)
+	case EventServiceMessage:
+		return e.Message
+	case EventProgress:
+		return fmt.Sprintf("desired: %d, pending: %d, running: %d", e.Desired, e.Pending, e.Running)
+	case EventSteadyState:
+		if e.TaskDefinition == "" {
+			return fmt.Sprintf("%s reached a steady state", e.Service)
+		}
+		return fmt.Sprintf("%s reached a steady state with %s", e.Service, revision)
+	case EventTimeout:
+		if e.TaskDefinition == "" {
+			return fmt.Sprintf("%s did not become stable: %s", e.Service, e.Reason)
+		}
+		return fmt.Sprintf("%s did not become stable with %s: %s", e.Service, revision, e.Reason)
+	case EventTargetDeregistered:
+		return fmt.Sprintf("draining %s of task %s from %s", e.Target, path.Base(e.Task), path.Base(path.Dir(e.TargetGroup)))
+	case EventTargetDrained:
+		return fmt.Sprintf("%s of task %s drained from %s", e.Target, path.Base(e.Task), path.Base(path.Dir(e.TargetGroup)))
+	case EventTaskHealthy:
+		return fmt.Sprintf("task %s is healthy", path.Base(e.Task))
+	case EventDeploymentFailed:
+		return fmt.Sprintf("deployment of %s failed: %s", revision, e.Reason)
+	}
+	return fmt.Sprintf("%s %s", e.Type, e.Message)
+}
+
+// Wait waits for the service to finish being updated, logging its progress. It fails with
+// a DeploymentError once it times out, maxStoppedTasks tasks of the deployment stopped, a
+// task is unhealthy or ECS marked the rollout as failed.
+func (c *Ecsclient) Wait(cluster, service, arn *string) error {
+	events := make(chan *Event)
+	done := make(chan struct{})
+	go func() {
+		for e := range events {
+			c.logger.Printf("[info] --> %s", e)
+		}
+		close(done)
+	}()
+
+	err := c.WaitWithEvents(cluster, service, arn, events)
+	close(events)
+	<-done
+	return err
+}
+
+// WaitWithEvents waits like Wait and sends what happens to the deployment on events: its
+// tasks being placed, stopped tasks of the service with their reasons, the service's
+// event messages, changed counts and how it ended. events is not closed.
+func (c *Ecsclient) WaitWithEvents(cluster, service, arn *string, events chan<- *Event) error {
+	w := &deploymentWatch{
+		client:  c,
+		cluster: cluster,
+		service: service,
+		arn:     arn,
+		events:  events,
+		placed:  make(map[string]bool),
+		stopped: make(map[string]bool),
+		seen:    make(map[string]bool),
+	}
+
+	t := time.NewTicker(c.pollInterval)
+	defer t.Stop()
+	start := time.Now()
+	for range t.C {
+		done, err := w.poll()
+		if err != nil {
+			if de, ok := err.(*DeploymentError); ok {
+				w.send(&Event{Type: EventDeploymentFailed, Reason: de.Reason})
+			}
+			return err
+		}
+		if done {
+			w.send(&Event{Type: EventSteadyState})
+			return nil
+		}
+		if time.Since(start) > time.Second*time.Duration(c.timeout) {
+			reason := fmt.Sprintf("waiting timed out after %ds", c.timeout)
+			w.send(&Event{Type: EventTimeout, Reason: reason})
+			return &DeploymentError{TaskDefinition: *arn, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// deploymentWatch remembers what has been reported about a deployment
+type deploymentWatch struct {
+	client                *Ecsclient
+	cluster, service, arn *string
+	events                chan<- *Event
+
+	deployment *ecs.Deployment
+	counts     string
+	placed     map[string]bool
+	stopped    map[string]bool
+	seen       map[string]bool
+}
+
+// send fills in the service, task definition and counts, and the time if the event has none
+func (w *deploymentWatch) send(e *Event) {
+	if w.events == nil {
+		return
+	}
+	e.Cluster = *w.cluster
+	e.Service = *w.service
+	e.TaskDefinition = *w.arn
+	if w.deployment != nil {
+		e.Deployment = aws.StringValue(w.deployment.Id)
+		e.Desired = aws.Int64Value(w.deployment.DesiredCount)
+		e.Pending = aws.Int64Value(w.deployment.PendingCount)
+		e.Running = aws.Int64Value(w.deployment.RunningCount)
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	w.events <- e
+}
+
+// poll looks at the service once, reporting whether the deployment is stable
+func (w *deploymentWatch) poll() (bool, error) {
+	s, err := w.client.FindService(w.cluster, w.service)
+	if err != nil {
+		return false, err
+	}
+
+	var d *ecs.Deployment
+	for _, sd := range s.Deployments {
+		if *sd.TaskDefinition == *w.arn {
+			d = sd
+		}
+	}
+	if d == nil {
+		return false, &DeploymentError{TaskDefinition: *w.arn, Reason: fmt.Sprintf("the deployment of %s was replaced", path.Base(*w.arn))}
+	}
+	if w.deployment == nil {
+		w.deployment = d
+		w.send(&Event{Type: EventDeploymentStarted, Time: aws.TimeValue(d.CreatedAt)})
+	}
+	w.deployment = d
+
+	// the newest service event comes first
+	for i := len(s.Events) - 1; i >= 0; i-- {
+		se := s.Events[i]
+		if w.seen[*se.Id] || aws.TimeValue(se.CreatedAt).Before(aws.TimeValue(d.CreatedAt)) {
+			continue
+		}
+		w.seen[*se.Id] = true
+		w.send(&Event{Type: EventServiceMessage, Time: aws.TimeValue(se.CreatedAt), Message: aws.StringValue(se.Message)})
+	}
+
+	if err := w.checkTasks(); err != nil {
+		return false, err
+	}
+
+	counts := fmt.Sprintf("%d/%d/%d", *d.DesiredCount, *d.PendingCount, *d.RunningCount)
+	if counts != w.counts {
+		w.counts = counts
+		w.send(&Event{Type: EventProgress})
+	}
+
+	if aws.StringValue(d.RolloutState) == ecs.DeploymentRolloutStateFailed {
+		return false, &DeploymentError{TaskDefinition: *w.arn, Reason: fmt.Sprintf("rollout failed: %s", aws.StringValue(d.RolloutStateReason))}
+	}
+	return *d.RunningCount == *d.DesiredCount, nil
+}
+
+// checkTasks reports the tasks of the service placed by the deployment or stopped since
+// it started. It returns a DeploymentError if too many tasks of the deployment stopped
+// or one of its running tasks is unhealthy.
+func (w *deploymentWatch) checkTasks() error {
+	d := w.deployment
+	for _, status := range []string{ecs.DesiredStatusStopped, ecs.DesiredStatusRunning} {
+		// ListTasks does not allow filtering by startedBy and service at once
+		taskArns, err := w.client.listTasks(&ecs.ListTasksInput{
+			Cluster:       w.cluster,
+			ServiceName:   w.service,
+			DesiredStatus: aws.String(status),
+		})
+		if err != nil {
+			return err
+		}
+		tasks, err := w.client.describeTasks(w.cluster, taskArns)
+		if err != nil {
+			return err
+		}
+
+		stopped := make([]*ecs.Task, 0)
+		for _, t := range tasks {
+			ours := aws.StringValue(t.StartedBy) == *d.Id && *t.TaskDefinitionArn == *d.TaskDefinition
+			if ours && !w.placed[*t.TaskArn] {
+				w.placed[*t.TaskArn] = true
+				w.send(&Event{Type: EventTaskPlaced, Time: aws.TimeValue(t.CreatedAt), Task: *t.TaskArn})
+			}
+			if aws.StringValue(t.LastStatus) == ecs.DesiredStatusStopped && !w.stopped[*t.TaskArn] && !aws.TimeValue(t.StoppedAt).Before(aws.TimeValue(d.CreatedAt)) {
+				w.stopped[*t.TaskArn] = true
+				w.send(&Event{Type: EventTaskStopped, Time: aws.TimeValue(t.StoppedAt), Task: *t.TaskArn, Reason: aws.StringValue(t.StoppedReason), Message: containerExits(t)})
+			}
+			if !ours {
+				continue
+			}
+			if aws.StringValue(t.HealthStatus) == ecs.HealthStatusUnhealthy {
+				return &DeploymentError{TaskDefinition: *d.TaskDefinition, Reason: fmt.Sprintf("task %s is unhealthy", path.Base(*t.TaskArn))}
+			}
+			if status == ecs.DesiredStatusStopped {
+				stopped = append(stopped, t)
+			}
+		}
+		if len(stopped) >= maxStoppedTasks {
+			return &DeploymentError{TaskDefinition: *d.TaskDefinition, Reason: fmt.Sprintf("%d tasks stopped, last reason: %s", len(stopped), aws.StringValue(stopped[len(stopped)-1].StoppedReason))}
+		}
+	}
+	return nil
+}
+
+// containerExits describes the exit codes and reasons of the stopped task's containers
+func containerExits(t *ecs.Task) string {
+	exits := make([]string, 0, len(t.Containers))
+	for _, c := range t.Containers {
+		if c.ExitCode == nil && c.Reason == nil {
+			continue
+		}
+		exit := aws.StringValue(c.Name)
+		if c.ExitCode != nil {
+			exit = fmt.Sprintf("%s exited with %d", exit, *c.ExitCode)
+		}
+		if c.Reason != nil {
+			exit = fmt.Sprintf("%s: %s", exit, *c.Reason)
+		}
+		exits = append(exits, exit)
+	}
+	return strings.Join(exits, ", ")
+}
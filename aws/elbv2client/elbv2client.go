@@ -0,0 +1,114 @@
+package elbv2client
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+// deregistrationDelayAttribute is the target group attribute holding how long
+// deregistered targets are drained
+const deregistrationDelayAttribute = "deregistration_delay.timeout_seconds"
+
+// Client is the ELBv2 behaviour skipper's commands depend on, implemented by Elbv2client
+type Client interface {
+	TargetHealth(targetGroupArn *string, targets []Target) (map[Target]string, error)
+	DeregisterTargets(targetGroupArn *string, targets []Target) error
+	DeregistrationDelay(targetGroupArn *string) (time.Duration, error)
+}
+
+// Elbv2client looks after the targets of application and network load balancers
+type Elbv2client struct {
+	svc elbv2iface.ELBV2API
+}
+
+// Target is an instance id or ip address and the port it is registered with
+type Target struct {
+	ID   string
+	Port int64
+}
+
+func (t Target) String() string {
+	return fmt.Sprintf("%s:%d", t.ID, t.Port)
+}
+
+// New Constructor
+func New() *Elbv2client {
+	return NewWithClient(elbv2.New(session.New()))
+}
+
+// NewWithClient constructs an Elbv2client on top of the given ELBv2 API implementation
+func NewWithClient(svc elbv2iface.ELBV2API) *Elbv2client {
+	return &Elbv2client{
+		svc: svc,
+	}
+}
+
+// TargetHealth returns the state of each target in the target group, like initial,
+// healthy, unhealthy, draining or unused for targets which are not registered
+func (c *Elbv2client) TargetHealth(targetGroupArn *string, targets []Target) (map[Target]string, error) {
+	output, err := c.svc.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: targetGroupArn,
+		Targets:        targetDescriptions(targets),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[Target]string, len(output.TargetHealthDescriptions))
+	for _, d := range output.TargetHealthDescriptions {
+		if d.Target == nil || d.TargetHealth == nil {
+			continue
+		}
+		t := Target{ID: aws.StringValue(d.Target.Id), Port: aws.Int64Value(d.Target.Port)}
+		states[t] = aws.StringValue(d.TargetHealth.State)
+	}
+	return states, nil
+}
+
+// DeregisterTargets starts draining the targets from the target group
+func (c *Elbv2client) DeregisterTargets(targetGroupArn *string, targets []Target) error {
+	_, err := c.svc.DeregisterTargets(&elbv2.DeregisterTargetsInput{
+		TargetGroupArn: targetGroupArn,
+		Targets:        targetDescriptions(targets),
+	})
+	return err
+}
+
+// DeregistrationDelay returns how long the target group drains deregistered targets
+func (c *Elbv2client) DeregistrationDelay(targetGroupArn *string) (time.Duration, error) {
+	output, err := c.svc.DescribeTargetGroupAttributes(&elbv2.DescribeTargetGroupAttributesInput{
+		TargetGroupArn: targetGroupArn,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range output.Attributes {
+		if aws.StringValue(a.Key) != deregistrationDelayAttribute {
+			continue
+		}
+		seconds, err := strconv.Atoi(aws.StringValue(a.Value))
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s of %s: %v", deregistrationDelayAttribute, *targetGroupArn, err)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	// the default of new target groups
+	return 300 * time.Second, nil
+}
+
+func targetDescriptions(targets []Target) []*elbv2.TargetDescription {
+	if len(targets) == 0 {
+		return nil
+	}
+	descriptions := make([]*elbv2.TargetDescription, len(targets))
+	for i, t := range targets {
+		descriptions[i] = &elbv2.TargetDescription{Id: aws.String(t.ID), Port: aws.Int64(t.Port)}
+	}
+	return descriptions
+}
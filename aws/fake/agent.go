@@ -0,0 +1,149 @@
+package fake
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/blinkist/skipper/aws/ssmsession"
+)
+
+// SessionAgent is a websocket stand-in for the SSM agent serving the sessions started
+// with ExecuteCommand. Serve it with httptest.NewServer and set the backend's SessionURL
+// to the server's ws:// url.
+type SessionAgent struct {
+	backend  *Backend
+	upgrader websocket.Upgrader
+
+	// Handler runs the command of a session. stdin receives the client's input,
+	// everything written to stdout is sent as output. It returns the exit code.
+	Handler func(command string, stdin io.Reader, stdout io.Writer) int
+}
+
+type execSession struct {
+	task      string
+	container string
+	command   string
+}
+
+// SessionAgent returns an agent running the commands of the backend's sessions with handler
+func (b *Backend) SessionAgent(handler func(command string, stdin io.Reader, stdout io.Writer) int) *SessionAgent {
+	return &SessionAgent{backend: b, Handler: handler}
+}
+
+// ServeHTTP performs the handshake of the data channel, runs the command and closes
+// the channel once it returns. Commands wrapped by ssmsession.WrapCommand are unwrapped
+// and their exit code printed like the wrapping shell would.
+func (a *SessionAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := a.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	out := &agentStream{conn: conn}
+
+	open := ssmsession.OpenDataChannelInput{}
+	if _, data, err := conn.ReadMessage(); err != nil || json.Unmarshal(data, &open) != nil {
+		return
+	}
+	a.backend.mu.Lock()
+	session, ok := a.backend.sessions[open.TokenValue]
+	delete(a.backend.sessions, open.TokenValue)
+	a.backend.mu.Unlock()
+	if !ok {
+		out.close("Session token is invalid or expired.")
+		return
+	}
+
+	request, _ := json.Marshal(ssmsession.HandshakeRequestPayload{
+		AgentVersion: "3.0.0.0",
+		RequestedClientActions: []ssmsession.RequestedClientAction{{
+			ActionType:       ssmsession.ActionSessionType,
+			ActionParameters: map[string]interface{}{"SessionType": "InteractiveCommands"},
+		}},
+	})
+	if out.send(ssmsession.HandshakeRequest, request) != nil {
+		return
+	}
+
+	handshake := make(chan bool, 1)
+	stdin, input := io.Pipe()
+	go func() {
+		defer input.Close()
+		defer close(handshake)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msg := &ssmsession.AgentMessage{}
+			if msg.UnmarshalBinary(data) != nil || msg.MessageType != ssmsession.InputStreamData {
+				continue
+			}
+			switch msg.PayloadType {
+			case ssmsession.HandshakeResponse:
+				response := ssmsession.HandshakeResponsePayload{}
+				handshake <- json.Unmarshal(msg.Payload, &response) == nil && len(response.Errors) == 0
+			case ssmsession.Output:
+				input.Write(msg.Payload)
+			}
+		}
+	}()
+
+	if ok := <-handshake; !ok {
+		out.close("Handshake failed.")
+		return
+	}
+	complete, _ := json.Marshal(ssmsession.HandshakeCompletePayload{})
+	if out.send(ssmsession.HandshakeComplete, complete) != nil {
+		return
+	}
+
+	command, wrapped := ssmsession.UnwrapCommand(session.command)
+	code := a.Handler(command, stdin, out)
+	if wrapped {
+		io.WriteString(out, ssmsession.ExitCodeLine(code))
+	}
+	out.close("")
+}
+
+// agentStream writes output stream data messages in sequence
+type agentStream struct {
+	conn *websocket.Conn
+	seq  int64
+}
+
+func (s *agentStream) Write(p []byte) (int, error) {
+	payload := make([]byte, len(p))
+	copy(payload, p)
+	if err := s.send(ssmsession.Output, payload); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *agentStream) send(payloadType ssmsession.PayloadType, payload []byte) error {
+	msg := ssmsession.NewAgentMessage(ssmsession.OutputStreamData, s.seq, payloadType, payload)
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	s.seq++
+	return s.conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+func (s *agentStream) close(output string) {
+	payload, _ := json.Marshal(ssmsession.ChannelClosedPayload{
+		MessageType:   ssmsession.ChannelClosed,
+		SchemaVersion: 1,
+		Output:        output,
+	})
+	msg := ssmsession.NewAgentMessage(ssmsession.ChannelClosed, 0, 0, payload)
+	if data, err := msg.MarshalBinary(); err == nil {
+		s.conn.WriteMessage(websocket.BinaryMessage, data)
+	}
+	s.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
@@ -0,0 +1,53 @@
+package fake
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling/applicationautoscalingiface"
+)
+
+// ApplicationAutoScaling implements the scalable target lookups skipper uses on top of
+// the backend. Calling any other operation of applicationautoscalingiface.ApplicationAutoScalingAPI panics.
+type ApplicationAutoScaling struct {
+	applicationautoscalingiface.ApplicationAutoScalingAPI
+	backend *Backend
+}
+
+// DescribeScalableTargets describes the scalable targets of the namespace, filtered by
+// resource ids and dimension if given
+func (a *ApplicationAutoScaling) DescribeScalableTargets(input *applicationautoscaling.DescribeScalableTargetsInput) (*applicationautoscaling.DescribeScalableTargetsOutput, error) {
+	b := a.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := &applicationautoscaling.DescribeScalableTargetsOutput{}
+	for _, t := range b.scalableTargets {
+		if aws.StringValue(t.ServiceNamespace) != aws.StringValue(input.ServiceNamespace) {
+			continue
+		}
+		if input.ScalableDimension != nil && aws.StringValue(t.ScalableDimension) != *input.ScalableDimension {
+			continue
+		}
+		if len(input.ResourceIds) > 0 && !contains(input.ResourceIds, aws.StringValue(t.ResourceId)) {
+			continue
+		}
+		out.ScalableTargets = append(out.ScalableTargets, awsutil.CopyOf(t).(*applicationautoscaling.ScalableTarget))
+	}
+	return out, nil
+}
+
+// AddScalableTarget makes the desired count of the service scalable between min and max
+func (b *Backend) AddScalableTarget(clusterName, service string, min, max int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	resourceID := "service/" + clusterName + "/" + service
+	b.scalableTargets = append(b.scalableTargets, &applicationautoscaling.ScalableTarget{
+		ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+		ResourceId:        aws.String(resourceID),
+		ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+		MinCapacity:       aws.Int64(min),
+		MaxCapacity:       aws.Int64(max),
+	})
+}
@@ -0,0 +1,78 @@
+package fake
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+)
+
+// CloudWatchLogs implements the log event lookups skipper uses on top of the backend.
+// Calling any other operation of cloudwatchlogsiface.CloudWatchLogsAPI panics.
+type CloudWatchLogs struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	backend *Backend
+}
+
+// FilterLogEvents returns the events of the streams of a group in the order they were logged
+func (c *CloudWatchLogs) FilterLogEvents(input *cloudwatchlogs.FilterLogEventsInput) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	b := c.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group := aws.StringValue(input.LogGroupName)
+	events, ok := b.logEvents[group]
+	if !ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException, "The specified log group does not exist.", nil)
+	}
+
+	var matching []*cloudwatchlogs.FilteredLogEvent
+	for _, e := range events {
+		if !strings.HasPrefix(*e.LogStreamName, aws.StringValue(input.LogStreamNamePrefix)) {
+			continue
+		}
+		if input.StartTime != nil && *e.Timestamp < *input.StartTime {
+			continue
+		}
+		if input.EndTime != nil && *e.Timestamp > *input.EndTime {
+			continue
+		}
+		matching = append(matching, e)
+	}
+	start, end, next, err := b.page(len(matching), input.NextToken, input.Limit)
+	if err != nil {
+		return nil, err
+	}
+	out := &cloudwatchlogs.FilterLogEventsOutput{NextToken: next}
+	for _, e := range matching[start:end] {
+		copied := *e
+		out.Events = append(out.Events, &copied)
+	}
+	return out, nil
+}
+
+// AddLogEvents appends messages logged now to a stream of a group, the group is created
+// if it does not exist
+func (b *Backend) AddLogEvents(group, stream string, messages ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.logEvents[group]; !ok {
+		b.logEvents[group] = nil
+	}
+	now := aws.TimeUnixMilli(time.Now())
+	for _, message := range messages {
+		b.serial++
+		b.logEvents[group] = append(b.logEvents[group], &cloudwatchlogs.FilteredLogEvent{
+			EventId:       aws.String(fmt.Sprintf("%056d", b.serial)),
+			LogStreamName: aws.String(stream),
+			Timestamp:     aws.Int64(now),
+			IngestionTime: aws.Int64(now),
+			Message:       aws.String(message),
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package fake
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+)
+
+// ECR implements the image lookups skipper uses on top of the backend.
+// Calling any other operation of ecriface.ECRAPI panics.
+type ECR struct {
+	ecriface.ECRAPI
+	backend *Backend
+}
+
+// DescribeImages describes images of a repository by tag or digest
+func (e *ECR) DescribeImages(input *ecr.DescribeImagesInput) (*ecr.DescribeImagesOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	repository := aws.StringValue(input.RepositoryName)
+	images, ok := b.images[repository]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeRepositoryNotFoundException, fmt.Sprintf("The repository with name '%s' does not exist in the registry with id '%s'", repository, b.AccountID), nil)
+	}
+
+	out := &ecr.DescribeImagesOutput{}
+	for _, id := range input.ImageIds {
+		var found *ecr.ImageDetail
+		for _, image := range images {
+			if id.ImageDigest != nil && *id.ImageDigest == *image.ImageDigest {
+				found = image
+			}
+			if id.ImageTag != nil && contains(image.ImageTags, *id.ImageTag) {
+				found = image
+			}
+		}
+		if found == nil {
+			return nil, awserr.New(ecr.ErrCodeImageNotFoundException, fmt.Sprintf("The image with imageId {imageDigest:'%s', imageTag:'%s'} does not exist within the repository with name '%s' in the registry with id '%s'", aws.StringValue(id.ImageDigest), aws.StringValue(id.ImageTag), repository, b.AccountID), nil)
+		}
+		out.ImageDetails = append(out.ImageDetails, found)
+	}
+	return out, nil
+}
+
+// AddImage pushes an image with the tags to the repository, creating it if needed, and
+// returns the uri of the repository
+func (b *Backend) AddImage(repository string, tags ...string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.serial++
+	image := &ecr.ImageDetail{
+		RegistryId:     aws.String(b.AccountID),
+		RepositoryName: aws.String(repository),
+		ImageDigest:    aws.String(fmt.Sprintf("sha256:%064x", b.serial)),
+		ImagePushedAt:  &now,
+		ImageTags:      aws.StringSlice(tags),
+	}
+	b.images[repository] = append(b.images[repository], image)
+	return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s", b.AccountID, b.Region, repository)
+}
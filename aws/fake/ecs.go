@@ -0,0 +1,952 @@
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+)
+
+const (
+	maxDescribeTasks              = 100
+	maxDescribeContainerInstances = 100
+	maxDescribeServices           = 10
+	firstDynamicHostPort          = 32768
+)
+
+// ECS implements the ECS operations skipper uses on top of the backend.
+// Calling any other operation of ecsiface.ECSAPI panics.
+type ECS struct {
+	ecsiface.ECSAPI
+	backend *Backend
+}
+
+// ListClusters lists the ARNs of all clusters
+func (e *ECS) ListClusters(input *ecs.ListClustersInput) (*ecs.ListClustersOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	start, end, next, err := b.page(len(b.clusters), input.NextToken, input.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	out := &ecs.ListClustersOutput{NextToken: next}
+	for _, c := range b.clusters[start:end] {
+		out.ClusterArns = append(out.ClusterArns, aws.String(c.arn))
+	}
+	return out, nil
+}
+
+// ListClustersPages iterates over the pages of ListClusters
+func (e *ECS) ListClustersPages(input *ecs.ListClustersInput, fn func(*ecs.ListClustersOutput, bool) bool) error {
+	in := *input
+	for {
+		out, err := e.ListClusters(&in)
+		if err != nil {
+			return err
+		}
+		last := out.NextToken == nil
+		if !fn(out, last) || last {
+			return nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// ListServices lists the ARNs of the services of a cluster
+func (e *ECS) ListServices(input *ecs.ListServicesInput) (*ecs.ListServicesOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	start, end, next, err := b.page(len(c.services), input.NextToken, input.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	out := &ecs.ListServicesOutput{NextToken: next}
+	for _, s := range c.services[start:end] {
+		out.ServiceArns = append(out.ServiceArns, aws.String(*s.ServiceArn))
+	}
+	return out, nil
+}
+
+// ListServicesPages iterates over the pages of ListServices
+func (e *ECS) ListServicesPages(input *ecs.ListServicesInput, fn func(*ecs.ListServicesOutput, bool) bool) error {
+	in := *input
+	for {
+		out, err := e.ListServices(&in)
+		if err != nil {
+			return err
+		}
+		last := out.NextToken == nil
+		if !fn(out, last) || last {
+			return nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// DescribeServices describes services by name or ARN
+func (e *ECS) DescribeServices(input *ecs.DescribeServicesInput) (*ecs.DescribeServicesOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	if len(input.Services) > maxDescribeServices {
+		return nil, invalidParameter("services can have at most %d items", maxDescribeServices)
+	}
+	out := &ecs.DescribeServicesOutput{}
+	for _, name := range input.Services {
+		s := c.findService(*name)
+		if s == nil {
+			out.Failures = append(out.Failures, &ecs.Failure{Arn: aws.String(b.arn("ecs", "service/"+*name)), Reason: aws.String("MISSING")})
+			continue
+		}
+		if *s.RunningCount < *s.DesiredCount {
+			// the scheduler retries starting the missing tasks
+			b.reconcile(c, s)
+		}
+		service := awsutil.CopyOf(s).(*ecs.Service)
+		if !contains(input.Include, ecs.ServiceFieldTags) {
+			service.Tags = nil
+		}
+		out.Services = append(out.Services, service)
+	}
+	return out, nil
+}
+
+// UpdateService changes the desired count or task definition of a service. A new
+// task definition is rolled out immediately.
+func (e *ECS) UpdateService(input *ecs.UpdateServiceInput) (*ecs.UpdateServiceOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	s := c.findService(aws.StringValue(input.Service))
+	if s == nil {
+		return nil, awserr.New("ServiceNotFoundException", "Service not found.", nil)
+	}
+
+	if input.EnableExecuteCommand != nil {
+		s.EnableExecuteCommand = aws.Bool(*input.EnableExecuteCommand)
+	}
+	if input.DesiredCount != nil {
+		s.DesiredCount = aws.Int64(*input.DesiredCount)
+		s.Deployments[0].DesiredCount = aws.Int64(*input.DesiredCount)
+	}
+
+	switch {
+	case input.TaskDefinition != nil:
+		td := b.findTaskDefinition(*input.TaskDefinition)
+		if td == nil {
+			return nil, awserr.New("ClientException", "TaskDefinition not found.", nil)
+		}
+		b.deploy(c, s, *td.TaskDefinitionArn)
+	case input.ForceNewDeployment != nil && *input.ForceNewDeployment:
+		b.deploy(c, s, *s.TaskDefinition)
+	default:
+		b.reconcile(c, s)
+	}
+	return &ecs.UpdateServiceOutput{Service: awsutil.CopyOf(s).(*ecs.Service)}, nil
+}
+
+// RegisterTaskDefinition registers the next revision of a task definition family
+func (e *ECS) RegisterTaskDefinition(input *ecs.RegisterTaskDefinitionInput) (*ecs.RegisterTaskDefinitionOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if aws.StringValue(input.Family) == "" {
+		return nil, invalidParameter("family is required")
+	}
+	if len(input.ContainerDefinitions) == 0 {
+		return nil, invalidParameter("container definitions are required")
+	}
+	family := *input.Family
+	revision := int64(len(b.taskDefinitions[family]) + 1)
+	in := awsutil.CopyOf(input).(*ecs.RegisterTaskDefinitionInput)
+	now := time.Now()
+	td := &ecs.TaskDefinition{
+		RegisteredAt:            &now,
+		RegisteredBy:            aws.String(b.User),
+		TaskDefinitionArn:       aws.String(b.arn("ecs", fmt.Sprintf("task-definition/%s:%d", family, revision))),
+		Family:                  aws.String(family),
+		Revision:                aws.Int64(revision),
+		Status:                  aws.String(ecs.TaskDefinitionStatusActive),
+		ContainerDefinitions:    in.ContainerDefinitions,
+		TaskRoleArn:             in.TaskRoleArn,
+		ExecutionRoleArn:        in.ExecutionRoleArn,
+		NetworkMode:             in.NetworkMode,
+		Volumes:                 in.Volumes,
+		PlacementConstraints:    in.PlacementConstraints,
+		RequiresCompatibilities: in.RequiresCompatibilities,
+		Cpu:                     in.Cpu,
+		Memory:                  in.Memory,
+		ProxyConfiguration:      in.ProxyConfiguration,
+		EphemeralStorage:        in.EphemeralStorage,
+		RuntimePlatform:         in.RuntimePlatform,
+		PidMode:                 in.PidMode,
+		IpcMode:                 in.IpcMode,
+		InferenceAccelerators:   in.InferenceAccelerators,
+	}
+	if td.NetworkMode == nil {
+		td.NetworkMode = aws.String(ecs.NetworkModeBridge)
+	}
+	b.taskDefinitions[family] = append(b.taskDefinitions[family], td)
+	if len(in.Tags) > 0 {
+		b.definitionTags[*td.TaskDefinitionArn] = in.Tags
+	}
+	return &ecs.RegisterTaskDefinitionOutput{TaskDefinition: awsutil.CopyOf(td).(*ecs.TaskDefinition)}, nil
+}
+
+// DescribeTaskDefinition describes a task definition by ARN, family:revision or
+// family, the latter resolving to the latest active revision
+func (e *ECS) DescribeTaskDefinition(input *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	td := b.findTaskDefinition(aws.StringValue(input.TaskDefinition))
+	if td == nil {
+		return nil, awserr.New("ClientException", "Unable to describe task definition.", nil)
+	}
+	output := &ecs.DescribeTaskDefinitionOutput{TaskDefinition: awsutil.CopyOf(td).(*ecs.TaskDefinition)}
+	if contains(input.Include, ecs.TaskDefinitionFieldTags) {
+		for _, tag := range b.definitionTags[*td.TaskDefinitionArn] {
+			output.Tags = append(output.Tags, awsutil.CopyOf(tag).(*ecs.Tag))
+		}
+	}
+	return output, nil
+}
+
+// ListTaskDefinitions lists task definition ARNs, sorted by family and revision
+func (e *ECS) ListTaskDefinitions(input *ecs.ListTaskDefinitionsInput) (*ecs.ListTaskDefinitionsOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := ecs.TaskDefinitionStatusActive
+	if input.Status != nil {
+		status = *input.Status
+	}
+
+	families := make([]string, 0, len(b.taskDefinitions))
+	for name := range b.taskDefinitions {
+		if strings.HasPrefix(name, aws.StringValue(input.FamilyPrefix)) {
+			families = append(families, name)
+		}
+	}
+	sort.Strings(families)
+
+	matches := make([]*ecs.TaskDefinition, 0)
+	for _, name := range families {
+		for _, td := range b.taskDefinitions[name] {
+			if *td.Status == status {
+				matches = append(matches, td)
+			}
+		}
+	}
+	if aws.StringValue(input.Sort) == ecs.SortOrderDesc {
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	}
+
+	start, end, next, err := b.page(len(matches), input.NextToken, input.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	out := &ecs.ListTaskDefinitionsOutput{NextToken: next}
+	for _, td := range matches[start:end] {
+		out.TaskDefinitionArns = append(out.TaskDefinitionArns, aws.String(*td.TaskDefinitionArn))
+	}
+	return out, nil
+}
+
+// ListTaskDefinitionsPages iterates over the pages of ListTaskDefinitions
+func (e *ECS) ListTaskDefinitionsPages(input *ecs.ListTaskDefinitionsInput, fn func(*ecs.ListTaskDefinitionsOutput, bool) bool) error {
+	in := *input
+	for {
+		out, err := e.ListTaskDefinitions(&in)
+		if err != nil {
+			return err
+		}
+		last := out.NextToken == nil
+		if !fn(out, last) || last {
+			return nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// ListTasks lists the ARNs of the tasks of a cluster, by default only the ones
+// desired to be running
+func (e *ECS) ListTasks(input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	desiredStatus := ecs.DesiredStatusRunning
+	if input.DesiredStatus != nil {
+		desiredStatus = *input.DesiredStatus
+	}
+
+	matches := make([]*ecs.Task, 0)
+	for _, t := range c.tasks {
+		switch {
+		case *t.DesiredStatus != desiredStatus:
+		case input.ServiceName != nil && aws.StringValue(t.Group) != "service:"+baseName(*input.ServiceName):
+		case input.StartedBy != nil && aws.StringValue(t.StartedBy) != *input.StartedBy:
+		case input.Family != nil && family(*t.TaskDefinitionArn) != *input.Family:
+		case input.ContainerInstance != nil && aws.StringValue(t.ContainerInstanceArn) != *input.ContainerInstance:
+		default:
+			matches = append(matches, t)
+		}
+	}
+
+	start, end, next, err := b.page(len(matches), input.NextToken, input.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	out := &ecs.ListTasksOutput{NextToken: next}
+	for _, t := range matches[start:end] {
+		out.TaskArns = append(out.TaskArns, aws.String(*t.TaskArn))
+	}
+	return out, nil
+}
+
+// ListTasksPages iterates over the pages of ListTasks
+func (e *ECS) ListTasksPages(input *ecs.ListTasksInput, fn func(*ecs.ListTasksOutput, bool) bool) error {
+	in := *input
+	for {
+		out, err := e.ListTasks(&in)
+		if err != nil {
+			return err
+		}
+		last := out.NextToken == nil
+		if !fn(out, last) || last {
+			return nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// DescribeTasks describes tasks by id or ARN
+func (e *ECS) DescribeTasks(input *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	if len(input.Tasks) > maxDescribeTasks {
+		return nil, invalidParameter("tasks can have at most %d items", maxDescribeTasks)
+	}
+	out := &ecs.DescribeTasksOutput{}
+	for _, id := range input.Tasks {
+		t := c.findTask(*id)
+		if t == nil {
+			out.Failures = append(out.Failures, &ecs.Failure{Arn: aws.String(*id), Reason: aws.String("MISSING")})
+			continue
+		}
+		out.Tasks = append(out.Tasks, awsutil.CopyOf(t).(*ecs.Task))
+	}
+	return out, nil
+}
+
+// StopTask stops a task. The service scheduler replaces stopped service tasks.
+func (e *ECS) StopTask(input *ecs.StopTaskInput) (*ecs.StopTaskOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	t := c.findTask(aws.StringValue(input.Task))
+	if t == nil {
+		return nil, invalidParameter("The referenced task was not found.")
+	}
+	reason := "Task stopped by user"
+	if input.Reason != nil {
+		reason = *input.Reason
+	}
+	b.stopTask(c, t, reason)
+	out := &ecs.StopTaskOutput{Task: awsutil.CopyOf(t).(*ecs.Task)}
+
+	if strings.HasPrefix(aws.StringValue(t.Group), "service:") {
+		if s := c.findService(strings.TrimPrefix(*t.Group, "service:")); s != nil {
+			b.reconcile(c, s)
+		}
+	}
+	return out, nil
+}
+
+// StartTask starts a task on each of the given container instances
+func (e *ECS) StartTask(input *ecs.StartTaskInput) (*ecs.StartTaskOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	td := b.findTaskDefinition(aws.StringValue(input.TaskDefinition))
+	if td == nil {
+		return nil, awserr.New("ClientException", "TaskDefinition not found.", nil)
+	}
+	group := "family:" + *td.Family
+	if input.Group != nil {
+		group = *input.Group
+	}
+
+	out := &ecs.StartTaskOutput{}
+	for _, arn := range input.ContainerInstances {
+		ci := c.findContainerInstance(*arn)
+		if ci == nil {
+			out.Failures = append(out.Failures, &ecs.Failure{Arn: aws.String(*arn), Reason: aws.String("MISSING")})
+			continue
+		}
+		if aws.StringValue(td.NetworkMode) == ecs.NetworkModeAwsvpc && input.NetworkConfiguration == nil {
+			return nil, invalidParameter("Network Configuration must be provided when networkMode 'awsvpc' is specified.")
+		}
+		t := b.runTask(c, td, ci, group, aws.StringValue(input.StartedBy), input.Overrides, input.NetworkConfiguration)
+		t.EnableExecuteCommand = aws.Bool(aws.BoolValue(input.EnableExecuteCommand))
+		out.Tasks = append(out.Tasks, awsutil.CopyOf(t).(*ecs.Task))
+	}
+	return out, nil
+}
+
+// RunTask runs tasks on Fargate or places them on the container instances of the cluster
+func (e *ECS) RunTask(input *ecs.RunTaskInput) (*ecs.RunTaskOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	td := b.findTaskDefinition(aws.StringValue(input.TaskDefinition))
+	if td == nil {
+		return nil, awserr.New("ClientException", "TaskDefinition not found.", nil)
+	}
+	fargate := aws.StringValue(input.LaunchType) == ecs.LaunchTypeFargate
+	if fargate && aws.StringValue(td.NetworkMode) != ecs.NetworkModeAwsvpc {
+		return nil, invalidParameter("Task definition does not support launch_type FARGATE.")
+	}
+	if aws.StringValue(td.NetworkMode) == ecs.NetworkModeAwsvpc && input.NetworkConfiguration == nil {
+		return nil, invalidParameter("Network Configuration must be provided when networkMode 'awsvpc' is specified.")
+	}
+	group := "family:" + *td.Family
+	if input.Group != nil {
+		group = *input.Group
+	}
+	count := int64(1)
+	if input.Count != nil {
+		count = *input.Count
+	}
+
+	out := &ecs.RunTaskOutput{}
+	for i := int64(0); i < count; i++ {
+		var ci *ecs.ContainerInstance
+		if !fargate {
+			if ci = c.placement(); ci == nil {
+				out.Failures = append(out.Failures, &ecs.Failure{Reason: aws.String("RESOURCE:MEMORY")})
+				continue
+			}
+		}
+		t := b.runTask(c, td, ci, group, aws.StringValue(input.StartedBy), input.Overrides, input.NetworkConfiguration)
+		t.EnableExecuteCommand = aws.Bool(aws.BoolValue(input.EnableExecuteCommand))
+		out.Tasks = append(out.Tasks, awsutil.CopyOf(t).(*ecs.Task))
+	}
+	return out, nil
+}
+
+// ExecuteCommand starts a session served by the backend's SessionAgent for a running
+// task with ECS Exec enabled
+func (e *ECS) ExecuteCommand(input *ecs.ExecuteCommandInput) (*ecs.ExecuteCommandOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	if !aws.BoolValue(input.Interactive) {
+		return nil, invalidParameter("Interactive is the only mode supported currently.")
+	}
+	t := c.findTask(aws.StringValue(input.Task))
+	if t == nil || *t.LastStatus != ecs.DesiredStatusRunning {
+		return nil, invalidParameter("The task provided in the request was not found or is not running.")
+	}
+	if !aws.BoolValue(t.EnableExecuteCommand) {
+		return nil, invalidParameter("The execute command failed because execute command was not enabled when the task was run or the execute command agent isn’t running.")
+	}
+	var container *ecs.Container
+	for _, candidate := range t.Containers {
+		if input.Container == nil && len(t.Containers) == 1 || aws.StringValue(candidate.Name) == aws.StringValue(input.Container) {
+			container = candidate
+		}
+	}
+	if container == nil {
+		return nil, invalidParameter("The container provided in the request was not found or could not be determined.")
+	}
+	if b.SessionURL == "" {
+		return nil, awserr.New("TargetNotConnectedException", "The execute command failed due to an internal error.", nil)
+	}
+
+	sessionID := "ecs-execute-command-" + b.nextID()
+	token := "token-" + b.nextID()
+	b.sessions[token] = &execSession{
+		task:      *t.TaskArn,
+		container: *container.Name,
+		command:   aws.StringValue(input.Command),
+	}
+	return &ecs.ExecuteCommandOutput{
+		ClusterArn:    aws.String(c.arn),
+		TaskArn:       aws.String(*t.TaskArn),
+		ContainerArn:  aws.String(*container.ContainerArn),
+		ContainerName: aws.String(*container.Name),
+		Interactive:   aws.Bool(true),
+		Session: &ecs.Session{
+			SessionId:  aws.String(sessionID),
+			StreamUrl:  aws.String(b.SessionURL + "?sessionId=" + sessionID),
+			TokenValue: aws.String(token),
+		},
+	}, nil
+}
+
+// WaitUntilTasksRunning returns an error if one of the tasks is stopped, tasks of
+// the backend are running as soon as they are started
+func (e *ECS) WaitUntilTasksRunning(input *ecs.DescribeTasksInput) error {
+	out, err := e.DescribeTasks(input)
+	if err != nil {
+		return err
+	}
+	if len(out.Failures) > 0 {
+		return awserr.New("ResourceNotReady", "failed waiting for successful resource state", nil)
+	}
+	for _, t := range out.Tasks {
+		if *t.LastStatus != ecs.DesiredStatusRunning {
+			return awserr.New("ResourceNotReady", "failed waiting for successful resource state", nil)
+		}
+	}
+	return nil
+}
+
+// ListContainerInstances lists the ARNs of the container instances of a cluster
+func (e *ECS) ListContainerInstances(input *ecs.ListContainerInstancesInput) (*ecs.ListContainerInstancesOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	start, end, next, err := b.page(len(c.containerInstances), input.NextToken, input.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	out := &ecs.ListContainerInstancesOutput{NextToken: next}
+	for _, ci := range c.containerInstances[start:end] {
+		out.ContainerInstanceArns = append(out.ContainerInstanceArns, aws.String(*ci.ContainerInstanceArn))
+	}
+	return out, nil
+}
+
+// ListContainerInstancesPages iterates over the pages of ListContainerInstances
+func (e *ECS) ListContainerInstancesPages(input *ecs.ListContainerInstancesInput, fn func(*ecs.ListContainerInstancesOutput, bool) bool) error {
+	in := *input
+	for {
+		out, err := e.ListContainerInstances(&in)
+		if err != nil {
+			return err
+		}
+		last := out.NextToken == nil
+		if !fn(out, last) || last {
+			return nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// DescribeContainerInstances describes container instances by id or ARN
+func (e *ECS) DescribeContainerInstances(input *ecs.DescribeContainerInstancesInput) (*ecs.DescribeContainerInstancesOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(aws.StringValue(input.Cluster))
+	if c == nil {
+		return nil, clusterNotFound(aws.StringValue(input.Cluster))
+	}
+	if len(input.ContainerInstances) > maxDescribeContainerInstances {
+		return nil, invalidParameter("containerInstances can have at most %d items", maxDescribeContainerInstances)
+	}
+	out := &ecs.DescribeContainerInstancesOutput{}
+	for _, id := range input.ContainerInstances {
+		ci := c.findContainerInstance(*id)
+		if ci == nil {
+			out.Failures = append(out.Failures, &ecs.Failure{Arn: aws.String(*id), Reason: aws.String("MISSING")})
+			continue
+		}
+		out.ContainerInstances = append(out.ContainerInstances, awsutil.CopyOf(ci).(*ecs.ContainerInstance))
+	}
+	return out, nil
+}
+
+func (c *cluster) findService(name string) *ecs.Service {
+	for _, s := range c.services {
+		if *s.ServiceName == name || *s.ServiceArn == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (c *cluster) findTask(id string) *ecs.Task {
+	for _, t := range c.tasks {
+		if *t.TaskArn == id || baseName(*t.TaskArn) == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func (c *cluster) findContainerInstance(id string) *ecs.ContainerInstance {
+	for _, ci := range c.containerInstances {
+		if *ci.ContainerInstanceArn == id || baseName(*ci.ContainerInstanceArn) == id {
+			return ci
+		}
+	}
+	return nil
+}
+
+func (b *Backend) findTaskDefinition(name string) *ecs.TaskDefinition {
+	name = baseName(name)
+	parts := strings.SplitN(name, ":", 2)
+	revisions := b.taskDefinitions[parts[0]]
+	if len(parts) == 1 {
+		for i := len(revisions) - 1; i >= 0; i-- {
+			if *revisions[i].Status == ecs.TaskDefinitionStatusActive {
+				return revisions[i]
+			}
+		}
+		return nil
+	}
+	revision, err := strconv.Atoi(parts[1])
+	if err != nil || revision < 1 || revision > len(revisions) {
+		return nil
+	}
+	return revisions[revision-1]
+}
+
+func (b *Backend) registerContainerInstance(c *cluster, instance *ec2.Instance) *ecs.ContainerInstance {
+	resources := func() []*ecs.Resource {
+		return []*ecs.Resource{
+			{Name: aws.String("CPU"), Type: aws.String("INTEGER"), IntegerValue: aws.Int64(2048)},
+			{Name: aws.String("MEMORY"), Type: aws.String("INTEGER"), IntegerValue: aws.Int64(7982)},
+			{Name: aws.String("PORTS"), Type: aws.String("STRINGSET"), StringSetValue: []*string{aws.String("22"), aws.String("2375"), aws.String("2376"), aws.String("51678"), aws.String("51679")}},
+		}
+	}
+	ci := &ecs.ContainerInstance{
+		ContainerInstanceArn: aws.String(b.arn("ecs", "container-instance/"+b.nextID())),
+		Ec2InstanceId:        aws.String(*instance.InstanceId),
+		Status:               aws.String("ACTIVE"),
+		AgentConnected:       aws.Bool(true),
+		RegisteredResources:  resources(),
+		RemainingResources:   resources(),
+		RunningTasksCount:    aws.Int64(0),
+		PendingTasksCount:    aws.Int64(0),
+	}
+	c.containerInstances = append(c.containerInstances, ci)
+	return ci
+}
+
+// deploy makes the task definition the primary deployment of the service and
+// replaces the tasks of the service, like a finished rolling update
+func (b *Backend) deploy(c *cluster, s *ecs.Service, taskDefinitionArn string) {
+	now := time.Now()
+	s.TaskDefinition = aws.String(taskDefinitionArn)
+	s.Deployments = []*ecs.Deployment{{
+		Id:             aws.String("ecs-svc/" + strconv.Itoa(b.serial+1)),
+		Status:         aws.String("PRIMARY"),
+		TaskDefinition: aws.String(taskDefinitionArn),
+		DesiredCount:   aws.Int64(*s.DesiredCount),
+		PendingCount:   aws.Int64(0),
+		RunningCount:   aws.Int64(0),
+		LaunchType:     s.LaunchType,
+		CreatedAt:      &now,
+		UpdatedAt:      &now,
+	}}
+	b.serial++
+	b.reconcile(c, s)
+}
+
+// reconcile stops the service tasks which do not belong to the primary deployment
+// and starts tasks until the desired count is running
+func (b *Backend) reconcile(c *cluster, s *ecs.Service) {
+	group := "service:" + *s.ServiceName
+	deployment := s.Deployments[0]
+	td := b.findTaskDefinition(*s.TaskDefinition)
+
+	running := 0
+	for _, t := range c.tasks {
+		if aws.StringValue(t.Group) != group || *t.DesiredStatus != ecs.DesiredStatusRunning {
+			continue
+		}
+		if *t.TaskDefinitionArn != *s.TaskDefinition || int64(running) >= *s.DesiredCount {
+			b.stopTask(c, t, fmt.Sprintf("Scaling activity initiated by (deployment %s)", *deployment.Id))
+			continue
+		}
+		running++
+	}
+
+	started := make([]string, 0)
+	for int64(running) < *s.DesiredCount {
+		var ci *ecs.ContainerInstance
+		if aws.StringValue(s.LaunchType) != ecs.LaunchTypeFargate {
+			if ci = c.placement(); ci == nil {
+				b.addServiceEvent(s, fmt.Sprintf("(service %s) was unable to place a task because no container instance met all of its requirements.", *s.ServiceName))
+				break
+			}
+		}
+		t := b.runTask(c, td, ci, group, *deployment.Id, nil, s.NetworkConfiguration)
+		t.EnableExecuteCommand = aws.Bool(aws.BoolValue(s.EnableExecuteCommand))
+		started = append(started, "(task "+baseName(*t.TaskArn)+")")
+		if reason, ok := b.failures[*td.TaskDefinitionArn]; ok {
+			// one attempt per reconcile, the scheduler backs off between them
+			b.stopTask(c, t, reason)
+			for _, container := range t.Containers {
+				container.ExitCode = aws.Int64(1)
+			}
+			break
+		}
+		b.registerTargets(c, s, t)
+		running++
+	}
+	if len(started) > 0 {
+		b.addServiceEvent(s, fmt.Sprintf("(service %s) has started %d tasks: %s.", *s.ServiceName, len(started), strings.Join(started, " ")))
+	}
+
+	// pending tasks count towards the desired tasks but are not running yet
+	pending := 0
+	for _, t := range c.tasks {
+		if aws.StringValue(t.Group) == group && *t.DesiredStatus == ecs.DesiredStatusRunning && *t.LastStatus != ecs.DesiredStatusRunning {
+			pending++
+		}
+	}
+	running -= pending
+	s.RunningCount = aws.Int64(int64(running))
+	s.PendingCount = aws.Int64(int64(pending))
+	deployment.RunningCount = aws.Int64(int64(running))
+	deployment.PendingCount = aws.Int64(int64(pending))
+	deployment.DesiredCount = aws.Int64(*s.DesiredCount)
+	if int64(running) == *s.DesiredCount {
+		b.addServiceEvent(s, fmt.Sprintf("(service %s) has reached a steady state.", *s.ServiceName))
+	}
+}
+
+// placement picks the active container instance running the fewest tasks
+func (c *cluster) placement() *ecs.ContainerInstance {
+	var best *ecs.ContainerInstance
+	for _, ci := range c.containerInstances {
+		if *ci.Status != "ACTIVE" {
+			continue
+		}
+		if best == nil || *ci.RunningTasksCount < *best.RunningTasksCount {
+			best = ci
+		}
+	}
+	return best
+}
+
+// runTask starts a task on the container instance, or on Fargate if ci is nil. Tasks
+// using the awsvpc network mode get an ENI in the first subnet of the network configuration.
+func (b *Backend) runTask(c *cluster, td *ecs.TaskDefinition, ci *ecs.ContainerInstance, group, startedBy string, overrides *ecs.TaskOverride, networkConfiguration *ecs.NetworkConfiguration) *ecs.Task {
+	now := time.Now()
+	taskArn := b.arn("ecs", "task/"+b.nextID())
+	health := ecs.HealthStatusUnknown
+
+	containers := make([]*ecs.Container, len(td.ContainerDefinitions))
+	for i, def := range td.ContainerDefinitions {
+		container := &ecs.Container{
+			ContainerArn: aws.String(b.arn("ecs", "container/"+b.nextID())),
+			TaskArn:      aws.String(taskArn),
+			Name:         aws.String(*def.Name),
+			LastStatus:   aws.String(ecs.DesiredStatusRunning),
+			HealthStatus: aws.String(ecs.HealthStatusUnknown),
+		}
+		if def.HealthCheck != nil {
+			container.HealthStatus = aws.String(ecs.HealthStatusHealthy)
+			health = ecs.HealthStatusHealthy
+		}
+		for _, pm := range def.PortMappings {
+			if aws.StringValue(td.NetworkMode) == ecs.NetworkModeAwsvpc {
+				// awsvpc containers are reachable on the task's ENI and report no bindings
+				break
+			}
+			binding := &ecs.NetworkBinding{
+				BindIP:        aws.String("0.0.0.0"),
+				ContainerPort: aws.Int64(*pm.ContainerPort),
+				HostPort:      aws.Int64(*pm.ContainerPort),
+				Protocol:      aws.String("tcp"),
+			}
+			if pm.Protocol != nil {
+				binding.Protocol = aws.String(*pm.Protocol)
+			}
+			if aws.StringValue(td.NetworkMode) == ecs.NetworkModeBridge {
+				if pm.HostPort != nil && *pm.HostPort != 0 {
+					binding.HostPort = aws.Int64(*pm.HostPort)
+				} else {
+					binding.HostPort = aws.Int64(int64(firstDynamicHostPort + b.serial))
+				}
+			}
+			container.NetworkBindings = append(container.NetworkBindings, binding)
+		}
+		containers[i] = container
+	}
+
+	t := &ecs.Task{
+		TaskArn:           aws.String(taskArn),
+		ClusterArn:        aws.String(c.arn),
+		TaskDefinitionArn: aws.String(*td.TaskDefinitionArn),
+		Containers:        containers,
+		Group:             aws.String(group),
+		LastStatus:        aws.String(ecs.DesiredStatusRunning),
+		DesiredStatus:     aws.String(ecs.DesiredStatusRunning),
+		HealthStatus:      aws.String(health),
+		LaunchType:        aws.String(ecs.LaunchTypeFargate),
+		Overrides:         &ecs.TaskOverride{},
+		CreatedAt:         &now,
+		StartedAt:         &now,
+		Version:           aws.Int64(1),
+	}
+	if ci != nil {
+		t.ContainerInstanceArn = aws.String(*ci.ContainerInstanceArn)
+		t.LaunchType = aws.String(ecs.LaunchTypeEc2)
+		*ci.RunningTasksCount++
+	}
+	if aws.StringValue(td.NetworkMode) == ecs.NetworkModeAwsvpc {
+		t.Attachments = []*ecs.Attachment{b.networkInterface(networkConfiguration)}
+	}
+	if startedBy != "" {
+		t.StartedBy = aws.String(startedBy)
+	}
+	if overrides != nil {
+		t.Overrides = awsutil.CopyOf(overrides).(*ecs.TaskOverride)
+	}
+	if b.unhealthy[*td.TaskDefinitionArn] {
+		t.HealthStatus = aws.String(ecs.HealthStatusUnhealthy)
+		for _, container := range t.Containers {
+			container.HealthStatus = aws.String(ecs.HealthStatusUnhealthy)
+		}
+	}
+	if b.pending[*td.TaskDefinitionArn] {
+		t.LastStatus = aws.String("PENDING")
+		t.StartedAt = nil
+		t.HealthStatus = aws.String(ecs.HealthStatusUnknown)
+		for _, container := range t.Containers {
+			container.LastStatus = aws.String("PENDING")
+			container.HealthStatus = aws.String(ecs.HealthStatusUnknown)
+			container.NetworkBindings = nil
+		}
+	}
+	c.tasks = append(c.tasks, t)
+	return t
+}
+
+// networkInterface returns an attached ENI attachment as ECS reports it for awsvpc tasks
+func (b *Backend) networkInterface(networkConfiguration *ecs.NetworkConfiguration) *ecs.Attachment {
+	b.serial++
+	subnet := "subnet-00000000"
+	if networkConfiguration != nil && networkConfiguration.AwsvpcConfiguration != nil && len(networkConfiguration.AwsvpcConfiguration.Subnets) > 0 {
+		subnet = *networkConfiguration.AwsvpcConfiguration.Subnets[0]
+	}
+	detail := func(name, value string) *ecs.KeyValuePair {
+		return &ecs.KeyValuePair{Name: aws.String(name), Value: aws.String(value)}
+	}
+	return &ecs.Attachment{
+		Id:     aws.String(b.nextID()),
+		Type:   aws.String("ElasticNetworkInterface"),
+		Status: aws.String("ATTACHED"),
+		Details: []*ecs.KeyValuePair{
+			detail("subnetId", subnet),
+			detail("networkInterfaceId", fmt.Sprintf("eni-%017x", b.serial)),
+			detail("macAddress", fmt.Sprintf("02:00:00:00:%02x:%02x", b.serial/256%256, b.serial%256)),
+			detail("privateIPv4Address", fmt.Sprintf("10.1.%d.%d", b.serial/256%256, b.serial%256)),
+		},
+	}
+}
+
+func (b *Backend) stopTask(c *cluster, t *ecs.Task, reason string) {
+	if *t.LastStatus == ecs.DesiredStatusStopped {
+		return
+	}
+	now := time.Now()
+	t.LastStatus = aws.String(ecs.DesiredStatusStopped)
+	t.DesiredStatus = aws.String(ecs.DesiredStatusStopped)
+	t.StoppedReason = aws.String(reason)
+	t.StoppingAt = &now
+	t.StoppedAt = &now
+	for _, container := range t.Containers {
+		container.LastStatus = aws.String(ecs.DesiredStatusStopped)
+		container.ExitCode = aws.Int64(137)
+	}
+	if ci := c.findContainerInstance(aws.StringValue(t.ContainerInstanceArn)); ci != nil {
+		*ci.RunningTasksCount--
+	}
+	b.deregisterTargets(t)
+}
+
+// addServiceEvent prepends an event, DescribeServices returns the newest event first
+func (b *Backend) addServiceEvent(s *ecs.Service, message string) {
+	now := time.Now()
+	event := &ecs.ServiceEvent{
+		Id:        aws.String(b.nextID()),
+		CreatedAt: &now,
+		Message:   aws.String(message),
+	}
+	s.Events = append([]*ecs.ServiceEvent{event}, s.Events...)
+}
+
+// family returns the family of a task definition ARN
+func family(taskDefinitionArn string) string {
+	return strings.Split(baseName(taskDefinitionArn), ":")[0]
+}
+
+func invalidParameter(format string, args ...interface{}) error {
+	return awserr.New("InvalidParameterException", fmt.Sprintf(format, args...), nil)
+}
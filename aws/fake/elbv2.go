@@ -0,0 +1,242 @@
+package fake
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+// ELBV2 implements the target group operations skipper uses on top of the backend.
+// Calling any other operation of elbv2iface.ELBV2API panics.
+type ELBV2 struct {
+	elbv2iface.ELBV2API
+	backend *Backend
+}
+
+type targetGroup struct {
+	arn     string
+	delay   int
+	targets []*target
+}
+
+// target is a registered task port. New targets report initial once before they are
+// healthy, deregistered ones report draining once before they are gone.
+type target struct {
+	id    string
+	port  int64
+	task  string
+	state string
+}
+
+// DescribeTargetHealth reports the state of the given targets, or of all registered
+// targets of the group
+func (e *ELBV2) DescribeTargetHealth(input *elbv2.DescribeTargetHealthInput) (*elbv2.DescribeTargetHealthOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tg, ok := b.targetGroups[aws.StringValue(input.TargetGroupArn)]
+	if !ok {
+		return nil, targetGroupNotFound(aws.StringValue(input.TargetGroupArn))
+	}
+
+	describe := func(id string, port int64, state string) *elbv2.TargetHealthDescription {
+		d := &elbv2.TargetHealthDescription{
+			Target:       &elbv2.TargetDescription{Id: aws.String(id), Port: aws.Int64(port)},
+			TargetHealth: &elbv2.TargetHealth{State: aws.String(state)},
+		}
+		if state == elbv2.TargetHealthStateEnumUnused {
+			d.TargetHealth.Reason = aws.String(elbv2.TargetHealthReasonEnumTargetNotRegistered)
+		}
+		return d
+	}
+
+	out := &elbv2.DescribeTargetHealthOutput{}
+	if len(input.Targets) == 0 {
+		for _, t := range tg.targets {
+			out.TargetHealthDescriptions = append(out.TargetHealthDescriptions, describe(t.id, t.port, t.state))
+		}
+	}
+	for _, td := range input.Targets {
+		state := elbv2.TargetHealthStateEnumUnused
+		if t := tg.findTarget(aws.StringValue(td.Id), aws.Int64Value(td.Port)); t != nil {
+			state = t.state
+		}
+		out.TargetHealthDescriptions = append(out.TargetHealthDescriptions, describe(aws.StringValue(td.Id), aws.Int64Value(td.Port), state))
+	}
+	b.advanceTargets(tg)
+	return out, nil
+}
+
+// DeregisterTargets starts draining the targets
+func (e *ELBV2) DeregisterTargets(input *elbv2.DeregisterTargetsInput) (*elbv2.DeregisterTargetsOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tg, ok := b.targetGroups[aws.StringValue(input.TargetGroupArn)]
+	if !ok {
+		return nil, targetGroupNotFound(aws.StringValue(input.TargetGroupArn))
+	}
+	for _, td := range input.Targets {
+		t := tg.findTarget(aws.StringValue(td.Id), aws.Int64Value(td.Port))
+		if t == nil {
+			return nil, awserr.New(elbv2.ErrCodeInvalidTargetException, fmt.Sprintf("The following targets are not registered in target group '%s': '%s'", tg.arn, aws.StringValue(td.Id)), nil)
+		}
+		t.state = elbv2.TargetHealthStateEnumDraining
+	}
+	return &elbv2.DeregisterTargetsOutput{}, nil
+}
+
+// DescribeTargetGroupAttributes returns the deregistration delay of the target group
+func (e *ELBV2) DescribeTargetGroupAttributes(input *elbv2.DescribeTargetGroupAttributesInput) (*elbv2.DescribeTargetGroupAttributesOutput, error) {
+	b := e.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tg, ok := b.targetGroups[aws.StringValue(input.TargetGroupArn)]
+	if !ok {
+		return nil, targetGroupNotFound(aws.StringValue(input.TargetGroupArn))
+	}
+	return &elbv2.DescribeTargetGroupAttributesOutput{
+		Attributes: []*elbv2.TargetGroupAttribute{{
+			Key:   aws.String("deregistration_delay.timeout_seconds"),
+			Value: aws.String(strconv.Itoa(tg.delay)),
+		}},
+	}, nil
+}
+
+// AddTargetGroup creates a target group draining deregistered targets for the delay in
+// seconds and returns its ARN
+func (b *Backend) AddTargetGroup(name string, delay int) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.serial++
+	arn := b.arn("elasticloadbalancing", fmt.Sprintf("targetgroup/%s/%016x", name, b.serial))
+	b.targetGroups[arn] = &targetGroup{arn: arn, delay: delay}
+	return arn
+}
+
+// AttachTargetGroup puts the container port of the service's tasks behind the target
+// group. The running tasks are registered right away, tasks started later once they run.
+func (b *Backend) AttachTargetGroup(clusterName, service, targetGroupArn, container string, port int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(clusterName)
+	if c == nil {
+		return clusterNotFound(clusterName)
+	}
+	s := c.findService(service)
+	if s == nil {
+		return awserr.New("ServiceNotFoundException", "Service not found.", nil)
+	}
+	if _, ok := b.targetGroups[targetGroupArn]; !ok {
+		return targetGroupNotFound(targetGroupArn)
+	}
+	s.LoadBalancers = append(s.LoadBalancers, &ecs.LoadBalancer{
+		TargetGroupArn: aws.String(targetGroupArn),
+		ContainerName:  aws.String(container),
+		ContainerPort:  aws.Int64(port),
+	})
+	for _, t := range c.tasks {
+		if aws.StringValue(t.Group) == "service:"+service && *t.LastStatus == ecs.DesiredStatusRunning {
+			b.registerTargets(c, s, t)
+		}
+	}
+	return nil
+}
+
+// registerTargets registers the task with the target groups of the service, by the ip
+// of its ENI for awsvpc tasks and by the instance and host port otherwise
+func (b *Backend) registerTargets(c *cluster, s *ecs.Service, t *ecs.Task) {
+	for _, lb := range s.LoadBalancers {
+		tg, ok := b.targetGroups[aws.StringValue(lb.TargetGroupArn)]
+		if !ok {
+			continue
+		}
+		id, port := taskTarget(c, t, lb)
+		if id == "" {
+			continue
+		}
+		tg.targets = append(tg.targets, &target{id: id, port: port, task: *t.TaskArn, state: elbv2.TargetHealthStateEnumInitial})
+	}
+}
+
+// deregisterTargets starts draining the targets of the task, like ECS does when it
+// stops a service task
+func (b *Backend) deregisterTargets(t *ecs.Task) {
+	for _, tg := range b.targetGroups {
+		for _, target := range tg.targets {
+			if target.task == *t.TaskArn {
+				target.state = elbv2.TargetHealthStateEnumDraining
+			}
+		}
+	}
+}
+
+// advanceTargets moves the targets on once their state has been reported: initial ones
+// become healthy, or unhealthy if their task is, and draining ones are removed
+func (b *Backend) advanceTargets(tg *targetGroup) {
+	targets := make([]*target, 0, len(tg.targets))
+	for _, t := range tg.targets {
+		switch t.state {
+		case elbv2.TargetHealthStateEnumDraining:
+			continue
+		case elbv2.TargetHealthStateEnumInitial:
+			t.state = elbv2.TargetHealthStateEnumHealthy
+			for _, c := range b.clusters {
+				if task := c.findTask(t.task); task != nil && aws.StringValue(task.HealthStatus) == ecs.HealthStatusUnhealthy {
+					t.state = elbv2.TargetHealthStateEnumUnhealthy
+				}
+			}
+		}
+		targets = append(targets, t)
+	}
+	tg.targets = targets
+}
+
+func (tg *targetGroup) findTarget(id string, port int64) *target {
+	for _, t := range tg.targets {
+		if t.id == id && t.port == port {
+			return t
+		}
+	}
+	return nil
+}
+
+// taskTarget returns the target id and port of the load balanced container of the task
+func taskTarget(c *cluster, t *ecs.Task, lb *ecs.LoadBalancer) (string, int64) {
+	for _, a := range t.Attachments {
+		for _, d := range a.Details {
+			if aws.StringValue(d.Name) == "privateIPv4Address" {
+				return aws.StringValue(d.Value), aws.Int64Value(lb.ContainerPort)
+			}
+		}
+	}
+	ci := c.findContainerInstance(aws.StringValue(t.ContainerInstanceArn))
+	if ci == nil {
+		return "", 0
+	}
+	for _, container := range t.Containers {
+		if aws.StringValue(container.Name) != aws.StringValue(lb.ContainerName) {
+			continue
+		}
+		for _, nb := range container.NetworkBindings {
+			if aws.Int64Value(nb.ContainerPort) == aws.Int64Value(lb.ContainerPort) {
+				return aws.StringValue(ci.Ec2InstanceId), aws.Int64Value(nb.HostPort)
+			}
+		}
+	}
+	return "", 0
+}
+
+func targetGroupNotFound(arn string) error {
+	return awserr.New(elbv2.ErrCodeTargetGroupNotFoundException, fmt.Sprintf("Target groups '%s' not found", arn), nil)
+}
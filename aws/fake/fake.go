@@ -0,0 +1,359 @@
+// Package fake provides an in-memory ECS, EC2, ECR, ELBv2, SSM, Application Auto Scaling,
+// IAM and CloudWatch Logs backend implementing the SDK interfaces skipper's clients are built on, so commands can run without AWS
+//
+//	backend := fake.New()
+//	backend.AddCluster("production")
+//	backend.AddContainerInstance("production")
+//	ecs := ecsclient.NewWithClients(backend.ECS(), backend.EC2())
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+const (
+	// DefaultRegion is the region used in all ARNs of the backend
+	DefaultRegion = "eu-central-1"
+	// DefaultAccountID is the account id used in all ARNs of the backend
+	DefaultAccountID = "123456789012"
+	// DefaultPageSize is the maximum amount of results of one List call if none is requested
+	DefaultPageSize = 100
+)
+
+// Backend holds the state shared by the fake ECS, EC2, ECR, ELBv2, SSM, Application Auto
+// Scaling, IAM and CloudWatch Logs APIs
+type Backend struct {
+	mu sync.Mutex
+
+	Region    string
+	AccountID string
+	// PageSize caps the results of every List/Describe call which supports pagination
+	PageSize int
+	// User is reported as the LastModifiedUser of SSM parameters
+	User string
+	// SessionURL is the websocket url of the SessionAgent serving ExecuteCommand sessions
+	SessionURL string
+
+	clusters        []*cluster
+	taskDefinitions map[string][]*ecs.TaskDefinition
+	definitionTags  map[string][]*ecs.Tag
+	instances       []*ec2.Instance
+	userData        map[string]string
+	keyPairs        map[string]*ec2.KeyPairInfo
+	parameters      map[string][]*ssm.ParameterHistory
+	sessions        map[string]*execSession
+	images          map[string][]*ecr.ImageDetail
+	failures        map[string]string
+	unhealthy       map[string]bool
+	pending         map[string]bool
+	targetGroups    map[string]*targetGroup
+	scalableTargets []*applicationautoscaling.ScalableTarget
+	grants          map[string][]*grant
+	logEvents       map[string][]*cloudwatchlogs.FilteredLogEvent
+
+	serial int
+	ecs    *ECS
+	ec2    *EC2
+	ssm    *SSM
+	ecr    *ECR
+	elbv2  *ELBV2
+	aas    *ApplicationAutoScaling
+	iam    *IAM
+	logs   *CloudWatchLogs
+}
+
+type cluster struct {
+	name               string
+	arn                string
+	services           []*ecs.Service
+	tasks              []*ecs.Task
+	containerInstances []*ecs.ContainerInstance
+}
+
+// New returns an empty backend
+func New() *Backend {
+	b := &Backend{
+		Region:          DefaultRegion,
+		AccountID:       DefaultAccountID,
+		PageSize:        DefaultPageSize,
+		User:            "arn:aws:iam::" + DefaultAccountID + ":user/skipper",
+		taskDefinitions: make(map[string][]*ecs.TaskDefinition),
+		definitionTags:  make(map[string][]*ecs.Tag),
+		userData:        make(map[string]string),
+		keyPairs:        make(map[string]*ec2.KeyPairInfo),
+		parameters:      make(map[string][]*ssm.ParameterHistory),
+		sessions:        make(map[string]*execSession),
+		images:          make(map[string][]*ecr.ImageDetail),
+		failures:        make(map[string]string),
+		unhealthy:       make(map[string]bool),
+		pending:         make(map[string]bool),
+		targetGroups:    make(map[string]*targetGroup),
+		grants:          make(map[string][]*grant),
+		logEvents:       make(map[string][]*cloudwatchlogs.FilteredLogEvent),
+	}
+	b.ecs = &ECS{backend: b}
+	b.ec2 = &EC2{backend: b}
+	b.ssm = &SSM{backend: b}
+	b.ecr = &ECR{backend: b}
+	b.elbv2 = &ELBV2{backend: b}
+	b.aas = &ApplicationAutoScaling{backend: b}
+	b.iam = &IAM{backend: b}
+	b.logs = &CloudWatchLogs{backend: b}
+	return b
+}
+
+// ECS returns the fake ECS API of the backend
+func (b *Backend) ECS() *ECS {
+	return b.ecs
+}
+
+// EC2 returns the fake EC2 API of the backend
+func (b *Backend) EC2() *EC2 {
+	return b.ec2
+}
+
+// SSM returns the fake SSM API of the backend
+func (b *Backend) SSM() *SSM {
+	return b.ssm
+}
+
+// ECR returns the fake ECR API of the backend
+func (b *Backend) ECR() *ECR {
+	return b.ecr
+}
+
+// ELBV2 returns the fake ELBv2 API of the backend
+func (b *Backend) ELBV2() *ELBV2 {
+	return b.elbv2
+}
+
+// ApplicationAutoScaling returns the fake Application Auto Scaling API of the backend
+func (b *Backend) ApplicationAutoScaling() *ApplicationAutoScaling {
+	return b.aas
+}
+
+// IAM returns the fake IAM API of the backend
+func (b *Backend) IAM() *IAM {
+	return b.iam
+}
+
+// CloudWatchLogs returns the fake CloudWatch Logs API of the backend
+func (b *Backend) CloudWatchLogs() *CloudWatchLogs {
+	return b.logs
+}
+
+// AddCluster creates an empty cluster and returns its ARN
+func (b *Backend) AddCluster(name string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c := b.findCluster(name); c != nil {
+		return c.arn
+	}
+	c := &cluster{
+		name: name,
+		arn:  b.arn("ecs", "cluster/"+name),
+	}
+	b.clusters = append(b.clusters, c)
+	return c.arn
+}
+
+// AddContainerInstance launches an EC2 instance and registers it with the cluster
+func (b *Backend) AddContainerInstance(clusterName string) (*ecs.ContainerInstance, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(clusterName)
+	if c == nil {
+		return nil, clusterNotFound(clusterName)
+	}
+	instance := b.launchInstance(&ec2.RunInstancesInput{})
+	ci := b.registerContainerInstance(c, instance)
+	return awsutil.CopyOf(ci).(*ecs.ContainerInstance), nil
+}
+
+// AddService creates a service running the task definition on the cluster with
+// ECS Exec enabled and places its tasks right away
+func (b *Backend) AddService(clusterName, service, taskDefinition string, desiredCount int64) (*ecs.Service, error) {
+	return b.addService(clusterName, service, taskDefinition, desiredCount, ecs.LaunchTypeEc2, nil)
+}
+
+// AddFargateService creates a service running the awsvpc task definition on Fargate
+// in the given subnets
+func (b *Backend) AddFargateService(clusterName, service, taskDefinition string, desiredCount int64, subnets ...string) (*ecs.Service, error) {
+	networkConfiguration := &ecs.NetworkConfiguration{
+		AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
+			AssignPublicIp: aws.String(ecs.AssignPublicIpDisabled),
+			Subnets:        aws.StringSlice(subnets),
+			SecurityGroups: []*string{aws.String("sg-00000000")},
+		},
+	}
+	return b.addService(clusterName, service, taskDefinition, desiredCount, ecs.LaunchTypeFargate, networkConfiguration)
+}
+
+func (b *Backend) addService(clusterName, service, taskDefinition string, desiredCount int64, launchType string, networkConfiguration *ecs.NetworkConfiguration) (*ecs.Service, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(clusterName)
+	if c == nil {
+		return nil, clusterNotFound(clusterName)
+	}
+	td := b.findTaskDefinition(taskDefinition)
+	if td == nil {
+		return nil, awserr.New("ClientException", "Unable to describe task definition.", nil)
+	}
+	now := time.Now()
+	s := &ecs.Service{
+		ClusterArn:           &c.arn,
+		ServiceArn:           aws.String(b.arn("ecs", "service/"+service)),
+		ServiceName:          aws.String(service),
+		Status:               aws.String("ACTIVE"),
+		LaunchType:           aws.String(launchType),
+		CreatedAt:            &now,
+		DesiredCount:         aws.Int64(desiredCount),
+		RunningCount:         aws.Int64(0),
+		PendingCount:         aws.Int64(0),
+		EnableExecuteCommand: aws.Bool(true),
+	}
+	if launchType == ecs.LaunchTypeFargate && aws.StringValue(td.NetworkMode) != ecs.NetworkModeAwsvpc {
+		return nil, invalidParameter("Task definition does not support launch_type FARGATE.")
+	}
+	if networkConfiguration != nil {
+		s.NetworkConfiguration = awsutil.CopyOf(networkConfiguration).(*ecs.NetworkConfiguration)
+	}
+	c.services = append(c.services, s)
+	b.deploy(c, s, *td.TaskDefinitionArn)
+	return awsutil.CopyOf(s).(*ecs.Service), nil
+}
+
+// TagService sets the tags of the service, DescribeServices returns them if asked to
+func (b *Backend) TagService(clusterName, service string, tags map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.findCluster(clusterName)
+	if c == nil {
+		return clusterNotFound(clusterName)
+	}
+	s := c.findService(service)
+	if s == nil {
+		return awserr.New("ServiceNotFoundException", "Service not found.", nil)
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	s.Tags = nil
+	for _, k := range keys {
+		s.Tags = append(s.Tags, &ecs.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+	return nil
+}
+
+// FailTaskDefinition makes the tasks of the task definition stop right after they
+// started with the reason, like an essential container exiting
+func (b *Backend) FailTaskDefinition(taskDefinitionArn, reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures[taskDefinitionArn] = reason
+}
+
+// SetUnhealthy makes the tasks of the task definition started from now on fail their health checks
+func (b *Backend) SetUnhealthy(taskDefinitionArn string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unhealthy[taskDefinitionArn] = true
+}
+
+// SetPending makes the tasks of the task definition started from now on stay PENDING,
+// like tasks waiting for their image to be pulled
+func (b *Backend) SetPending(taskDefinitionArn string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[taskDefinitionArn] = true
+}
+
+// Parameters returns the names of all stored SSM parameters
+func (b *Backend) Parameters() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names := make([]string, 0, len(b.parameters))
+	for name := range b.parameters {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (b *Backend) nextID() string {
+	b.serial++
+	return fmt.Sprintf("%08x-0000-4000-8000-%012x", b.serial, b.serial)
+}
+
+// resourceID returns an EC2 style resource id like i-0000000000000002a
+func (b *Backend) resourceID(prefix string) string {
+	b.serial++
+	return fmt.Sprintf("%s-%017x", prefix, b.serial)
+}
+
+func (b *Backend) arn(service, resource string) string {
+	return fmt.Sprintf("arn:aws:%s:%s:%s:%s", service, b.Region, b.AccountID, resource)
+}
+
+func (b *Backend) findCluster(name string) *cluster {
+	if name == "" {
+		name = "default"
+	}
+	for _, c := range b.clusters {
+		if c.name == name || c.arn == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// page returns the window of n items starting at the position encoded in the token
+// and the token of the next page, or nil if it is the last one
+func (b *Backend) page(n int, token *string, max *int64) (int, int, *string, error) {
+	start := 0
+	if token != nil && *token != "" {
+		if _, err := fmt.Sscanf(*token, "token-%d", &start); err != nil || start > n {
+			return 0, 0, nil, awserr.New("InvalidParameterException", "Invalid token "+*token, nil)
+		}
+	}
+	size := b.PageSize
+	if max != nil && *max > 0 && int(*max) < size {
+		size = int(*max)
+	}
+	end := start + size
+	if end >= n {
+		return start, n, nil, nil
+	}
+	next := fmt.Sprintf("token-%d", end)
+	return start, end, &next, nil
+}
+
+func clusterNotFound(name string) error {
+	return awserr.New("ClusterNotFoundException", fmt.Sprintf("Cluster %s not found.", name), nil)
+}
+
+// baseName returns the part of an ARN after the last slash
+func baseName(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
@@ -0,0 +1,79 @@
+package fake
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// IAM simulates the policies of principals on top of the backend, they are allowed what
+// AllowPrincipal allowed them and nothing else. Calling any other operation of
+// iamiface.IAMAPI panics.
+type IAM struct {
+	iamiface.IAMAPI
+	backend *Backend
+}
+
+// grant allows an action on the resources matching a pattern, which may end with *
+type grant struct {
+	action   string
+	resource string
+}
+
+func (g *grant) allows(action, resource string) bool {
+	if g.action != action && g.action != "*" {
+		return false
+	}
+	if strings.HasSuffix(g.resource, "*") {
+		return strings.HasPrefix(resource, strings.TrimSuffix(g.resource, "*"))
+	}
+	return g.resource == resource
+}
+
+// SimulatePrincipalPolicy evaluates every action on every resource, all results are
+// returned at once
+func (i *IAM) SimulatePrincipalPolicy(input *iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	b := i.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	principal := aws.StringValue(input.PolicySourceArn)
+	if principal == "" || len(input.ActionNames) == 0 {
+		return nil, awserr.New("InvalidInput", "policy source arn and action names are required", nil)
+	}
+	resources := aws.StringValueSlice(input.ResourceArns)
+	if len(resources) == 0 {
+		resources = []string{"*"}
+	}
+
+	out := &iam.SimulatePolicyResponse{IsTruncated: aws.Bool(false)}
+	for _, action := range aws.StringValueSlice(input.ActionNames) {
+		for _, resource := range resources {
+			decision := iam.PolicyEvaluationDecisionTypeImplicitDeny
+			for _, g := range b.grants[principal] {
+				if g.allows(action, resource) {
+					decision = iam.PolicyEvaluationDecisionTypeAllowed
+					break
+				}
+			}
+			out.EvaluationResults = append(out.EvaluationResults, &iam.EvaluationResult{
+				EvalActionName:   aws.String(action),
+				EvalResourceName: aws.String(resource),
+				EvalDecision:     aws.String(decision),
+			})
+		}
+	}
+	return out, nil
+}
+
+// AllowPrincipal allows the principal, a user or role ARN, the action on the resources
+// matching the pattern, which may end with *
+func (b *Backend) AllowPrincipal(principalArn, action, resource string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.grants[principalArn] = append(b.grants[principalArn], &grant{action: action, resource: resource})
+}
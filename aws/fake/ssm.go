@@ -0,0 +1,218 @@
+package fake
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+const (
+	maxParametersByPath      = 10
+	maxParameterHistory      = 50
+	defaultSecureStringKeyID = "alias/aws/ssm"
+)
+
+// SSM implements the Parameter Store operations skipper uses on top of the
+// backend. Values are stored in plain text, decryption is a no-op.
+// Calling any other operation of ssmiface.SSMAPI panics.
+type SSM struct {
+	ssmiface.SSMAPI
+	backend *Backend
+}
+
+// PutParameter creates a parameter or adds a new version to it
+func (s *SSM) PutParameter(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+	b := s.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	name := aws.StringValue(input.Name)
+	if name == "" || input.Value == nil {
+		return nil, awserr.New("ValidationException", "name and value are required", nil)
+	}
+	versions := b.parameters[name]
+	if len(versions) > 0 && !aws.BoolValue(input.Overwrite) {
+		return nil, awserr.New("ParameterAlreadyExists", "The parameter already exists. To overwrite this value, set the overwrite option in the request to true.", nil)
+	}
+
+	var previous *ssm.ParameterHistory
+	if len(versions) > 0 {
+		previous = versions[len(versions)-1]
+	}
+	parameterType := aws.StringValue(input.Type)
+	if parameterType == "" {
+		if previous == nil {
+			return nil, awserr.New("ValidationException", "A parameter type is required when you create a parameter.", nil)
+		}
+		parameterType = *previous.Type
+	}
+	var keyID *string
+	if parameterType == ssm.ParameterTypeSecureString {
+		keyID = aws.String(defaultSecureStringKeyID)
+		if input.KeyId != nil {
+			keyID = aws.String(*input.KeyId)
+		} else if previous != nil && previous.KeyId != nil {
+			keyID = aws.String(*previous.KeyId)
+		}
+	}
+
+	now := time.Now()
+	version := &ssm.ParameterHistory{
+		Name:             aws.String(name),
+		Value:            aws.String(*input.Value),
+		Type:             aws.String(parameterType),
+		KeyId:            keyID,
+		Description:      input.Description,
+		Version:          aws.Int64(int64(len(versions) + 1)),
+		LastModifiedUser: aws.String(b.User),
+		LastModifiedDate: &now,
+	}
+	b.parameters[name] = append(versions, version)
+	return &ssm.PutParameterOutput{Version: aws.Int64(*version.Version)}, nil
+}
+
+// GetParameter returns the latest version of a parameter
+func (s *SSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	b := s.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	versions, ok := b.parameters[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, parameterNotFound()
+	}
+	return &ssm.GetParameterOutput{Parameter: b.parameter(versions[len(versions)-1])}, nil
+}
+
+// GetParametersByPath returns the latest versions of the parameters below a path,
+// sorted by name
+func (s *SSM) GetParametersByPath(input *ssm.GetParametersByPathInput) (*ssm.GetParametersByPathOutput, error) {
+	b := s.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	path := aws.StringValue(input.Path)
+	if !strings.HasPrefix(path, "/") {
+		return nil, awserr.New("ValidationException", "The parameter doesn't meet the parameter name requirements. The parameter name must begin with a forward slash \"/\".", nil)
+	}
+	prefix := strings.TrimSuffix(path, "/") + "/"
+
+	names := make([]string, 0)
+	for name := range b.parameters {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if !aws.BoolValue(input.Recursive) && strings.Contains(strings.TrimPrefix(name, prefix), "/") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	max := input.MaxResults
+	if max == nil {
+		max = aws.Int64(maxParametersByPath)
+	}
+	start, end, next, err := b.page(len(names), input.NextToken, max)
+	if err != nil {
+		return nil, err
+	}
+	out := &ssm.GetParametersByPathOutput{NextToken: next}
+	for _, name := range names[start:end] {
+		versions := b.parameters[name]
+		out.Parameters = append(out.Parameters, b.parameter(versions[len(versions)-1]))
+	}
+	return out, nil
+}
+
+// GetParametersByPathPages iterates over the pages of GetParametersByPath
+func (s *SSM) GetParametersByPathPages(input *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool) error {
+	in := *input
+	for {
+		out, err := s.GetParametersByPath(&in)
+		if err != nil {
+			return err
+		}
+		last := out.NextToken == nil
+		if !fn(out, last) || last {
+			return nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// GetParameterHistory returns all versions of a parameter, oldest first
+func (s *SSM) GetParameterHistory(input *ssm.GetParameterHistoryInput) (*ssm.GetParameterHistoryOutput, error) {
+	b := s.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	versions, ok := b.parameters[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, parameterNotFound()
+	}
+	max := input.MaxResults
+	if max == nil {
+		max = aws.Int64(maxParameterHistory)
+	}
+	start, end, next, err := b.page(len(versions), input.NextToken, max)
+	if err != nil {
+		return nil, err
+	}
+	out := &ssm.GetParameterHistoryOutput{NextToken: next}
+	for _, v := range versions[start:end] {
+		copied := *v
+		out.Parameters = append(out.Parameters, &copied)
+	}
+	return out, nil
+}
+
+// GetParameterHistoryPages iterates over the pages of GetParameterHistory
+func (s *SSM) GetParameterHistoryPages(input *ssm.GetParameterHistoryInput, fn func(*ssm.GetParameterHistoryOutput, bool) bool) error {
+	in := *input
+	for {
+		out, err := s.GetParameterHistory(&in)
+		if err != nil {
+			return err
+		}
+		last := out.NextToken == nil
+		if !fn(out, last) || last {
+			return nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// DeleteParameter deletes a parameter with all its versions
+func (s *SSM) DeleteParameter(input *ssm.DeleteParameterInput) (*ssm.DeleteParameterOutput, error) {
+	b := s.backend
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	name := aws.StringValue(input.Name)
+	if _, ok := b.parameters[name]; !ok {
+		return nil, parameterNotFound()
+	}
+	delete(b.parameters, name)
+	return &ssm.DeleteParameterOutput{}, nil
+}
+
+func (b *Backend) parameter(v *ssm.ParameterHistory) *ssm.Parameter {
+	return &ssm.Parameter{
+		ARN:              aws.String(b.arn("ssm", "parameter/"+strings.TrimPrefix(*v.Name, "/"))),
+		Name:             aws.String(*v.Name),
+		Value:            aws.String(*v.Value),
+		Type:             aws.String(*v.Type),
+		Version:          aws.Int64(*v.Version),
+		LastModifiedDate: v.LastModifiedDate,
+	}
+}
+
+func parameterNotFound() error {
+	return awserr.New(ssm.ErrCodeParameterNotFound, "Parameter not found.", nil)
+}
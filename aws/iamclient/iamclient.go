@@ -0,0 +1,66 @@
+package iamclient
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// Client is the IAM behaviour skipper's commands depend on, implemented by Iamclient
+type Client interface {
+	DeniedResources(principalArn, action string, resources []string) ([]string, error)
+}
+
+// Iamclient checks what roles are allowed to do by simulating their policies
+type Iamclient struct {
+	svc iamiface.IAMAPI
+}
+
+// New Constructor
+func New() *Iamclient {
+	return NewWithClient(iam.New(session.New()))
+}
+
+// NewWithClient constructs an Iamclient on top of the given IAM API implementation
+func NewWithClient(svc iamiface.IAMAPI) *Iamclient {
+	return &Iamclient{
+		svc: svc,
+	}
+}
+
+// DeniedResources returns the resources the policies of the principal, a user or role
+// ARN, do not allow the action on
+func (c *Iamclient) DeniedResources(principalArn, action string, resources []string) ([]string, error) {
+	denied := make([]string, 0)
+	if len(resources) == 0 {
+		return denied, nil
+	}
+
+	var marker *string
+	for {
+		resp, err := c.svc.SimulatePrincipalPolicy(&iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principalArn),
+			ActionNames:     []*string{aws.String(action)},
+			ResourceArns:    aws.StringSlice(resources),
+			Marker:          marker,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// there is one result per resource, denied implicitly or explicitly unless allowed
+		for _, r := range resp.EvaluationResults {
+			if aws.StringValue(r.EvalDecision) != iam.PolicyEvaluationDecisionTypeAllowed {
+				denied = append(denied, aws.StringValue(r.EvalResourceName))
+			}
+		}
+
+		if !aws.BoolValue(resp.IsTruncated) {
+			break
+		}
+		marker = resp.Marker
+	}
+
+	return denied, nil
+}
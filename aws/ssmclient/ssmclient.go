@@ -3,19 +3,29 @@ package ssmclient
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 )
 
+// Client is the SSM behaviour skipper's commands depend on, implemented by Ssmclient.
+// Parameters are kept below a path like /application/api, their names are relative to it.
+type Client interface {
+	GetParameters(path *string) ([]*Ssmkeypair, error)
+	GetParameterHistory(path *string, name *string) ([]*Ssmkeypairhistory, error)
+	PutParameter(path *string, name *string, value *string, kmsKeyID *string) error
+	UpdateParameter(path *string, name *string, value *string) error
+	RestoreParameter(path *string, name *string, version *Ssmkeypairhistory) error
+	DeleteParameter(path *string, name *string) error
+}
+
 type Ssmclient struct {
-	session *session.Session
-	svc     *ssm.SSM
-	creds   *credentials.Credentials
-	logger  *log.Logger
+	svc    ssmiface.SSMAPI
+	logger *log.Logger
 }
 
 type Ssmkeypair struct {
@@ -23,28 +33,38 @@ type Ssmkeypair struct {
 	Value *string
 }
 
+// Ssmkeypairhistory is one version of a parameter, KeyID is only set for SecureStrings
 type Ssmkeypairhistory struct {
 	Key              *string
 	Value            *string
+	Type             *string
+	KeyID            *string
 	Version          *int64
 	LastModifiedUser *string
 	LastModifiedDate *time.Time
 }
 
+// ParameterName returns the full name of the parameter of the path
+func ParameterName(path, name string) string {
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(path, "/"), strings.TrimPrefix(name, "/"))
+}
+
 func New() *Ssmclient {
-	sess := session.New()
-	svc := ssm.New(sess)
+	return NewWithClient(ssm.New(session.New()))
+}
 
+// NewWithClient constructs an Ssmclient on top of the given SSM API implementation
+func NewWithClient(svc ssmiface.SSMAPI) *Ssmclient {
 	return &Ssmclient{
-		svc:     svc,
-		session: sess,
+		svc: svc,
 	}
 }
 
-func (c *Ssmclient) GetParameters(application *string) ([]*Ssmkeypair, error) {
+// GetParameters returns the decrypted parameters below the path, their keys are the full names
+func (c *Ssmclient) GetParameters(path *string) ([]*Ssmkeypair, error) {
 
 	withDecryption := true
-	mypath := fmt.Sprintf("/application/%s", *application)
+	mypath := *path
 
 	ssmkeypairs := make([]*Ssmkeypair, 0)
 
@@ -59,7 +79,7 @@ func (c *Ssmclient) GetParameters(application *string) ([]*Ssmkeypair, error) {
 		})
 
 		if err != nil {
-			log.Fatalf("ssm:GetParametersByPath failed. (path: %s)\n %v", mypath, err)
+			return nil, err
 		}
 
 		for i := range resp.Parameters {
@@ -83,65 +103,107 @@ func (c *Ssmclient) GetParameters(application *string) ([]*Ssmkeypair, error) {
 	return ssmkeypairs, nil
 }
 
-func (c *Ssmclient) GetParameterHistory(application *string, name *string) ([]*Ssmkeypairhistory, error) {
+// GetParameterHistory returns the decrypted versions of the parameter of the path, oldest first
+func (c *Ssmclient) GetParameterHistory(path *string, name *string) ([]*Ssmkeypairhistory, error) {
 
 	withDecryption := true
-	fullname := fmt.Sprintf("/application/%s/%s", *application, *name)
-	params := &ssm.GetParameterHistoryInput{
-		Name:           &fullname,
-		WithDecryption: &withDecryption,
-	}
-	resp, err := c.svc.GetParameterHistory(params)
-	if err != nil {
-		log.Fatal(err)
-	}
-	ssmkeypairs := make([]*Ssmkeypairhistory, len(resp.Parameters))
-
-	for i := range resp.Parameters {
-		name := *resp.Parameters[i].Name
-		value := *resp.Parameters[i].Value
-		a := Ssmkeypairhistory{
-			Key:              &name,
-			Value:            &value,
-			Version:          resp.Parameters[i].Version,
-			LastModifiedUser: resp.Parameters[i].LastModifiedUser,
-			LastModifiedDate: resp.Parameters[i].LastModifiedDate,
+	fullname := ParameterName(*path, *name)
+	ssmkeypairs := make([]*Ssmkeypairhistory, 0)
+
+	var nextToken *string
+	for {
+		resp, err := c.svc.GetParameterHistory(&ssm.GetParameterHistoryInput{
+			Name:           &fullname,
+			WithDecryption: &withDecryption,
+			NextToken:      nextToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range resp.Parameters {
+			name := *resp.Parameters[i].Name
+			value := *resp.Parameters[i].Value
+			a := Ssmkeypairhistory{
+				Key:              &name,
+				Value:            &value,
+				Type:             resp.Parameters[i].Type,
+				KeyID:            resp.Parameters[i].KeyId,
+				Version:          resp.Parameters[i].Version,
+				LastModifiedUser: resp.Parameters[i].LastModifiedUser,
+				LastModifiedDate: resp.Parameters[i].LastModifiedDate,
+			}
+			ssmkeypairs = append(ssmkeypairs, &a)
+		}
+
+		nextToken = resp.NextToken
+		if nextToken == nil || aws.StringValue(nextToken) == "" {
+			break
 		}
-		ssmkeypairs[i] = &a
 	}
 
 	return ssmkeypairs, nil
 }
 
-func (c *Ssmclient) PutParameter(application *string, name *string, value *string) error {
+// PutParameter creates or overwrites the parameter of the path as a SecureString encrypted
+// with the KMS key
+func (c *Ssmclient) PutParameter(path *string, name *string, value *string, kmsKeyID *string) error {
 	overwrite := true
-	kmskeyid := fmt.Sprintf("alias/application/%s", *application)
-	ssmparamname := fmt.Sprintf("/application/%s/%s", *application, *name)
+	ssmparamname := ParameterName(*path, *name)
 	parameterType := "SecureString"
 	input := &ssm.PutParameterInput{
 		Name:      &ssmparamname,
 		Value:     value,
-		KeyId:     &kmskeyid,
+		KeyId:     kmsKeyID,
 		Type:      &parameterType,
 		Overwrite: &overwrite,
 	}
 
 	_, err := c.svc.PutParameter(input)
+	return err
+}
+
+// UpdateParameter puts a new value of the existing parameter of the path, keeping the type
+// and KMS key of its latest version
+func (c *Ssmclient) UpdateParameter(path *string, name *string, value *string) error {
+	history, err := c.GetParameterHistory(path, name)
 	if err != nil {
-		panic(fmt.Sprintf("Error authorizing: %s\n", err.Error()))
+		return err
+	}
+	if len(history) == 0 {
+		return fmt.Errorf("parameter %s has no versions", ParameterName(*path, *name))
 	}
-	return nil
+	latest := *history[len(history)-1]
+	latest.Value = value
+	return c.RestoreParameter(path, name, &latest)
 }
 
-func (c *Ssmclient) DeleteParameter(application *string, name *string) error {
-	ssmparamname := fmt.Sprintf("/application/%s/%s", *application, *name)
+// RestoreParameter puts the value of an earlier version of the parameter of the path as
+// its new version, with the type and KMS key of that version
+func (c *Ssmclient) RestoreParameter(path *string, name *string, version *Ssmkeypairhistory) error {
+	overwrite := true
+	ssmparamname := ParameterName(*path, *name)
+	input := &ssm.PutParameterInput{
+		Name:      &ssmparamname,
+		Value:     version.Value,
+		Type:      version.Type,
+		Overwrite: &overwrite,
+	}
+	if aws.StringValue(version.Type) == ssm.ParameterTypeSecureString {
+		input.KeyId = version.KeyID
+	}
+
+	_, err := c.svc.PutParameter(input)
+	return err
+}
+
+// DeleteParameter deletes the parameter of the path
+func (c *Ssmclient) DeleteParameter(path *string, name *string) error {
+	ssmparamname := ParameterName(*path, *name)
 	input := &ssm.DeleteParameterInput{
 		Name: &ssmparamname,
 	}
 
 	_, err := c.svc.DeleteParameter(input)
-	if err != nil {
-		panic(fmt.Sprintf("Error authorizing: %s\n", err.Error()))
-	}
-	return nil
+	return err
 }
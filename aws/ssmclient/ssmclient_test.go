@@ -0,0 +1,198 @@
+package ssmclient
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/blinkist/skipper/aws/fake"
+)
+
+func TestPutParameterHistory(t *testing.T) {
+	backend := fake.New()
+	c := NewWithClient(backend.SSM())
+	path, name, key := "/application/api", "LOG_LEVEL", "alias/application/api"
+
+	for _, value := range []string{"info", "debug", "warn"} {
+		if err := c.PutParameter(&path, &name, aws.String(value), &key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := c.GetParameterHistory(&path, &name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 versions, got %d", len(history))
+	}
+	for i, value := range []string{"info", "debug", "warn"} {
+		v := history[i]
+		if aws.StringValue(v.Key) != "/application/api/LOG_LEVEL" || aws.StringValue(v.Value) != value || aws.Int64Value(v.Version) != int64(i+1) {
+			t.Errorf("version %d: got %s=%s version %d", i+1, aws.StringValue(v.Key), aws.StringValue(v.Value), aws.Int64Value(v.Version))
+		}
+		if aws.StringValue(v.Type) != ssm.ParameterTypeSecureString || aws.StringValue(v.KeyID) != key {
+			t.Errorf("version %d: expected a SecureString encrypted with %s, got %s with %s", i+1, key, aws.StringValue(v.Type), aws.StringValue(v.KeyID))
+		}
+		if aws.StringValue(v.LastModifiedUser) != backend.User || v.LastModifiedDate == nil {
+			t.Errorf("version %d: expected the modification by %s, got %s at %v", i+1, backend.User, aws.StringValue(v.LastModifiedUser), v.LastModifiedDate)
+		}
+	}
+}
+
+func TestGetParametersPages(t *testing.T) {
+	backend := fake.New()
+	backend.PageSize = 2
+	c := NewWithClient(backend.SSM())
+	path, other, key := "/application/api", "/application/web", "alias/application/api"
+
+	names := []string{"A", "B", "C", "D", "db/URL"}
+	for _, name := range names {
+		name := name
+		if err := c.PutParameter(&path, &name, aws.String("value of "+name), &key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.PutParameter(&other, aws.String("A"), aws.String("other"), &key); err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := c.GetParameters(&path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != len(names) {
+		t.Fatalf("expected %d parameters, got %d", len(names), len(params))
+	}
+	for i, name := range names {
+		if aws.StringValue(params[i].Key) != path+"/"+name || aws.StringValue(params[i].Value) != "value of "+name {
+			t.Errorf("parameter %d: got %s=%s", i, aws.StringValue(params[i].Key), aws.StringValue(params[i].Value))
+		}
+	}
+}
+
+func TestGetParameterHistoryPages(t *testing.T) {
+	backend := fake.New()
+	backend.PageSize = 2
+	c := NewWithClient(backend.SSM())
+	path, name, key := "/application/api", "LOG_LEVEL", "alias/application/api"
+
+	for i := 1; i <= 5; i++ {
+		if err := c.PutParameter(&path, &name, aws.String(fmt.Sprintf("v%d", i)), &key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := c.GetParameterHistory(&path, &name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 5 {
+		t.Fatalf("expected 5 versions, got %d", len(history))
+	}
+	for i, v := range history {
+		if aws.Int64Value(v.Version) != int64(i+1) || aws.StringValue(v.Value) != fmt.Sprintf("v%d", i+1) {
+			t.Errorf("expected version %d to be v%d, got version %d %s", i+1, i+1, aws.Int64Value(v.Version), aws.StringValue(v.Value))
+		}
+	}
+}
+
+func TestRestoreParameter(t *testing.T) {
+	backend := fake.New()
+	c := NewWithClient(backend.SSM())
+	path, name, key := "/application/api", "PORT", "alias/application/api"
+
+	if _, err := backend.SSM().PutParameter(&ssm.PutParameterInput{
+		Name:  aws.String("/application/api/PORT"),
+		Value: aws.String("8080"),
+		Type:  aws.String(ssm.ParameterTypeString),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutParameter(&path, &name, aws.String("9090"), &key); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := c.GetParameterHistory(&path, &name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RestoreParameter(&path, &name, history[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err = c.GetParameterHistory(&path, &name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := history[len(history)-1]
+	if aws.Int64Value(latest.Version) != 3 || aws.StringValue(latest.Value) != "8080" {
+		t.Errorf("expected version 3 to restore 8080, got version %d %s", aws.Int64Value(latest.Version), aws.StringValue(latest.Value))
+	}
+	if aws.StringValue(latest.Type) != ssm.ParameterTypeString || latest.KeyID != nil {
+		t.Errorf("expected the restored version to be a String without key, got %s with %s", aws.StringValue(latest.Type), aws.StringValue(latest.KeyID))
+	}
+}
+
+func TestDeleteParameter(t *testing.T) {
+	backend := fake.New()
+	c := NewWithClient(backend.SSM())
+	path, name, key := "/application/api", "OLD_FLAG", "alias/application/api"
+
+	if err := c.PutParameter(&path, &name, aws.String("true"), &key); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteParameter(&path, &name); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := c.GetParameterHistory(&path, &name)
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ssm.ErrCodeParameterNotFound {
+		t.Errorf("expected %s, got %v", ssm.ErrCodeParameterNotFound, err)
+	}
+	if err := c.DeleteParameter(&path, &name); err == nil {
+		t.Error("expected deleting a missing parameter to fail")
+	}
+}
+
+func TestUpdateParameter(t *testing.T) {
+	backend := fake.New()
+	c := NewWithClient(backend.SSM())
+	path, key := "/application/api", "alias/application/api"
+
+	if _, err := backend.SSM().PutParameter(&ssm.PutParameterInput{
+		Name:  aws.String("/application/api/PORT"),
+		Value: aws.String("8080"),
+		Type:  aws.String(ssm.ParameterTypeString),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutParameter(&path, aws.String("TOKEN"), aws.String("secret"), &key); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]*Ssmkeypairhistory{
+		"PORT":  {Value: aws.String("9090"), Type: aws.String(ssm.ParameterTypeString)},
+		"TOKEN": {Value: aws.String("rotated"), Type: aws.String(ssm.ParameterTypeSecureString), KeyID: &key},
+	} {
+		name := name
+		if err := c.UpdateParameter(&path, &name, expected.Value); err != nil {
+			t.Fatal(err)
+		}
+		history, err := c.GetParameterHistory(&path, &name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest := history[len(history)-1]
+		if aws.StringValue(latest.Value) != *expected.Value || aws.StringValue(latest.Type) != *expected.Type || aws.StringValue(latest.KeyID) != aws.StringValue(expected.KeyID) {
+			t.Errorf("expected %s to be the %s %s with %q, got the %s %s with %q", name, *expected.Type, *expected.Value, aws.StringValue(expected.KeyID),
+				aws.StringValue(latest.Type), aws.StringValue(latest.Value), aws.StringValue(latest.KeyID))
+		}
+	}
+
+	if err := c.UpdateParameter(&path, aws.String("MISSING"), aws.String("value")); err == nil {
+		t.Error("expected updating a missing parameter to fail")
+	}
+}
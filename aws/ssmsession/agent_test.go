@@ -0,0 +1,146 @@
+package ssmsession_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/fake"
+	"github.com/blinkist/skipper/aws/ssmsession"
+)
+
+// startAgent returns a backend running one task of the service web whose sessions are
+// served by handler, and a function starting a session with command
+func startAgent(t *testing.T, handler func(string, io.Reader, io.Writer) int) (func(command string) (string, string), func()) {
+	backend := fake.New()
+	backend.AddCluster("production")
+	if _, err := backend.AddContainerInstance("production"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.ECS().RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family: aws.String("web"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{{
+			Name:   aws.String("app"),
+			Image:  aws.String("api:v1"),
+			Memory: aws.Int64(128),
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.AddService("production", "web", "web:1", 1); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := backend.ECS().ListTasks(&ecs.ListTasksInput{Cluster: aws.String("production")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := httptest.NewServer(backend.SessionAgent(handler))
+	backend.SessionURL = "ws" + strings.TrimPrefix(agent.URL, "http")
+
+	execute := func(command string) (string, string) {
+		out, err := backend.ECS().ExecuteCommand(&ecs.ExecuteCommandInput{
+			Cluster:     aws.String("production"),
+			Task:        tasks.TaskArns[0],
+			Command:     aws.String(command),
+			Interactive: aws.Bool(true),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *out.Session.StreamUrl, *out.Session.TokenValue
+	}
+	return execute, agent.Close
+}
+
+func TestRunAgainstAgent(t *testing.T) {
+	commands := make(chan string, 1)
+	execute, stop := startAgent(t, func(command string, stdin io.Reader, stdout io.Writer) int {
+		commands <- command
+		line, _ := bufio.NewReader(stdin).ReadString('\n')
+		io.WriteString(stdout, "you said "+line)
+		return 0
+	})
+	defer stop()
+
+	s, err := ssmsession.Dial(execute("/bin/sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var stdout bytes.Buffer
+	code, err := s.Run(strings.NewReader("hello\n"), &stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "you said hello\n" {
+		t.Errorf("expected the input to be echoed, got %q", stdout.String())
+	}
+	if code != -1 {
+		t.Errorf("expected no exit code from the agent, got %d", code)
+	}
+	if command := <-commands; command != "/bin/sh" {
+		t.Errorf("expected /bin/sh to run, got %q", command)
+	}
+}
+
+func TestRunWrappedCommandAgainstAgent(t *testing.T) {
+	commands := make(chan string, 1)
+	execute, stop := startAgent(t, func(command string, stdin io.Reader, stdout io.Writer) int {
+		commands <- command
+		io.WriteString(stdout, "it's\r\nnot found\r\n")
+		return 127
+	})
+	defer stop()
+
+	command := `echo "it's" && missing`
+	s, err := ssmsession.Dial(execute(ssmsession.WrapCommand(command)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var stdout bytes.Buffer
+	out := ssmsession.NewExitCodeWriter(&stdout)
+	if _, err := s.Run(nil, out); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "it's\r\nnot found\r\n" {
+		t.Errorf("expected the output without the exit code line, got %q", stdout.String())
+	}
+	if code, err := out.ExitCode(); err != nil || code != 127 {
+		t.Errorf("expected exit code 127, got %d, %v", code, err)
+	}
+	if received := <-commands; received != command {
+		t.Errorf("expected the agent to run %q, got %q", command, received)
+	}
+}
+
+func TestRunWithInvalidToken(t *testing.T) {
+	execute, stop := startAgent(t, func(string, io.Reader, io.Writer) int {
+		t.Error("expected no command to run")
+		return 0
+	})
+	defer stop()
+
+	url, _ := execute("/bin/sh")
+	s, err := ssmsession.Dial(url, "expired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var stdout bytes.Buffer
+	if _, err := s.Run(nil, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "Session token is invalid") {
+		t.Errorf("expected the agent to refuse the token, got %q", stdout.String())
+	}
+}
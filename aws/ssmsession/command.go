@@ -0,0 +1,101 @@
+package ssmsession
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ECS Exec sessions always run the command in a TTY and the agent does not report how it
+// ended, so non-interactive commands are wrapped in a shell echoing the exit code after a marker.
+const (
+	exitMarker    = "__skipper_exit_code__="
+	wrapperPrefix = "/bin/sh -c '"
+	wrapperSuffix = "; echo " + exitMarker + "$?'"
+)
+
+// ErrNoExitCode is returned by ExitCodeWriter.ExitCode if the command output did not contain the marker
+var ErrNoExitCode = errors.New("command did not report an exit code")
+
+// WrapCommand returns a command running command in a shell and printing its exit code
+// in a line ExitCodeWriter understands
+func WrapCommand(command string) string {
+	return wrapperPrefix + strings.Replace(command, "'", `'\''`, -1) + wrapperSuffix
+}
+
+// UnwrapCommand returns the command wrapped by WrapCommand and true, or the command
+// itself and false if it is not wrapped
+func UnwrapCommand(command string) (string, bool) {
+	if !strings.HasPrefix(command, wrapperPrefix) || !strings.HasSuffix(command, wrapperSuffix) {
+		return command, false
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(command, wrapperPrefix), wrapperSuffix)
+	return strings.Replace(inner, `'\''`, "'", -1), true
+}
+
+// ExitCodeLine returns the line a wrapped command prints when it exits with code
+func ExitCodeLine(code int) string {
+	return exitMarker + strconv.Itoa(code) + "\r\n"
+}
+
+// ExitCodeWriter passes the output of a wrapped command through line by line and
+// filters out the exit code line
+type ExitCodeWriter struct {
+	w       io.Writer
+	line    []byte
+	code    int
+	hasCode bool
+}
+
+// NewExitCodeWriter returns a writer forwarding to w
+func NewExitCodeWriter(w io.Writer) *ExitCodeWriter {
+	return &ExitCodeWriter{w: w}
+}
+
+func (e *ExitCodeWriter) Write(p []byte) (int, error) {
+	e.line = append(e.line, p...)
+	for {
+		i := bytes.IndexByte(e.line, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := e.line[:i+1]
+		e.line = e.line[i+1:]
+		if err := e.writeLine(line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Flush writes an incomplete last line
+func (e *ExitCodeWriter) Flush() error {
+	line := e.line
+	e.line = nil
+	if len(line) == 0 {
+		return nil
+	}
+	return e.writeLine(line)
+}
+
+// ExitCode returns the exit code of the command once its output is complete
+func (e *ExitCodeWriter) ExitCode() (int, error) {
+	if !e.hasCode {
+		return -1, ErrNoExitCode
+	}
+	return e.code, nil
+}
+
+func (e *ExitCodeWriter) writeLine(line []byte) error {
+	text := strings.TrimRight(string(line), "\r\n")
+	if strings.HasPrefix(text, exitMarker) {
+		if code, err := strconv.Atoi(strings.TrimPrefix(text, exitMarker)); err == nil {
+			e.code = code
+			e.hasCode = true
+			return nil
+		}
+	}
+	_, err := e.w.Write(line)
+	return err
+}
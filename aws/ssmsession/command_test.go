@@ -0,0 +1,83 @@
+package ssmsession
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+)
+
+func TestWrapCommand(t *testing.T) {
+	for _, command := range []string{"ls -la", `echo 'it'\''s'`, "printf '%s\\n' \"a b\""} {
+		wrapped := WrapCommand(command)
+		unwrapped, ok := UnwrapCommand(wrapped)
+		if !ok || unwrapped != command {
+			t.Errorf("expected %q to unwrap to %q, got %q", wrapped, command, unwrapped)
+		}
+	}
+	if command, ok := UnwrapCommand("/bin/sh"); ok || command != "/bin/sh" {
+		t.Errorf("expected a plain command to be left alone, got %q", command)
+	}
+}
+
+func TestWrapCommandInShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell to run the wrapped command")
+	}
+	wrapped := WrapCommand(`echo "it's"; (exit 3)`)
+	output, err := exec.Command(sh, "-c", wrapped).Output()
+	if err != nil {
+		t.Fatalf("%s failed: %v", wrapped, err)
+	}
+
+	var buf bytes.Buffer
+	w := NewExitCodeWriter(&buf)
+	w.Write(output)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "it's\n" {
+		t.Errorf("expected the output without the marker, got %q", buf.String())
+	}
+	if code, err := w.ExitCode(); err != nil || code != 3 {
+		t.Errorf("expected exit code 3, got %d, %v", code, err)
+	}
+}
+
+func TestExitCodeWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewExitCodeWriter(&buf)
+	// the marker is split across writes like it is across output messages
+	for _, chunk := range []string{"first\r\nsec", "ond\r\n__skipper_", "exit_code__=42\r", "\n"} {
+		if n, err := w.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("expected %d bytes written, got %d, %v", len(chunk), n, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "first\r\nsecond\r\n" {
+		t.Errorf("expected the marker line to be filtered, got %q", buf.String())
+	}
+	if code, err := w.ExitCode(); err != nil || code != 42 {
+		t.Errorf("expected exit code 42, got %d, %v", code, err)
+	}
+}
+
+func TestExitCodeWriterWithoutMarker(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewExitCodeWriter(&buf)
+	w.Write([]byte("__skipper_exit_code__=none\nno newline"))
+	if buf.String() != "__skipper_exit_code__=none\n" {
+		t.Errorf("expected an invalid marker to be passed through, got %q", buf.String())
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "__skipper_exit_code__=none\nno newline" {
+		t.Errorf("expected the incomplete last line to be flushed, got %q", buf.String())
+	}
+	if code, err := w.ExitCode(); err != ErrNoExitCode || code != -1 {
+		t.Errorf("expected no exit code, got %d, %v", code, err)
+	}
+}
@@ -0,0 +1,164 @@
+package ssmsession
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message types of the Session Manager data channel
+const (
+	InputStreamData  = "input_stream_data"
+	OutputStreamData = "output_stream_data"
+	Acknowledge      = "acknowledge"
+	ChannelClosed    = "channel_closed"
+	StartPublication = "start_publication"
+	PausePublication = "pause_publication"
+)
+
+// PayloadType tells how the payload of a stream data message is to be read
+type PayloadType uint32
+
+// Payload types of stream data messages
+const (
+	Output                      PayloadType = 1
+	Error                       PayloadType = 2
+	Size                        PayloadType = 3
+	Parameter                   PayloadType = 4
+	HandshakeRequest            PayloadType = 5
+	HandshakeResponse           PayloadType = 6
+	HandshakeComplete           PayloadType = 7
+	EncryptionChallengeRequest  PayloadType = 8
+	EncryptionChallengeResponse PayloadType = 9
+	Flag                        PayloadType = 10
+	StdErr                      PayloadType = 11
+	ExitCode                    PayloadType = 12
+)
+
+const (
+	// headerLength is the length of the fixed header, it does not include the payload length field
+	headerLength      = 116
+	messageTypeLength = 32
+	schemaVersion     = 1
+)
+
+// AgentMessage is one binary message exchanged with the agent. On the wire it is laid out as
+//
+//	HeaderLength   uint32
+//	MessageType    [32]byte, padded with spaces
+//	SchemaVersion  uint32
+//	CreatedDate    uint64, milliseconds since epoch
+//	SequenceNumber int64
+//	Flags          uint64
+//	MessageId      [16]byte, least significant half of the UUID first
+//	PayloadDigest  [32]byte, SHA-256 of the payload
+//	PayloadType    uint32
+//	PayloadLength  uint32
+//	Payload        []byte
+//
+// all integers in big endian.
+type AgentMessage struct {
+	MessageType    string
+	SchemaVersion  uint32
+	CreatedDate    time.Time
+	SequenceNumber int64
+	Flags          uint64
+	MessageID      UUID
+	PayloadType    PayloadType
+	Payload        []byte
+}
+
+// NewAgentMessage returns a message with a random id created now
+func NewAgentMessage(messageType string, sequenceNumber int64, payloadType PayloadType, payload []byte) *AgentMessage {
+	return &AgentMessage{
+		MessageType:    messageType,
+		SchemaVersion:  schemaVersion,
+		CreatedDate:    time.Now(),
+		SequenceNumber: sequenceNumber,
+		MessageID:      NewUUID(),
+		PayloadType:    payloadType,
+		Payload:        payload,
+	}
+}
+
+// MarshalBinary encodes the message in the wire format
+func (m *AgentMessage) MarshalBinary() ([]byte, error) {
+	if len(m.MessageType) > messageTypeLength {
+		return nil, fmt.Errorf("message type %s is longer than %d bytes", m.MessageType, messageTypeLength)
+	}
+	buf := new(bytes.Buffer)
+	buf.Grow(headerLength + 4 + len(m.Payload))
+
+	digest := sha256.Sum256(m.Payload)
+	binary.Write(buf, binary.BigEndian, uint32(headerLength))
+	buf.WriteString(m.MessageType + strings.Repeat(" ", messageTypeLength-len(m.MessageType)))
+	binary.Write(buf, binary.BigEndian, m.SchemaVersion)
+	binary.Write(buf, binary.BigEndian, uint64(m.CreatedDate.UnixNano()/int64(time.Millisecond)))
+	binary.Write(buf, binary.BigEndian, m.SequenceNumber)
+	binary.Write(buf, binary.BigEndian, m.Flags)
+	buf.Write(m.MessageID[8:])
+	buf.Write(m.MessageID[:8])
+	buf.Write(digest[:])
+	binary.Write(buf, binary.BigEndian, uint32(m.PayloadType))
+	binary.Write(buf, binary.BigEndian, uint32(len(m.Payload)))
+	buf.Write(m.Payload)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a message in the wire format and verifies the payload digest
+func (m *AgentMessage) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLength+4 {
+		return errors.New("agent message is shorter than its header")
+	}
+	header := binary.BigEndian.Uint32(data[0:4])
+	if header != headerLength {
+		return fmt.Errorf("unexpected agent message header length %d", header)
+	}
+
+	m.MessageType = strings.TrimRight(string(bytes.TrimRight(data[4:36], "\x00")), " ")
+	m.SchemaVersion = binary.BigEndian.Uint32(data[36:40])
+	created := int64(binary.BigEndian.Uint64(data[40:48]))
+	m.CreatedDate = time.Unix(0, created*int64(time.Millisecond))
+	m.SequenceNumber = int64(binary.BigEndian.Uint64(data[48:56]))
+	m.Flags = binary.BigEndian.Uint64(data[56:64])
+	copy(m.MessageID[8:], data[64:72])
+	copy(m.MessageID[:8], data[72:80])
+	digest := data[80:112]
+	m.PayloadType = PayloadType(binary.BigEndian.Uint32(data[112:116]))
+
+	length := binary.BigEndian.Uint32(data[116:120])
+	if uint32(len(data)-headerLength-4) < length {
+		return fmt.Errorf("agent message payload is shorter than its length %d", length)
+	}
+	m.Payload = data[headerLength+4 : headerLength+4+int(length)]
+
+	if sum := sha256.Sum256(m.Payload); !bytes.Equal(sum[:], digest) {
+		return fmt.Errorf("payload digest of message %s does not match", m.MessageID)
+	}
+	return nil
+}
+
+// UUID is a RFC 4122 UUID in its canonical byte order
+type UUID [16]byte
+
+// NewUUID returns a random version 4 UUID
+func NewUUID() UUID {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+func (u UUID) String() string {
+	s := hex.EncodeToString(u[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
@@ -0,0 +1,84 @@
+package ssmsession
+
+// ClientVersion is the Session Manager plugin version skipper reports to the agent
+const ClientVersion = "1.2.0.0"
+
+// OpenDataChannelInput is the first, text, message sent on the websocket
+type OpenDataChannelInput struct {
+	MessageSchemaVersion string `json:"MessageSchemaVersion"`
+	RequestID            string `json:"RequestId"`
+	TokenValue           string `json:"TokenValue"`
+	ClientID             string `json:"ClientId"`
+	ClientVersion        string `json:"ClientVersion"`
+}
+
+// AcknowledgeContent is the payload of an acknowledge message
+type AcknowledgeContent struct {
+	MessageType         string `json:"AcknowledgedMessageType"`
+	MessageID           string `json:"AcknowledgedMessageId"`
+	SequenceNumber      int64  `json:"AcknowledgedMessageSequenceNumber"`
+	IsSequentialMessage bool   `json:"IsSequentialMessage"`
+}
+
+// Client actions the agent can request during the handshake
+const (
+	ActionSessionType   = "SessionType"
+	ActionKMSEncryption = "KMSEncryption"
+)
+
+// Statuses of processed client actions
+const (
+	ActionSuccess     = 1
+	ActionFailed      = 2
+	ActionUnsupported = 3
+)
+
+// RequestedClientAction is an action the agent asks the client to perform
+type RequestedClientAction struct {
+	ActionType       string      `json:"ActionType"`
+	ActionParameters interface{} `json:"ActionParameters"`
+}
+
+// HandshakeRequestPayload is sent by the agent once the data channel is open
+type HandshakeRequestPayload struct {
+	AgentVersion           string                  `json:"AgentVersion"`
+	RequestedClientActions []RequestedClientAction `json:"RequestedClientActions"`
+}
+
+// ProcessedClientAction is the client's answer to a requested action
+type ProcessedClientAction struct {
+	ActionType   string      `json:"ActionType"`
+	ActionStatus int         `json:"ActionStatus"`
+	ActionResult interface{} `json:"ActionResult"`
+	Error        string      `json:"Error"`
+}
+
+// HandshakeResponsePayload answers the handshake request
+type HandshakeResponsePayload struct {
+	ClientVersion          string                  `json:"ClientVersion"`
+	ProcessedClientActions []ProcessedClientAction `json:"ProcessedClientActions"`
+	Errors                 []string                `json:"Errors"`
+}
+
+// HandshakeCompletePayload ends the handshake, input is accepted from now on
+type HandshakeCompletePayload struct {
+	HandshakeTimeToComplete int64  `json:"HandshakeTimeToComplete"`
+	CustomerMessage         string `json:"CustomerMessage"`
+}
+
+// SizeData is the payload of a Size message resizing the remote terminal
+type SizeData struct {
+	Cols uint32 `json:"cols"`
+	Rows uint32 `json:"rows"`
+}
+
+// ChannelClosedPayload is sent by the agent when the session ends
+type ChannelClosedPayload struct {
+	MessageID     string `json:"MessageId"`
+	CreatedDate   string `json:"CreatedDate"`
+	DestinationID string `json:"DestinationId"`
+	SessionID     string `json:"SessionId"`
+	MessageType   string `json:"MessageType"`
+	SchemaVersion int    `json:"SchemaVersion"`
+	Output        string `json:"Output"`
+}
@@ -0,0 +1,333 @@
+// Package ssmsession implements the client side of the Session Manager data channel
+// protocol as used by ECS Exec, so skipper can talk to the SSM agent in a container
+// without the session-manager-plugin binary.
+package ssmsession
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// maxInputChunk is the largest payload of one input message
+	maxInputChunk = 1024
+	pingInterval  = 5 * time.Minute
+	ackFlags      = 3
+)
+
+// Conn is the part of a websocket connection the session uses, satisfied by *websocket.Conn
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// Session is an open data channel to the agent
+type Session struct {
+	conn     Conn
+	token    string
+	clientID UUID
+
+	writeMu sync.Mutex
+	seq     int64
+
+	expected  int64
+	pending   map[int64]*AgentMessage
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	sizeMu sync.Mutex
+	size   *SizeData
+
+	exitCode *int
+}
+
+// Dial connects to the stream url of a session returned by ExecuteCommand or StartSession
+// and opens the data channel with the session token
+func Dial(streamURL, token string) (*Session, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(streamURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %v", streamURL, err)
+	}
+	s := NewSession(conn, token)
+	if err := s.Open(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSession wraps an established connection, Open has to be called before Run
+func NewSession(conn Conn, token string) *Session {
+	return &Session{
+		conn:     conn,
+		token:    token,
+		clientID: NewUUID(),
+		pending:  make(map[int64]*AgentMessage),
+		ready:    make(chan struct{}),
+	}
+}
+
+// Open sends the token to the agent
+func (s *Session) Open() error {
+	data, err := json.Marshal(OpenDataChannelInput{
+		MessageSchemaVersion: "1.0",
+		RequestID:            NewUUID().String(),
+		TokenValue:           s.token,
+		ClientID:             s.clientID.String(),
+		ClientVersion:        ClientVersion,
+	})
+	if err != nil {
+		return err
+	}
+	return s.write(websocket.TextMessage, data)
+}
+
+// Close closes the connection
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// SetSize resizes the remote terminal, before the handshake is complete the size is
+// remembered and sent once it is
+func (s *Session) SetSize(cols, rows int) error {
+	s.sizeMu.Lock()
+	s.size = &SizeData{Cols: uint32(cols), Rows: uint32(rows)}
+	s.sizeMu.Unlock()
+
+	select {
+	case <-s.ready:
+		return s.sendSize()
+	default:
+		return nil
+	}
+}
+
+func (s *Session) sendSize() error {
+	s.sizeMu.Lock()
+	size := s.size
+	s.sizeMu.Unlock()
+	if size == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(size)
+	if err != nil {
+		return err
+	}
+	return s.send(Size, data)
+}
+
+// Run copies stdin to the remote process and its output to stdout until the agent
+// closes the channel. Input is held back until the handshake is complete. stdin may be nil.
+// The returned exit code is -1 if the agent did not report one.
+func (s *Session) Run(stdin io.Reader, stdout io.Writer) (int, error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	if stdin != nil {
+		go s.pumpInput(stdin, done)
+	}
+	go s.keepAlive(done)
+
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return s.result(), nil
+			}
+			return s.result(), err
+		}
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+
+		msg := &AgentMessage{}
+		if err := msg.UnmarshalBinary(data); err != nil {
+			return s.result(), err
+		}
+
+		switch msg.MessageType {
+		case OutputStreamData:
+			if err := s.receive(msg, stdout); err != nil {
+				return s.result(), err
+			}
+			// the agent may close the connection right after its last message, a failed
+			// acknowledge shows up as a read error if the connection is really gone
+			s.acknowledge(msg)
+		case ChannelClosed:
+			payload := ChannelClosedPayload{}
+			if err := json.Unmarshal(msg.Payload, &payload); err == nil && payload.Output != "" {
+				fmt.Fprintln(stdout, payload.Output)
+			}
+			return s.result(), nil
+		case Acknowledge, StartPublication, PausePublication:
+			// input is sent once and not retransmitted, so there is nothing to do
+		}
+	}
+}
+
+// receive handles stream data messages in sequence, buffering the ones arriving early
+func (s *Session) receive(msg *AgentMessage, stdout io.Writer) error {
+	if msg.SequenceNumber < s.expected {
+		return nil
+	}
+	s.pending[msg.SequenceNumber] = msg
+
+	for {
+		next, ok := s.pending[s.expected]
+		if !ok {
+			return nil
+		}
+		delete(s.pending, s.expected)
+		s.expected++
+		if err := s.handle(next, stdout); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Session) handle(msg *AgentMessage, stdout io.Writer) error {
+	switch msg.PayloadType {
+	case Output, StdErr:
+		_, err := stdout.Write(msg.Payload)
+		return err
+	case HandshakeRequest:
+		return s.handshake(msg.Payload)
+	case HandshakeComplete:
+		s.readyOnce.Do(func() { close(s.ready) })
+		return s.sendSize()
+	case ExitCode:
+		code, err := strconv.Atoi(strings.TrimSpace(string(msg.Payload)))
+		if err != nil {
+			return fmt.Errorf("invalid exit code %q: %v", msg.Payload, err)
+		}
+		s.exitCode = &code
+	}
+	return nil
+}
+
+// handshake accepts the session type and declines everything else, skipper does not
+// implement KMS encryption of the data channel
+func (s *Session) handshake(payload []byte) error {
+	request := HandshakeRequestPayload{}
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return fmt.Errorf("invalid handshake request: %v", err)
+	}
+
+	response := HandshakeResponsePayload{ClientVersion: ClientVersion, Errors: []string{}}
+	for _, action := range request.RequestedClientActions {
+		processed := ProcessedClientAction{ActionType: action.ActionType, ActionStatus: ActionSuccess}
+		if action.ActionType != ActionSessionType {
+			processed.ActionStatus = ActionUnsupported
+			processed.Error = fmt.Sprintf("%s is not supported by skipper", action.ActionType)
+			response.Errors = append(response.Errors, processed.Error)
+		}
+		response.ProcessedClientActions = append(response.ProcessedClientActions, processed)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return s.send(HandshakeResponse, data)
+}
+
+func (s *Session) acknowledge(msg *AgentMessage) error {
+	data, err := json.Marshal(AcknowledgeContent{
+		MessageType:         msg.MessageType,
+		MessageID:           msg.MessageID.String(),
+		SequenceNumber:      msg.SequenceNumber,
+		IsSequentialMessage: true,
+	})
+	if err != nil {
+		return err
+	}
+	ack := NewAgentMessage(Acknowledge, 0, 0, data)
+	ack.Flags = ackFlags
+	return s.writeMessage(ack)
+}
+
+func (s *Session) pumpInput(stdin io.Reader, done chan struct{}) {
+	select {
+	case <-s.ready:
+	case <-done:
+		return
+	}
+
+	buf := make([]byte, maxInputChunk)
+	for {
+		n, err := stdin.Read(buf)
+		if n > 0 {
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			if s.send(Output, data) != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Session) keepAlive(done chan struct{}) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if s.write(websocket.PingMessage, []byte("keepalive")) != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// send writes an input stream message with the next sequence number
+func (s *Session) send(payloadType PayloadType, payload []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	msg := NewAgentMessage(InputStreamData, s.seq, payloadType, payload)
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		return err
+	}
+	s.seq++
+	return nil
+}
+
+func (s *Session) writeMessage(msg *AgentMessage) error {
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return s.write(websocket.BinaryMessage, data)
+}
+
+// write serializes writes, websocket connections support only one concurrent writer
+func (s *Session) write(messageType int, data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteMessage(messageType, data)
+}
+
+func (s *Session) result() int {
+	if s.exitCode == nil {
+		return -1
+	}
+	return *s.exitCode
+}
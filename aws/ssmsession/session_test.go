@@ -0,0 +1,181 @@
+package ssmsession
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// scriptedConn plays back the messages of an agent and records what the session writes
+type scriptedConn struct {
+	t        *testing.T
+	messages [][]byte
+
+	mu      sync.Mutex
+	written []*AgentMessage
+	texts   [][]byte
+}
+
+func (c *scriptedConn) play(msg *AgentMessage) {
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.messages = append(c.messages, data)
+}
+
+func (c *scriptedConn) ReadMessage() (int, []byte, error) {
+	if len(c.messages) == 0 {
+		return 0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	}
+	data := c.messages[0]
+	c.messages = c.messages[1:]
+	return websocket.BinaryMessage, data, nil
+}
+
+func (c *scriptedConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if messageType == websocket.TextMessage {
+		c.texts = append(c.texts, data)
+		return nil
+	}
+	msg := &AgentMessage{}
+	if err := msg.UnmarshalBinary(data); err != nil {
+		c.t.Errorf("invalid message written: %v", err)
+		return err
+	}
+	c.written = append(c.written, msg)
+	return nil
+}
+
+func (c *scriptedConn) Close() error {
+	return nil
+}
+
+func (c *scriptedConn) payload(payloadType PayloadType, v interface{}) *AgentMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return NewAgentMessage(OutputStreamData, 0, payloadType, data)
+}
+
+func TestSessionRun(t *testing.T) {
+	conn := &scriptedConn{t: t}
+	request := conn.payload(HandshakeRequest, HandshakeRequestPayload{
+		AgentVersion: "3.0.0.0",
+		RequestedClientActions: []RequestedClientAction{
+			{ActionType: ActionSessionType, ActionParameters: map[string]string{"SessionType": "InteractiveCommands"}},
+			{ActionType: ActionKMSEncryption},
+		},
+	})
+	complete := conn.payload(HandshakeComplete, HandshakeCompletePayload{})
+	complete.SequenceNumber = 1
+	first := NewAgentMessage(OutputStreamData, 2, Output, []byte("it's "))
+	second := NewAgentMessage(OutputStreamData, 3, StdErr, []byte("done\r\n"))
+	exit := NewAgentMessage(OutputStreamData, 4, ExitCode, []byte("3\n"))
+	closed := NewAgentMessage(ChannelClosed, 0, 0, []byte(`{"Output":"Exiting session."}`))
+
+	// the second output and the exit code arrive before the first output, which arrives twice
+	for _, msg := range []*AgentMessage{request, complete, second, exit, first, first, closed} {
+		conn.play(msg)
+	}
+
+	s := NewSession(conn, "token")
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetSize(80, 24); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	code, err := s.Run(nil, &stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 3 {
+		t.Errorf("expected exit code 3, got %d", code)
+	}
+	if stdout.String() != "it's done\r\nExiting session.\n" {
+		t.Errorf("expected the output in sequence, got %q", stdout.String())
+	}
+
+	open := OpenDataChannelInput{}
+	if len(conn.texts) != 1 || json.Unmarshal(conn.texts[0], &open) != nil || open.TokenValue != "token" {
+		t.Fatalf("expected the token to be sent first, got %q", conn.texts)
+	}
+
+	var inputs []*AgentMessage
+	var acked []int64
+	for _, msg := range conn.written {
+		switch msg.MessageType {
+		case InputStreamData:
+			inputs = append(inputs, msg)
+		case Acknowledge:
+			content := AcknowledgeContent{}
+			if err := json.Unmarshal(msg.Payload, &content); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Flags != ackFlags || content.MessageType != OutputStreamData || !content.IsSequentialMessage {
+				t.Errorf("unexpected acknowledge %+v with flags %d", content, msg.Flags)
+			}
+			acked = append(acked, content.SequenceNumber)
+		}
+	}
+	// every stream data message is acknowledged in the order it arrived, the duplicate too
+	if len(acked) != 6 || acked[0] != 0 || acked[1] != 1 || acked[2] != 3 || acked[3] != 4 || acked[4] != 2 || acked[5] != 2 {
+		t.Errorf("expected acknowledges of 0, 1, 3, 4, 2, 2, got %v", acked)
+	}
+
+	if len(inputs) != 2 {
+		t.Fatalf("expected the handshake response and the size, got %d messages", len(inputs))
+	}
+	if inputs[0].PayloadType != HandshakeResponse || inputs[0].SequenceNumber != 0 {
+		t.Fatalf("expected the handshake response first, got payload type %d", inputs[0].PayloadType)
+	}
+	response := HandshakeResponsePayload{}
+	if err := json.Unmarshal(inputs[0].Payload, &response); err != nil {
+		t.Fatal(err)
+	}
+	actions := response.ProcessedClientActions
+	if len(actions) != 2 || actions[0].ActionStatus != ActionSuccess || actions[1].ActionStatus != ActionUnsupported || len(response.Errors) != 1 {
+		t.Errorf("expected the session type to be accepted and KMS encryption declined, got %+v", response)
+	}
+	size := SizeData{}
+	if inputs[1].PayloadType != Size || inputs[1].SequenceNumber != 1 || json.Unmarshal(inputs[1].Payload, &size) != nil || size.Cols != 80 || size.Rows != 24 {
+		t.Errorf("expected the remembered size once the handshake is complete, got %q", inputs[1].Payload)
+	}
+}
+
+func TestSessionRunInvalidExitCode(t *testing.T) {
+	conn := &scriptedConn{t: t}
+	conn.play(NewAgentMessage(OutputStreamData, 0, ExitCode, []byte("killed")))
+
+	code, err := NewSession(conn, "token").Run(nil, &bytes.Buffer{})
+	if err == nil || code != -1 {
+		t.Errorf("expected an invalid exit code to fail, got %d, %v", code, err)
+	}
+}
+
+func TestAgentMessageDigest(t *testing.T) {
+	data, err := NewAgentMessage(OutputStreamData, 7, Output, []byte("hello")).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &AgentMessage{}
+	if err := msg.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if msg.MessageType != OutputStreamData || msg.SequenceNumber != 7 || string(msg.Payload) != "hello" {
+		t.Errorf("expected the message to round-trip, got %+v", msg)
+	}
+
+	data[len(data)-1] = 'O'
+	if err := msg.UnmarshalBinary(data); err == nil {
+		t.Error("expected a changed payload to fail the digest check")
+	}
+}
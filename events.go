@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Values of --progress
+const (
+	progressLive = "live"
+	progressJSON = "json"
+)
+
+var argProgress string
+
+// eventOutput is where the JSON events are written, the stdout skipper started with
+var eventOutput io.Writer = os.Stdout
+
+// separateProgress makes stdout carry nothing but the events with --progress json, all
+// other output of the command goes to stderr. Commands which deploy call it first.
+func separateProgress() {
+	if argProgress == progressJSON {
+		eventOutput = os.Stdout
+		os.Stdout = os.Stderr
+	}
+}
+
+// waitForDeployment waits until the deployment of the task definition is stable, rendering
+// its events as --progress asks for
+func waitForDeployment(ecs ecsclient.Client, cluster, service, arn string) error {
+	events, done := renderEvents()
+	err := ecs.WaitWithEvents(&cluster, &service, &arn, events)
+	close(events)
+	<-done
+	return err
+}
+
+// renderEvents prints the events sent on the returned channel until it is closed, as
+// live progress or as JSON lines. done is closed once the last event is printed.
+func renderEvents() (chan<- *ecsclient.Event, <-chan struct{}) {
+	events := make(chan *ecsclient.Event)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		if argProgress == progressJSON {
+			enc := json.NewEncoder(eventOutput)
+			for e := range events {
+				enc.Encode(e)
+			}
+			return
+		}
+
+		// on a terminal the counts are kept on one line which the other events scroll past,
+		// unless several services print their events
+		tty := terminal.IsTerminal(int(os.Stdout.Fd())) && !multiService
+		prefix := ""
+		status := ""
+		for e := range events {
+			if multiService {
+				prefix = fmt.Sprintf("%s/%s  ", e.Cluster, e.Service)
+			}
+			if e.Type == ecsclient.EventProgress && tty {
+				status = fmt.Sprintf("%s  %s", e.Time.Local().Format("15:04:05"), e)
+				fmt.Printf("\r\033[K%s", status)
+				continue
+			}
+			if status != "" {
+				fmt.Print("\r\033[K")
+			}
+			fmt.Printf("%s  %s%s\n", e.Time.Local().Format("15:04:05"), prefix, e)
+			if status != "" && e.Type != ecsclient.EventSteadyState && e.Type != ecsclient.EventTimeout && e.Type != ecsclient.EventDeploymentFailed {
+				fmt.Print(status)
+			}
+		}
+		if status != "" {
+			fmt.Print("\r\033[K")
+		}
+	}()
+	return events, done
+}
+
+// checkProgress validates --progress
+func checkProgress() error {
+	if argProgress != progressLive && argProgress != progressJSON {
+		return fmt.Errorf("--progress must be %s or %s, not %s", progressLive, progressJSON, argProgress)
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVarP(&argProgress, "progress", "", progressLive, "How deployment progress is shown: live or json, one event per line on stdout and all other output on stderr")
+}
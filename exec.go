@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/ssmsession"
+	"github.com/blinkist/skipper/helpers"
+)
+
+var (
+	argExecContainer string
+	argExecTask      string
+	argExecCommand   string
+	argExecNoTTY     bool
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec [cluster] [service]",
+	Short: "Run a command in a running container using ECS Exec",
+	Long: `
+Opens an interactive shell, or runs --command, in a container of a running task
+through ECS Exec and Session Manager. No keypair, debug instance or SSH access
+to the container instances is needed, but ECS Exec has to be enabled on the
+service and the task role has to allow the ssmmessages actions.
+
+With --no-tty the command runs without attaching the terminal and skipper exits
+with the exit code of the command:
+
+  skipper exec production api --container app --command "bin/rails db:migrate:status" --no-tty
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ecs := ecsclient.New()
+		cluster, service := helpers.ServicePicker(ecs, args)
+
+		code, err := ExecInService(ecs, cluster, service)
+		if err != nil {
+			fmt.Printf("error executing command: %v\n", err)
+			os.Exit(helpers.ExitCode(err))
+		}
+		os.Exit(code)
+	},
+}
+
+// ExecInService runs the configured command in a chosen container of the service and
+// returns its exit code
+func ExecInService(ecs ecsclient.Client, cluster, service string) (int, error) {
+	livetask, err := SelectTask(ecs, cluster, service, argExecTask)
+	if err != nil {
+		return -1, err
+	}
+
+	container, err := helpers.ContainerPicker(livetask, argExecContainer)
+	if err != nil {
+		return -1, err
+	}
+
+	return ExecInContainer(ecs, cluster, *livetask.TaskArn, *container.Name, argExecCommand, !argExecNoTTY)
+}
+
+// ExecInContainer starts an ECS Exec session and attaches the terminal to it if interactive,
+// otherwise the command's output is printed and its exit code returned
+func ExecInContainer(ecs ecsclient.Client, cluster, taskArn, container, command string, interactive bool) (int, error) {
+	if !interactive {
+		command = ssmsession.WrapCommand(command)
+	}
+
+	session, err := ecs.ExecuteCommand(&cluster, &taskArn, &container, &command)
+	if err != nil {
+		return -1, err
+	}
+
+	s, err := ssmsession.Dial(*session.StreamUrl, *session.TokenValue)
+	if err != nil {
+		return -1, err
+	}
+	defer s.Close()
+
+	if !interactive {
+		out := ssmsession.NewExitCodeWriter(os.Stdout)
+		if _, err := s.Run(nil, out); err != nil {
+			return -1, err
+		}
+		if err := out.Flush(); err != nil {
+			return -1, err
+		}
+		return out.ExitCode()
+	}
+
+	logger.Printf("Starting session in container %s of task %s", container, path.Base(taskArn))
+
+	var stdin io.Reader = os.Stdin
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return -1, err
+		}
+		defer terminal.Restore(fd, state)
+
+		resize := func() {
+			if cols, rows, err := terminal.GetSize(fd); err == nil {
+				s.SetSize(cols, rows)
+			}
+		}
+		resize()
+
+		winch := make(chan os.Signal, 1)
+		signal.Notify(winch, syscall.SIGWINCH)
+		defer signal.Stop(winch)
+		go func() {
+			for range winch {
+				resize()
+			}
+		}()
+	}
+
+	code, err := s.Run(stdin, os.Stdout)
+	if code < 0 {
+		code = 0
+	}
+	return code, err
+}
+
+func init() {
+	RootCmd.AddCommand(execCmd)
+	execCmd.Flags().StringVarP(&argExecContainer, "container", "c", "", "Name of the container, asks if the task runs more than one")
+	execCmd.Flags().StringVarP(&argExecTask, "task", "t", "", "Task id or prefix, asks if not set")
+	execCmd.Flags().StringVarP(&argExecCommand, "command", "", "/bin/sh", "Command to run in the container")
+	execCmd.Flags().BoolVarP(&argExecNoTTY, "no-tty", "T", false, "Run the command without attaching the terminal and exit with its exit code")
+}
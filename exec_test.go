@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestExecWithoutTTY(t *testing.T) {
+	defer testEnv(t)()
+	backend, client := newTestBackend(t)
+	commands := make(chan string, 1)
+	agent := httptest.NewServer(backend.SessionAgent(func(command string, stdin io.Reader, stdout io.Writer) int {
+		commands <- command
+		io.WriteString(stdout, "it's broken\r\n")
+		return 2
+	}))
+	defer agent.Close()
+	backend.SessionURL = "ws" + strings.TrimPrefix(agent.URL, "http")
+
+	tasks, err := client.GetContainerInstances(aws.String("production"), aws.String("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := `grep -q 'it'"'"'s' /etc/motd`
+	var code int
+	printed := captureStdout(t, func() {
+		code, err = ExecInContainer(client, "production", *tasks[0].TaskArn, "app", command, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 2 {
+		t.Errorf("expected the exit code of the command, got %d", code)
+	}
+	if printed != "it's broken\r\n" {
+		t.Errorf("expected the output without the exit code line, got %q", printed)
+	}
+	if received := <-commands; received != command {
+		t.Errorf("expected %q to run in %s, got %q", command, path.Base(*tasks[0].TaskArn), received)
+	}
+}
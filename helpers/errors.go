@@ -0,0 +1,129 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// Exit codes of skipper, scripts can tell why a command failed by them
+const (
+	ExitFailure  = 1
+	ExitUsage    = 2
+	ExitAborted  = 3
+	ExitNotFound = 4
+	ExitAWS      = 5
+)
+
+// ErrAborted is returned when the user, or the lack of --yes, did not confirm
+var ErrAborted = errors.New("aborted")
+
+// notFoundCodes are the AWS error codes of resources which do not exist
+var notFoundCodes = map[string]bool{
+	"ClusterNotFoundException":    true,
+	"ServiceNotFoundException":    true,
+	"ParameterNotFound":           true,
+	"ParameterVersionNotFound":    true,
+	"RepositoryNotFoundException": true,
+	"ImageNotFoundException":      true,
+	"TargetGroupNotFound":         true,
+}
+
+// UsageError is an invalid or missing argument
+type UsageError struct {
+	msg string
+}
+
+func (e *UsageError) Error() string {
+	return e.msg
+}
+
+// Usagef returns a UsageError
+func Usagef(format string, a ...interface{}) error {
+	return &UsageError{msg: fmt.Sprintf(format, a...)}
+}
+
+// NotFoundError is a cluster, service, container or parameter which does not exist
+type NotFoundError struct {
+	msg string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.msg
+}
+
+// NotFound reports that the error is about something which does not exist
+func (e *NotFoundError) NotFound() bool {
+	return true
+}
+
+// NotFoundf returns a NotFoundError
+func NotFoundf(format string, a ...interface{}) error {
+	return &NotFoundError{msg: fmt.Sprintf(format, a...)}
+}
+
+// wrappedError adds context to an error while keeping its exit code
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e *wrappedError) Error() string {
+	return e.msg
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+// Wrap prefixes the message of err, the exit code stays the one of err
+func Wrap(err error, format string, a ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return &wrappedError{msg: fmt.Sprintf(format, a...) + ": " + err.Error(), err: err}
+}
+
+// ExitCode returns the exit code for err. Errors with a NotFound() bool method which
+// returns true, like the ones of the AWS clients, are not found errors.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	for e := err; e != nil; {
+		if e == ErrAborted {
+			return ExitAborted
+		}
+		switch t := e.(type) {
+		case *UsageError:
+			return ExitUsage
+		case interface{ NotFound() bool }:
+			if t.NotFound() {
+				return ExitNotFound
+			}
+		case awserr.Error:
+			if notFoundCodes[t.Code()] {
+				return ExitNotFound
+			}
+			return ExitAWS
+		}
+		u, ok := e.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		e = u.Unwrap()
+	}
+	return ExitFailure
+}
+
+// Fatal prints err to stderr and exits with its exit code. An abort is not reported as an error.
+func Fatal(err error) {
+	if ExitCode(err) == ExitAborted {
+		fmt.Fprintln(os.Stderr, "exiting")
+	} else {
+		fmt.Fprintf(os.Stderr, "[error] %s\n", err)
+	}
+	os.Exit(ExitCode(err))
+}
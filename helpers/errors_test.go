@@ -0,0 +1,61 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// notFound is an error of a client which tells it is about something missing
+type notFound bool
+
+func (e notFound) Error() string {
+	return "not found"
+}
+
+func (e notFound) NotFound() bool {
+	return bool(e)
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{nil, 0},
+		{errors.New("failed"), ExitFailure},
+		{fmt.Errorf("failed: %v", ErrAborted), ExitFailure},
+		{ErrAborted, ExitAborted},
+		{Usagef("--output must be table, json or yaml"), ExitUsage},
+		{NotFoundf("cluster production not found"), ExitNotFound},
+		{notFound(true), ExitNotFound},
+		{notFound(false), ExitFailure},
+		{awserr.New("ServiceNotFoundException", "Service not found.", nil), ExitNotFound},
+		{awserr.New("ParameterNotFound", "", nil), ExitNotFound},
+		{awserr.New("AccessDeniedException", "not authorized", nil), ExitAWS},
+		{awserr.New("ThrottlingException", "Rate exceeded", errors.New("throttled")), ExitAWS},
+		{awserr.NewRequestFailure(awserr.New("ClusterNotFoundException", "Cluster not found.", nil), 400, "id"), ExitNotFound},
+		{Wrap(ErrAborted, "update web"), ExitAborted},
+		{Wrap(Usagef("invalid"), "update web"), ExitUsage},
+		{Wrap(Wrap(awserr.New("TargetGroupNotFound", "", nil), "describe"), "status of web"), ExitNotFound},
+		{Wrap(awserr.New("AccessDeniedException", "", nil), "update web"), ExitAWS},
+		{Wrap(errors.New("failed"), "update web"), ExitFailure},
+	}
+	for _, test := range tests {
+		if code := ExitCode(test.err); code != test.expected {
+			t.Errorf("%v: expected exit code %d, got %d", test.err, test.expected, code)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if Wrap(nil, "update web") != nil {
+		t.Error("expected wrapping nil to be nil")
+	}
+	err := Wrap(NotFoundf("service web not found"), "update %s", "production")
+	if err.Error() != "update production: service web not found" {
+		t.Errorf("expected the message to be prefixed, got %s", err)
+	}
+}
@@ -0,0 +1,174 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+// fuzzyMatch is an option matching the query of the picker
+type fuzzyMatch struct {
+	option string
+	score  int
+	// recent is the position of the option in the recent choices, -1 if it is not one
+	recent int
+}
+
+// FuzzyPick lets the user filter the options by typing and pick one with the arrow keys
+// and enter. The recent options are ranked first, the latest first. Escape and ctrl-c
+// abort.
+func FuzzyPick(options, recent []string, title string) (string, error) {
+	term, err := OpenTerminal()
+	if err != nil {
+		return "", err
+	}
+	defer term.Close()
+
+	query := []rune{}
+	cursor := 0
+	matches := fuzzyFilter(options, recent, "")
+	for {
+		drawPicker(term, title, string(query), matches, cursor, len(options))
+
+		key, err := term.ReadKey()
+		if err != nil {
+			return "", err
+		}
+		switch key.Code {
+		case KeyInterrupt, KeyEscape, KeyEOF:
+			return "", ErrAborted
+		case KeyEnter:
+			if len(matches) > 0 {
+				return matches[cursor].option, nil
+			}
+		case KeyUp:
+			cursor--
+		case KeyDown, KeyTab:
+			cursor++
+		case KeyPageUp:
+			_, height := term.Size()
+			cursor -= height / 2
+		case KeyPageDown:
+			_, height := term.Size()
+			cursor += height / 2
+		case KeyBackspace:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				matches = fuzzyFilter(options, recent, string(query))
+				cursor = 0
+			}
+		case KeyRune:
+			query = append(query, key.Rune)
+			matches = fuzzyFilter(options, recent, string(query))
+			cursor = 0
+		}
+		if cursor >= len(matches) {
+			cursor = len(matches) - 1
+		}
+		if cursor < 0 {
+			cursor = 0
+		}
+	}
+}
+
+// drawPicker renders the title, the query and the matches fitting the screen, scrolled
+// to the cursor
+func drawPicker(term *Terminal, title, query string, matches []fuzzyMatch, cursor, total int) {
+	_, height := term.Size()
+	selected := color.New(color.ReverseVideo).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+
+	lines := []string{
+		fmt.Sprintf("%s %s", title, faint(fmt.Sprintf("(%d/%d, esc to abort)", len(matches), total))),
+		"> " + query + "_",
+	}
+	rows := height - len(lines)
+	if rows < 1 {
+		rows = 1
+	}
+	start := 0
+	if cursor >= rows {
+		start = cursor - rows + 1
+	}
+	for i := start; i < len(matches) && i < start+rows; i++ {
+		if i == cursor {
+			lines = append(lines, selected("> "+matches[i].option))
+		} else {
+			lines = append(lines, "  "+matches[i].option)
+		}
+	}
+	term.Draw(lines)
+}
+
+// fuzzyFilter returns the options matching the query, the recent ones first, then the
+// better matches and the others by name
+func fuzzyFilter(options, recent []string, query string) []fuzzyMatch {
+	positions := make(map[string]int, len(recent))
+	for i, r := range recent {
+		if _, ok := positions[r]; !ok {
+			positions[r] = i
+		}
+	}
+
+	matches := make([]fuzzyMatch, 0, len(options))
+	for _, option := range options {
+		score, ok := FuzzyScore(query, option)
+		if !ok {
+			continue
+		}
+		m := fuzzyMatch{option: option, score: score, recent: -1}
+		if i, ok := positions[option]; ok {
+			m.recent = i
+		}
+		matches = append(matches, m)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if (a.recent >= 0) != (b.recent >= 0) {
+			return a.recent >= 0
+		}
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.recent != b.recent {
+			return a.recent < b.recent
+		}
+		return a.option < b.option
+	})
+	return matches
+}
+
+// FuzzyScore reports whether every word of the query matches s, its characters appearing
+// in s in order regardless of case. Characters following each other or starting a word
+// of s score higher.
+func FuzzyScore(query, s string) (int, bool) {
+	text := []rune(strings.ToLower(s))
+	total := 0
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		pattern := []rune(word)
+		score, matched, previous := 0, 0, -2
+		for i := 0; i < len(text) && matched < len(pattern); i++ {
+			if text[i] != pattern[matched] {
+				continue
+			}
+			score++
+			if i == previous+1 {
+				score += 2
+			}
+			if i == 0 || !unicode.IsLetter(text[i-1]) && !unicode.IsDigit(text[i-1]) {
+				score += 3
+			}
+			previous = i
+			matched++
+		}
+		if matched < len(pattern) {
+			return 0, false
+		}
+		total += score
+	}
+	return total, true
+}
@@ -0,0 +1,65 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query, s string
+		score    int
+		ok       bool
+	}{
+		{"", "prod-books-web", 0, true},
+		// b starts the name, w a word, o follows b
+		{"bw", "books-web", 8, true},
+		{"bo", "books-web", 7, true},
+		{"BW", "books-web", 8, true},
+		{"bw", "BOOKS-WEB", 8, true},
+		{"sb", "books", 0, false},
+		{"xyz", "books-web", 0, false},
+		{"web books", "prod-books-web", 26, true},
+		{"web users", "prod-books-web", 0, false},
+	}
+	for _, test := range tests {
+		score, ok := FuzzyScore(test.query, test.s)
+		if ok != test.ok || score != test.score {
+			t.Errorf("%q in %q: expected %d, %t, got %d, %t", test.query, test.s, test.score, test.ok, score, ok)
+		}
+	}
+
+	consecutive, _ := FuzzyScore("web", "prod-books-web")
+	scattered, _ := FuzzyScore("web", "prod-worker-beta")
+	if consecutive <= scattered {
+		t.Errorf("expected consecutive characters to score higher, got %d and %d", consecutive, scattered)
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	options := []string{"staging-books-web", "prod-worker-beta", "prod-users-web", "prod-books-worker", "prod-books-web"}
+
+	tests := []struct {
+		query    string
+		recent   []string
+		expected string
+	}{
+		{"", nil, "prod-books-web,prod-books-worker,prod-users-web,prod-worker-beta,staging-books-web"},
+		{"web", nil, "prod-books-web,prod-users-web,staging-books-web,prod-worker-beta"},
+		{"web", []string{"prod-worker-beta"}, "prod-worker-beta,prod-books-web,prod-users-web,staging-books-web"},
+		// the latest recent choice comes first, duplicates and gone options are ignored
+		{"", []string{"gone", "prod-users-web", "staging-books-web", "prod-users-web"}, "prod-users-web,staging-books-web,prod-books-web,prod-books-worker,prod-worker-beta"},
+		{"books web", []string{"staging-books-web"}, "staging-books-web,prod-books-web"},
+		{"nothing", []string{"prod-users-web"}, ""},
+	}
+	for _, test := range tests {
+		matches := fuzzyFilter(options, test.recent, test.query)
+		names := make([]string, len(matches))
+		for i, m := range matches {
+			names[i] = m.option
+		}
+		if strings.Join(names, ",") != test.expected {
+			t.Errorf("%q with recent %v: expected %s, got %s", test.query, test.recent, test.expected, strings.Join(names, ","))
+		}
+	}
+}
@@ -3,8 +3,7 @@ package helpers
 import (
 	"bufio"
 	"fmt"
-
-	"log"
+	"io"
 	"os"
 	"sort"
 	"strings"
@@ -14,7 +13,26 @@ import (
 	"strconv"
 )
 
-func ServicePicker(ecs *ecsclient.Ecsclient, args []string) (string, string) {
+// NonInteractive makes prompts for missing arguments errors, confirmations are only
+// given by AssumeYes then
+var NonInteractive bool
+
+// AssumeYes answers every confirmation with yes
+var AssumeYes bool
+
+// ServicePicker returns the cluster and service of the arguments, asking for the missing
+// ones. It exits if they can not be found or asked for.
+func ServicePicker(ecs ecsclient.Client, args []string) (string, string) {
+	cluster, service, err := PickService(ecs, args)
+	if err != nil {
+		Fatal(err)
+	}
+	return cluster, service
+}
+
+// PickService returns the cluster and service of the arguments, asking for the missing
+// ones unless NonInteractive is set
+func PickService(ecs ecsclient.Client, args []string) (string, string, error) {
 	var cluster, service string
 	if len(args) > 0 {
 		cluster = args[0]
@@ -27,18 +45,39 @@ func ServicePicker(ecs *ecsclient.Ecsclient, args []string) (string, string) {
 
 	names, err := ecs.GetClusterNames()
 	if err != nil {
-		log.Fatalf("Error getting clusters %v", err)
+		return "", "", Wrap(err, "could not list clusters")
 	}
 
-	for _, clusterName := range names {
-		services, err := ecs.ListServices(&clusterName)
-
+	for i := range names {
+		services, err := ecs.ListServices(&names[i])
 		if err != nil {
-			log.Fatalf("Error listing services %v", err)
+			return "", "", Wrap(err, "could not list the services of %s", names[i])
 		}
 
 		if len(services) > 0 {
-			clusterAndServices[clusterName] = services
+			clusterAndServices[names[i]] = services
+		}
+	}
+
+	// on a terminal the services of all clusters are picked from one list, the recently
+	// used ones first
+	fuzzy := !NonInteractive && IsTerminal()
+	recent := RecentChoices("service")
+	if cluster == "" && fuzzy {
+		options := make([]string, 0)
+		for name, services := range clusterAndServices {
+			for _, s := range services {
+				options = append(options, name+"/"+s)
+			}
+		}
+		choice, err := pickRecent(options, recent, "service")
+		if err != nil {
+			return "", "", err
+		}
+		parts := strings.SplitN(choice, "/", 2)
+		cluster = parts[0]
+		if service == "" {
+			service = parts[1]
 		}
 	}
 
@@ -48,30 +87,107 @@ func ServicePicker(ecs *ecsclient.Ecsclient, args []string) (string, string) {
 			clusternames = append(clusternames, k)
 		}
 
-		cluster = PickOption(clusternames, "Please choose a cluster")
-
+		if cluster, err = ChooseOption(clusternames, "cluster"); err != nil {
+			return "", "", err
+		}
+	}
+	services, ok := clusterAndServices[cluster]
+	if !ok {
+		return "", "", NotFoundf("cluster %s not found or without services", cluster)
+	}
+	if service == "" && fuzzy {
+		recentOfCluster := make([]string, 0, len(recent))
+		for _, r := range recent {
+			if strings.HasPrefix(r, cluster+"/") {
+				recentOfCluster = append(recentOfCluster, strings.TrimPrefix(r, cluster+"/"))
+			}
+		}
+		if service, err = pickRecent(services, recentOfCluster, "service of "+cluster); err != nil {
+			return "", "", err
+		}
 	}
 	if service == "" {
-		services := clusterAndServices[cluster]
-		service = PickOption(services, "Please choose a service")
+		if service, err = ChooseOption(services, "service"); err != nil {
+			return "", "", err
+		}
+	}
+	for _, name := range services {
+		if name == service {
+			if !NonInteractive {
+				RememberChoice("service", cluster+"/"+service)
+			}
+			return cluster, service, nil
+		}
+	}
+	return "", "", NotFoundf("service %s not found in cluster %s", service, cluster)
+}
 
-		if err != nil {
-			log.Fatal(err)
+// pickRecent returns the only option or lets the user pick one with the fuzzy finder,
+// the recent options first
+func pickRecent(options, recent []string, name string) (string, error) {
+	if len(options) == 0 {
+		return "", NotFoundf("there is no %s to choose", name)
+	}
+	if len(options) == 1 {
+		return options[0], nil
+	}
+	return FuzzyPick(options, recent, "Please choose a "+name)
+}
+
+// ContainerPicker returns the container of the task with the given name, or lets the
+// user choose one if the name is empty and the task runs more than one container
+func ContainerPicker(ti *ecsclient.TaskInfo, name string) (*ecsclient.ContainerInfo, error) {
+	if len(ti.Containers) == 0 {
+		return nil, fmt.Errorf("task %s has no containers", *ti.TaskArn)
+	}
+	if name == "" {
+		var err error
+		if name, err = ChooseOption(ti.ContainerNames(), "container"); err != nil {
+			return nil, err
 		}
 	}
-	return cluster, service
+	ci := ti.Container(name)
+	if ci == nil {
+		return nil, NotFoundf("container %s not found, available containers: %s", name, strings.Join(ti.ContainerNames(), ", "))
+	}
+	return ci, nil
+}
+
+// stdin is shared by all prompts, so lines piped to skipper are not lost to the buffer
+// of an earlier prompt. It is replaced along with os.Stdin.
+var (
+	stdin     *bufio.Reader
+	stdinFile *os.File
+)
+
+// ReadLine reads a line of stdin without its line break, the last line does not need
+// one. io.EOF is only returned once stdin has ended.
+func ReadLine() (string, error) {
+	if stdin == nil || stdinFile != os.Stdin {
+		stdin, stdinFile = bufio.NewReader(os.Stdin), os.Stdin
+	}
+	text, err := stdin.ReadString('\n')
+	if err == io.EOF && text != "" {
+		err = nil
+	}
+	return strings.TrimRight(text, "\r\n"), err
 }
 
 func GetUserStringInput() (string, error) {
-	reader := bufio.NewReader(os.Stdin)
 	fmt.Print("\n >>> ")
-	text, err := reader.ReadString('\n')
-	return text, err
+	text, err := ReadLine()
+	if err != nil {
+		return "", err
+	}
+	return text + "\n", nil
 }
 
 func GetUserIntInput() (int, error) {
 	input, err := GetUserStringInput()
 
+	if err == io.EOF {
+		return 0, err
+	}
 	if err != nil {
 		return 0, fmt.Errorf("Could receive string %v", err)
 	}
@@ -88,10 +204,34 @@ func GetUserIntInput() (int, error) {
 	return myint, nil
 }
 
+// ChooseOption returns the only option or lets the user pick one, name is what is
+// chosen like a cluster. On a terminal the option is picked with the fuzzy finder,
+// otherwise by its number. Without options, or with more than one and NonInteractive,
+// it fails.
+func ChooseOption(options []string, name string) (string, error) {
+	if len(options) == 0 {
+		return "", NotFoundf("there is no %s to choose", name)
+	}
+	if len(options) > 1 && NonInteractive {
+		sorted := append([]string(nil), options...)
+		sort.Strings(sorted)
+		return "", Usagef("missing the %s, one of: %s", name, strings.Join(sorted, ", "))
+	}
+	if len(options) > 1 && IsTerminal() {
+		return FuzzyPick(options, nil, "Please choose a "+name)
+	}
+	return PickOption(options, "Please choose a "+name), nil
+}
+
+// PickOption lets the user pick one of the options with its number. It exits if there
+// is more than one option and NonInteractive is set.
 func PickOption(options []string, title string) string {
 	if len(options) == 1 {
 		return options[0]
 	}
+	if NonInteractive {
+		Fatal(Usagef("%s: can not ask without a terminal, rerun without --non-interactive and --yes", strings.TrimSuffix(title, ":")))
+	}
 	for {
 		fmt.Printf("%s:\n", title)
 		sort.Strings(options)
@@ -99,6 +239,9 @@ func PickOption(options []string, title string) string {
 			fmt.Printf("[%d]: %s\n", choice+1, disp)
 		}
 		myint, err := GetUserIntInput()
+		if err == io.EOF {
+			Fatal(Usagef("%s: stdin ended without a choice", strings.TrimSuffix(title, ":")))
+		}
 
 		myint--
 
@@ -109,14 +252,23 @@ func PickOption(options []string, title string) string {
 	}
 }
 
+// GetYesNo asks a yes or no question. AssumeYes answers yes, NonInteractive no.
 func GetYesNo(text string) bool {
+	if AssumeYes {
+		fmt.Printf("%s [y/n]: y (--yes)\n", text)
+		return true
+	}
+	if NonInteractive {
+		fmt.Printf("%s [y/n]: n (--non-interactive without --yes)\n", text)
+		return false
+	}
 
 	for {
 		fmt.Printf("%s [y/n]: ", text)
 
 		res, err := GetUserStringInput()
 		if err != nil {
-			log.Fatal(err)
+			unanswered(text, err)
 		}
 
 		res = strings.ToLower(strings.TrimSpace(res))
@@ -129,15 +281,32 @@ func GetYesNo(text string) bool {
 	}
 }
 
+// unanswered exits with a usage error if stdin ends or can not be read before a question
+// is answered, without a terminal confirmations need --yes
+func unanswered(question string, err error) {
+	if err == io.EOF {
+		Fatal(Usagef("%s: stdin ended without an answer, rerun with --yes to confirm", question))
+	}
+	Fatal(Usagef("%s: could not read the answer: %v", question, err))
+}
+
+// Confirm asks the user to repeat the text. AssumeYes confirms, NonInteractive does not.
 func Confirm(repeat string) bool {
+	if AssumeYes {
+		fmt.Printf("Please confirm by writing the following [%s]: confirmed by --yes\n", repeat)
+		return true
+	}
+	if NonInteractive {
+		fmt.Printf("Please confirm by writing the following [%s]: not confirmed, --non-interactive without --yes\n", repeat)
+		return false
+	}
 
 	for {
 		fmt.Printf("Please confirm by writing the following [%s]: ", repeat)
 
 		res, err := GetUserStringInput()
-
 		if err != nil {
-			log.Fatal(err)
+			unanswered(fmt.Sprintf("confirming %s", repeat), err)
 		}
 		res = strings.ToUpper(strings.TrimSpace(res))
 		repeat = strings.ToUpper(strings.TrimSpace(repeat))
@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// recentLimit is how many choices of each kind are remembered
+const recentLimit = 50
+
+// recentPath returns the file the recent choices are kept in
+func recentPath() string {
+	return filepath.Join(*GetConfigDir(), "recent.json")
+}
+
+// loadRecent returns the recent choices of every kind, none if they can not be read
+func loadRecent() map[string][]string {
+	recent := make(map[string][]string)
+	data, err := ioutil.ReadFile(recentPath())
+	if err != nil {
+		return recent
+	}
+	if err := json.Unmarshal(data, &recent); err != nil || recent == nil {
+		return make(map[string][]string)
+	}
+	return recent
+}
+
+// RecentChoices returns the remembered choices of the kind, like service, the latest first
+func RecentChoices(kind string) []string {
+	return loadRecent()[kind]
+}
+
+// RememberChoice puts the choice first in the recent choices of the kind. The choices are
+// a convenience, failing to save them is ignored.
+func RememberChoice(kind, choice string) {
+	recent := loadRecent()
+	choices := []string{choice}
+	for _, c := range recent[kind] {
+		if c != choice && len(choices) < recentLimit {
+			choices = append(choices, c)
+		}
+	}
+	recent[kind] = choices
+
+	data, err := json.MarshalIndent(recent, "", "  ")
+	if err != nil {
+		return
+	}
+	if EnsureConfigDir() != nil {
+		return
+	}
+	ioutil.WriteFile(recentPath(), data, 0600)
+}
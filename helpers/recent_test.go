@@ -0,0 +1,75 @@
+package helpers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// tempHome points HOME at a temporary directory, the returned function restores it
+func tempHome(t *testing.T) func() {
+	home, err := ioutil.TempDir("", "skipper-helpers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	return func() {
+		os.Setenv("HOME", old)
+		os.RemoveAll(home)
+	}
+}
+
+func TestRememberChoice(t *testing.T) {
+	defer tempHome(t)()
+
+	if choices := RecentChoices("service"); len(choices) != 0 {
+		t.Fatalf("expected no recent choices, got %v", choices)
+	}
+	RememberChoice("service", "production/web")
+	RememberChoice("service", "production/worker")
+	RememberChoice("cluster", "production")
+	RememberChoice("service", "production/web")
+
+	if choices := strings.Join(RecentChoices("service"), ","); choices != "production/web,production/worker" {
+		t.Errorf("expected the latest choice first without duplicates, got %s", choices)
+	}
+	if choices := strings.Join(RecentChoices("cluster"), ","); choices != "production" {
+		t.Errorf("expected the clusters to be kept apart, got %s", choices)
+	}
+}
+
+func TestRememberChoiceLimit(t *testing.T) {
+	defer tempHome(t)()
+
+	for i := 0; i < recentLimit+10; i++ {
+		RememberChoice("service", fmt.Sprintf("production/web-%d", i))
+	}
+	choices := RecentChoices("service")
+	if len(choices) != recentLimit {
+		t.Fatalf("expected %d recent choices, got %d", recentLimit, len(choices))
+	}
+	if first, last := choices[0], choices[len(choices)-1]; first != fmt.Sprintf("production/web-%d", recentLimit+9) || last != "production/web-10" {
+		t.Errorf("expected the oldest choices to be dropped, got %s to %s", first, last)
+	}
+}
+
+func TestRecentChoicesInvalidFile(t *testing.T) {
+	defer tempHome(t)()
+
+	if err := EnsureConfigDir(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(recentPath(), []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if choices := RecentChoices("service"); len(choices) != 0 {
+		t.Errorf("expected an unreadable file to have no choices, got %v", choices)
+	}
+	RememberChoice("service", "production/web")
+	if choices := strings.Join(RecentChoices("service"), ","); choices != "production/web" {
+		t.Errorf("expected the file to be replaced, got %s", choices)
+	}
+}
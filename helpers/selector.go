@@ -0,0 +1,130 @@
+package helpers
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ecsclient"
+)
+
+// ServiceRef names a service of a cluster
+type ServiceRef struct {
+	Cluster string
+	Service string
+}
+
+func (r ServiceRef) String() string {
+	return fmt.Sprintf("%s/%s", r.Cluster, r.Service)
+}
+
+// ServiceSelector selects services by name and tags. Match is a glob like prod-books-*,
+// or a regular expression between slashes like /^prod-books-(web|worker)$/. A service
+// has to carry all Tags.
+type ServiceSelector struct {
+	Match string
+	Tags  map[string]string
+}
+
+// ParseTags parses key=value tag selectors
+func ParseTags(tags []string) (map[string]string, error) {
+	out := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid tag selector %s, expected key=value", tag)
+		}
+		out[parts[0]] = parts[1]
+	}
+	return out, nil
+}
+
+// matcher returns a function reporting whether a service name matches Match
+func (s *ServiceSelector) matcher() (func(string) bool, error) {
+	if s.Match == "" {
+		return func(string) bool { return true }, nil
+	}
+	if len(s.Match) > 1 && strings.HasPrefix(s.Match, "/") && strings.HasSuffix(s.Match, "/") {
+		re, err := regexp.Compile(s.Match[1 : len(s.Match)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s: %v", s.Match, err)
+		}
+		return re.MatchString, nil
+	}
+	if _, err := path.Match(s.Match, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %v", s.Match, err)
+	}
+	return func(name string) bool {
+		ok, _ := path.Match(s.Match, name)
+		return ok
+	}, nil
+}
+
+// SelectServices returns the services matching the selector, sorted by cluster and name.
+// Only the cluster is searched if it is set, otherwise all of them.
+func SelectServices(ecsclient_ ecsclient.Client, cluster string, selector *ServiceSelector) ([]ServiceRef, error) {
+	match, err := selector.matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := []string{cluster}
+	if cluster == "" {
+		if clusters, err = ecsclient_.GetClusterNames(); err != nil {
+			return nil, fmt.Errorf("could not list clusters: %v", err)
+		}
+	}
+
+	refs := make([]ServiceRef, 0)
+	for i := range clusters {
+		services, err := ecsclient_.ListServices(&clusters[i])
+		if err != nil {
+			return nil, fmt.Errorf("could not list the services of %s: %v", clusters[i], err)
+		}
+		names := make([]string, 0, len(services))
+		for _, name := range services {
+			if match(name) {
+				names = append(names, name)
+			}
+		}
+
+		if len(selector.Tags) > 0 && len(names) > 0 {
+			described, err := ecsclient_.DescribeServices(&clusters[i], names)
+			if err != nil {
+				return nil, err
+			}
+			names = names[:0]
+			for _, s := range described {
+				if hasTags(s.Tags, selector.Tags) {
+					names = append(names, *s.ServiceName)
+				}
+			}
+		}
+
+		for _, name := range names {
+			refs = append(refs, ServiceRef{Cluster: clusters[i], Service: name})
+		}
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].String() < refs[j].String()
+	})
+	return refs, nil
+}
+
+func hasTags(tags []*ecs.Tag, want map[string]string) bool {
+	have := make(map[string]string, len(tags))
+	for _, t := range tags {
+		have[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	for k, v := range want {
+		if value, ok := have[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/fake"
+)
+
+// newSelectorBackend returns the clusters production and staging with the services
+// prod-books-web, prod-books-worker and prod-users-web, and staging-books-web. The
+// books services are tagged team=content, the web ones tier=web.
+func newSelectorBackend(t *testing.T) ecsclient.Client {
+	backend := fake.New()
+	if _, err := backend.ECS().RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family: aws.String("web"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{{
+			Name:   aws.String("app"),
+			Image:  aws.String("nginx"),
+			Memory: aws.Int64(128),
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	services := map[string][]string{
+		"production": {"prod-books-web", "prod-books-worker", "prod-users-web"},
+		"staging":    {"staging-books-web"},
+	}
+	for cluster, names := range services {
+		backend.AddCluster(cluster)
+		for _, name := range names {
+			if _, err := backend.AddService(cluster, name, "web:1", 0); err != nil {
+				t.Fatal(err)
+			}
+			tags := make(map[string]string)
+			if strings.Contains(name, "-books-") {
+				tags["team"] = "content"
+			}
+			if strings.HasSuffix(name, "-web") {
+				tags["tier"] = "web"
+			}
+			if err := backend.TagService(cluster, name, tags); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return ecsclient.NewWithClients(backend.ECS(), backend.EC2())
+}
+
+func TestSelectServices(t *testing.T) {
+	client := newSelectorBackend(t)
+
+	tests := []struct {
+		cluster  string
+		selector ServiceSelector
+		expected string
+	}{
+		{"", ServiceSelector{}, "production/prod-books-web,production/prod-books-worker,production/prod-users-web,staging/staging-books-web"},
+		{"production", ServiceSelector{}, "production/prod-books-web,production/prod-books-worker,production/prod-users-web"},
+		{"", ServiceSelector{Match: "prod-books-*"}, "production/prod-books-web,production/prod-books-worker"},
+		{"", ServiceSelector{Match: "*-web"}, "production/prod-books-web,production/prod-users-web,staging/staging-books-web"},
+		{"", ServiceSelector{Match: "prod-[u]*-we?"}, "production/prod-users-web"},
+		{"", ServiceSelector{Match: "books"}, ""},
+		{"", ServiceSelector{Match: "/books/"}, "production/prod-books-web,production/prod-books-worker,staging/staging-books-web"},
+		{"", ServiceSelector{Match: "/^prod-books-(web|worker)$/"}, "production/prod-books-web,production/prod-books-worker"},
+		{"staging", ServiceSelector{Match: "/^prod-/"}, ""},
+		{"", ServiceSelector{Tags: map[string]string{"team": "content"}}, "production/prod-books-web,production/prod-books-worker,staging/staging-books-web"},
+		{"", ServiceSelector{Tags: map[string]string{"team": "content", "tier": "web"}}, "production/prod-books-web,staging/staging-books-web"},
+		{"", ServiceSelector{Tags: map[string]string{"team": "platform"}}, ""},
+		{"", ServiceSelector{Match: "prod-*", Tags: map[string]string{"tier": "web"}}, "production/prod-books-web,production/prod-users-web"},
+	}
+	for _, test := range tests {
+		refs, err := SelectServices(client, test.cluster, &test.selector)
+		if err != nil {
+			t.Errorf("%q %+v: %s", test.cluster, test.selector, err)
+			continue
+		}
+		selected := make([]string, len(refs))
+		for i, ref := range refs {
+			selected[i] = ref.String()
+		}
+		if strings.Join(selected, ",") != test.expected {
+			t.Errorf("%q %+v: expected %s, got %s", test.cluster, test.selector, test.expected, strings.Join(selected, ","))
+		}
+	}
+}
+
+func TestSelectServicesInvalidPattern(t *testing.T) {
+	client := newSelectorBackend(t)
+
+	for match, expected := range map[string]string{
+		"prod-[books": "invalid pattern prod-[books",
+		"/prod-(/":    "invalid regular expression /prod-(/",
+	} {
+		_, err := SelectServices(client, "", &ServiceSelector{Match: match})
+		if err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("%s: expected %q, got %v", match, expected, err)
+		}
+	}
+}
+
+func TestHasTags(t *testing.T) {
+	tags := []*ecs.Tag{
+		{Key: aws.String("team"), Value: aws.String("content")},
+		{Key: aws.String("tier"), Value: aws.String("web")},
+		{Key: aws.String("empty"), Value: aws.String("")},
+	}
+
+	tests := []struct {
+		want     map[string]string
+		expected bool
+	}{
+		{nil, true},
+		{map[string]string{"team": "content"}, true},
+		{map[string]string{"team": "content", "tier": "web"}, true},
+		{map[string]string{"empty": ""}, true},
+		{map[string]string{"team": "platform"}, false},
+		{map[string]string{"team": "content", "tier": "worker"}, false},
+		{map[string]string{"owner": ""}, false},
+	}
+	for _, test := range tests {
+		if actual := hasTags(tags, test.want); actual != test.expected {
+			t.Errorf("%v: expected %t, got %t", test.want, test.expected, actual)
+		}
+	}
+	if hasTags(nil, map[string]string{"team": "content"}) {
+		t.Error("expected a service without tags not to match")
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags([]string{"team=content", "query=a=b", "empty="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 3 || tags["team"] != "content" || tags["query"] != "a=b" || tags["empty"] != "" {
+		t.Errorf("expected the tags to be split at the first =, got %v", tags)
+	}
+	for _, invalid := range []string{"team", "=content"} {
+		if _, err := ParseTags([]string{invalid}); err == nil {
+			t.Errorf("expected %s to be invalid", invalid)
+		}
+	}
+}
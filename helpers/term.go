@@ -0,0 +1,230 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// KeyCode tells which key was pressed, KeyRune for printable characters
+type KeyCode int
+
+// Keys read by ReadKey
+const (
+	KeyUnknown KeyCode = iota
+	KeyRune
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyHome
+	KeyEnd
+	KeyPageUp
+	KeyPageDown
+	KeyEnter
+	KeyBackspace
+	KeyEscape
+	KeyTab
+	KeyInterrupt
+	KeyEOF
+)
+
+// Key is a key press, Rune is set for KeyRune
+type Key struct {
+	Code KeyCode
+	Rune rune
+}
+
+// Terminal draws full screen views on the terminal of stdin and stdout and reads single
+// key presses from it while in raw mode
+type Terminal struct {
+	in    *os.File
+	out   *os.File
+	state *terminal.State
+}
+
+// IsTerminal reports whether stdin and stdout are a terminal
+func IsTerminal() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd())) && terminal.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// OpenTerminal puts the terminal in raw mode and switches to its alternate screen. Close
+// restores it.
+func OpenTerminal() (*Terminal, error) {
+	if !IsTerminal() {
+		return nil, Usagef("stdin and stdout have to be a terminal")
+	}
+	t := &Terminal{in: os.Stdin, out: os.Stdout}
+	if err := t.MakeRaw(); err != nil {
+		return nil, err
+	}
+	t.EnterFullScreen()
+	return t, nil
+}
+
+// Close leaves the alternate screen and restores the terminal
+func (t *Terminal) Close() error {
+	t.ExitFullScreen()
+	return t.Restore()
+}
+
+// MakeRaw puts the terminal in raw mode unless it already is
+func (t *Terminal) MakeRaw() error {
+	if t.state != nil {
+		return nil
+	}
+	state, err := terminal.MakeRaw(int(t.in.Fd()))
+	if err != nil {
+		return err
+	}
+	t.state = state
+	return nil
+}
+
+// Restore leaves raw mode, the terminal echoes and reads lines again
+func (t *Terminal) Restore() error {
+	if t.state == nil {
+		return nil
+	}
+	err := terminal.Restore(int(t.in.Fd()), t.state)
+	t.state = nil
+	return err
+}
+
+// EnterFullScreen switches to the alternate screen and hides the cursor
+func (t *Terminal) EnterFullScreen() {
+	fmt.Fprint(t.out, "\033[?1049h\033[?25l")
+}
+
+// ExitFullScreen shows the cursor and switches back to the screen skipper was started on
+func (t *Terminal) ExitFullScreen() {
+	fmt.Fprint(t.out, "\033[?25h\033[?1049l")
+}
+
+// Size returns the width and height of the terminal, 80x24 if it can not be told
+func (t *Terminal) Size() (int, int) {
+	width, height, err := terminal.GetSize(int(t.out.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// Draw replaces the screen with the lines, cutting them to the size of the terminal
+func (t *Terminal) Draw(lines []string) {
+	width, height := t.Size()
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	var buf bytes.Buffer
+	buf.WriteString("\033[H\033[2J")
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString(Truncate(line, width))
+	}
+	t.out.Write(buf.Bytes())
+}
+
+// ReadKey waits for a key press, the terminal has to be in raw mode
+func (t *Terminal) ReadKey() (Key, error) {
+	buf := make([]byte, 16)
+	n, err := t.in.Read(buf)
+	if err != nil {
+		return Key{}, err
+	}
+	return parseKey(buf[:n]), nil
+}
+
+// parseKey returns the key of the bytes of one read in raw mode, which hold one key
+// press unless text is pasted
+func parseKey(b []byte) Key {
+	if len(b) == 0 {
+		return Key{Code: KeyUnknown}
+	}
+	if b[0] == 27 {
+		if len(b) == 1 {
+			return Key{Code: KeyEscape}
+		}
+		if len(b) >= 3 && (b[1] == '[' || b[1] == 'O') {
+			switch b[2] {
+			case 'A':
+				return Key{Code: KeyUp}
+			case 'B':
+				return Key{Code: KeyDown}
+			case 'C':
+				return Key{Code: KeyRight}
+			case 'D':
+				return Key{Code: KeyLeft}
+			case 'H', '1':
+				return Key{Code: KeyHome}
+			case 'F', '4':
+				return Key{Code: KeyEnd}
+			case '5':
+				return Key{Code: KeyPageUp}
+			case '6':
+				return Key{Code: KeyPageDown}
+			}
+		}
+		return Key{Code: KeyUnknown}
+	}
+
+	switch b[0] {
+	case '\r', '\n':
+		return Key{Code: KeyEnter}
+	case 127, 8:
+		return Key{Code: KeyBackspace}
+	case '\t':
+		return Key{Code: KeyTab}
+	case 3:
+		return Key{Code: KeyInterrupt}
+	case 4:
+		return Key{Code: KeyEOF}
+	case 14:
+		// Ctrl-N
+		return Key{Code: KeyDown}
+	case 16:
+		// Ctrl-P
+		return Key{Code: KeyUp}
+	}
+	r, _ := utf8.DecodeRune(b)
+	if r < 32 || r == utf8.RuneError {
+		return Key{Code: KeyUnknown}
+	}
+	return Key{Code: KeyRune, Rune: r}
+}
+
+// Truncate cuts s to width visible characters, keeping its color escape sequences
+func Truncate(s string, width int) string {
+	var buf bytes.Buffer
+	visible := 0
+	escaped := false
+	for i := 0; i < len(s); {
+		if s[i] == 27 {
+			end := strings.IndexByte(s[i:], 'm')
+			if end < 0 {
+				break
+			}
+			buf.WriteString(s[i : i+end+1])
+			i += end + 1
+			escaped = true
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if visible == width {
+			break
+		}
+		buf.WriteRune(r)
+		visible++
+		i += size
+	}
+	if escaped {
+		buf.WriteString("\033[0m")
+	}
+	return buf.String()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	argHistoryLimit     int
+	argHistoryContainer string
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [cluster] [service]",
+	Short: "List the task definition revisions of a service",
+	Long: `
+Lists the latest revisions of the service's task definition family, oldest first,
+with the images of their containers, when and by whom they were registered and
+the environment variables changed against the revision before. The values of
+variables named like secrets (TOKEN, PASSWORD...) and passwords in urls are masked.
+Use skipper rollback to go back to one of them.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ecs := ecsclient.New()
+		cluster, service := helpers.ServicePicker(ecs, args)
+
+		if err := printHistory(ecs, cluster, service); err != nil {
+			helpers.Fatal(err)
+		}
+	},
+}
+
+// printHistory prints the last --limit revisions of the service's task definition
+func printHistory(ecsclient_ ecsclient.Client, cluster, service string) error {
+	serviceObj, arns, err := serviceRevisions(ecsclient_, cluster, service)
+	if err != nil {
+		return err
+	}
+
+	start := len(arns) - argHistoryLimit
+	if start < 0 {
+		start = 0
+	}
+
+	var previous *ecs.TaskDefinition
+	if start > 0 {
+		if previous, err = ecsclient_.GetTaskDefinition(&arns[start-1]); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Cluster:\t\t%s\n", cluster)
+	fmt.Printf("Service:\t\t%s\n", service)
+	fmt.Printf("Task Definition:\t%s\n", path.Base(*serviceObj.TaskDefinition))
+	for i := range arns[start:] {
+		td, err := ecsclient_.GetTaskDefinition(&arns[start+i])
+		if err != nil {
+			return err
+		}
+		fmt.Println("---------------------------------------------------------------------------------------")
+		printRevision(serviceObj, td, previous)
+		previous = td
+	}
+	return nil
+}
+
+// printRevision prints when the revision was registered, whether the service runs it,
+// its images and the environment changes against the previous revision, if any
+func printRevision(serviceObj *ecs.Service, td, previous *ecs.TaskDefinition) {
+	registered := "-"
+	if td.RegisteredAt != nil {
+		registered = td.RegisteredAt.Local().Format("2006-01-02 15:04:05")
+	}
+	status := ""
+	for _, d := range serviceObj.Deployments {
+		if *d.TaskDefinition == *td.TaskDefinitionArn {
+			status = fmt.Sprintf(" (%s)", *d.Status)
+		}
+	}
+	fmt.Printf("%s\t%s\t%s%s\n", path.Base(*td.TaskDefinitionArn), registered, aws.StringValue(td.RegisteredBy), status)
+
+	for _, d := range td.ContainerDefinitions {
+		if argHistoryContainer != "" && *d.Name != argHistoryContainer {
+			continue
+		}
+		fmt.Printf("\t%s: %s\n", *d.Name, aws.StringValue(d.Image))
+	}
+
+	if previous == nil {
+		return
+	}
+	for _, c := range ecsclient.DiffTaskDefinitions(previous, td) {
+		if c.Field != ecsclient.FieldEnvironment || (argHistoryContainer != "" && c.Container != argHistoryContainer) {
+			continue
+		}
+		fmt.Printf("\t%s\n", c)
+	}
+}
+
+// serviceRevisions returns the service and the arns of the active revisions of its
+// task definition family, oldest first
+func serviceRevisions(ecsclient_ ecsclient.Client, cluster, service string) (*ecs.Service, []string, error) {
+	serviceObj, err := ecsclient_.FindService(&cluster, &service)
+	if err != nil {
+		return nil, nil, helpers.Wrap(err, "could not find service %s %s", cluster, service)
+	}
+
+	family := ecsclient.TaskDefinitionFamily(*serviceObj.TaskDefinition)
+	arns, err := ecsclient_.ListTaskDefinitionRevisions(&family)
+	if err != nil {
+		return nil, nil, helpers.Wrap(err, "could not list the revisions of %s", family)
+	}
+	return serviceObj, arns, nil
+}
+
+// revisionLabel describes a revision in one line, the revision number is padded so
+// labels sort by it
+func revisionLabel(td *ecs.TaskDefinition, width int) string {
+	images := make([]string, 0, len(td.ContainerDefinitions))
+	for _, d := range td.ContainerDefinitions {
+		images = append(images, aws.StringValue(d.Image))
+	}
+	registered := "-"
+	if td.RegisteredAt != nil {
+		registered = td.RegisteredAt.Local().Format("2006-01-02 15:04")
+	}
+	return fmt.Sprintf("%*d  %s  %s", width, aws.Int64Value(td.Revision), registered, strings.Join(images, ", "))
+}
+
+func init() {
+	RootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().IntVarP(&argHistoryLimit, "limit", "n", 10, "The number of revisions to show")
+	historyCmd.Flags().StringVarP(&argHistoryContainer, "container", "c", "", "Only show this container of the revisions")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/fake"
+)
+
+// addRevisions registers web:2 to web:n, revision i sets LOG_LEVEL to level-i
+func addRevisions(t *testing.T, backend *fake.Backend, n int) {
+	repository := backend.AddImage("api", "v1")
+	for i := 2; i <= n; i++ {
+		if _, err := backend.ECS().RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+			Family:      aws.String("web"),
+			NetworkMode: aws.String(ecs.NetworkModeBridge),
+			ContainerDefinitions: []*ecs.ContainerDefinition{{
+				Name:         aws.String("app"),
+				Image:        aws.String(fmt.Sprintf("%s:v%d", repository, i)),
+				Memory:       aws.Int64(128),
+				PortMappings: []*ecs.PortMapping{{ContainerPort: aws.Int64(8080)}},
+				Environment:  []*ecs.KeyValuePair{{Name: aws.String("LOG_LEVEL"), Value: aws.String(fmt.Sprintf("level-%d", i))}},
+			}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPrintHistory(t *testing.T) {
+	defer func(limit int) { argHistoryLimit = limit }(argHistoryLimit)
+	backend, ecs := newTestBackend(t)
+	addRevisions(t, backend, 5)
+
+	tests := []struct {
+		limit     int
+		revisions []string
+		changes   []string
+	}{
+		// the revision before the window is compared against too
+		{2, []string{"web:4", "web:5"}, []string{`LOG_LEVEL: "level-3" => "level-4"`, `LOG_LEVEL: "level-4" => "level-5"`}},
+		{10, []string{"web:1", "web:2", "web:3", "web:4", "web:5"}, []string{`LOG_LEVEL: "info" => "level-2"`, `LOG_LEVEL: "level-4" => "level-5"`}},
+	}
+	for _, test := range tests {
+		argHistoryLimit = test.limit
+		var err error
+		out := captureStdout(t, func() {
+			err = printHistory(ecs, "production", "web")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		revisions := strings.Split(out, "---------------------------------------------------------------------------------------\n")[1:]
+		if len(revisions) != len(test.revisions) {
+			t.Fatalf("--limit %d: expected %d revisions, got\n%s", test.limit, len(test.revisions), out)
+		}
+		for i, revision := range test.revisions {
+			if !strings.HasPrefix(revisions[i], revision+"\t") {
+				t.Errorf("--limit %d: expected %s, got\n%s", test.limit, revision, revisions[i])
+			}
+		}
+		for _, change := range test.changes {
+			if !strings.Contains(out, change) {
+				t.Errorf("--limit %d: expected the change %s, got\n%s", test.limit, change, out)
+			}
+		}
+		if strings.Contains(out, `"level-2" => "level-3"`) != (test.limit > 3) {
+			t.Errorf("--limit %d: expected only the changes of the listed revisions, got\n%s", test.limit, out)
+		}
+	}
+}
+
+func TestPrintHistoryCurrentRevision(t *testing.T) {
+	defer func(limit int) { argHistoryLimit = limit }(argHistoryLimit)
+	backend, ecs := newTestBackend(t)
+	addRevisions(t, backend, 2)
+	argHistoryLimit = 10
+
+	out := captureStdout(t, func() {
+		if err := printHistory(ecs, "production", "web"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "web:") && strings.HasSuffix(line, "(PRIMARY)") != strings.HasPrefix(line, "web:1\t") {
+			t.Errorf("expected only web:1 to be marked as the primary deployment, got %q", line)
+		}
+	}
+}
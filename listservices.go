@@ -2,12 +2,12 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"sort"
 
 	"github.com/spf13/cobra"
 
 	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/helpers"
 )
 
 func init() {
@@ -15,29 +15,40 @@ func init() {
 
 }
 
-func listServices() {
-	ecs := ecsclient.New()
+func listServices(ecs ecsclient.Client) error {
 	clusters, err := ecs.GetClusterNames()
 	if err != nil {
-		panic(fmt.Sprintf("unhandled error: %v", err))
+		return helpers.Wrap(err, "could not list clusters")
 	}
 	sort.Strings(clusters)
-	if len(clusters) < 0 {
-		fmt.Printf("no clusters found\n")
-		os.Exit(0)
+
+	out := make([]*clusterOutput, len(clusters))
+	for i := range clusters {
+		services, err := ecs.ListServices(&clusters[i])
+		if err != nil {
+			return helpers.Wrap(err, "could not list the services of %s", clusters[i])
+		}
+		if services == nil {
+			services = []string{}
+		}
+		sort.Strings(services)
+		out[i] = &clusterOutput{Name: clusters[i], Services: services}
 	}
 
-	for _, cluster := range clusters {
-		services, _ := ecs.ListServices(&cluster)
-		if len(services) > 0 {
-			fmt.Printf("Cluster:\t%s\n", cluster)
+	return printOutput(out, func() {
+		if len(clusters) == 0 {
+			fmt.Printf("no clusters found\n")
+		}
+		for _, c := range out {
+			if len(c.Services) > 0 {
+				fmt.Printf("Cluster:\t%s\n", c.Name)
 
-			sort.Strings(services)
-			for _, disp := range services {
-				fmt.Printf("[ - ]: %s\n", disp)
+				for _, disp := range c.Services {
+					fmt.Printf("[ - ]: %s\n", disp)
+				}
 			}
 		}
-	}
+	})
 }
 
 var servicesListCmd = &cobra.Command{
@@ -45,6 +56,8 @@ var servicesListCmd = &cobra.Command{
 	Short: "View current the different clusters and services",
 	Long:  "View current cluster or service deployment status",
 	Run: func(cmd *cobra.Command, args []string) {
-		listServices()
+		if err := listServices(ecsclient.New()); err != nil {
+			helpers.Fatal(err)
+		}
 	},
 }
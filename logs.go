@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/blinkist/skipper/aws/ecsclient"
 	"github.com/blinkist/skipper/helpers"
 	cwlogs "github.com/segmentio/cwlogs/lib"
@@ -37,6 +38,7 @@ var templateFuncMap = template.FuncMap{
 var (
 	follow        bool
 	task          string
+	container     string
 	eventTemplate string
 	since         string
 	until         string
@@ -61,6 +63,7 @@ var fetchCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(fetchCmd)
 	fetchCmd.Flags().StringVarP(&task, "task", "t", "", "Task UUID or prefix")
+	fetchCmd.Flags().StringVarP(&container, "container", "c", "", "Name of the container to fetch logs for, asks if the task runs more than one")
 	fetchCmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow log streams")
 	fetchCmd.Flags().StringVarP(&eventTemplate, "format", "o", defaultFormatString, "Format template for displaying log events")
 	fetchCmd.Flags().StringVarP(&since, "since", "s", "1h", "Fetch logs since timestamp (e.g. 2013-01-02T13:23:37), relative (e.g. 42m for 42 minutes), or all for all logs")
@@ -92,14 +95,21 @@ func fetch(cmd *cobra.Command, args []string) error {
 
 	tcs, err := ecs.GetContainerInstances(&cluster, &service)
 	if err != nil {
-		fmt.Errorf("error getting container instances: %s", err)
-		os.Exit(1)
+		fmt.Printf("error getting container instances: %s\n", err)
+		os.Exit(helpers.ExitCode(err))
+	}
+	if len(tcs) == 0 {
+		return helpers.NotFoundf("no running tasks found for service %s in cluster %s", service, cluster)
 	}
 
-	loggroup := "undefined"
-	for _, ti := range tcs {
-		loggroup = *ti.AwsLogGroup
+	ci, err := helpers.ContainerPicker(tcs[0], container)
+	if err != nil {
+		return err
+	}
+	if ci.AwsLogGroup == nil {
+		return fmt.Errorf("container %s does not log to CloudWatch Logs (log driver %s)", *ci.Name, aws.StringValue(ci.LogDriver))
 	}
+	loggroup := *ci.AwsLogGroup
 
 	logReader, err := cwlogs.NewCloudwatchLogsReader(loggroup, task, start, end)
 
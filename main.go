@@ -7,6 +7,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/blinkist/skipper/config"
+	"github.com/blinkist/skipper/helpers"
 )
 
 var (
@@ -16,11 +17,25 @@ var (
 	argServiceType string
 	argTimeout     int
 
+	argYes            bool
+	argNonInteractive bool
+
 	RootCmd = &cobra.Command{
 		Use:     "skipper",
 		Short:   "Helper tools for Amazon's Elastic Container Service",
 		Long:    `Skipper is a command-line tool to help working with Amazon ECS clusters`,
 		Version: "0.0.1",
+		// Execute prints errors once, to stderr
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// --yes never prompts either
+			helpers.NonInteractive = argNonInteractive || argYes
+			helpers.AssumeYes = argYes
+			if err := checkOutput(); err != nil {
+				return err
+			}
+			return checkProgress()
+		},
 		// Uncomment the following line if your bare application
 		// has an action associated with it:
 		//	Run: func(cmd *cobra.Command, args []string) { },
@@ -29,20 +44,28 @@ var (
 
 func init() {
 	RootCmd.Flags().IntVarP(&argTimeout, "timeout", "", 300, "Default timeout for task replacement.")
+	RootCmd.PersistentFlags().BoolVarP(&argYes, "yes", "y", false, "Answer every confirmation with yes, implies --non-interactive")
+	RootCmd.PersistentFlags().BoolVarP(&argNonInteractive, "non-interactive", "", false, "Fail instead of asking for missing arguments, confirmations fail unless --yes is set")
 }
 
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Invalid flags and arguments exit with helpers.ExitUsage.
 func Execute() {
 	if err := RootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(-1)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		code := helpers.ExitCode(err)
+		if code == helpers.ExitFailure {
+			// cobra's errors about flags and arguments are not typed
+			code = helpers.ExitUsage
+		}
+		os.Exit(code)
 	}
 }
 
 func main() {
 	if err := config.Init(); err != nil {
-		fmt.Println("error initialising config:", err)
+		fmt.Fprintln(os.Stderr, "error initialising config:", err)
 		os.Exit(1)
 	}
 	Execute()
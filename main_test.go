@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/fake"
+	"github.com/blinkist/skipper/helpers"
+)
+
+// testEnv points HOME at a temporary directory, sets USER and answers every
+// confirmation with yes. The returned function restores all of it.
+func testEnv(t *testing.T) func() {
+	home, err := ioutil.TempDir("", "skipper-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldHome, oldUser := os.Getenv("HOME"), os.Getenv("USER")
+	oldStdin := os.Stdin
+	os.Setenv("HOME", home)
+	os.Setenv("USER", "tester")
+	helpers.AssumeYes = true
+	helpers.NonInteractive = true
+
+	// nothing is typed, interactive sessions read EOF
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	os.Stdin = r
+
+	return func() {
+		os.Stdin = oldStdin
+		r.Close()
+		helpers.AssumeYes = false
+		helpers.NonInteractive = false
+		os.Setenv("HOME", oldHome)
+		os.Setenv("USER", oldUser)
+		os.RemoveAll(home)
+	}
+}
+
+// newTestBackend returns a backend with the cluster production of two container
+// instances running the service web, two tasks of web:1 whose app container runs the
+// ECR image api:v1 on port 8080. The client looks at deployments every 10ms.
+func newTestBackend(t *testing.T) (*fake.Backend, *ecsclient.Ecsclient) {
+	backend := fake.New()
+	backend.AddCluster("production")
+	for i := 0; i < 2; i++ {
+		if _, err := backend.AddContainerInstance("production"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repository := backend.AddImage("api", "v1", "v2")
+	if _, err := backend.ECS().RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family:      aws.String("web"),
+		NetworkMode: aws.String(ecs.NetworkModeBridge),
+		ContainerDefinitions: []*ecs.ContainerDefinition{{
+			Name:         aws.String("app"),
+			Image:        aws.String(repository + ":v1"),
+			Memory:       aws.Int64(128),
+			PortMappings: []*ecs.PortMapping{{ContainerPort: aws.Int64(8080)}},
+			HealthCheck:  &ecs.HealthCheck{Command: aws.StringSlice([]string{"CMD", "true"})},
+			Environment:  []*ecs.KeyValuePair{{Name: aws.String("LOG_LEVEL"), Value: aws.String("info")}},
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.AddService("production", "web", "web:1", 2); err != nil {
+		t.Fatal(err)
+	}
+	client := ecsclient.NewWithClients(backend.ECS(), backend.EC2())
+	client.SetPollInterval(10 * time.Millisecond)
+	return backend, client
+}
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		out <- buf.String()
+	}()
+
+	defer func() {
+		os.Stdout = stdout
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
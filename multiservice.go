@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	argMatch       string
+	argTags        []string
+	argConcurrency int
+
+	// multiService is set while several services are worked on at once, their events
+	// are prefixed with the service then
+	multiService bool
+)
+
+// serviceResult is the outcome of working on one of several services
+type serviceResult struct {
+	Ref      helpers.ServiceRef
+	Status   string
+	Err      error
+	Duration time.Duration
+}
+
+// addSelectorFlags adds the flags selecting several services to the command
+func addSelectorFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&argMatch, "match", "", "", "Work on all services matching the glob like prod-books-*, or the regular expression between slashes like /^prod-books-(web|worker)$/")
+	cmd.Flags().StringArrayVar(&argTags, "tag", nil, "Work on all services with the tag key=value (can be used multiple times)")
+	cmd.Flags().IntVarP(&argConcurrency, "concurrency", "", 4, "The number of services worked on at once with --match or --tag")
+}
+
+// serviceSelector returns the selector of --match and --tag, or nil if neither is set
+func serviceSelector() (*helpers.ServiceSelector, error) {
+	if argMatch == "" && len(argTags) == 0 {
+		return nil, nil
+	}
+	tags, err := helpers.ParseTags(argTags)
+	if err != nil {
+		return nil, helpers.Usagef("%s", err)
+	}
+	if argConcurrency < 1 {
+		return nil, helpers.Usagef("--concurrency must be at least 1")
+	}
+	return &helpers.ServiceSelector{Match: argMatch, Tags: tags}, nil
+}
+
+// selectServices returns the services of the selector in the cluster given as first
+// argument, or in all clusters, and prints them
+func selectServices(ecs ecsclient.Client, args []string, selector *helpers.ServiceSelector) ([]helpers.ServiceRef, error) {
+	if len(args) > 1 {
+		return nil, helpers.Usagef("a service name can not be combined with --match or --tag")
+	}
+	var cluster string
+	if len(args) > 0 {
+		cluster = args[0]
+	}
+
+	refs, err := helpers.SelectServices(ecs, cluster, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, helpers.NotFoundf("no services match")
+	}
+	fmt.Printf("Matched %d services:\n", len(refs))
+	for _, ref := range refs {
+		fmt.Printf("\t%s\n", ref)
+	}
+	return refs, nil
+}
+
+// forEachService runs fn for every service, --concurrency of them at once. fn returns
+// the status of the service if it succeeds. The results are in the order of the services.
+func forEachService(refs []helpers.ServiceRef, fn func(ref helpers.ServiceRef) (string, error)) []*serviceResult {
+	multiService = len(refs) > 1
+	defer func() { multiService = false }()
+
+	results := make([]*serviceResult, len(refs))
+	slots := make(chan struct{}, argConcurrency)
+	var wg sync.WaitGroup
+	for i := range refs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			start := time.Now()
+			status, err := fn(refs[i])
+			if err != nil {
+				status = "failed"
+			}
+			results[i] = &serviceResult{Ref: refs[i], Status: status, Err: err, Duration: time.Since(start)}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// printSummary prints one line per service and returns how many failed
+func printSummary(results []*serviceResult) int {
+	failed := 0
+	fmt.Println("---------------------------------------------------------------------------------------")
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("%s\t%s after %s: %v\n", r.Ref, r.Status, r.Duration.Round(time.Second), r.Err)
+			continue
+		}
+		fmt.Printf("%s\t%s after %s\n", r.Ref, r.Status, r.Duration.Round(time.Second))
+	}
+	fmt.Printf("%d services, %d failed\n", len(results), failed)
+	return failed
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/ssmclient"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/fatih/color"
+	"golang.org/x/crypto/ssh/terminal"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Values of --output
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var argOutput string
+
+// The types below are the schema of --output json and yaml. Fields are only ever added
+// to them, so tooling can rely on the existing ones.
+
+// clusterOutput is a cluster with the names of its services
+type clusterOutput struct {
+	Name     string   `json:"name" yaml:"name"`
+	Services []string `json:"services" yaml:"services"`
+}
+
+// serviceOutput is the state of a service, its deployments, the containers of its task
+// definition and its running tasks
+type serviceOutput struct {
+	Cluster        string                       `json:"cluster" yaml:"cluster"`
+	Name           string                       `json:"name" yaml:"name"`
+	Status         string                       `json:"status" yaml:"status"`
+	LaunchType     string                       `json:"launch_type,omitempty" yaml:"launch_type,omitempty"`
+	TaskDefinition string                       `json:"task_definition" yaml:"task_definition"`
+	Desired        int64                        `json:"desired" yaml:"desired"`
+	Pending        int64                        `json:"pending" yaml:"pending"`
+	Running        int64                        `json:"running" yaml:"running"`
+	Deployments    []*deploymentOutput          `json:"deployments" yaml:"deployments"`
+	Containers     []*containerDefinitionOutput `json:"containers" yaml:"containers"`
+	Tasks          []*taskOutput                `json:"tasks" yaml:"tasks"`
+	Events         []*serviceEventOutput        `json:"events,omitempty" yaml:"events,omitempty"`
+	TargetGroups   []*targetGroupOutput         `json:"target_groups,omitempty" yaml:"target_groups,omitempty"`
+	Autoscaling    *autoscalingOutput           `json:"autoscaling,omitempty" yaml:"autoscaling,omitempty"`
+}
+
+// deploymentOutput is a deployment of a service
+type deploymentOutput struct {
+	ID             string    `json:"id" yaml:"id"`
+	Status         string    `json:"status" yaml:"status"`
+	RolloutState   string    `json:"rollout_state,omitempty" yaml:"rollout_state,omitempty"`
+	TaskDefinition string    `json:"task_definition" yaml:"task_definition"`
+	Desired        int64     `json:"desired" yaml:"desired"`
+	Pending        int64     `json:"pending" yaml:"pending"`
+	Running        int64     `json:"running" yaml:"running"`
+	CreatedAt      time.Time `json:"created_at" yaml:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+// containerDefinitionOutput is a container of a task definition with its limits, unset
+// memory limits are left out
+type containerDefinitionOutput struct {
+	Name       string `json:"name" yaml:"name"`
+	Image      string `json:"image" yaml:"image"`
+	CPU        int64  `json:"cpu" yaml:"cpu"`
+	SoftMemory *int64 `json:"soft_memory,omitempty" yaml:"soft_memory,omitempty"`
+	HardMemory *int64 `json:"hard_memory,omitempty" yaml:"hard_memory,omitempty"`
+}
+
+// taskOutput is a running task, see ecsclient.TaskInfo
+type taskOutput struct {
+	Arn            string                 `json:"arn" yaml:"arn"`
+	TaskDefinition string                 `json:"task_definition" yaml:"task_definition"`
+	LaunchType     string                 `json:"launch_type,omitempty" yaml:"launch_type,omitempty"`
+	Status         string                 `json:"status" yaml:"status"`
+	HealthStatus   string                 `json:"health_status,omitempty" yaml:"health_status,omitempty"`
+	InstanceID     string                 `json:"instance_id,omitempty" yaml:"instance_id,omitempty"`
+	IPAddress      string                 `json:"ip_address,omitempty" yaml:"ip_address,omitempty"`
+	StartedAt      *time.Time             `json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	Containers     []*taskContainerOutput `json:"containers" yaml:"containers"`
+}
+
+// taskContainerOutput is a container of a running task
+type taskContainerOutput struct {
+	Name         string   `json:"name" yaml:"name"`
+	Image        string   `json:"image" yaml:"image"`
+	Status       string   `json:"status" yaml:"status"`
+	HealthStatus string   `json:"health_status,omitempty" yaml:"health_status,omitempty"`
+	Endpoints    []string `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+}
+
+// serviceEventOutput is a message of the ECS service scheduler
+type serviceEventOutput struct {
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	Message   string    `json:"message" yaml:"message"`
+}
+
+// targetGroupOutput is a target group the service registers a container port with,
+// and the state of the service's tasks in it
+type targetGroupOutput struct {
+	Arn       string          `json:"arn" yaml:"arn"`
+	Container string          `json:"container" yaml:"container"`
+	Port      int64           `json:"port" yaml:"port"`
+	Targets   []*targetOutput `json:"targets" yaml:"targets"`
+}
+
+// targetOutput is a task registered in a target group, see elbv2client.Target
+type targetOutput struct {
+	Task  string `json:"task" yaml:"task"`
+	ID    string `json:"id" yaml:"id"`
+	Port  int64  `json:"port" yaml:"port"`
+	State string `json:"state" yaml:"state"`
+}
+
+// autoscalingOutput are the bounds Application Auto Scaling keeps the desired count in
+type autoscalingOutput struct {
+	Min int64 `json:"min" yaml:"min"`
+	Max int64 `json:"max" yaml:"max"`
+}
+
+// parametersOutput are the parameters of an application, kept below the path
+type parametersOutput struct {
+	Application string             `json:"application" yaml:"application"`
+	Path        string             `json:"path" yaml:"path"`
+	Parameters  []*parameterOutput `json:"parameters" yaml:"parameters"`
+}
+
+// parameterOutput is a parameter, or one version of it in its history. The name is
+// relative to the application.
+type parameterOutput struct {
+	Name             string     `json:"name" yaml:"name"`
+	Value            string     `json:"value" yaml:"value"`
+	Version          int64      `json:"version,omitempty" yaml:"version,omitempty"`
+	LastModifiedDate *time.Time `json:"last_modified_date,omitempty" yaml:"last_modified_date,omitempty"`
+	LastModifiedUser string     `json:"last_modified_user,omitempty" yaml:"last_modified_user,omitempty"`
+}
+
+// newServiceOutput returns the output of the service with the containers of its task
+// definition and its tasks
+func newServiceOutput(cluster string, s *ecs.Service, defs []*ecs.ContainerDefinition, tasks []*ecsclient.TaskInfo) *serviceOutput {
+	out := &serviceOutput{
+		Cluster:        cluster,
+		Name:           aws.StringValue(s.ServiceName),
+		Status:         aws.StringValue(s.Status),
+		LaunchType:     aws.StringValue(s.LaunchType),
+		TaskDefinition: path.Base(aws.StringValue(s.TaskDefinition)),
+		Desired:        aws.Int64Value(s.DesiredCount),
+		Pending:        aws.Int64Value(s.PendingCount),
+		Running:        aws.Int64Value(s.RunningCount),
+		Deployments:    make([]*deploymentOutput, len(s.Deployments)),
+		Containers:     make([]*containerDefinitionOutput, len(defs)),
+		Tasks:          make([]*taskOutput, len(tasks)),
+	}
+	for i, d := range s.Deployments {
+		out.Deployments[i] = &deploymentOutput{
+			ID:             aws.StringValue(d.Id),
+			Status:         aws.StringValue(d.Status),
+			RolloutState:   aws.StringValue(d.RolloutState),
+			TaskDefinition: path.Base(aws.StringValue(d.TaskDefinition)),
+			Desired:        aws.Int64Value(d.DesiredCount),
+			Pending:        aws.Int64Value(d.PendingCount),
+			Running:        aws.Int64Value(d.RunningCount),
+			CreatedAt:      aws.TimeValue(d.CreatedAt),
+			UpdatedAt:      aws.TimeValue(d.UpdatedAt),
+		}
+	}
+	for i, d := range defs {
+		out.Containers[i] = &containerDefinitionOutput{
+			Name:       aws.StringValue(d.Name),
+			Image:      aws.StringValue(d.Image),
+			CPU:        aws.Int64Value(d.Cpu),
+			SoftMemory: d.MemoryReservation,
+			HardMemory: d.Memory,
+		}
+	}
+	for i, ti := range tasks {
+		out.Tasks[i] = newTaskOutput(ti)
+	}
+	return out
+}
+
+// newTaskOutput returns the output of a running task
+func newTaskOutput(ti *ecsclient.TaskInfo) *taskOutput {
+	out := &taskOutput{
+		Arn:            aws.StringValue(ti.TaskArn),
+		TaskDefinition: path.Base(aws.StringValue(ti.TaskDefinitionArn)),
+		LaunchType:     aws.StringValue(ti.LaunchType),
+		Status:         aws.StringValue(ti.LastStatus),
+		HealthStatus:   aws.StringValue(ti.HealthStatus),
+		InstanceID:     aws.StringValue(ti.Ec2InstanceId),
+		IPAddress:      aws.StringValue(ti.IpAddress),
+		StartedAt:      ti.StartedAt,
+		Containers:     make([]*taskContainerOutput, len(ti.Containers)),
+	}
+	for i, ci := range ti.Containers {
+		out.Containers[i] = &taskContainerOutput{
+			Name:         aws.StringValue(ci.Name),
+			Image:        aws.StringValue(ci.Image),
+			Status:       aws.StringValue(ci.LastStatus),
+			HealthStatus: aws.StringValue(ci.HealthStatus),
+			Endpoints:    ti.Endpoints(ci),
+		}
+	}
+	return out
+}
+
+// newParameterOutput returns the output of a parameter, prefix is stripped from its name
+func newParameterOutput(p *ssmclient.Ssmkeypair, prefix string) *parameterOutput {
+	return &parameterOutput{
+		Name:  strings.TrimPrefix(aws.StringValue(p.Key), prefix),
+		Value: aws.StringValue(p.Value),
+	}
+}
+
+// newParameterVersionOutput returns the output of one version of a parameter
+func newParameterVersionOutput(p *ssmclient.Ssmkeypairhistory, prefix string) *parameterOutput {
+	return &parameterOutput{
+		Name:             strings.TrimPrefix(aws.StringValue(p.Key), prefix),
+		Value:            aws.StringValue(p.Value),
+		Version:          aws.Int64Value(p.Version),
+		LastModifiedDate: p.LastModifiedDate,
+		LastModifiedUser: aws.StringValue(p.LastModifiedUser),
+	}
+}
+
+// printOutput prints v as JSON or YAML as --output asks for, or calls table to print
+// it for humans
+func printOutput(v interface{}, table func()) error {
+	switch argOutput {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	table()
+	return nil
+}
+
+// structuredOutput reports whether --output asks for JSON or YAML
+func structuredOutput() bool {
+	return argOutput != outputTable
+}
+
+// checkOutput validates --output. Colors are only used for tables on a terminal.
+func checkOutput() error {
+	if argOutput != outputTable && argOutput != outputJSON && argOutput != outputYAML {
+		return helpers.Usagef("--output must be %s, %s or %s, not %s", outputTable, outputJSON, outputYAML, argOutput)
+	}
+	if structuredOutput() || !terminal.IsTerminal(int(os.Stdout.Fd())) {
+		color.NoColor = true
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVarP(&argOutput, "output", "", outputTable, "How list, status, ssm list, ssm history and the service status of restart are printed: table, json or yaml")
+}
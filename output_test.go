@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/helpers"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// testServiceOutput is web of production in the middle of a deployment, one task of
+// each revision running
+func testServiceOutput() *serviceOutput {
+	created := time.Date(2019, 3, 4, 10, 15, 0, 0, time.UTC)
+	updated := created.Add(2 * time.Minute)
+	started := created.Add(time.Minute)
+
+	service := &ecs.Service{
+		ServiceName:    aws.String("web"),
+		Status:         aws.String("ACTIVE"),
+		LaunchType:     aws.String(ecs.LaunchTypeEc2),
+		TaskDefinition: aws.String("arn:aws:ecs:eu-central-1:123456789012:task-definition/web:2"),
+		DesiredCount:   aws.Int64(2),
+		PendingCount:   aws.Int64(0),
+		RunningCount:   aws.Int64(2),
+		Deployments: []*ecs.Deployment{
+			{
+				Id:             aws.String("ecs-svc/2"),
+				Status:         aws.String("PRIMARY"),
+				RolloutState:   aws.String(ecs.DeploymentRolloutStateInProgress),
+				TaskDefinition: aws.String("arn:aws:ecs:eu-central-1:123456789012:task-definition/web:2"),
+				DesiredCount:   aws.Int64(2),
+				PendingCount:   aws.Int64(0),
+				RunningCount:   aws.Int64(1),
+				CreatedAt:      aws.Time(created),
+				UpdatedAt:      aws.Time(updated),
+			},
+			{
+				Id:             aws.String("ecs-svc/1"),
+				Status:         aws.String("ACTIVE"),
+				TaskDefinition: aws.String("arn:aws:ecs:eu-central-1:123456789012:task-definition/web:1"),
+				DesiredCount:   aws.Int64(1),
+				PendingCount:   aws.Int64(0),
+				RunningCount:   aws.Int64(1),
+				CreatedAt:      aws.Time(created.Add(-24 * time.Hour)),
+				UpdatedAt:      aws.Time(created),
+			},
+		},
+	}
+	defs := []*ecs.ContainerDefinition{
+		{Name: aws.String("app"), Image: aws.String("api:v2"), Cpu: aws.Int64(256), MemoryReservation: aws.Int64(256), Memory: aws.Int64(512)},
+		{Name: aws.String("sidecar"), Image: aws.String("envoy:1.9")},
+	}
+	task := func(id, revision, image string, port int64) *ecsclient.TaskInfo {
+		return &ecsclient.TaskInfo{
+			TaskArn:           aws.String("arn:aws:ecs:eu-central-1:123456789012:task/" + id),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-central-1:123456789012:task-definition/web:" + revision),
+			LaunchType:        aws.String(ecs.LaunchTypeEc2),
+			Ec2InstanceId:     aws.String("i-00000000000000001"),
+			IpAddress:         aws.String("10.0.0.1"),
+			LastStatus:        aws.String("RUNNING"),
+			HealthStatus:      aws.String(ecs.HealthStatusHealthy),
+			StartedAt:         aws.Time(started),
+			Containers: []*ecsclient.ContainerInfo{
+				{
+					Name:            aws.String("app"),
+					Image:           aws.String(image),
+					LastStatus:      aws.String("RUNNING"),
+					HealthStatus:    aws.String(ecs.HealthStatusHealthy),
+					NetworkBindings: []*ecs.NetworkBinding{{HostPort: aws.Int64(port), ContainerPort: aws.Int64(8080), Protocol: aws.String("tcp")}},
+				},
+				{
+					Name:       aws.String("sidecar"),
+					Image:      aws.String("envoy:1.9"),
+					LastStatus: aws.String("RUNNING"),
+				},
+			},
+		}
+	}
+	tasks := []*ecsclient.TaskInfo{task("0001", "1", "api:v1", 32768), task("0002", "2", "api:v2", 32769)}
+	return newServiceOutput("production", service, defs, tasks)
+}
+
+func TestPrintServiceOutputJSON(t *testing.T) {
+	defer func(output string) { argOutput = output }(argOutput)
+	argOutput = outputJSON
+
+	var err error
+	actual := captureStdout(t, func() {
+		err = printOutput(testServiceOutput(), func() {
+			t.Error("expected no table with --output json")
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "service.json")
+	if *updateGolden {
+		if err := ioutil.WriteFile(golden, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != string(expected) {
+		t.Errorf("expected the output of %s, run go test -update if the change is intended, got\n%s", golden, actual)
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	defer func(output string) { argOutput = output }(argOutput)
+
+	for _, output := range []string{outputTable, outputJSON, outputYAML} {
+		argOutput = output
+		if err := checkOutput(); err != nil {
+			t.Errorf("%s: %s", output, err)
+		}
+	}
+	argOutput = "xml"
+	if err := checkOutput(); helpers.ExitCode(err) != helpers.ExitUsage {
+		t.Errorf("expected --output xml to be a usage error, got %v", err)
+	}
+}
@@ -2,199 +2,338 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"path"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/elbv2client"
 	"github.com/blinkist/skipper/helpers"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
 	rotatingkillFlag  = false
 	terminatekillFlag = false
+	restartContainer  = ""
+	argBatchSize      int
+	argBatchPercent   int
+	argStepTimeout    time.Duration
+	argResume         bool
 )
 
 var servicesRestartCmd = &cobra.Command{
 	Use:   "restart",
 	Short: "restart services",
-	Long:  "Restart a servicestatus",
+	Long: `
+Restarts a service by rolling it to a copy of its task definition, or by stopping
+its tasks with --rotatingkill or --terminatekill. With --match or --tag all matching
+services are restarted gracefully after one confirmation.
+
+  skipper restart production --match 'prod-books-*'
+  skipper restart --tag team=content --concurrency 2
+`,
 	Run: func(cmd *cobra.Command, args []string) {
+		separateProgress()
 		ecs := ecsclient.New()
+
+		selector, err := serviceSelector()
+		if err != nil {
+			helpers.Fatal(err)
+		}
+		if selector != nil {
+			if err := restartServices(ecs, args, selector); err != nil {
+				helpers.Fatal(err)
+			}
+			return
+		}
+
 		cluster, service := helpers.ServicePicker(ecs, args)
 
-		printServiceStatus(cluster, service)
+		printServiceStatus(ecs, cluster, service)
 		if terminatekillFlag == true {
-			terminatekill(&cluster, &service)
-		} else if rotatingkillFlag == true {
-			rotatingkill(&cluster, &service)
+			terminatekill(ecs, &cluster, &service)
+		} else if rotatingkillFlag == true || argResume {
+			rotatingkill(ecs, elbv2client.New(), &cluster, &service, cmd.Flags())
 		} else {
-			restartgracefully(&cluster, &service)
+			restartgracefully(ecs, &cluster, &service)
 		}
 
 	},
 }
 
-func rotatingkill(cluster *string, service *string) {
-
-	var err error
-	var tcs []*ecsclient.TaskInfo
-	ecs := ecsclient.New()
-
-	tcs, err = ecs.GetContainerInstances(cluster, service)
+// rotatingkill replaces the tasks of the service batch by batch once confirmed, or
+// resumes an interrupted rotation of it with --resume
+func rotatingkill(ecs ecsclient.Client, elb elbv2client.Client, cluster *string, service *string, flags *pflag.FlagSet) {
+	serviceObj, err := ecs.FindService(cluster, service)
 	if err != nil {
-		fmt.Printf("Error getting container instances: %s\n", err)
-		os.Exit(1)
+		helpers.Fatal(err)
 	}
 
-	if len(tcs) < 2 {
-		fmt.Printf("There are less than 2 tasks running, please use the option --terminatekill")
-		os.Exit(1)
+	tcs, err := ecs.GetContainerInstances(cluster, service)
+	if err != nil {
+		helpers.Fatal(helpers.Wrap(err, "could not get the tasks of %s", *service))
 	}
 
-	taskarns := make([]*string, len(tcs))
-
-	fmt.Println("Currently running tasks:")
-	for i, ti := range tcs {
-		taskarns[i] = ti.TaskArn
-		fmt.Printf("%s:%s\t - %s - %s\n ", *ti.IpAddress, strconv.FormatInt(*ti.Hostport0, 10), *ti.TaskArn, *ti.Ec2InstanceId)
+	state, err := loadRotationState(*cluster, *service)
+	if err != nil {
+		helpers.Fatal(err)
 	}
 
-	if helpers.GetYesNo("Start rotating kill tasks ?") {
-		rotatingkillhelper(cluster, service, taskarns, len(taskarns))
-		fmt.Printf("do it")
-	} else {
-		fmt.Printf("exitting")
-		os.Exit(0)
+	tasks, known := tcs, tcs
+	var stopped []string
+	if argResume {
+		if state == nil {
+			helpers.Fatal(helpers.NotFoundf("there is no interrupted rotation of %s to resume", *service))
+		}
+		tasks, stopped, known = resumableTasks(state, tcs)
+		fmt.Printf("Resuming the rotation started %s: %d tasks replaced, %d stopped tasks waiting for replacements, %d pending tasks still running\n", state.StartedAt.Local().Format("2006-01-02 15:04:05"), len(state.Replaced), len(stopped), len(tasks))
+		if !flags.Changed("batch-size") && !flags.Changed("batch-percent") {
+			argBatchSize = state.BatchSize
+		}
+		if !flags.Changed("step-timeout") {
+			argStepTimeout = state.StepTimeout
+		}
+	} else if state != nil {
+		fmt.Printf("Discarding the interrupted rotation of %s started %s, use --resume to continue it instead\n", *service, state.StartedAt.Local().Format("2006-01-02 15:04:05"))
 	}
-}
-
-func sliceremove(s []*string, i int) []*string {
-	s[len(s)-1], s[i] = s[i], s[len(s)-1]
-	return s[:len(s)-1]
-}
 
-func rotatingkillhelper(cluster *string, service *string, arns []*string, initialcount int) bool {
-	if len(arns) == 0 {
-		fmt.Println("Done.")
-		return true
+	if len(tcs) < 2 {
+		helpers.Fatal(helpers.Usagef("there are less than 2 tasks running, please use the option --terminatekill"))
 	}
-
-	ecs := ecsclient.New()
-	taskarns, err := ecs.GetTaskArnsForService(cluster, service)
+	batchSize, err := rotationBatchSize(flags, len(tcs))
 	if err != nil {
-		fmt.Printf("Error getting tasks: %s", err)
-		os.Exit(1)
+		helpers.Fatal(err)
 	}
 
-	if len(arns) == 0 {
-		return true
+	fmt.Println("Tasks to replace:")
+	for _, ti := range tasks {
+		fmt.Printf("%s - %s - %s\n", *ti.TaskArn, aws.StringValue(ti.Ec2InstanceId), aws.StringValue(ti.HealthStatus))
+		for _, ci := range ti.Containers {
+			if restartContainer != "" && *ci.Name != restartContainer {
+				continue
+			}
+			fmt.Printf("\t%s\n", ti.Describe(ci))
+		}
+	}
+	for _, lb := range serviceObj.LoadBalancers {
+		if lb.TargetGroupArn == nil {
+			fmt.Printf("Classic load balancer %s is not drained or checked\n", aws.StringValue(lb.LoadBalancerName))
+			continue
+		}
+		fmt.Printf("Target group:\t\t%s (%s:%d)\n", *lb.TargetGroupArn, aws.StringValue(lb.ContainerName), aws.Int64Value(lb.ContainerPort))
+	}
+
+	if !helpers.GetYesNo(fmt.Sprintf("Start rotating kill tasks, %d at a time ?", batchSize)) {
+		helpers.Fatal(helpers.ErrAborted)
 	}
 
-	tobekilledtask := arns[0]
-	arns = sliceremove(arns, 0)
+	if !argResume || state == nil {
+		state = &rotationState{Cluster: *cluster, Service: *service, StartedAt: time.Now()}
+		for _, ti := range tasks {
+			state.Pending = append(state.Pending, *ti.TaskArn)
+		}
+	}
+	state.BatchSize = batchSize
+	state.StepTimeout = argStepTimeout
+	if err := state.save(); err != nil {
+		helpers.Fatal(helpers.Wrap(err, "save rotation state"))
+	}
 
-	_, errr := ecs.StopTask(cluster, tobekilledtask)
+	events, done := renderEvents()
+	r := newRotation(ecs, elb, *cluster, *service, serviceObj, events)
+	r.batchSize = batchSize
+	r.stepTimeout = argStepTimeout
+	r.state = state
+	r.stopped = stopped
+	err = r.run(tasks, known)
+	close(events)
+	<-done
 	if err != nil {
-		fmt.Printf("Failed to kill task instance: %s", errr)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Continue the rotation with: skipper restart %s %s --resume\n", *cluster, *service)
+		helpers.Fatal(helpers.Wrap(err, "rotation of %s", *service))
 	}
+}
 
-	fmt.Println("----- Currently running tasks  --------------------------------------------------------")
-	for _, task := range taskarns {
-		fmt.Printf("Task: %s\n", *task)
+// resumableTasks returns the pending tasks of the state which are still running and the
+// ones which are gone, stopped before the rotation was interrupted. Their replacements
+// have to be waited for, so only the running pending tasks and the replacements of
+// finished batches are known.
+func resumableTasks(state *rotationState, running []*ecsclient.TaskInfo) (tasks []*ecsclient.TaskInfo, stopped []string, known []*ecsclient.TaskInfo) {
+	replacements := make(map[string]bool, len(state.Replacements))
+	for _, arn := range state.Replacements {
+		replacements[arn] = true
 	}
-	fmt.Println("-----  to be killed tasks  --------------------------------------------------------")
-	for _, task := range arns {
-		fmt.Printf("Task: %s\n", *task)
+	runningArns := make(map[string]bool, len(running))
+	for _, ti := range running {
+		runningArns[*ti.TaskArn] = true
+		if replacements[*ti.TaskArn] {
+			known = append(known, ti)
+		}
 	}
-	fmt.Println("-----  Just killed task  --------------------------------------------------------")
-	fmt.Printf("Task: %s\n", *tobekilledtask)
-	fmt.Println("Waiting for the amount of tasks to be back to the initial value, in cases of autoscaling this could fail. Waiting for a task to come back again.")
-
-	countmax := 600
-	for countmax > 0 {
-		fmt.Printf(". sleep . ")
-		taskarns, err = ecs.GetTaskArnsForService(cluster, service)
-		if err != nil {
-			fmt.Printf("Error getting container instances: %s", err)
-			os.Exit(1)
+	pending := make(map[string]bool, len(state.Pending))
+	for _, arn := range state.Pending {
+		pending[arn] = true
+		if !runningArns[arn] {
+			stopped = append(stopped, arn)
 		}
-
-		if len(taskarns) == initialcount {
-			fmt.Println("=================================================")
-			return rotatingkillhelper(cluster, service, arns, initialcount)
+	}
+	for _, ti := range running {
+		if pending[*ti.TaskArn] {
+			tasks = append(tasks, ti)
 		}
+	}
+	return tasks, stopped, append(known, tasks...)
+}
 
-		time.Sleep(time.Duration(5) * time.Second)
-		countmax = countmax - 5
+// rotationBatchSize returns how many of the service's tasks are replaced at once, from
+// --batch-size or --batch-percent rounded up. At least one task has to keep running.
+func rotationBatchSize(flags *pflag.FlagSet, count int) (int, error) {
+	if flags.Changed("batch-size") && flags.Changed("batch-percent") {
+		return 0, helpers.Usagef("--batch-size and --batch-percent can not be used together")
+	}
+	size := argBatchSize
+	if argBatchPercent != 0 {
+		if argBatchPercent < 0 || argBatchPercent > 100 {
+			return 0, helpers.Usagef("--batch-percent must be between 1 and 100")
+		}
+		size = (count*argBatchPercent + 99) / 100
+	}
+	if size < 1 {
+		return 0, helpers.Usagef("the batch size must be at least 1")
+	}
+	if size >= count {
+		return 0, helpers.Usagef("a batch of %d would stop all %d tasks, please use the option --terminatekill", size, count)
 	}
-	return false
+	return size, nil
 }
 
-func terminatekill(cluster *string, service *string) {
+func terminatekill(ecs ecsclient.Client, cluster *string, service *string) {
 	if helpers.Confirm(fmt.Sprintf("KILL %s", strings.ToUpper(*service))) {
-		ecs := ecsclient.New()
 		taskarns, err := ecs.GetTaskArnsForService(cluster, service)
 		if err != nil {
-			fmt.Printf("Error getting tasks: %s", err)
-			os.Exit(1)
+			helpers.Fatal(helpers.Wrap(err, "could not get the tasks of %s", *service))
 		}
 		for _, task := range taskarns {
 			fmt.Printf("Killing Task: %s\n", *task)
-			_, errr := ecs.StopTask(cluster, task)
-			if err != nil {
-				fmt.Printf("Failed to kill task instance: %s", errr)
-				os.Exit(1)
+			if _, err := ecs.StopTask(cluster, task); err != nil {
+				helpers.Fatal(helpers.Wrap(err, "failed to kill task %s", *task))
 			}
 		}
+	} else {
+		helpers.Fatal(helpers.ErrAborted)
 	}
 
 }
 
-func printServiceStatus(cluster, service string) {
-	ecs := ecsclient.New()
-
+// printServiceStatus prints the deployments of the service and the limits of its
+// containers, or with --output json or yaml the service with its tasks
+func printServiceStatus(ecs ecsclient.Client, cluster, service string) {
 	serviceObj, err := ecs.FindService(&cluster, &service)
 	if err != nil {
-		log.Fatalf("Could not find service %s %s", cluster, service)
-	}
-
-	fmt.Printf("Cluster:\t\t%s\n", cluster)
-	fmt.Printf("Service:\t\t%s\n", service)
-	fmt.Printf("Task Definition:\t%s\n", path.Base(*serviceObj.TaskDefinition))
-	fmt.Println("Deployments:")
-	for _, d := range serviceObj.Deployments {
-		fmt.Printf("%s %s (%d Desired, %d Pending, %d Running) %v\n", path.Base(*d.TaskDefinition), *d.Status, *d.DesiredCount, *d.PendingCount, *d.RunningCount, *d.CreatedAt)
+		helpers.Fatal(err)
 	}
 	task := path.Base(*serviceObj.TaskDefinition)
 	defs, err := ecs.GetContainerDefinitions(&task)
 	if err != nil {
-		log.Fatalf("%v", err)
+		helpers.Fatal(err)
+	}
+	var tasks []*ecsclient.TaskInfo
+	if structuredOutput() {
+		if tasks, err = ecs.GetContainerInstances(&cluster, &service); err != nil {
+			helpers.Fatal(helpers.Wrap(err, "could not get the tasks of %s", service))
+		}
 	}
 
-	fmt.Println("---------------------------------------------------------------------------------------")
+	err = printOutput(newServiceOutput(cluster, serviceObj, defs, tasks), func() {
+		fmt.Printf("Cluster:\t\t%s\n", cluster)
+		fmt.Printf("Service:\t\t%s\n", service)
+		fmt.Printf("Task Definition:\t%s\n", path.Base(*serviceObj.TaskDefinition))
+		fmt.Println("Deployments:")
+		for _, d := range serviceObj.Deployments {
+			fmt.Printf("%s %s (%d Desired, %d Pending, %d Running) %v\n", path.Base(*d.TaskDefinition), *d.Status, *d.DesiredCount, *d.PendingCount, *d.RunningCount, *d.CreatedAt)
+		}
+
+		fmt.Println("---------------------------------------------------------------------------------------")
 
-	for _, d := range defs {
-		memreservation := "-1"
-		if d.MemoryReservation != nil {
-			memreservation = strconv.FormatInt(*d.MemoryReservation, 10)
+		for _, d := range defs {
+			if restartContainer != "" && *d.Name != restartContainer {
+				continue
+			}
+			fmt.Printf("%s: CPU %d, Soft Memory limit: %s, Hard memory limit: %s\n", *d.Name, aws.Int64Value(d.Cpu), formatLimit(d.MemoryReservation), formatLimit(d.Memory))
 		}
-		fmt.Printf("CPU %v, Soft Memory limit: %s, Hard memory limit: %s\n", *d.Cpu, strconv.FormatInt(*d.Memory, 10), memreservation)
+	})
+	if err != nil {
+		helpers.Fatal(err)
+	}
+}
+
+// formatLimit prints an optional memory limit, -1 meaning it is not set
+func formatLimit(limit *int64) string {
+	if limit == nil {
+		return "-1"
+	}
+	return strconv.FormatInt(*limit, 10)
+}
+
+// restartgracefully rolls the service to a new revision of its task definition, rolling
+// back if the new tasks do not become stable
+func restartgracefully(ecs ecsclient.Client, cluster *string, service *string) {
+	if err := restartService(ecs, *cluster, *service); err != nil {
+		helpers.Fatal(err)
+	}
+}
+
+// restartService registers a copy of the service's task definition and rolls it out
+func restartService(ecs ecsclient.Client, cluster, service string) error {
+	serviceObj, err := ecs.FindService(&cluster, &service)
+	if err != nil {
+		return helpers.Wrap(err, "could not find service %s %s", cluster, service)
 	}
+
+	arn, err := ecs.RegisterTaskDefinition(serviceObj.TaskDefinition, &ecsclient.RegisterTaskDefinitionInput{})
+	if err != nil {
+		return helpers.Wrap(err, "register task definition")
+	}
+	return rollout(ecs, cluster, service, *serviceObj.TaskDefinition, arn)
 }
 
-func restartgracefully(cluster *string, service *string) {
-	ecs := ecsclient.New()
-	ecs.RestartService(cluster, service)
+// restartServices gracefully restarts all services of the selector once confirmed and
+// prints how each restart went
+func restartServices(ecs ecsclient.Client, args []string, selector *helpers.ServiceSelector) error {
+	if rotatingkillFlag || terminatekillFlag || argResume {
+		return helpers.Usagef("--match and --tag only restart services gracefully, without --rotatingkill, --terminatekill or --resume")
+	}
+	refs, err := selectServices(ecs, args, selector)
+	if err != nil {
+		return err
+	}
+	if !helpers.GetYesNo(fmt.Sprintf("Restart these %d services ?", len(refs))) {
+		return helpers.ErrAborted
+	}
+
+	results := forEachService(refs, func(ref helpers.ServiceRef) (string, error) {
+		return "restarted", restartService(ecs, ref.Cluster, ref.Service)
+	})
+	if failed := printSummary(results); failed > 0 {
+		return fmt.Errorf("%d of %d services failed to restart", failed, len(results))
+	}
+	return nil
 }
 
 func init() {
 	RootCmd.AddCommand(servicesRestartCmd)
-	servicesRestartCmd.Flags().BoolVarP(&rotatingkillFlag, "rotatingkill", "r", false, "Kill all tasks but not at the same time aka. Rolling kill.")
+	servicesRestartCmd.Flags().BoolVarP(&rotatingkillFlag, "rotatingkill", "r", false, "Kill all tasks but not at the same time aka. Rolling kill. Each task is drained from the service's target groups first and the next one waits until its replacement is healthy.")
 	servicesRestartCmd.Flags().BoolVarP(&terminatekillFlag, "terminatekill", "t", false, "Kill al tasls at the same time.. FEAR THIS.")
+	servicesRestartCmd.Flags().StringVarP(&restartContainer, "container", "c", "", "Only list this container of the tasks")
+	servicesRestartCmd.Flags().BoolVarP(&argNoRollback, "no-rollback", "", false, "Leave the service as it is if the restart fails to become stable")
+	servicesRestartCmd.Flags().IntVarP(&argBatchSize, "batch-size", "", 1, "The number of tasks --rotatingkill replaces at once")
+	servicesRestartCmd.Flags().IntVarP(&argBatchPercent, "batch-percent", "", 0, "The percentage of tasks --rotatingkill replaces at once, rounded up")
+	servicesRestartCmd.Flags().DurationVarP(&argStepTimeout, "step-timeout", "", 10*time.Minute, "How long --rotatingkill waits for the replacements of a batch to become healthy")
+	servicesRestartCmd.Flags().BoolVarP(&argResume, "resume", "", false, "Continue the interrupted --rotatingkill of the service")
+	addSelectorFlags(servicesRestartCmd)
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/elbv2client"
+	"github.com/blinkist/skipper/aws/fake"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/spf13/pflag"
+)
+
+// attachWebTargetGroup puts the app container of web behind a target group without
+// deregistration delay and makes rotations poll every 10ms
+func attachWebTargetGroup(t *testing.T, backend *fake.Backend) (string, func()) {
+	tg := backend.AddTargetGroup("web", 0)
+	if err := backend.AttachTargetGroup("production", "web", tg, "app", 8080); err != nil {
+		t.Fatal(err)
+	}
+	interval := rotatePollInterval
+	rotatePollInterval = 10 * time.Millisecond
+	return tg, func() { rotatePollInterval = interval }
+}
+
+func TestRotatingKill(t *testing.T) {
+	defer testEnv(t)()
+	backend, ecs := newTestBackend(t)
+	tg, restore := attachWebTargetGroup(t, backend)
+	defer restore()
+	elb := elbv2client.NewWithClient(backend.ELBV2())
+	cluster, service := "production", "web"
+
+	before, err := ecs.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatingkill(ecs, elb, &cluster, &service, servicesRestartCmd.Flags())
+
+	after, err := ecs.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 2 {
+		t.Fatalf("expected 2 running tasks, got %d", len(after))
+	}
+	for _, old := range before {
+		for _, ti := range after {
+			if *ti.TaskArn == *old.TaskArn {
+				t.Errorf("expected task %s to be replaced", *old.TaskArn)
+			}
+		}
+	}
+
+	states, err := elb.TargetHealth(&tg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthy := 0
+	for _, state := range states {
+		if state == "healthy" {
+			healthy++
+		}
+	}
+	if healthy != 2 {
+		t.Errorf("expected the 2 replacements to be healthy targets, got %v", states)
+	}
+	if _, err := os.Stat(rotationStatePath(cluster, service)); !os.IsNotExist(err) {
+		t.Errorf("expected the state of the finished rotation to be removed, got %v", err)
+	}
+}
+
+func TestRotationUnhealthyReplacement(t *testing.T) {
+	defer testEnv(t)()
+	backend, ecs := newTestBackend(t)
+	_, restore := attachWebTargetGroup(t, backend)
+	defer restore()
+	elb := elbv2client.NewWithClient(backend.ELBV2())
+	cluster, service := "production", "web"
+
+	serviceObj, err := ecs.FindService(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := ecs.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.SetUnhealthy(*serviceObj.TaskDefinition)
+
+	events, done := renderEvents()
+	r := newRotation(ecs, elb, cluster, service, serviceObj, events)
+	r.stepTimeout = time.Second
+	err = r.run(tasks, tasks)
+	close(events)
+	<-done
+	if err == nil || !strings.Contains(err.Error(), "unhealthy") {
+		t.Fatalf("expected the unhealthy replacement to stop the rotation, got %v", err)
+	}
+
+	// the second task is kept running
+	running, err := ecs.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := false
+	for _, ti := range running {
+		kept = kept || *ti.TaskArn == *tasks[1].TaskArn
+	}
+	if !kept {
+		t.Errorf("expected task %s of the next batch to keep running", aws.StringValue(tasks[1].TaskArn))
+	}
+}
+
+func TestRotationBatchSize(t *testing.T) {
+	defer func(size, percent int) {
+		argBatchSize, argBatchPercent = size, percent
+	}(argBatchSize, argBatchPercent)
+
+	tests := []struct {
+		args     []string
+		count    int
+		expected int
+	}{
+		{nil, 4, 1},
+		{[]string{"--batch-size", "3"}, 4, 3},
+		{[]string{"--batch-percent", "50"}, 4, 2},
+		{[]string{"--batch-percent", "50"}, 5, 3},
+		{[]string{"--batch-percent", "1"}, 3, 1},
+		{[]string{"--batch-size", "0"}, 4, 0},
+		{[]string{"--batch-size", "4"}, 4, 0},
+		{[]string{"--batch-percent", "100"}, 4, 0},
+		{[]string{"--batch-percent", "101"}, 4, 0},
+		{[]string{"--batch-percent", "-10"}, 4, 0},
+		{[]string{"--batch-size", "2", "--batch-percent", "50"}, 4, 0},
+	}
+	for _, test := range tests {
+		flags := pflag.NewFlagSet("restart", pflag.ContinueOnError)
+		flags.IntVar(&argBatchSize, "batch-size", 1, "")
+		flags.IntVar(&argBatchPercent, "batch-percent", 0, "")
+		if err := flags.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+
+		size, err := rotationBatchSize(flags, test.count)
+		if test.expected == 0 {
+			if _, ok := err.(*helpers.UsageError); !ok {
+				t.Errorf("%v of %d tasks: expected a usage error, got %d, %v", test.args, test.count, size, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v of %d tasks: %s", test.args, test.count, err)
+		} else if size != test.expected {
+			t.Errorf("%v of %d tasks: expected a batch of %d, got %d", test.args, test.count, test.expected, size)
+		}
+	}
+}
+
+func TestResumableTasks(t *testing.T) {
+	task := func(arn string) *ecsclient.TaskInfo {
+		return &ecsclient.TaskInfo{TaskArn: aws.String(arn)}
+	}
+	state := &rotationState{
+		Pending:      []string{"old-3", "old-4", "old-5"},
+		Replaced:     []string{"old-1", "old-2"},
+		Replacements: []string{"new-1", "new-2"},
+	}
+	// old-3 was stopped, new-3 is its replacement which was not saved yet
+	running := []*ecsclient.TaskInfo{task("new-1"), task("old-4"), task("new-2"), task("new-3"), task("old-5")}
+
+	tasks, stopped, known := resumableTasks(state, running)
+	arns := func(tasks []*ecsclient.TaskInfo) string {
+		var arns []string
+		for _, ti := range tasks {
+			arns = append(arns, *ti.TaskArn)
+		}
+		return strings.Join(arns, ",")
+	}
+	if arns(tasks) != "old-4,old-5" {
+		t.Errorf("expected old-4 and old-5 to be replaced, got %s", arns(tasks))
+	}
+	if strings.Join(stopped, ",") != "old-3" {
+		t.Errorf("expected old-3 to be waited for, got %v", stopped)
+	}
+	if arns(known) != "new-1,new-2,old-4,old-5" {
+		t.Errorf("expected new-3 to be taken for the replacement of old-3, known are %s", arns(known))
+	}
+}
+
+func TestRotationResumeWaitsForStoppedBatch(t *testing.T) {
+	defer testEnv(t)()
+	backend, ecs := newTestBackend(t)
+	_, restore := attachWebTargetGroup(t, backend)
+	defer restore()
+	elb := elbv2client.NewWithClient(backend.ELBV2())
+	cluster, service := "production", "web"
+
+	serviceObj, err := ecs.FindService(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, err := ecs.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &rotationState{Cluster: cluster, Service: service, Pending: []string{*running[0].TaskArn, *running[1].TaskArn}}
+
+	// the rotation was interrupted after stopping the first task, its replacement fails
+	backend.SetUnhealthy(*serviceObj.TaskDefinition)
+	if _, err := ecs.StopTask(&cluster, running[0].TaskArn); err != nil {
+		t.Fatal(err)
+	}
+	tcs, err := ecs.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, stopped, known := resumableTasks(state, tcs)
+
+	events, done := renderEvents()
+	r := newRotation(ecs, elb, cluster, service, serviceObj, events)
+	r.stepTimeout = time.Second
+	r.stopped = stopped
+	err = r.run(tasks, known)
+	close(events)
+	<-done
+	if err == nil || !strings.Contains(err.Error(), "unhealthy") {
+		t.Fatalf("expected the unhealthy replacement of the stopped task to stop the rotation, got %v", err)
+	}
+
+	after, err := ecs.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := false
+	for _, ti := range after {
+		kept = kept || *ti.TaskArn == *running[1].TaskArn
+	}
+	if !kept {
+		t.Errorf("expected task %s to keep running until the stopped task is replaced", *running[1].TaskArn)
+	}
+}
+
+func TestRotatingKillResume(t *testing.T) {
+	defer testEnv(t)()
+	backend, ecs := newTestBackend(t)
+	_, restore := attachWebTargetGroup(t, backend)
+	defer restore()
+	elb := elbv2client.NewWithClient(backend.ELBV2())
+	cluster, service := "production", "web"
+	defer func(resume bool) { argResume = resume }(argResume)
+
+	running, err := ecs.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &rotationState{
+		Cluster:     cluster,
+		Service:     service,
+		StartedAt:   time.Now(),
+		BatchSize:   1,
+		StepTimeout: 10 * time.Second,
+		Pending:     []string{*running[0].TaskArn, *running[1].TaskArn},
+	}
+	if err := state.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ecs.StopTask(&cluster, running[0].TaskArn); err != nil {
+		t.Fatal(err)
+	}
+
+	argResume = true
+	rotatingkill(ecs, elb, &cluster, &service, servicesRestartCmd.Flags())
+
+	after, err := ecs.GetContainerInstances(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 2 {
+		t.Fatalf("expected 2 running tasks, got %d", len(after))
+	}
+	for _, ti := range after {
+		if *ti.TaskArn == *running[0].TaskArn || *ti.TaskArn == *running[1].TaskArn {
+			t.Errorf("expected task %s to be replaced", *ti.TaskArn)
+		}
+	}
+	if _, err := os.Stat(rotationStatePath(cluster, service)); !os.IsNotExist(err) {
+		t.Errorf("expected the state of the resumed rotation to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/spf13/cobra"
+)
+
+// rollbackCandidates is the number of earlier revisions offered if --revision is not set
+const rollbackCandidates = 10
+
+var argRollbackRevision string
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [cluster] [service]",
+	Short: "Point a service back at an earlier task definition revision",
+	Long: `
+Updates the service to an earlier revision of its task definition and waits until
+it is stable. The revision is given as a number, family:revision or arn, or chosen
+from the latest ones. The changes against the running revision are shown before
+anything happens.
+
+  skipper rollback production api --revision 41
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		separateProgress()
+		ecs := ecsclient.New()
+		cluster, service := helpers.ServicePicker(ecs, args)
+
+		if err := rollbackService(ecs, cluster, service); err != nil {
+			helpers.Fatal(err)
+		}
+	},
+}
+
+// rollbackService updates the service to the chosen revision once confirmed
+func rollbackService(ecsclient_ ecsclient.Client, cluster, service string) error {
+	serviceObj, arns, err := serviceRevisions(ecsclient_, cluster, service)
+	if err != nil {
+		return err
+	}
+	current := *serviceObj.TaskDefinition
+
+	target, err := pickRevision(ecsclient_, current, arns)
+	if err != nil {
+		return err
+	}
+	if target == current {
+		return fmt.Errorf("%s already runs %s", service, path.Base(current))
+	}
+
+	currentTd, err := ecsclient_.GetTaskDefinition(&current)
+	if err != nil {
+		return err
+	}
+	targetTd, err := ecsclient_.GetTaskDefinition(&target)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cluster:\t\t%s\n", cluster)
+	fmt.Printf("Service:\t\t%s\n", service)
+	fmt.Printf("Task Definition:\t%s => %s\n", path.Base(current), path.Base(target))
+	fmt.Println("---------------------------------------------------------------------------------------")
+	ecsclient.WriteChanges(os.Stdout, ecsclient.DiffTaskDefinitions(currentTd, targetTd))
+	fmt.Println("---------------------------------------------------------------------------------------")
+
+	if !helpers.GetYesNo(fmt.Sprintf("Roll %s back to %s ?", service, path.Base(target))) {
+		return helpers.ErrAborted
+	}
+	return rollout(ecsclient_, cluster, service, current, target)
+}
+
+// pickRevision returns the arn of the revision given by --revision, or lets the user
+// choose one of the latest revisions besides the current one
+func pickRevision(ecsclient_ ecsclient.Client, current string, arns []string) (string, error) {
+	family := ecsclient.TaskDefinitionFamily(current)
+
+	if argRollbackRevision != "" {
+		name := argRollbackRevision
+		if _, err := strconv.Atoi(name); err == nil {
+			name = fmt.Sprintf("%s:%s", family, name)
+		}
+		for _, arn := range arns {
+			if arn == name || path.Base(arn) == name {
+				return arn, nil
+			}
+		}
+		return "", helpers.NotFoundf("revision %s not found in the active revisions of %s", argRollbackRevision, family)
+	}
+
+	candidates := make([]string, 0, rollbackCandidates)
+	for i := len(arns) - 1; i >= 0 && len(candidates) < rollbackCandidates; i-- {
+		if arns[i] != current {
+			candidates = append(candidates, arns[i])
+		}
+	}
+	if len(candidates) == 0 {
+		return "", helpers.NotFoundf("%s has no other active revisions", family)
+	}
+
+	// candidates[0] has the highest revision
+	width := len(strings.SplitN(path.Base(candidates[0]), ":", 2)[1])
+	labels := make([]string, len(candidates))
+	byLabel := make(map[string]string, len(candidates))
+	for i, arn := range candidates {
+		td, err := ecsclient_.GetTaskDefinition(&candidates[i])
+		if err != nil {
+			return "", err
+		}
+		labels[i] = revisionLabel(td, width)
+		byLabel[labels[i]] = arn
+	}
+	label, err := helpers.ChooseOption(labels, fmt.Sprintf("revision of %s", family))
+	if err != nil {
+		return "", err
+	}
+	return byLabel[label], nil
+}
+
+func init() {
+	RootCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().StringVarP(&argRollbackRevision, "revision", "r", "", "The revision to roll back to, as number, family:revision or arn")
+	rollbackCmd.Flags().BoolVarP(&argNoRollback, "no-rollback", "", false, "Leave the service as it is if the earlier revision fails to become stable")
+}
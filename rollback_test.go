@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path"
+	"testing"
+
+	"github.com/blinkist/skipper/helpers"
+)
+
+func TestPickRevision(t *testing.T) {
+	defer func(revision string) { argRollbackRevision = revision }(argRollbackRevision)
+	backend, ecs := newTestBackend(t)
+	addRevisions(t, backend, 3)
+
+	serviceObj, arns, err := serviceRevisions(ecs, "production", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arns) != 3 {
+		t.Fatalf("expected 3 revisions, got %v", arns)
+	}
+
+	for revision, expected := range map[string]string{
+		"2":      arns[1],
+		"web:3":  arns[2],
+		arns[0]:  arns[0],
+		"9":      "",
+		"web:9":  "",
+		"api:2":  "",
+		"web":    "",
+		"web:2 ": "",
+	} {
+		argRollbackRevision = revision
+		arn, err := pickRevision(ecs, *serviceObj.TaskDefinition, arns)
+		if expected == "" {
+			if helpers.ExitCode(err) != helpers.ExitNotFound {
+				t.Errorf("--revision %q: expected a not found error, got %s, %v", revision, arn, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("--revision %q: %s", revision, err)
+		} else if arn != expected {
+			t.Errorf("--revision %q: expected %s, got %s", revision, path.Base(expected), path.Base(arn))
+		}
+	}
+}
+
+func TestRollbackServiceCurrentRevision(t *testing.T) {
+	defer testEnv(t)()
+	defer func(revision string) { argRollbackRevision = revision }(argRollbackRevision)
+	backend, ecs := newTestBackend(t)
+	addRevisions(t, backend, 2)
+
+	argRollbackRevision = "1"
+	if err := rollbackService(ecs, "production", "web"); err == nil {
+		t.Error("expected rolling back to the running revision to fail")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/helpers"
+)
+
+var argNoRollback bool
+
+// rollout updates the service to the task definition and waits until it is stable. If
+// the deployment fails the service is rolled back to previous unless --no-rollback is set.
+func rollout(ecs ecsclient.Client, cluster, service, previous, arn string) error {
+	if err := ecs.UpdateServiceWithTaskDefinition(&cluster, &service, nil, &arn); err != nil {
+		return helpers.Wrap(err, "update service")
+	}
+	fmt.Printf("Updated %s to %s, waiting for it to become stable\n", service, path.Base(arn))
+
+	err := waitForDeployment(ecs, cluster, service, arn)
+	if err == nil {
+		fmt.Println("Done.")
+		return nil
+	}
+	if _, ok := err.(*ecsclient.DeploymentError); !ok || argNoRollback || previous == arn {
+		return fmt.Errorf("wait: %v", err)
+	}
+
+	fmt.Printf("Deployment of %s failed: %v\n", path.Base(arn), err)
+	fmt.Printf("Rolling %s back to %s\n", service, path.Base(previous))
+	if err := ecs.UpdateServiceWithTaskDefinition(&cluster, &service, nil, &previous); err != nil {
+		return helpers.Wrap(err, "rollback to %s failed", path.Base(previous))
+	}
+	if err := waitForDeployment(ecs, cluster, service, previous); err != nil {
+		return fmt.Errorf("rollback to %s did not become stable: %v", path.Base(previous), err)
+	}
+	return fmt.Errorf("deployment of %s failed and %s was rolled back to %s: %v", path.Base(arn), service, path.Base(previous), err)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/elbv2client"
+	"github.com/blinkist/skipper/helpers"
+)
+
+// drainMargin is how much longer than the deregistration delay a rotation waits for a
+// target to drain
+const drainMargin = time.Minute
+
+// rotatePollInterval is how often a rotation looks at the tasks and targets
+var rotatePollInterval = 5 * time.Second
+
+// rotation stops the tasks of a service batchSize at a time. The tasks of a batch are
+// drained from the service's target groups first, and the next batch is only stopped
+// once as many replacements run, pass their container health checks and are healthy in
+// every target group. Each batch has stepTimeout to be replaced.
+type rotation struct {
+	ecs           ecsclient.Client
+	elb           elbv2client.Client
+	cluster       string
+	service       string
+	loadBalancers []*ecs.LoadBalancer
+	events        chan<- *ecsclient.Event
+	batchSize     int
+	stepTimeout   time.Duration
+
+	// state is saved after every batch if set
+	state *rotationState
+	// stopped are the tasks of an interrupted batch which were stopped before their
+	// replacements were healthy, a resumed rotation waits for those first
+	stopped []string
+	// known holds the tasks which can not be a replacement
+	known map[string]bool
+}
+
+// newRotation returns a rotation of the service, load balanced by the target groups
+// of its load balancers. Classic load balancers are not drained or checked.
+func newRotation(ecs ecsclient.Client, elb elbv2client.Client, cluster, service string, serviceObj *ecs.Service, events chan<- *ecsclient.Event) *rotation {
+	r := &rotation{
+		ecs:         ecs,
+		elb:         elb,
+		cluster:     cluster,
+		service:     service,
+		events:      events,
+		batchSize:   1,
+		stepTimeout: 10 * time.Minute,
+		known:       make(map[string]bool),
+	}
+	for _, lb := range serviceObj.LoadBalancers {
+		if lb.TargetGroupArn != nil {
+			r.loadBalancers = append(r.loadBalancers, lb)
+		}
+	}
+	return r
+}
+
+// run replaces the tasks batch by batch, stopping at the first batch which fails to be
+// replaced. The known tasks are not taken for replacements. The state is removed once
+// all tasks are replaced.
+func (r *rotation) run(tasks, known []*ecsclient.TaskInfo) error {
+	for _, ti := range known {
+		r.known[*ti.TaskArn] = true
+	}
+	for _, ti := range tasks {
+		r.known[*ti.TaskArn] = true
+	}
+
+	if len(r.stopped) > 0 {
+		if err := r.replaced(r.stopped); err != nil {
+			return err
+		}
+	}
+	for len(tasks) > 0 {
+		n := r.batchSize
+		if n > len(tasks) {
+			n = len(tasks)
+		}
+		batch := tasks[:n]
+		tasks = tasks[n:]
+
+		if err := r.drain(batch); err != nil {
+			return err
+		}
+		arns := make([]string, len(batch))
+		for i, ti := range batch {
+			if _, err := r.ecs.StopTask(&r.cluster, ti.TaskArn); err != nil {
+				return helpers.Wrap(err, "stop task %s", path.Base(*ti.TaskArn))
+			}
+			r.send(&ecsclient.Event{Type: ecsclient.EventTaskStopped, Task: *ti.TaskArn, Reason: "stopped by skipper restart --rotatingkill"})
+			arns[i] = *ti.TaskArn
+		}
+		if err := r.replaced(arns); err != nil {
+			return err
+		}
+	}
+	r.send(&ecsclient.Event{Type: ecsclient.EventSteadyState})
+	if r.state != nil {
+		return r.state.remove()
+	}
+	return nil
+}
+
+// replaced waits for the replacements of the stopped tasks and saves them in the state
+func (r *rotation) replaced(stopped []string) error {
+	healthy, err := r.waitForReplacements(len(stopped))
+	if err != nil {
+		return err
+	}
+	if r.state == nil {
+		return nil
+	}
+	replacements := make([]string, len(healthy))
+	for i, ti := range healthy {
+		replacements[i] = *ti.TaskArn
+	}
+	r.state.done(stopped, replacements)
+	if err := r.state.save(); err != nil {
+		return fmt.Errorf("save rotation state: %v", err)
+	}
+	return nil
+}
+
+// drain deregisters the tasks from the target groups and waits until none of them sends
+// them requests anymore, at most the longest deregistration delay and drainMargin.
+// Targets which are not registered anymore, like after an interruption, are skipped.
+func (r *rotation) drain(tasks []*ecsclient.TaskInfo) error {
+	type registration struct {
+		lb     *ecs.LoadBalancer
+		target elbv2client.Target
+		task   string
+	}
+	draining := make([]registration, 0)
+	var delay time.Duration
+	for _, lb := range r.loadBalancers {
+		for _, ti := range tasks {
+			id, port, ok := ti.Target(lb)
+			if !ok {
+				continue
+			}
+			target := elbv2client.Target{ID: id, Port: port}
+			states, err := r.elb.TargetHealth(lb.TargetGroupArn, []elbv2client.Target{target})
+			if err != nil {
+				return err
+			}
+			if state := states[target]; state == "" || state == elbv2.TargetHealthStateEnumUnused {
+				continue
+			}
+			if err := r.elb.DeregisterTargets(lb.TargetGroupArn, []elbv2client.Target{target}); err != nil {
+				return helpers.Wrap(err, "deregister %s from %s", target, *lb.TargetGroupArn)
+			}
+			r.send(&ecsclient.Event{Type: ecsclient.EventTargetDeregistered, Task: *ti.TaskArn, Target: target.String(), TargetGroup: *lb.TargetGroupArn})
+			draining = append(draining, registration{lb: lb, target: target, task: *ti.TaskArn})
+		}
+
+		d, err := r.elb.DeregistrationDelay(lb.TargetGroupArn)
+		if err != nil {
+			return err
+		}
+		if d > delay {
+			delay = d
+		}
+	}
+
+	deadline := time.Now().Add(delay + drainMargin)
+	for len(draining) > 0 {
+		remaining := draining[:0]
+		for _, reg := range draining {
+			states, err := r.elb.TargetHealth(reg.lb.TargetGroupArn, []elbv2client.Target{reg.target})
+			if err != nil {
+				return err
+			}
+			if state := states[reg.target]; state == "" || state == elbv2.TargetHealthStateEnumUnused {
+				r.send(&ecsclient.Event{Type: ecsclient.EventTargetDrained, Task: reg.task, Target: reg.target.String(), TargetGroup: *reg.lb.TargetGroupArn})
+				continue
+			}
+			remaining = append(remaining, reg)
+		}
+		draining = remaining
+		if len(draining) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("task %s did not drain within %s", path.Base(draining[0].task), delay+drainMargin)
+		}
+		time.Sleep(rotatePollInterval)
+	}
+	return nil
+}
+
+// waitForReplacements waits for n new tasks of the service which are healthy
+func (r *rotation) waitForReplacements(n int) ([]*ecsclient.TaskInfo, error) {
+	placed := make(map[string]bool)
+	healthy := make([]*ecsclient.TaskInfo, 0, n)
+	deadline := time.Now().Add(r.stepTimeout)
+	for {
+		// only running tasks are returned
+		tasks, err := r.ecs.GetContainerInstances(&r.cluster, &r.service)
+		if err != nil {
+			return nil, err
+		}
+		for _, ti := range tasks {
+			if r.known[*ti.TaskArn] {
+				continue
+			}
+			if !placed[*ti.TaskArn] {
+				placed[*ti.TaskArn] = true
+				r.send(&ecsclient.Event{Type: ecsclient.EventTaskPlaced, Task: *ti.TaskArn, TaskDefinition: *ti.TaskDefinitionArn})
+			}
+			ok, err := r.healthy(ti)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				r.known[*ti.TaskArn] = true
+				r.send(&ecsclient.Event{Type: ecsclient.EventTaskHealthy, Task: *ti.TaskArn, TaskDefinition: *ti.TaskDefinitionArn})
+				if healthy = append(healthy, ti); len(healthy) == n {
+					return healthy, nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			reason := fmt.Sprintf("%d of %d replacements healthy after %s", len(healthy), n, r.stepTimeout)
+			r.send(&ecsclient.Event{Type: ecsclient.EventTimeout, Reason: reason})
+			return nil, fmt.Errorf("replacing the tasks timed out: %s", reason)
+		}
+		time.Sleep(rotatePollInterval)
+	}
+}
+
+// healthy reports whether the containers of the task with health checks are healthy and
+// the task is healthy in every target group. An unhealthy container is an error.
+func (r *rotation) healthy(ti *ecsclient.TaskInfo) (bool, error) {
+	for _, ci := range ti.Containers {
+		if ci.HealthCheck == nil {
+			continue
+		}
+		switch aws.StringValue(ci.HealthStatus) {
+		case ecs.HealthStatusHealthy:
+		case ecs.HealthStatusUnhealthy:
+			return false, fmt.Errorf("container %s of task %s is unhealthy", aws.StringValue(ci.Name), path.Base(*ti.TaskArn))
+		default:
+			return false, nil
+		}
+	}
+
+	for _, lb := range r.loadBalancers {
+		id, port, ok := ti.Target(lb)
+		if !ok {
+			return false, fmt.Errorf("task %s does not publish port %d of container %s", path.Base(*ti.TaskArn), aws.Int64Value(lb.ContainerPort), aws.StringValue(lb.ContainerName))
+		}
+		target := elbv2client.Target{ID: id, Port: port}
+		states, err := r.elb.TargetHealth(lb.TargetGroupArn, []elbv2client.Target{target})
+		if err != nil {
+			return false, err
+		}
+		if states[target] != elbv2.TargetHealthStateEnumHealthy {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// send fills in the service and time of the event
+func (r *rotation) send(e *ecsclient.Event) {
+	e.Cluster = r.cluster
+	e.Service = r.service
+	e.Time = time.Now()
+	r.events <- e
+}
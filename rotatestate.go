@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/blinkist/skipper/helpers"
+)
+
+// relConfigRotationsPath holds the state of unfinished rotations, relative to the config dir
+const relConfigRotationsPath = "rotations"
+
+// rotationState is what a rotating restart has done so far, saved after every batch so
+// an interrupted rotation can be resumed
+type rotationState struct {
+	Cluster     string        `json:"cluster"`
+	Service     string        `json:"service"`
+	StartedAt   time.Time     `json:"started_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	BatchSize   int           `json:"batch_size"`
+	StepTimeout time.Duration `json:"step_timeout"`
+	// Pending are the tasks still to be replaced, Replaced the ones which were and
+	// Replacements the healthy tasks which replaced them
+	Pending      []string `json:"pending"`
+	Replaced     []string `json:"replaced"`
+	Replacements []string `json:"replacements"`
+}
+
+// rotationStatePath returns the path of the state file of a rotation of the service
+func rotationStatePath(cluster, service string) string {
+	return filepath.Join(*helpers.GetConfigDir(), relConfigRotationsPath, fmt.Sprintf("%s.%s.json", cluster, service))
+}
+
+// loadRotationState reads the state of an unfinished rotation of the service, or
+// returns nil if there is none
+func loadRotationState(cluster, service string) (*rotationState, error) {
+	data, err := ioutil.ReadFile(rotationStatePath(cluster, service))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &rotationState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid rotation state %s: %v", rotationStatePath(cluster, service), err)
+	}
+	return state, nil
+}
+
+// save writes the state, creating the rotations directory if needed
+func (s *rotationState) save() error {
+	path := rotationStatePath(s.Cluster, s.Service)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// remove deletes the state once the rotation finished
+func (s *rotationState) remove() error {
+	err := os.Remove(rotationStatePath(s.Cluster, s.Service))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// done moves the tasks from pending to replaced and records their replacements
+func (s *rotationState) done(taskArns, replacements []string) {
+	replaced := make(map[string]bool, len(taskArns))
+	for _, arn := range taskArns {
+		replaced[arn] = true
+	}
+	pending := make([]string, 0, len(s.Pending))
+	for _, arn := range s.Pending {
+		if !replaced[arn] {
+			pending = append(pending, arn)
+		}
+	}
+	s.Pending = pending
+	s.Replaced = append(s.Replaced, taskArns...)
+	s.Replacements = append(s.Replacements, replacements...)
+}
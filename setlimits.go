@@ -2,31 +2,47 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"path"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/helpers"
 	"github.com/spf13/cobra"
 )
 
 var (
-	argCpu     int64
-	argSoftmem int64
-	argHardmem int64
+	argCpu                int64
+	argSoftmem            int64
+	argHardmem            int64
+	argLimitsContainer    string
+	argLimitsWait         bool
+	argLimitsSkipCapacity bool
 )
 
 var setlimitsCmd = &cobra.Command{
-	Use:   "setlimits",
+	Use:   "setlimits [cluster] [service]",
 	Short: "Set limits regarding CPU/SOFTMEM/HARDMEM of a service",
-	Long:  "View current cluster or service deployment status",
-	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) < 1 {
-			fmt.Printf("No service defined")
-			os.Exit(1)
-		}
+	Long: `
+Registers a new revision of the service's task definition with the new CPU and
+memory limits of one container and rolls the service to it. The limits have to
+fit the registered resources of the cluster's container instances, or the task
+size of a Fargate service.
 
+  skipper setlimits production api --container app --softmem 512 --hardmem 1024 --wait
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		separateProgress()
 		err := checkInput()
 		if err != nil {
-			fmt.Printf("An error occured : %s", err)
-			os.Exit(1)
+			helpers.Fatal(err)
+		}
+
+		ecs := ecsclient.New()
+		cluster, service := helpers.ServicePicker(ecs, args)
+
+		if err := setLimits(ecs, cluster, service); err != nil {
+			helpers.Fatal(err)
 		}
 	},
 }
@@ -34,11 +50,167 @@ var setlimitsCmd = &cobra.Command{
 func checkInput() error {
 	if argSoftmem != -1 && argHardmem != -1 {
 		if argSoftmem > argHardmem {
-			return fmt.Errorf("reserved Soft memory needs to be smaller than Hard Memory")
+			return helpers.Usagef("reserved Soft memory needs to be smaller than Hard Memory")
 		}
 	}
 	if argSoftmem == -1 && argHardmem == -1 && argCpu == -1 {
-		return fmt.Errorf("at least one of the properties need to be set [cpu,softmem,hardmem]")
+		return helpers.Usagef("at least one of the properties need to be set [cpu,softmem,hardmem]")
+	}
+	return nil
+}
+
+// setLimits registers a revision of the service's task definition with the limits
+// of the flags applied to one container and updates the service to it
+func setLimits(ecsclient_ ecsclient.Client, cluster, service string) error {
+	serviceObj, err := ecsclient_.FindService(&cluster, &service)
+	if err != nil {
+		return helpers.Wrap(err, "could not find service %s %s", cluster, service)
+	}
+
+	td, err := ecsclient_.GetTaskDefinition(serviceObj.TaskDefinition)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(td.ContainerDefinitions))
+	for i, d := range td.ContainerDefinitions {
+		names[i] = *d.Name
+	}
+	if argLimitsContainer == "" {
+		if argLimitsContainer, err = helpers.ChooseOption(names, "container"); err != nil {
+			return err
+		}
+	}
+
+	rdi := &ecsclient.RegisterTaskDefinitionInput{Container: aws.String(argLimitsContainer)}
+	if argCpu != -1 {
+		rdi.Cpu = aws.Int64(argCpu)
+	}
+	if argSoftmem != -1 {
+		rdi.Softmem = aws.Int64(argSoftmem)
+	}
+	if argHardmem != -1 {
+		rdi.Hardmem = aws.Int64(argHardmem)
+	}
+
+	current, proposed, err := ecsclient_.ProposeTaskDefinition(serviceObj.TaskDefinition, rdi)
+	if err != nil {
+		return err
+	}
+
+	var before, after *ecs.ContainerDefinition
+	for i, d := range proposed.ContainerDefinitions {
+		if *d.Name == argLimitsContainer {
+			before, after = current.ContainerDefinitions[i], d
+		}
+	}
+	if after == nil {
+		return helpers.NotFoundf("container %s not found in %s", argLimitsContainer, path.Base(*td.TaskDefinitionArn))
+	}
+
+	if after.Memory != nil && after.MemoryReservation != nil && *after.MemoryReservation > *after.Memory {
+		return fmt.Errorf("soft memory %d MB of %s would be above its hard memory %d MB", *after.MemoryReservation, argLimitsContainer, *after.Memory)
+	}
+	if after.Memory == nil && after.MemoryReservation == nil && !ecsclient.IsFargateTaskDefinition(td) {
+		return fmt.Errorf("container %s needs a soft or hard memory limit", argLimitsContainer)
+	}
+
+	fmt.Printf("Cluster:\t\t%s\n", cluster)
+	fmt.Printf("Service:\t\t%s\n", service)
+	fmt.Printf("Task Definition:\t%s\n", path.Base(*td.TaskDefinitionArn))
+	fmt.Println("---------------------------------------------------------------------------------------")
+	fmt.Printf("%s before: CPU %d, Soft Memory limit: %s, Hard memory limit: %s\n", *before.Name, aws.Int64Value(before.Cpu), formatLimit(before.MemoryReservation), formatLimit(before.Memory))
+	fmt.Printf("%s after:  CPU %d, Soft Memory limit: %s, Hard memory limit: %s\n", *after.Name, aws.Int64Value(after.Cpu), formatLimit(after.MemoryReservation), formatLimit(after.Memory))
+	fmt.Println("---------------------------------------------------------------------------------------")
+
+	if !argLimitsSkipCapacity {
+		if err := checkCapacity(ecsclient_, cluster, serviceObj, proposed); err != nil {
+			return err
+		}
+	}
+
+	if !helpers.GetYesNo(fmt.Sprintf("Register the new limits and update %s ?", service)) {
+		return helpers.ErrAborted
+	}
+
+	arn, err := ecsclient_.RegisterTaskDefinitionRevision(proposed)
+	if err != nil {
+		return helpers.Wrap(err, "register task definition")
+	}
+	fmt.Printf("Registered %s\n", path.Base(arn))
+
+	if argLimitsWait {
+		return rollout(ecsclient_, cluster, service, *serviceObj.TaskDefinition, arn)
+	}
+
+	if err := ecsclient_.UpdateServiceWithTaskDefinition(&cluster, &service, nil, &arn); err != nil {
+		return helpers.Wrap(err, "update service")
+	}
+	fmt.Printf("Updated %s to %s\n", service, path.Base(arn))
+	return nil
+}
+
+// checkCapacity makes sure a task of the definition fits the registered resources of
+// at least one container instance, and the desired count of them the whole cluster.
+// Fargate tasks have to fit their task size instead. On EC2 the task size is optional,
+// the containers have to fit what is set of it and it is reserved in their place.
+func checkCapacity(ecsclient_ ecsclient.Client, cluster string, serviceObj *ecs.Service, td *ecs.TaskDefinition) error {
+	cpu, memory := ecsclient.TaskResources(td)
+	taskCpu, taskMemory := ecsclient.TaskSize(td)
+
+	if ecsclient.IsFargateTaskDefinition(td) {
+		if cpu > taskCpu || memory > taskMemory {
+			return fmt.Errorf("containers need %d CPU units and %d MB memory, the task size is %d CPU units and %d MB memory", cpu, memory, taskCpu, taskMemory)
+		}
+		return nil
+	}
+
+	if taskCpu > 0 {
+		if cpu > taskCpu {
+			return fmt.Errorf("containers need %d CPU units, the task size is %d CPU units", cpu, taskCpu)
+		}
+		cpu = taskCpu
+	}
+	if taskMemory > 0 {
+		if memory > taskMemory {
+			return fmt.Errorf("containers need %d MB memory, the task size is %d MB memory", memory, taskMemory)
+		}
+		memory = taskMemory
+	}
+
+	instances, err := ecsclient_.GetClusterContainerInstances(&cluster)
+	if err != nil {
+		return err
+	}
+
+	var fits bool
+	var totalCpu, totalMemory, maxCpu, maxMemory int64
+	for _, ci := range instances {
+		if aws.StringValue(ci.Status) != "ACTIVE" {
+			continue
+		}
+		ciCpu := ecsclient.ResourceValue(ci.RegisteredResources, "CPU")
+		ciMemory := ecsclient.ResourceValue(ci.RegisteredResources, "MEMORY")
+		totalCpu += ciCpu
+		totalMemory += ciMemory
+		if ciCpu > maxCpu {
+			maxCpu = ciCpu
+		}
+		if ciMemory > maxMemory {
+			maxMemory = ciMemory
+		}
+		if cpu <= ciCpu && memory <= ciMemory {
+			fits = true
+		}
+	}
+
+	if !fits {
+		return fmt.Errorf("a task needs %d CPU units and %d MB memory, the largest container instance of %s has %d CPU units and %d MB memory", cpu, memory, cluster, maxCpu, maxMemory)
+	}
+
+	count := aws.Int64Value(serviceObj.DesiredCount)
+	if cpu*count > totalCpu || memory*count > totalMemory {
+		return fmt.Errorf("%d tasks need %d CPU units and %d MB memory, the container instances of %s have %d CPU units and %d MB memory registered", count, cpu*count, memory*count, cluster, totalCpu, totalMemory)
 	}
 	return nil
 }
@@ -48,4 +220,8 @@ func init() {
 	setlimitsCmd.Flags().Int64VarP(&argCpu, "cpu", "", -1, "The amount of cpu units ")
 	setlimitsCmd.Flags().Int64VarP(&argSoftmem, "softmem", "", -1, "The amount of soft-memory reserved MB ")
 	setlimitsCmd.Flags().Int64VarP(&argHardmem, "hardmem", "", -1, "The amount of hard-memory reserved MB ")
+	setlimitsCmd.Flags().StringVarP(&argLimitsContainer, "container", "c", "", "The container to set the limits of, asks if the task runs more than one")
+	setlimitsCmd.Flags().BoolVarP(&argLimitsWait, "wait", "w", false, "Wait until the service runs the new task definition, rolling back if it does not become stable")
+	setlimitsCmd.Flags().BoolVarP(&argNoRollback, "no-rollback", "", false, "Leave the service as it is if the deployment fails to become stable")
+	setlimitsCmd.Flags().BoolVarP(&argLimitsSkipCapacity, "skip-capacity-check", "", false, "Do not check the limits against the registered resources of the cluster")
 }
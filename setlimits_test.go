@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestCheckCapacity(t *testing.T) {
+	_, client := newTestBackend(t)
+	cluster, service := "production", "web"
+	serviceObj, err := client.FindService(&cluster, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the container instances register 2048 CPU units and 7982 MB memory each
+	definition := func(taskCpu, taskMemory string, cpu, memory int64, compatibilities ...string) *ecs.TaskDefinition {
+		td := &ecs.TaskDefinition{
+			RequiresCompatibilities: aws.StringSlice(compatibilities),
+			ContainerDefinitions: []*ecs.ContainerDefinition{
+				{Name: aws.String("app"), Cpu: aws.Int64(cpu), Memory: aws.Int64(memory)},
+			},
+		}
+		if taskCpu != "" {
+			td.Cpu = aws.String(taskCpu)
+		}
+		if taskMemory != "" {
+			td.Memory = aws.String(taskMemory)
+		}
+		return td
+	}
+
+	tests := []struct {
+		td      *ecs.TaskDefinition
+		desired int64
+		err     string
+	}{
+		{definition("", "", 512, 1024), 2, ""},
+		{definition("", "", 512, 8192), 2, "the largest container instance"},
+		{definition("", "", 1024, 4096), 4, "4 tasks need 4096 CPU units and 16384 MB memory"},
+		// the task size is reserved instead of what the containers need
+		{definition("1024", "4096", 256, 512), 2, ""},
+		{definition("", "8192", 256, 512), 2, "a task needs 256 CPU units and 8192 MB memory"},
+		{definition("4096", "", 256, 512), 2, "a task needs 4096 CPU units and 512 MB memory"},
+		{definition("1024", "4096", 256, 512), 4, "4 tasks need 4096 CPU units and 16384 MB memory"},
+		{definition("256", "4096", 512, 512), 2, "containers need 512 CPU units, the task size is 256 CPU units"},
+		{definition("1024", "512", 256, 1024), 2, "containers need 1024 MB memory, the task size is 512 MB memory"},
+		// Fargate tasks only have to fit their task size
+		{definition("256", "512", 256, 512, ecs.CompatibilityFargate), 100, ""},
+		{definition("256", "512", 256, 1024, ecs.CompatibilityFargate), 2, "the task size is 256 CPU units and 512 MB memory"},
+	}
+	for i, test := range tests {
+		serviceObj.DesiredCount = aws.Int64(test.desired)
+		err := checkCapacity(client, cluster, serviceObj, test.td)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%d: %s", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%d: expected %q, got %v", i, test.err, err)
+		}
+	}
+}
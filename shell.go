@@ -7,8 +7,8 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -57,10 +57,14 @@ func GetIdentifier(taskdef *string) *string {
 
 // ShellSelectTask is an interactive method which asks the user to select one of the few shell tasks
 // Todo: Create a distinct selection of tasks by task version
-func ShellSelectTask() (*ecsclient.TaskInfo, error) {
-	ecs := ecsclient.GetInstance()
+func ShellSelectTask(ecs ecsclient.Client) (*ecsclient.TaskInfo, error) {
 	cluster, service := helpers.ServicePicker(ecs, nil)
+	return SelectTask(ecs, cluster, service, "")
+}
 
+// SelectTask returns the running task of the service whose id starts with taskID, or asks
+// the user to choose one if taskID is empty
+func SelectTask(ecs ecsclient.Client, cluster, service, taskID string) (*ecsclient.TaskInfo, error) {
 	var taskinfos []*ecsclient.TaskInfo
 	var err error
 
@@ -69,44 +73,71 @@ func ShellSelectTask() (*ecsclient.TaskInfo, error) {
 		return nil, err
 	}
 
+	if len(taskinfos) == 0 {
+		return nil, helpers.NotFoundf("no running tasks found for service %s in cluster %s", service, cluster)
+	}
+
+	if taskID != "" {
+		for _, ti := range taskinfos {
+			if strings.HasPrefix(path.Base(*ti.TaskArn), taskID) || *ti.TaskArn == taskID {
+				return ti, nil
+			}
+		}
+		return nil, helpers.NotFoundf("no running task %s found for service %s in cluster %s", taskID, service, cluster)
+	}
+
 	var selectString []string
+	byLabel := make(map[string]*ecsclient.TaskInfo)
 	for _, ti := range taskinfos {
-		mystr := fmt.Sprintf("%s:%s\t - %s - %s", *ti.IpAddress, strconv.FormatInt(*ti.Hostport0, 10), *ti.TaskDefinitionArn, *ti.Ec2InstanceId)
+		containers := make([]string, len(ti.Containers))
+		for i, ci := range ti.Containers {
+			containers[i] = ti.Describe(ci)
+		}
+		mystr := fmt.Sprintf("%s\t - %s - %s - %s", aws.StringValue(ti.IpAddress), path.Base(*ti.TaskArn), path.Base(*ti.TaskDefinitionArn), strings.Join(containers, " | "))
 		selectString = append(selectString, mystr)
+		byLabel[mystr] = ti
 	}
 
-	choice, _ := strconv.Atoi(helpers.PickOption(selectString, "Please choose a task to run"))
-
-	return taskinfos[choice], nil
+	label, err := helpers.ChooseOption(selectString, "task to run")
+	if err != nil {
+		return nil, err
+	}
+	return byLabel[label], nil
 }
 
 // InvokeShell method called to start invoking a shell inside a newly created docker
-func InvokeShell() error {
-	livetask, err := ShellSelectTask()
+func InvokeShell(ecs ecsclient.Client, ec2cl ec2client.Client) error {
+	livetask, err := ShellSelectTask(ecs)
 	if err != nil {
 		return err
 	}
 
-	tasks := GetRunningTasks(livetask.TaskDefinitionArn)
+	container, err := helpers.ContainerPicker(livetask, argShellContainer)
+	if err != nil {
+		return err
+	}
+
+	tasks := GetRunningTasks(ecs, livetask.TaskDefinitionArn)
+
+	if livetask.IsFargate() {
+		return InvokeShellOnFargateTask(ecs, livetask, tasks, *container.Name)
+	}
 
 	if len(tasks) > 0 {
-		InvokeShellOnActiveTask(tasks)
+		InvokeShellOnActiveTask(ecs, ec2cl, tasks, *container.Name)
 	} else {
 
-		instancecopy := StartInstance(livetask)
+		instancecopy := StartInstance(ec2cl, livetask)
 
-		taskcopy := StartTaskOnInstance(livetask, instancecopy)
+		taskcopy := StartTaskOnInstance(ecs, livetask, instancecopy)
 
-		DockerStart(instancecopy, taskcopy)
+		DockerStart(ec2cl, instancecopy, taskcopy, *container.Name)
 	}
 	return nil
 }
 
-// InvokeShellOnActiveTask invokes a shell on an already running debug task
-func InvokeShellOnActiveTask(tasks []*ecs.Task) {
-	ecs := ecsclient.GetInstance()
-	ec2cl := ec2client.GetInstance()
-
+// InvokeShellOnActiveTask invokes a shell in the named container of an already running debug task
+func InvokeShellOnActiveTask(ecs ecsclient.Client, ec2cl ec2client.Client, tasks []*ecs.Task, containerName string) {
 	clusterParts := strings.Split(*tasks[0].ClusterArn, "/")
 	clusterName := clusterParts[len(clusterParts)-1]
 
@@ -123,13 +154,90 @@ func InvokeShellOnActiveTask(tasks []*ecs.Task) {
 		os.Exit(1)
 	}
 
-	DockerStart(instance, tasks[0])
+	DockerStart(ec2cl, instance, tasks[0], containerName)
+
+}
+
+// InvokeShellOnFargateTask runs a copy of a Fargate task in the debug cluster, or reuses a running one.
+// Fargate has no host to tunnel into, so the shell is opened through ECS Exec instead.
+func InvokeShellOnFargateTask(ecs ecsclient.Client, livetask *ecsclient.TaskInfo, tasks []*ecs.Task, containerName string) error {
+	if len(tasks) == 0 {
+		networkConfiguration, err := serviceNetworkConfiguration(ecs, livetask)
+		if err != nil {
+			return err
+		}
+
+		taskrolearn, _ := ecs.GetTaskRoleArn(livetask.TaskDefinitionArn)
+
+		rto, err := ecs.RunFargateTask(&DEBUGCLUSTERNAME, livetask.TaskDefinitionArn, taskrolearn, GetKeypairName(), networkConfiguration)
+		if err != nil {
+			return fmt.Errorf("could not run debug task on Fargate: %v", err)
+		}
+		if len(rto.Failures) > 0 {
+			return fmt.Errorf("could not run debug task on Fargate: %s", aws.StringValue(rto.Failures[0].Reason))
+		}
+		if len(rto.Tasks) != 1 {
+			return fmt.Errorf("we don't have one task running")
+		}
+
+		logger.Println("Waiting for the debug task to start on Fargate")
+		if err := ecs.WaitForTaskRunning(&DEBUGCLUSTERNAME, rto.Tasks[0].TaskArn); err != nil {
+			return fmt.Errorf("task takes too long to start: %v", err)
+		}
+
+		tasks = GetRunningTasks(ecs, livetask.TaskDefinitionArn)
+		if len(tasks) == 0 {
+			return fmt.Errorf("debug task %s stopped right after it was started", *rto.Tasks[0].TaskArn)
+		}
+	}
+
+	task := tasks[0]
+	fmt.Printf("Debug task %s runs on Fargate in cluster %s on %s\n", path.Base(*task.TaskArn), DEBUGCLUSTERNAME, aws.StringValue(ecsclient.TaskPrivateIPv4Address(task)))
 
+	if _, err := ExecInContainer(ecs, DEBUGCLUSTERNAME, *task.TaskArn, containerName, "/bin/sh", true); err != nil {
+		logger.Printf("Could not open a shell in the debug task: %v", err)
+	}
+
+	StopDebugTask(ecs, task)
+	return nil
+}
+
+// serviceNetworkConfiguration returns the awsvpc configuration of the service which started the task,
+// for tasks without a service the subnet of the task's ENI is used
+func serviceNetworkConfiguration(ecsclient_ ecsclient.Client, livetask *ecsclient.TaskInfo) (*ecs.NetworkConfiguration, error) {
+	if service := livetask.ServiceName(); service != "" {
+		cluster := path.Base(*livetask.ClusterArn)
+		serviceObj, err := ecsclient_.FindService(&cluster, &service)
+		if err != nil {
+			return nil, err
+		}
+		if serviceObj.NetworkConfiguration != nil && serviceObj.NetworkConfiguration.AwsvpcConfiguration != nil {
+			return serviceObj.NetworkConfiguration, nil
+		}
+	}
+	if livetask.SubnetId == nil {
+		return nil, fmt.Errorf("could not determine the network configuration of task %s", *livetask.TaskArn)
+	}
+	return &ecs.NetworkConfiguration{
+		AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
+			Subnets: []*string{livetask.SubnetId},
+		},
+	}, nil
+}
+
+// StopDebugTask is an interactive method taking care of stopping a started debug task
+func StopDebugTask(ecs ecsclient.Client, task *ecs.Task) {
+	if helpers.GetYesNo("Do you want the debug task to stop?") {
+		log.Printf("Stopping task %s", *task.TaskArn)
+		if _, err := ecs.StopTask(&DEBUGCLUSTERNAME, task.TaskArn); err != nil {
+			log.Fatalf("Could not stop task %s error: %v\n", *task.TaskArn, err)
+		}
+		log.Println("Succesfully stopped task")
+	}
 }
 
 // GetRunningTasks gets running DEBUG tasks belonging to the user executing skipper
-func GetRunningTasks(taskdefinition *string) []*ecs.Task {
-	ecs := ecsclient.GetInstance()
+func GetRunningTasks(ecs ecsclient.Client, taskdefinition *string) []*ecs.Task {
 	tasks, err := ecs.GetClusterTasksWithDefinition(&DEBUGCLUSTERNAME, taskdefinition)
 	if err != nil {
 		logger.Println("Could not retrieve tasks")
@@ -154,7 +262,7 @@ func GetRunningTasks(taskdefinition *string) []*ecs.Task {
 }
 
 // StartInstance starts an EC2 Instance with keypair belonging to a user
-func StartInstance(livetask *ecsclient.TaskInfo) *ec2.Instance {
+func StartInstance(ec2cl ec2client.Client, livetask *ecsclient.TaskInfo) *ec2.Instance {
 	identifier := GetIdentifier(livetask.TaskDefinitionArn)
 
 	userdata := fmt.Sprintf(`#!/bin/bash
@@ -162,8 +270,6 @@ echo ECS_CLUSTER=%s >> /etc/ecs/ecs.config
 echo ECS_INSTANCE_ATTRIBUTES={\"group\": \"%s\"} >> /etc/ecs/ecs.config
 `, DEBUGCLUSTERNAME, *identifier)
 
-	ec2cl := ec2client.GetInstance()
-
 	// SelectTask(ecs2client_)
 	keypairname := GetKeypairName()
 	key_on_aws := ec2cl.KeypairExists(keypairname)
@@ -199,8 +305,7 @@ echo ECS_INSTANCE_ATTRIBUTES={\"group\": \"%s\"} >> /etc/ecs/ecs.config
 }
 
 // StartTaskOnInstance starts task on ec2 instance ( debug instance )
-func StartTaskOnInstance(livetask *ecsclient.TaskInfo, ec2instance *ec2.Instance) *ecs.Task {
-	ecsclient_ := ecsclient.GetInstance()
+func StartTaskOnInstance(ecsclient_ ecsclient.Client, livetask *ecsclient.TaskInfo, ec2instance *ec2.Instance) *ecs.Task {
 
 	varInstances := make([]*ec2.Instance, 1)
 	varInstances[0] = ec2instance
@@ -228,7 +333,20 @@ func StartTaskOnInstance(livetask *ecsclient.TaskInfo, ec2instance *ec2.Instance
 
 	taskrolearn, _ := ecsclient_.GetTaskRoleArn(livetask.TaskDefinitionArn)
 
-	sto, err2 := ecsclient_.StartTaskOnContainerInstance(&DEBUGCLUSTERNAME, livetask.TaskDefinitionArn, containerinstances[0].ContainerInstanceArn, taskrolearn, ec2instance.KeyName)
+	var networkConfiguration *ecs.NetworkConfiguration
+	if livetask.NetworkInterfaceId != nil {
+		// awsvpc tasks get their own ENI, keep it in the subnet of the live task
+		networkConfiguration, err = serviceNetworkConfiguration(ecsclient_, livetask)
+		if err != nil {
+			logger.Printf("Error happened getting the network configuration %s\n", err)
+			os.Exit(1)
+		}
+		if livetask.SubnetId != nil {
+			networkConfiguration.AwsvpcConfiguration.Subnets = []*string{livetask.SubnetId}
+		}
+	}
+
+	sto, err2 := ecsclient_.StartTaskOnContainerInstance(&DEBUGCLUSTERNAME, livetask.TaskDefinitionArn, containerinstances[0].ContainerInstanceArn, taskrolearn, ec2instance.KeyName, networkConfiguration)
 
 	if len(sto.Failures) > 0 || err2 != nil {
 		logger.Println("Problem running task")
@@ -262,8 +380,8 @@ func GetUnixSocketPath() (*string, *string) {
 	return &localSocket, &localSocketPath
 }
 
-// DockerStart takes care of creating an SSH Tunnel and forwarding the docket socket to be able to exec into the docker of the remote task
-func DockerStart(ec2instance *ec2.Instance, task *ecs.Task) error {
+// DockerStart takes care of creating an SSH Tunnel and forwarding the docket socket to be able to exec into the named container of the remote task
+func DockerStart(ec2cl ec2client.Client, ec2instance *ec2.Instance, task *ecs.Task, containerName string) error {
 
 	dockerClient, err := StartDockerTunnel(*ec2instance.PrivateIpAddress)
 	if err != nil {
@@ -282,7 +400,7 @@ func DockerStart(ec2instance *ec2.Instance, task *ecs.Task) error {
 		if !ok {
 			continue
 		}
-		if value == *task.TaskArn {
+		if value == *task.TaskArn && container.Labels["com.amazonaws.ecs.container-name"] == containerName {
 			exec, err := dockerClient.CreateExec(docker.CreateExecOptions{
 				Container:    container.ID,
 				AttachStdin:  true,
@@ -302,20 +420,18 @@ func DockerStart(ec2instance *ec2.Instance, task *ecs.Task) error {
 				// This is where we get stuck exiting the shell
 				logger.Println("error execing container:", err)
 			}
+			break
 		}
-		break
 	}
-	StopInstance(ec2instance)
+	StopInstance(ec2cl, ec2instance)
 	return nil
 }
 
 // StopInstance is an interactive method taking care of stopping a started debug instance
-func StopInstance(ec2instance *ec2.Instance) {
-	choicelist := []string{"Yes", "No"}
-	choice := helpers.PickOption(choicelist, "Do you want the instance to terminate?")
-	if choice == "Yes" {
+func StopInstance(ec2cl ec2client.Client, ec2instance *ec2.Instance) {
+	if helpers.GetYesNo("Do you want the instance to terminate?") {
 		log.Printf("Terminating instance %s", *ec2instance.InstanceId)
-		err := safeTerminateInstance(ec2instance)
+		err := safeTerminateInstance(ec2cl, ec2instance)
 		if err != nil {
 			log.Fatalf("Could not terminate instance %s error: %v\n", *ec2instance.InstanceId, err)
 		}
@@ -325,20 +441,19 @@ func StopInstance(ec2instance *ec2.Instance) {
 
 // safeTerminateInstance is a private method which wraps around the ec2client terminate
 // to make sure the instance is started by the executing skipper user
-func safeTerminateInstance(ec2instance *ec2.Instance) error {
+func safeTerminateInstance(ec2cl ec2client.Client, ec2instance *ec2.Instance) error {
 	userkeyname := GetKeypairName()
 	if *ec2instance.KeyName != *userkeyname {
 		logger.Fatalf("user not eligible to destroy instance; different keypair")
 	}
 
-	return ec2client.GetInstance().TerminateInstance(ec2instance)
+	return ec2cl.TerminateInstance(ec2instance)
 }
 
 // SetKeypair sets the keypair on both local filesystem and EC2
-func SetKeypair() {
+func SetKeypair(ec2cl ec2client.Client) {
 	EnsureSSHDir()
 
-	ec2cl := ec2client.GetInstance()
 	keyname := GetKeypairName()
 
 	key_on_aws := ec2cl.KeypairExists(keyname)
@@ -5,8 +5,13 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/blinkist/skipper/aws/ec2client"
+	"github.com/blinkist/skipper/aws/ecsclient"
 )
 
+var argShellContainer string
+
 var tunnelCmd = &cobra.Command{
 	Use:   "tunnel [service]",
 	Short: "Secure Shell into one of the service container instances' EC2 host machines",
@@ -14,7 +19,7 @@ var tunnelCmd = &cobra.Command{
 TUNNELLL
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		err := InvokeShell()
+		err := InvokeShell(ecsclient.GetInstance(), ec2client.GetInstance())
 		if err != nil {
 			fmt.Printf("error invoking shell: %v", err)
 			os.Exit(-1)
@@ -38,7 +43,7 @@ in there through this command using a menu system rather than figuring it out
 yourself! Yay. I guess.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		SetKeypair()
+		SetKeypair(ec2client.GetInstance())
 	},
 }
 
@@ -69,4 +74,6 @@ func init() {
 	shellCmd.AddCommand(setkeypairCmd)
 	shellCmd.AddCommand(purgeKeypairCmd)
 	shellCmd.AddCommand(tunnelCmd)
+
+	tunnelCmd.Flags().StringVarP(&argShellContainer, "container", "c", "", "Name of the container to open the shell in, asks if the task runs more than one")
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ec2client"
+)
+
+func TestDebugCloneOnInstance(t *testing.T) {
+	defer testEnv(t)()
+	backend, client := newTestBackend(t)
+	backend.AddCluster(DEBUGCLUSTERNAME)
+	ec2cl := ec2client.NewWithClient(backend.EC2())
+
+	livetask, err := SelectTask(client, "production", "web", "")
+	if err == nil {
+		t.Fatal("expected choosing one of two tasks to need a terminal")
+	}
+	tasks, err := client.GetContainerInstances(aws.String("production"), aws.String("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if livetask, err = SelectTask(client, "production", "web", path.Base(*tasks[0].TaskArn)[:8]); err != nil {
+		t.Fatal(err)
+	}
+
+	SetKeypair(ec2cl)
+	if !ec2cl.KeypairExists(GetKeypairName()) || !PrivateKeyExists(*GetKeypairName()) {
+		t.Fatal("expected the keypair to exist on AWS and locally")
+	}
+	instance := StartInstance(ec2cl, livetask)
+	task := StartTaskOnInstance(client, livetask, instance)
+	if *task.TaskDefinitionArn != *livetask.TaskDefinitionArn || aws.StringValue(task.StartedBy) != "skipper-tester" {
+		t.Errorf("expected a copy of %s started by skipper-tester, got %s by %s", *livetask.TaskDefinitionArn, *task.TaskDefinitionArn, aws.StringValue(task.StartedBy))
+	}
+
+	running := GetRunningTasks(client, livetask.TaskDefinitionArn)
+	if len(running) != 1 || *running[0].TaskArn != *task.TaskArn {
+		t.Fatalf("expected the debug task to run, got %d tasks", len(running))
+	}
+	instanceID, err := client.GetInstanceIDForContainerArn(aws.String(DEBUGCLUSTERNAME), running[0].ContainerInstanceArn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *instanceID != *instance.InstanceId {
+		t.Errorf("expected the debug task to run on %s, got %s", *instance.InstanceId, *instanceID)
+	}
+
+	StopDebugTask(client, task)
+	if running := GetRunningTasks(client, livetask.TaskDefinitionArn); len(running) != 0 {
+		t.Errorf("expected the debug task to be stopped, got %d tasks", len(running))
+	}
+	StopInstance(ec2cl, instance)
+	described, err := ec2cl.DescribeInstance(instance.InstanceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(described.State.Name) != "terminated" {
+		t.Errorf("expected the debug instance to be terminated, got %s", aws.StringValue(described.State.Name))
+	}
+}
+
+func TestDebugCloneOnFargate(t *testing.T) {
+	defer testEnv(t)()
+	backend, client := newTestBackend(t)
+	backend.AddCluster(DEBUGCLUSTERNAME)
+	if _, err := backend.ECS().RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family:                  aws.String("worker"),
+		NetworkMode:             aws.String(ecs.NetworkModeAwsvpc),
+		RequiresCompatibilities: aws.StringSlice([]string{ecs.CompatibilityFargate}),
+		Cpu:                     aws.String("256"),
+		Memory:                  aws.String("512"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{{
+			Name:  aws.String("worker"),
+			Image: aws.String("worker:v1"),
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.AddFargateService("production", "worker", "worker:1", 1, "subnet-12345678"); err != nil {
+		t.Fatal(err)
+	}
+
+	commands := make(chan string, 1)
+	agent := httptest.NewServer(backend.SessionAgent(func(command string, stdin io.Reader, stdout io.Writer) int {
+		commands <- command
+		io.WriteString(stdout, "$ ")
+		return 0
+	}))
+	defer agent.Close()
+	backend.SessionURL = "ws" + strings.TrimPrefix(agent.URL, "http")
+
+	livetask, err := SelectTask(client, "production", "worker", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !livetask.IsFargate() {
+		t.Fatalf("expected %s to run on Fargate", *livetask.TaskArn)
+	}
+	if err := InvokeShellOnFargateTask(client, livetask, GetRunningTasks(client, livetask.TaskDefinitionArn), "worker"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case command := <-commands:
+		if command != "/bin/sh" {
+			t.Errorf("expected a shell in the debug task, got %q", command)
+		}
+	default:
+		t.Error("expected a session in the debug task")
+	}
+	if running := GetRunningTasks(client, livetask.TaskDefinitionArn); len(running) != 0 {
+		t.Errorf("expected the debug task to be stopped, got %d tasks", len(running))
+	}
+	stopped, err := backend.ECS().ListTasks(&ecs.ListTasksInput{
+		Cluster:       aws.String(DEBUGCLUSTERNAME),
+		DesiredStatus: aws.String(ecs.DesiredStatusStopped),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stopped.TaskArns) != 1 {
+		t.Errorf("expected one stopped debug task, got %d", len(stopped.TaskArns))
+	}
+}
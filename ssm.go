@@ -3,8 +3,11 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/blinkist/skipper/aws/ecsclient"
@@ -12,28 +15,40 @@ import (
 	"github.com/blinkist/skipper/helpers"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
-func listSSM(service *string) {
-	ssm := ssmclient.New()
-	global := "global"
-	listParams, _ := ssm.GetParameters(&global)
-	green := color.New(color.FgGreen).SprintFunc()
-	whitebold := color.New(color.FgWhite, color.Bold).SprintFunc()
-	fmt.Printf("%s %s %s\n", "===", whitebold(global), whitebold("Config Vars"))
-	for v := range listParams {
-		key := strings.Replace(*listParams[v].Key, fmt.Sprintf("/application/%s/", global), "", -1)
-		fmt.Printf("%-30s%s \t%s\n", green(key), ":", whitebold(*listParams[v].Value))
-	}
-
-	listParams, _ = ssm.GetParameters(service)
+var (
+	argSSMName  string
+	argSSMValue string
+	argSSMFile  string
+)
 
-	fmt.Printf("%s %s %s\n", "===", whitebold(*service), whitebold("Config Vars"))
-	for v := range listParams {
-		key := strings.Replace(*listParams[v].Key, fmt.Sprintf("/application/%s/", *service), "", -1)
-		fmt.Printf("%-30s%s \t%s\n", green(key), ":", whitebold(*listParams[v].Value))
+// listSSM prints the global parameters and the ones of the application
+func listSSM(ssm ssmclient.Client, global, ns *ssmNamespace) error {
+	out := make([]*parametersOutput, 0, 2)
+	for _, n := range []*ssmNamespace{global, ns} {
+		listParams, err := ssm.GetParameters(&n.Path)
+		if err != nil {
+			return helpers.Wrap(err, "could not list the parameters of %s", n.Application)
+		}
+		params := &parametersOutput{Application: n.Application, Path: n.Path, Parameters: make([]*parameterOutput, len(listParams))}
+		for i, p := range listParams {
+			params.Parameters[i] = newParameterOutput(p, n.Prefix())
+		}
+		out = append(out, params)
 	}
 
+	return printOutput(out, func() {
+		green := color.New(color.FgGreen).SprintFunc()
+		whitebold := color.New(color.FgWhite, color.Bold).SprintFunc()
+		for _, params := range out {
+			fmt.Printf("%s %s %s (%s)\n", "===", whitebold(params.Application), whitebold("Config Vars"), params.Path)
+			for _, p := range params.Parameters {
+				fmt.Printf("%-30s%s \t%s\n", green(p.Name), ":", whitebold(p.Value))
+			}
+		}
+	})
 }
 
 var ssmindexCmd = &cobra.Command{
@@ -49,127 +64,307 @@ var ssmListCmd = &cobra.Command{
 
 		ecs := ecsclient.New()
 		cluster, service := helpers.ServicePicker(ecs, args)
-		stripped := strings.Replace(service, cluster+"-", "", -1)
-		stripped = strings.Replace(stripped, "-web", "", -1)
-		stripped = strings.Replace(stripped, "-worker", "", -1)
-		listSSM(&stripped)
+		ns := pickSSMNamespace(ecs, cluster, service)
+		global, err := resolveGlobalSSMNamespace(cluster, service)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+		if err := listSSM(ssmclient.New(), global, ns); err != nil {
+			helpers.Fatal(err)
+		}
 	},
 }
 
 var ssmDeleteCmd = &cobra.Command{
 	Use:   "delete",
-	Short: "Put one SSM parameter",
-	Long:  "Put one SSM parameter",
+	Short: "Delete one SSM parameter",
+	Long: `
+Deletes one parameter of the service's application once confirmed. The name is
+asked for unless --name is set.
+
+  skipper ssm delete production api --name OLD_FLAG --yes
+`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		ecs := ecsclient.New()
 		cluster, service := helpers.ServicePicker(ecs, args)
-		stripped := strings.Replace(service, cluster+"-", "", -1)
-		stripped = strings.Replace(stripped, "-web", "", -1)
-		stripped = strings.Replace(stripped, "-worker", "", -1)
-		fmt.Println("")
-		fmt.Println("Please enter the name of the parameter you want to delete. ")
-
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Name   : ")
-		name, _ := reader.ReadString('\n')
-		fmt.Printf("Are you sure you want to delete %s : ", strings.TrimRight(name, "\n"))
-		ack, _ := reader.ReadString('\n')
-
-		if strings.TrimRight(ack, "\n") != "yes" {
-			fmt.Println("Not deleting, exitting")
-			os.Exit(1)
+		ns := pickSSMNamespace(ecs, cluster, service)
 
+		if err := deleteSSM(ssmclient.New(), ns, argSSMName); err != nil {
+			helpers.Fatal(err)
 		}
-		fmt.Println("Deleting the key")
-
-		ssm := ssmclient.New()
+	},
+}
 
-		err := ssm.DeleteParameter(&stripped, &name)
-		if err != nil {
-			panic(fmt.Sprintf("Error deleting: %s\n", err.Error()))
+// deleteSSM deletes one parameter of the application once confirmed, the name is asked
+// for if it is empty
+func deleteSSM(ssm ssmclient.Client, ns *ssmNamespace, name string) error {
+	if name == "" {
+		fmt.Println("")
+		fmt.Println("Please enter the name of the parameter you want to delete. ")
+		var err error
+		if name, err = promptSSM("Name   : "); err != nil {
+			return err
 		}
+	}
+	if !helpers.GetYesNo(fmt.Sprintf("Are you sure you want to delete %s ?", ssmclient.ParameterName(ns.Path, name))) {
+		return helpers.ErrAborted
+	}
+	fmt.Println("Deleting the key")
 
-	},
+	if err := ssm.DeleteParameter(&ns.Path, &name); err != nil {
+		return helpers.Wrap(err, "could not delete %s", name)
+	}
+	return nil
 }
 
 var ssmHistoryCmd = &cobra.Command{
 	Use:   "history",
 	Short: "History of one SSM parameter",
-	Long:  "History of one SSM parameter",
+	Long: `
+Shows the versions of one parameter of the service's application, newest first.
+The name is asked for unless --name is set.
+
+  skipper ssm history production api --name DATABASE_URL
+`,
 	Run: func(cmd *cobra.Command, args []string) {
 		ecs := ecsclient.New()
 		cluster, service := helpers.ServicePicker(ecs, args)
-		stripped := strings.Replace(service, cluster+"-", "", -1)
-		stripped = strings.Replace(stripped, "-web", "", -1)
-		stripped = strings.Replace(stripped, "-worker", "", -1)
+		ns := pickSSMNamespace(ecs, cluster, service)
 
-		fmt.Println("")
-		fmt.Println("Please enter the name of the configuration parameter ")
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Name   : ")
-		nameUntrimmed, _ := reader.ReadString('\n')
-		name := strings.TrimRight(nameUntrimmed, "\n")
+		name := argSSMName
+		if name == "" {
+			fmt.Println("")
+			fmt.Println("Please enter the name of the configuration parameter ")
+			var err error
+			if name, err = promptSSM("Name   : "); err != nil {
+				helpers.Fatal(err)
+			}
+		}
 
-		ssm := ssmclient.New()
-		green := color.New(color.FgGreen).SprintFunc()
-		whitebold := color.New(color.FgWhite, color.Bold).SprintFunc()
+		if err := historySSM(ssmclient.New(), ns, name); err != nil {
+			helpers.Fatal(err)
+		}
+	},
+}
 
-		listParams, _ := ssm.GetParameterHistory(&stripped, &name)
+// historySSM prints the versions of one parameter of the application, newest first
+func historySSM(ssm ssmclient.Client, ns *ssmNamespace, name string) error {
+	listParams, err := ssm.GetParameterHistory(&ns.Path, &name)
+	if err != nil {
+		return helpers.Wrap(err, "could not get the history of %s", name)
+	}
 
-		sort.Slice(listParams, func(i, j int) bool {
-			return *listParams[i].Version > *listParams[j].Version
-		})
+	sort.Slice(listParams, func(i, j int) bool {
+		return *listParams[i].Version > *listParams[j].Version
+	})
+	out := &parametersOutput{Application: ns.Application, Path: ns.Path, Parameters: make([]*parameterOutput, len(listParams))}
+	for i, p := range listParams {
+		out.Parameters[i] = newParameterVersionOutput(p, ns.Prefix())
+	}
 
-		for v := range listParams {
-			key := strings.Replace(*listParams[v].Key, fmt.Sprintf("/application/%s/", stripped), "", -1)
+	return printOutput(out, func() {
+		green := color.New(color.FgGreen).SprintFunc()
+		whitebold := color.New(color.FgWhite, color.Bold).SprintFunc()
+		for _, p := range out.Parameters {
 			fmt.Println("-------------------------------------------------------------------------------------")
-			fmt.Printf("%-30s%s \t%s\n", green("VERSION"), ":", whitebold(*listParams[v].Version))
-			fmt.Printf("%-30s%s \t%s\n", green("LastModifiedDate"), ":", whitebold(*listParams[v].LastModifiedDate))
+			fmt.Printf("%-30s%s \t%s\n", green("VERSION"), ":", whitebold(p.Version))
+			fmt.Printf("%-30s%s \t%s\n", green("LastModifiedDate"), ":", whitebold(p.LastModifiedDate))
 
-			fmt.Printf("%-30s%s \t%s\n", green(key), ":", whitebold(*listParams[v].Value))
-			fmt.Printf("%-30s%s \t%s\n", green("User"), ":", whitebold(*listParams[v].LastModifiedUser))
+			fmt.Printf("%-30s%s \t%s\n", green(p.Name), ":", whitebold(p.Value))
+			fmt.Printf("%-30s%s \t%s\n", green("User"), ":", whitebold(p.LastModifiedUser))
 			fmt.Println("-------------------------------------------------------------------------------------")
-
 		}
-	},
+	})
 }
 
 var ssmPutCmd = &cobra.Command{
 	Use:   "put",
 	Short: "Put one SSM parameter",
-	Long:  "Put one SSM parameter",
+	Long: `
+Puts parameters of the service's application. The parameter is given by --name
+and --value, or --name with the value piped on stdin. --file puts every NAME=value
+line of the file, or of stdin with --file -. Without them the name and value are
+asked for.
+
+  skipper ssm put production api --name LOG_LEVEL --value debug
+  vault read -field=url secret/db | skipper ssm put production api --name DATABASE_URL
+  skipper ssm put production api --file api.env
+`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		ecs := ecsclient.New()
 		cluster, service := helpers.ServicePicker(ecs, args)
-		stripped := strings.Replace(service, cluster+"-", "", -1)
-		stripped = strings.Replace(stripped, "-web", "", -1)
-		stripped = strings.Replace(stripped, "-worker", "", -1)
-		fmt.Println("")
-		fmt.Println("Please enter the name and the value of the configuration parameter ")
-		fmt.Println("that you want to enter. Do not prepend /application/ etc. etc.")
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Name   : ")
-		nameUntrimmed, _ := reader.ReadString('\n')
-		name := strings.TrimRight(nameUntrimmed, "\n")
-		fmt.Print("Value : ")
-		valueUntrimmed, _ := reader.ReadString('\n')
-		value := strings.TrimRight(valueUntrimmed, "\n")
-
-		ssm := ssmclient.New()
-
-		err := ssm.PutParameter(&stripped, &name, &value)
+		ns := pickSSMNamespace(ecs, cluster, service)
+
+		params, err := ssmPutParameters(cmd.Flags().Changed("value"))
 		if err != nil {
-			panic(fmt.Sprintf("Error deleting: %s\n", err.Error()))
+			helpers.Fatal(err)
+		}
+
+		if err := putSSM(ssmclient.New(), ns, params); err != nil {
+			helpers.Fatal(err)
 		}
 	},
 }
 
+// putSSM puts the parameters into the application, encrypted with its KMS key
+func putSSM(ssm ssmclient.Client, ns *ssmNamespace, params []*ssmParameter) error {
+	for _, p := range params {
+		if err := ssm.PutParameter(&ns.Path, &p.name, &p.value, &ns.KmsKey); err != nil {
+			return helpers.Wrap(err, "could not put %s", p.name)
+		}
+		if len(params) > 1 {
+			fmt.Printf("Put %s\n", p.name)
+		}
+	}
+	return nil
+}
+
+// ssmParameter is a parameter to put, its name is relative to the application
+type ssmParameter struct {
+	name  string
+	value string
+}
+
+// pickSSMNamespace returns where the parameters of the service are kept, it exits if the
+// ssm config is invalid
+func pickSSMNamespace(ecs ecsclient.Client, cluster, service string) *ssmNamespace {
+	ns, err := resolveSSMNamespace(ecs, cluster, service)
+	if err != nil {
+		helpers.Fatal(err)
+	}
+	return ns
+}
+
+// ssmApplication returns the application of the service, its name without the cluster
+// and the -web or -worker suffix. It is the default of the ssm config.
+func ssmApplication(cluster, service string) string {
+	stripped := strings.Replace(service, cluster+"-", "", -1)
+	stripped = strings.Replace(stripped, "-web", "", -1)
+	stripped = strings.Replace(stripped, "-worker", "", -1)
+	return stripped
+}
+
+// ssmPutParameters returns the parameters to put from the flags, stdin or the user.
+// hasValue tells --value is set, it may be empty.
+func ssmPutParameters(hasValue bool) ([]*ssmParameter, error) {
+	if argSSMFile != "" {
+		if argSSMName != "" || hasValue {
+			return nil, helpers.Usagef("--file can not be combined with --name or --value")
+		}
+		if argSSMFile == "-" {
+			return readSSMParameters(os.Stdin, "stdin")
+		}
+		f, err := os.Open(argSSMFile)
+		if err != nil {
+			return nil, helpers.NotFoundf("could not open %s: %v", argSSMFile, err)
+		}
+		defer f.Close()
+		return readSSMParameters(f, argSSMFile)
+	}
+
+	if argSSMName != "" {
+		if hasValue {
+			return []*ssmParameter{{name: argSSMName, value: argSSMValue}}, nil
+		}
+		if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			data, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return nil, err
+			}
+			return []*ssmParameter{{name: argSSMName, value: strings.TrimSuffix(string(data), "\n")}}, nil
+		}
+	} else if hasValue {
+		return nil, helpers.Usagef("--value needs --name")
+	}
+
+	if helpers.NonInteractive {
+		return nil, helpers.Usagef("--name with --value or the value on stdin, or --file, is required with --non-interactive")
+	}
+
+	fmt.Println("")
+	fmt.Println("Please enter the name and the value of the configuration parameter ")
+	fmt.Println("that you want to enter. Do not prepend the path of the application.")
+	name := argSSMName
+	if name == "" {
+		var err error
+		if name, err = promptSSM("Name   : "); err != nil {
+			return nil, err
+		}
+	}
+	value, err := promptSSM("Value : ")
+	if err != nil {
+		return nil, err
+	}
+	return []*ssmParameter{{name: name, value: value}}, nil
+}
+
+// readSSMParameters reads NAME=value lines, skipping empty lines and # comments. The
+// value is everything after the first =, unquoted if it is in double or single quotes.
+func readSSMParameters(r io.Reader, source string) ([]*ssmParameter, error) {
+	params := make([]*ssmParameter, 0)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(strings.TrimSpace(text), "#") {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, helpers.Usagef("%s line %d: expected NAME=value", source, line)
+		}
+		value, err := unquoteSSMValue(parts[1])
+		if err != nil {
+			return nil, helpers.Usagef("%s line %d: invalid quoted value of %s: %v", source, line, name, err)
+		}
+		params = append(params, &ssmParameter{name: name, value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return nil, helpers.Usagef("%s has no parameters", source)
+	}
+	return params, nil
+}
+
+// unquoteSSMValue returns the value of a NAME=value line, double quoted values are Go
+// strings like the ones quoteSSMValue writes, single quoted ones are kept as they are
+func unquoteSSMValue(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return strconv.Unquote(value)
+	}
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1], nil
+	}
+	return value, nil
+}
+
+// promptSSM asks for a line, the name or value of a parameter
+func promptSSM(label string) (string, error) {
+	if helpers.NonInteractive {
+		return "", helpers.Usagef("--name is required with --non-interactive")
+	}
+	fmt.Print(label)
+	text, err := helpers.ReadLine()
+	if err != nil {
+		return "", helpers.Usagef("could not read %s: %v", strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(label), ":")), err)
+	}
+	return text, nil
+}
+
 func init() {
 	RootCmd.AddCommand(ssmindexCmd)
 	ssmindexCmd.AddCommand(ssmListCmd)
 	ssmindexCmd.AddCommand(ssmPutCmd)
 	ssmindexCmd.AddCommand(ssmDeleteCmd)
 	ssmindexCmd.AddCommand(ssmHistoryCmd)
+
+	ssmPutCmd.Flags().StringVarP(&argSSMName, "name", "", "", "The name of the parameter, relative to the path of the application")
+	ssmPutCmd.Flags().StringVarP(&argSSMValue, "value", "", "", "The value of the parameter, read from stdin if it is piped and --value is not set")
+	ssmPutCmd.Flags().StringVarP(&argSSMFile, "file", "f", "", "Put every NAME=value line of the file, - reads them from stdin")
+	ssmDeleteCmd.Flags().StringVarP(&argSSMName, "name", "", "", "The name of the parameter, relative to the path of the application")
+	ssmHistoryCmd.Flags().StringVarP(&argSSMName, "name", "", "", "The name of the parameter, relative to the path of the application")
 }
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/blinkist/skipper/aws/fake"
+	"github.com/blinkist/skipper/aws/ssmclient"
+	"github.com/blinkist/skipper/helpers"
+)
+
+func TestReadSSMParameters(t *testing.T) {
+	input := `# api
+LOG_LEVEL=debug
+
+DATABASE_URL="postgres://db/api?sslmode=require"
+GREETING='it''s'
+EMPTY=
+`
+	params, err := readSSMParameters(strings.NewReader(input), "api.env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ssmParameter{
+		{name: "LOG_LEVEL", value: "debug"},
+		{name: "DATABASE_URL", value: "postgres://db/api?sslmode=require"},
+		{name: "GREETING", value: "it''s"},
+		{name: "EMPTY", value: ""},
+	}
+	if len(params) != len(expected) {
+		t.Fatalf("expected %d parameters, got %d", len(expected), len(params))
+	}
+	for i, p := range params {
+		if *p != expected[i] {
+			t.Errorf("expected %s=%q, got %s=%q", expected[i].name, expected[i].value, p.name, p.value)
+		}
+	}
+
+	_, err = readSSMParameters(strings.NewReader("LOG_LEVEL=debug\nPORT\n"), "api.env")
+	if helpers.ExitCode(err) != helpers.ExitUsage || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected a usage error on line 2, got %v", err)
+	}
+}
+
+func TestPutAndHistorySSM(t *testing.T) {
+	backend := fake.New()
+	ssm := ssmclient.NewWithClient(backend.SSM())
+	ns := &ssmNamespace{Application: "api", Path: "/application/api", KmsKey: "alias/application/api"}
+
+	for _, value := range []string{"info", "debug"} {
+		if err := putSSM(ssm, ns, []*ssmParameter{{name: "LOG_LEVEL", value: value}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := putSSM(ssm, ns, []*ssmParameter{{name: "PORT", value: "8080"}, {name: "HOST", value: "0.0.0.0"}}); err != nil {
+		t.Fatal(err)
+	}
+	names := backend.Parameters()
+	sort.Strings(names)
+	if strings.Join(names, ",") != "/application/api/HOST,/application/api/LOG_LEVEL,/application/api/PORT" {
+		t.Errorf("expected HOST, LOG_LEVEL and PORT to be put, got %v", names)
+	}
+	history, err := ssm.GetParameterHistory(&ns.Path, aws.String("LOG_LEVEL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(history[0].KeyID) != ns.KmsKey {
+		t.Errorf("expected the parameter to be encrypted with %s, got %s", ns.KmsKey, aws.StringValue(history[0].KeyID))
+	}
+
+	argOutput = outputJSON
+	defer func() { argOutput = outputTable }()
+	printed := captureStdout(t, func() {
+		if err := historySSM(ssm, ns, "LOG_LEVEL"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	out := &parametersOutput{}
+	if err := json.Unmarshal([]byte(printed), out); err != nil {
+		t.Fatalf("invalid output %q: %v", printed, err)
+	}
+	if out.Application != "api" || len(out.Parameters) != 2 {
+		t.Fatalf("expected the 2 versions of LOG_LEVEL, got %s", printed)
+	}
+	for i, expected := range []*parameterOutput{{Name: "LOG_LEVEL", Value: "debug", Version: 2}, {Name: "LOG_LEVEL", Value: "info", Version: 1}} {
+		p := out.Parameters[i]
+		if p.Name != expected.Name || p.Value != expected.Value || p.Version != expected.Version || p.LastModifiedUser != backend.User {
+			t.Errorf("expected version %d to be %s, got version %d %s by %s", expected.Version, expected.Value, p.Version, p.Value, p.LastModifiedUser)
+		}
+	}
+
+	if err := historySSM(ssm, ns, "MISSING"); err == nil {
+		t.Error("expected the history of a missing parameter to fail")
+	}
+}
+
+func TestDeleteSSMPiped(t *testing.T) {
+	defer testEnv(t)()
+	helpers.AssumeYes, helpers.NonInteractive = false, false
+	backend := fake.New()
+	ssm := ssmclient.NewWithClient(backend.SSM())
+	ns := &ssmNamespace{Application: "api", Path: "/application/api", KmsKey: "alias/application/api"}
+	if err := putSSM(ssm, ns, []*ssmParameter{{name: "OLD_FLAG", value: "true"}, {name: "PORT", value: "8080"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the name and the confirmation are read from one pipe
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("OLD_FLAG\ny\n")
+	w.Close()
+	os.Stdin = r
+	if err := deleteSSM(ssm, ns, ""); err != nil {
+		t.Fatal(err)
+	}
+	if names := backend.Parameters(); len(names) != 1 || names[0] != "/application/api/PORT" {
+		t.Errorf("expected only PORT to be left, got %v", names)
+	}
+}
+
+func TestReadSSMFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skipper-ssm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"api.json": `{"PORT": 8080, "RATIO": 0.25, "ID": 12345678901234567890, "DEBUG": true, "HOST": "0.0.0.0", "EMPTY": null}`,
+		"api.yaml": "PORT: 8080\nRATIO: 0.25\nID: 12345678901234567890\nDEBUG: true\nHOST: 0.0.0.0\nEMPTY:\n",
+	}
+	expected := map[string]string{"PORT": "8080", "RATIO": "0.25", "ID": "12345678901234567890", "DEBUG": "true", "HOST": "0.0.0.0", "EMPTY": ""}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		format, err := ssmFileFormat("", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params, err := readSSMFile(file, format)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for key, value := range expected {
+			if actual, ok := params[key]; !ok || actual != value {
+				t.Errorf("%s: expected %s=%q, got %q", name, key, value, actual)
+			}
+		}
+	}
+
+	file := filepath.Join(dir, "nested.json")
+	if err := ioutil.WriteFile(file, []byte(`{"DB": {"HOST": "db"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSSMFile(file, ssmFormatJSON); helpers.ExitCode(err) != helpers.ExitUsage || !strings.Contains(err.Error(), "DB") {
+		t.Errorf("expected a usage error for the object DB, got %v", err)
+	}
+}
+
+func TestApplySSMChanges(t *testing.T) {
+	backend := fake.New()
+	client := ssmclient.NewWithClient(backend.SSM())
+	ns := &ssmNamespace{Application: "api", Path: "/application/api", KmsKey: "alias/application/api"}
+	if _, err := backend.SSM().PutParameter(&ssm.PutParameterInput{
+		Name:  aws.String("/application/api/PORT"),
+		Value: aws.String("8080"),
+		Type:  aws.String(ssm.ParameterTypeString),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PutParameter(&ns.Path, aws.String("OLD"), aws.String("gone"), aws.String("alias/other")); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := storedSSMParameters(client, ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := diffSSMParameters(stored, map[string]string{"PORT": "9090", "TOKEN": "secret"}, true)
+	captureStdout(t, func() {
+		err = applySSMChanges(client, ns, changes)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := backend.Parameters()
+	sort.Strings(names)
+	if strings.Join(names, ",") != "/application/api/PORT,/application/api/TOKEN" {
+		t.Errorf("expected PORT and TOKEN to be left, got %v", names)
+	}
+	for name, expected := range map[string][2]string{
+		"PORT":  {ssm.ParameterTypeString, ""},
+		"TOKEN": {ssm.ParameterTypeSecureString, ns.KmsKey},
+	} {
+		history, err := client.GetParameterHistory(&ns.Path, aws.String(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest := history[len(history)-1]
+		if aws.StringValue(latest.Type) != expected[0] || aws.StringValue(latest.KeyID) != expected[1] {
+			t.Errorf("expected %s to be a %s with %q, got a %s with %q", name, expected[0], expected[1], aws.StringValue(latest.Type), aws.StringValue(latest.KeyID))
+		}
+	}
+}
+
+func TestReadSSMFileYAML(t *testing.T) {
+	f, err := ioutil.TempFile("", "skipper-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("VERSION: 1.10\nENABLED: yes\nMASK: 0x1F\nMODE: 010\nEMPTY: ~\nNAME: api\n")
+	f.Close()
+
+	params, err := readSSMFile(f.Name(), ssmFormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"VERSION": "1.10", "ENABLED": "yes", "MASK": "0x1F", "MODE": "010", "EMPTY": "", "NAME": "api"}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("expected the values as written %v, got %v", expected, params)
+	}
+
+	if err := ioutil.WriteFile(f.Name(), []byte("HOSTS:\n  - a\n  - b\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSSMFile(f.Name(), ssmFormatYAML); helpers.ExitCode(err) != helpers.ExitUsage {
+		t.Errorf("expected a list to be a usage error, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/ssmclient"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/spf13/cobra"
+)
+
+var (
+	argSSMRegionA  string
+	argSSMRegionB  string
+	argSSMProfileA string
+	argSSMProfileB string
+	argSSMNoGlobal bool
+)
+
+var ssmDiffCmd = &cobra.Command{
+	Use:   "diff <a> <b>",
+	Short: "Compare the SSM parameters of two applications",
+	Long: `
+Compares the effective configuration of two applications, their global
+parameters overridden by their own, and shows the parameters only one of them
+has and the ones whose values differ. Values are masked unless --show-values
+is set, --no-global only compares the applications' own parameters.
+
+Each side is a cluster/service, named like the ssm commands name it, an
+application, or the path of the parameters like /application/api, which has
+no global parameters. The sides may be in other regions or accounts than the
+default ones with --region-a, --region-b, --profile-a and --profile-b.
+
+  skipper ssm diff staging/api production/api
+  skipper ssm diff api api --region-b us-east-1 --show-values
+  skipper ssm diff /legacy/api api --profile-b production
+`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		a, err := newSSMDiffSide(args[0], argSSMRegionA, argSSMProfileA)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+		b, err := newSSMDiffSide(args[1], argSSMRegionB, argSSMProfileB)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+
+		paramsA, err := a.effectiveParameters(!argSSMNoGlobal)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+		paramsB, err := b.effectiveParameters(!argSSMNoGlobal)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+
+		fmt.Printf("--- %s\n+++ %s\n", a.describe(!argSSMNoGlobal), b.describe(!argSSMNoGlobal))
+		writeSSMChanges(os.Stdout, diffSSMParameters(paramsA, paramsB, true), argSSMShowValues)
+	},
+}
+
+// ssmDiffSide is one side of ssm diff, the parameters of an application and the global
+// ones, global is nil for bare paths
+type ssmDiffSide struct {
+	ssm    ssmclient.Client
+	ns     *ssmNamespace
+	global *ssmNamespace
+}
+
+// newSSMDiffSide resolves a cluster/service, an application or a path with the clients
+// of the region and profile, the default ones if they are empty
+func newSSMDiffSide(name, region, profile string) (*ssmDiffSide, error) {
+	sess, err := awsSession(region, profile)
+	if err != nil {
+		return nil, err
+	}
+	return resolveSSMDiffSide(name, ecsclient.NewWithClients(ecs.New(sess), ec2.New(sess)), ssmclient.NewWithClient(ssm.New(sess)))
+}
+
+// resolveSSMDiffSide resolves a cluster/service, an application or a path, the tags of
+// services are looked up with ecs
+func resolveSSMDiffSide(name string, ecs ecsclient.Client, ssm ssmclient.Client) (*ssmDiffSide, error) {
+	side := &ssmDiffSide{ssm: ssm}
+
+	var err error
+	switch {
+	case strings.HasPrefix(name, "/"):
+		path, err := cleanSSMPath(name)
+		if err != nil {
+			return nil, err
+		}
+		side.ns = &ssmNamespace{Application: path, Path: path}
+	case strings.Contains(name, "/"):
+		parts := strings.SplitN(name, "/", 2)
+		if parts[0] == "" || parts[1] == "" || strings.Contains(parts[1], "/") {
+			return nil, helpers.Usagef("%s: expected cluster/service, an application or a path", name)
+		}
+		if side.ns, err = resolveSSMNamespace(ecs, parts[0], parts[1]); err != nil {
+			return nil, err
+		}
+		if side.global, err = resolveGlobalSSMNamespace(parts[0], parts[1]); err != nil {
+			return nil, err
+		}
+	default:
+		c, err := loadSSMConfig()
+		if err != nil {
+			return nil, err
+		}
+		if side.ns, side.global, err = c.applicationNamespace(name); err != nil {
+			return nil, err
+		}
+	}
+	return side, nil
+}
+
+// effectiveParameters returns the parameters the application sees, its own overriding
+// the global ones unless withGlobal is false
+func (s *ssmDiffSide) effectiveParameters(withGlobal bool) (map[string]string, error) {
+	params := make(map[string]string)
+	layers := []*ssmNamespace{s.ns}
+	if withGlobal && s.global != nil && s.global.Path != s.ns.Path {
+		layers = []*ssmNamespace{s.global, s.ns}
+	}
+	for _, ns := range layers {
+		layer, err := storedSSMParameters(s.ssm, ns)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range layer {
+			params[name] = value
+		}
+	}
+	return params, nil
+}
+
+// describe names the paths compared on the side
+func (s *ssmDiffSide) describe(withGlobal bool) string {
+	if withGlobal && s.global != nil && s.global.Path != s.ns.Path {
+		return fmt.Sprintf("%s (%s over %s)", s.ns.Application, s.ns.Path, s.global.Path)
+	}
+	if s.ns.Application == s.ns.Path {
+		return s.ns.Path
+	}
+	return fmt.Sprintf("%s (%s)", s.ns.Application, s.ns.Path)
+}
+
+// awsSession returns a session of the region and the profile of the shared config, the
+// default ones if they are empty
+func awsSession(region, profile string) (*awssession.Session, error) {
+	opts := awssession.Options{
+		Profile:           profile,
+		SharedConfigState: awssession.SharedConfigEnable,
+	}
+	if region != "" {
+		opts.Config.Region = aws.String(region)
+	}
+	sess, err := awssession.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, helpers.Usagef("could not load the AWS profile %s: %v", profile, err)
+	}
+	return sess, nil
+}
+
+func init() {
+	ssmindexCmd.AddCommand(ssmDiffCmd)
+
+	ssmDiffCmd.Flags().StringVarP(&argSSMRegionA, "region-a", "", "", "The region of the first side, the default region if it is not set")
+	ssmDiffCmd.Flags().StringVarP(&argSSMRegionB, "region-b", "", "", "The region of the second side, the default region if it is not set")
+	ssmDiffCmd.Flags().StringVarP(&argSSMProfileA, "profile-a", "", "", "The AWS profile of the first side, the default profile if it is not set")
+	ssmDiffCmd.Flags().StringVarP(&argSSMProfileB, "profile-b", "", "", "The AWS profile of the second side, the default profile if it is not set")
+	ssmDiffCmd.Flags().BoolVarP(&argSSMShowValues, "show-values", "", false, "Show the values instead of masking them")
+	ssmDiffCmd.Flags().BoolVarP(&argSSMNoGlobal, "no-global", "", false, "Only compare the parameters of the applications, without the global ones")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/blinkist/skipper/aws/ssmclient"
+	"github.com/blinkist/skipper/helpers"
+)
+
+func TestResolveSSMDiffSide(t *testing.T) {
+	backend, ecs := newTestBackend(t)
+	if err := backend.TagService("production", "web", map[string]string{ssmApplicationTag: "shop"}); err != nil {
+		t.Fatal(err)
+	}
+	ssm := ssmclient.NewWithClient(backend.SSM())
+
+	tests := []struct {
+		name   string
+		ns     ssmNamespace
+		global string
+	}{
+		{"/legacy/api/", ssmNamespace{"/legacy/api", "/legacy/api", ""}, ""},
+		{"api", ssmNamespace{"api", "/application/api", "alias/application/api"}, "/application/global"},
+		{"production/web", ssmNamespace{"shop", "/application/shop", "alias/application/shop"}, "/application/global"},
+	}
+	for _, test := range tests {
+		side, err := resolveSSMDiffSide(test.name, ecs, ssm)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if *side.ns != test.ns {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.ns, *side.ns)
+		}
+		global := ""
+		if side.global != nil {
+			global = side.global.Path
+		}
+		if global != test.global {
+			t.Errorf("%s: expected the global parameters at %q, got %q", test.name, test.global, global)
+		}
+	}
+
+	for _, name := range []string{"/", "production/", "production//", "production/web/"} {
+		if _, err := resolveSSMDiffSide(name, ecs, ssm); helpers.ExitCode(err) != helpers.ExitUsage {
+			t.Errorf("%s: expected a usage error, got %v", name, err)
+		}
+	}
+}
+
+func TestEffectiveSSMParameters(t *testing.T) {
+	backend, ecs := newTestBackend(t)
+	ssm := ssmclient.NewWithClient(backend.SSM())
+	put := func(path string, params map[string]string) {
+		for name, value := range params {
+			if err := ssm.PutParameter(aws.String(path), aws.String(name), aws.String(value), aws.String("alias/aws/ssm")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	put("/application/global", map[string]string{"LOG_LEVEL": "info", "REGION": "eu-central-1"})
+	put("/application/api", map[string]string{"LOG_LEVEL": "debug", "PORT": "8080"})
+
+	tests := []struct {
+		name       string
+		withGlobal bool
+		expected   map[string]string
+	}{
+		{"api", true, map[string]string{"LOG_LEVEL": "debug", "PORT": "8080", "REGION": "eu-central-1"}},
+		{"api", false, map[string]string{"LOG_LEVEL": "debug", "PORT": "8080"}},
+		{"/application/api", true, map[string]string{"LOG_LEVEL": "debug", "PORT": "8080"}},
+		{"global", true, map[string]string{"LOG_LEVEL": "info", "REGION": "eu-central-1"}},
+		{"books", true, map[string]string{"LOG_LEVEL": "info", "REGION": "eu-central-1"}},
+	}
+	for _, test := range tests {
+		side, err := resolveSSMDiffSide(test.name, ecs, ssm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params, err := side.effectiveParameters(test.withGlobal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(params, test.expected) {
+			t.Errorf("%s with global %t: expected %v, got %v", test.name, test.withGlobal, test.expected, params)
+		}
+	}
+}
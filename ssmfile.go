@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/ssmclient"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Formats of ssm export and import
+const (
+	ssmFormatEnv  = "env"
+	ssmFormatJSON = "json"
+	ssmFormatYAML = "yaml"
+)
+
+// ssmMaskedValue replaces the values in the diff of ssm import unless --show-values is set
+const ssmMaskedValue = "********"
+
+var (
+	argSSMFormat     string
+	argSSMGlobal     bool
+	argSSMNoDelete   bool
+	argSSMShowValues bool
+)
+
+var ssmExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the SSM parameters of an application to a file",
+	Long: `
+Writes the parameters of the service's application, or the global ones with
+--global, to a .env, JSON or YAML file, or to stdout without --file. The format
+is taken from the extension of the file unless --format is set. The names are
+relative to the path of the application.
+
+  skipper ssm export production api --file api.env
+  skipper ssm export production api --global --format json > global.json
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ecs := ecsclient.New()
+		cluster, service := helpers.ServicePicker(ecs, args)
+		ns := pickSSMFileNamespace(ecs, cluster, service)
+
+		format, err := ssmFileFormat(argSSMFormat, argSSMFile)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+		params, err := storedSSMParameters(ssmclient.New(), ns)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+		data, err := encodeSSMParameters(params, format)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+
+		if argSSMFile == "" || argSSMFile == "-" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := ioutil.WriteFile(argSSMFile, data, 0600); err != nil {
+			helpers.Fatal(helpers.Wrap(err, "could not write %s", argSSMFile))
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d parameters of %s to %s\n", len(params), ns.Path, argSSMFile)
+	},
+}
+
+var ssmImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import the SSM parameters of an application from a file",
+	Long: `
+Reads a .env, JSON or YAML file, like the ones written by ssm export, shows how
+it differs from the parameters of the service's application, or the global ones
+with --global, and once confirmed creates, updates and deletes them to match
+it. Parameters missing from the file are kept with --no-delete. Values are
+masked in the diff unless --show-values is set. New parameters are SecureStrings
+encrypted with the KMS key of the application, updated ones keep their type and
+key. Numbers and booleans of JSON and YAML files are stored as written, null is an
+empty value.
+
+  skipper ssm import production api --file api.env --dry-run
+  skipper ssm import production api --file api.yaml --no-delete --yes
+  skipper ssm export production api | sed s/debug/info/ | skipper ssm import production api --file - --yes
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if argSSMFile == "" {
+			helpers.Fatal(helpers.Usagef("--file is required, - reads it from stdin"))
+		}
+		if argSSMFile == "-" && !argDryRun && !helpers.AssumeYes {
+			helpers.Fatal(helpers.Usagef("--file - needs --yes or --dry-run, stdin can not be read for the confirmation"))
+		}
+
+		ecs := ecsclient.New()
+		cluster, service := helpers.ServicePicker(ecs, args)
+		ns := pickSSMFileNamespace(ecs, cluster, service)
+
+		format, err := ssmFileFormat(argSSMFormat, argSSMFile)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+		wanted, err := readSSMFile(argSSMFile, format)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+		ssm := ssmclient.New()
+		stored, err := storedSSMParameters(ssm, ns)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+
+		changes := diffSSMParameters(stored, wanted, !argSSMNoDelete)
+		fmt.Printf("Parameters of %s (%s):\n", ns.Application, ns.Path)
+		writeSSMChanges(os.Stdout, changes, argSSMShowValues)
+		if argDryRun || len(changes) == 0 {
+			return
+		}
+		if !helpers.GetYesNo(fmt.Sprintf("Apply %d changes to %s ?", len(changes), ns.Path)) {
+			helpers.Fatal(helpers.ErrAborted)
+		}
+		if err := applySSMChanges(ssm, ns, changes); err != nil {
+			helpers.Fatal(err)
+		}
+	},
+}
+
+// ssmChange is a parameter to create, update or delete. Old is nil for creations and New
+// for deletions.
+type ssmChange struct {
+	Name string
+	Old  *string
+	New  *string
+}
+
+// String formats the change as one line like the changes of update, + for creations, -
+// for deletions and ~ for updates
+func (c *ssmChange) String(showValues bool) string {
+	display := func(value *string) string {
+		if !showValues {
+			return ssmMaskedValue
+		}
+		return strconv.Quote(*value)
+	}
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("+ %s = %s", c.Name, display(c.New))
+	case c.New == nil:
+		return fmt.Sprintf("- %s = %s", c.Name, display(c.Old))
+	default:
+		return fmt.Sprintf("~ %s: %s => %s", c.Name, display(c.Old), display(c.New))
+	}
+}
+
+// pickSSMFileNamespace returns the namespace of the service, or the global one with
+// --global, it exits if the ssm config is invalid
+func pickSSMFileNamespace(ecs ecsclient.Client, cluster, service string) *ssmNamespace {
+	if !argSSMGlobal {
+		return pickSSMNamespace(ecs, cluster, service)
+	}
+	ns, err := resolveGlobalSSMNamespace(cluster, service)
+	if err != nil {
+		helpers.Fatal(err)
+	}
+	return ns
+}
+
+// ssmFileFormat returns the format set by --format, or the one of the extension of the
+// file, env for stdin and stdout
+func ssmFileFormat(format, file string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".json":
+			return ssmFormatJSON, nil
+		case ".yaml", ".yml":
+			return ssmFormatYAML, nil
+		default:
+			return ssmFormatEnv, nil
+		}
+	}
+	switch format {
+	case ssmFormatEnv, ssmFormatJSON, ssmFormatYAML:
+		return format, nil
+	}
+	return "", helpers.Usagef("--format must be %s, %s or %s, not %s", ssmFormatEnv, ssmFormatJSON, ssmFormatYAML, format)
+}
+
+// storedSSMParameters returns the values of the parameters of the namespace by their
+// names relative to its path
+func storedSSMParameters(ssm ssmclient.Client, ns *ssmNamespace) (map[string]string, error) {
+	list, err := ssm.GetParameters(&ns.Path)
+	if err != nil {
+		return nil, helpers.Wrap(err, "could not list the parameters of %s", ns.Application)
+	}
+	params := make(map[string]string, len(list))
+	for _, p := range list {
+		params[strings.TrimPrefix(aws.StringValue(p.Key), ns.Prefix())] = aws.StringValue(p.Value)
+	}
+	return params, nil
+}
+
+// encodeSSMParameters formats the parameters as NAME=value lines, or as a JSON or YAML
+// object, sorted by name. Values which would not survive a NAME=value line are quoted.
+func encodeSSMParameters(params map[string]string, format string) ([]byte, error) {
+	switch format {
+	case ssmFormatJSON:
+		data, err := json.MarshalIndent(params, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case ssmFormatYAML:
+		return yaml.Marshal(params)
+	}
+
+	var buf bytes.Buffer
+	for _, name := range sortedSSMNames(params) {
+		fmt.Fprintf(&buf, "%s=%s\n", name, quoteSSMValue(params[name]))
+	}
+	return buf.Bytes(), nil
+}
+
+// quoteSSMValue double quotes values with line breaks, quotes, backslashes or surrounding
+// spaces, readSSMParameters unquotes them
+func quoteSSMValue(value string) string {
+	if strings.ContainsAny(value, "\n\r\"'\\") || strings.TrimSpace(value) != value {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// readSSMFile reads the parameters of the file, or of stdin for -, in the format
+func readSSMFile(file, format string) (map[string]string, error) {
+	var r io.Reader = os.Stdin
+	source := "stdin"
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, helpers.NotFoundf("could not open %s: %v", file, err)
+		}
+		defer f.Close()
+		r, source = f, file
+	}
+
+	if format == ssmFormatEnv {
+		list, err := readSSMParameters(r, source)
+		if err != nil {
+			return nil, err
+		}
+		params := make(map[string]string, len(list))
+		for _, p := range list {
+			params[p.name] = p.value
+		}
+		return params, nil
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if format == ssmFormatYAML {
+		// scalars are decoded as written, so 1.10, yes or 010 stay what they are
+		params := make(map[string]string)
+		if err := yaml.Unmarshal(data, &params); err != nil {
+			return nil, helpers.Usagef("%s: expected an object of names and string, number or boolean values: %v", source, err)
+		}
+		if len(params) == 0 {
+			return nil, helpers.Usagef("%s has no parameters", source)
+		}
+		return params, nil
+	}
+
+	values := make(map[string]interface{})
+	// numbers are kept as written instead of going through float64
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, helpers.Usagef("%s: expected an object of names and values: %v", source, err)
+	}
+	if len(values) == 0 {
+		return nil, helpers.Usagef("%s has no parameters", source)
+	}
+
+	params := make(map[string]string, len(values))
+	for name, value := range values {
+		scalar, ok := formatSSMValue(value)
+		if !ok {
+			return nil, helpers.Usagef("%s: the value of %s is not a string, number or boolean", source, name)
+		}
+		params[name] = scalar
+	}
+	return params, nil
+}
+
+// formatSSMValue returns the scalar value of a JSON file as the string stored in SSM,
+// null is empty like NAME= in an env file. Lists and objects are not scalars.
+func formatSSMValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// diffSSMParameters returns the changes turning the stored parameters into the wanted
+// ones, sorted by name. Parameters which are not wanted are only deleted with del.
+func diffSSMParameters(stored, wanted map[string]string, del bool) []*ssmChange {
+	changes := make([]*ssmChange, 0)
+	for _, name := range sortedSSMNames(wanted) {
+		value := wanted[name]
+		old, ok := stored[name]
+		switch {
+		case !ok:
+			changes = append(changes, &ssmChange{Name: name, New: aws.String(value)})
+		case old != value:
+			changes = append(changes, &ssmChange{Name: name, Old: aws.String(old), New: aws.String(value)})
+		}
+	}
+	if del {
+		for _, name := range sortedSSMNames(stored) {
+			if _, ok := wanted[name]; !ok {
+				changes = append(changes, &ssmChange{Name: name, Old: aws.String(stored[name])})
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// writeSSMChanges prints the changes one per line, or a note if there are none
+func writeSSMChanges(w io.Writer, changes []*ssmChange, showValues bool) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+	for _, c := range changes {
+		line := c.String(showValues)
+		switch {
+		case c.Old == nil:
+			line = green(line)
+		case c.New == nil:
+			line = red(line)
+		default:
+			line = yellow(line)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// applySSMChanges creates parameters as SecureStrings encrypted with the KMS key of the
+// namespace, updates the others keeping their type and key and deletes the removed ones.
+// It stops at the first failure.
+func applySSMChanges(ssm ssmclient.Client, ns *ssmNamespace, changes []*ssmChange) error {
+	for _, c := range changes {
+		name := c.Name
+		if c.New == nil {
+			if err := ssm.DeleteParameter(&ns.Path, &name); err != nil {
+				return helpers.Wrap(err, "could not delete %s", name)
+			}
+			fmt.Printf("Deleted %s\n", name)
+			continue
+		}
+		if c.Old != nil {
+			if err := ssm.UpdateParameter(&ns.Path, &name, c.New); err != nil {
+				return helpers.Wrap(err, "could not update %s", name)
+			}
+			fmt.Printf("Updated %s\n", name)
+			continue
+		}
+		if err := ssm.PutParameter(&ns.Path, &name, c.New, &ns.KmsKey); err != nil {
+			return helpers.Wrap(err, "could not put %s", name)
+		}
+		fmt.Printf("Put %s\n", name)
+	}
+	return nil
+}
+
+// sortedSSMNames returns the names of the parameters in order
+func sortedSSMNames(params map[string]string) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	ssmindexCmd.AddCommand(ssmExportCmd)
+	ssmindexCmd.AddCommand(ssmImportCmd)
+
+	ssmExportCmd.Flags().StringVarP(&argSSMFile, "file", "f", "", "The file to write, stdout if it is not set")
+	ssmExportCmd.Flags().StringVarP(&argSSMFormat, "format", "", "", "env, json or yaml, taken from the extension of --file if it is not set")
+	ssmExportCmd.Flags().BoolVarP(&argSSMGlobal, "global", "", false, "Export the global parameters instead of the ones of the application")
+
+	ssmImportCmd.Flags().StringVarP(&argSSMFile, "file", "f", "", "The file to read, - reads it from stdin")
+	ssmImportCmd.Flags().StringVarP(&argSSMFormat, "format", "", "", "env, json or yaml, taken from the extension of --file if it is not set")
+	ssmImportCmd.Flags().BoolVarP(&argSSMGlobal, "global", "", false, "Import into the global parameters instead of the ones of the application")
+	ssmImportCmd.Flags().BoolVarP(&argSSMNoDelete, "no-delete", "", false, "Keep the parameters which are not in the file")
+	ssmImportCmd.Flags().BoolVarP(&argSSMShowValues, "show-values", "", false, "Show the values in the diff instead of masking them")
+	ssmImportCmd.Flags().BoolVarP(&argDryRun, "dry-run", "", false, "Only show the changes")
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/spf13/viper"
+)
+
+// Tags of an ECS service which override where its parameters are kept
+const (
+	ssmApplicationTag = "skipper:ssm-application"
+	ssmPathTag        = "skipper:ssm-path"
+	ssmKmsKeyTag      = "skipper:ssm-kms-key"
+)
+
+// Templates of the path and the KMS key of an application unless configured
+const (
+	defaultSSMPath   = "/application/{{ .Application }}"
+	defaultSSMKmsKey = "alias/application/{{ .Application }}"
+)
+
+// ssmGlobalApplication is the application whose parameters are shared by all services
+const ssmGlobalApplication = "global"
+
+// ssmConfig is the ssm section of the config file, like
+//
+//	ssm:
+//	  path: /config/{{ .Cluster }}/{{ .Application }}
+//	  kms_key: alias/{{ .Cluster }}
+//	  applications:
+//	    - match: ^(?P<team>[a-z]+)-(?P<app>.+)-(web|worker)$
+//	      application: "{{ .Groups.team }}-{{ .Groups.app }}"
+//	  services:
+//	    production/legacy-api:
+//	      application: api
+//	      path: /legacy/api
+//
+// The templates are rendered with the Cluster, the Service and the Application. The
+// first rule whose match, a regular expression, matches the service name names the
+// application, Groups are the named groups of the match. Without a matching rule the
+// application is the service name without the cluster and the -web or -worker suffix.
+// The global parameters are kept at global_path, or the path of the global application.
+type ssmConfig struct {
+	Path         string                       `mapstructure:"path"`
+	KmsKey       string                       `mapstructure:"kms_key"`
+	GlobalPath   string                       `mapstructure:"global_path"`
+	Applications []*ssmApplicationRule        `mapstructure:"applications"`
+	Services     map[string]*ssmServiceConfig `mapstructure:"services"`
+}
+
+// ssmApplicationRule names the application of the services matching it
+type ssmApplicationRule struct {
+	Match       string `mapstructure:"match"`
+	Application string `mapstructure:"application"`
+}
+
+// ssmServiceConfig overrides the naming of one service, it is keyed by cluster/service
+type ssmServiceConfig struct {
+	Application string `mapstructure:"application"`
+	Path        string `mapstructure:"path"`
+	KmsKey      string `mapstructure:"kms_key"`
+}
+
+// ssmNamespace is where the parameters of an application are kept and the KMS key
+// they are encrypted with
+type ssmNamespace struct {
+	Application string
+	Path        string
+	KmsKey      string
+}
+
+// Prefix returns the part of the full parameter names before their name
+func (n *ssmNamespace) Prefix() string {
+	return n.Path + "/"
+}
+
+// loadSSMConfig reads the ssm section of the config file
+func loadSSMConfig() (*ssmConfig, error) {
+	c := &ssmConfig{}
+	if err := viper.UnmarshalKey("ssm", c); err != nil {
+		return nil, helpers.Usagef("invalid ssm config: %v", err)
+	}
+	return c, nil
+}
+
+// resolveSSMNamespace returns where the parameters of the service are kept. The tags of
+// the service take precedence over its entry in the config, which takes precedence over
+// the rules and templates.
+func resolveSSMNamespace(ecs ecsclient.Client, cluster, service string) (*ssmNamespace, error) {
+	c, err := loadSSMConfig()
+	if err != nil {
+		return nil, err
+	}
+	services, err := ecs.DescribeServices(&cluster, []string{service})
+	if err != nil {
+		return nil, helpers.Wrap(err, "could not get the tags of %s", service)
+	}
+	tags := make(map[string]string)
+	for _, s := range services {
+		for _, t := range s.Tags {
+			tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+		}
+	}
+	return c.namespace(cluster, service, tags)
+}
+
+// resolveGlobalSSMNamespace returns where the global parameters are kept for the service
+func resolveGlobalSSMNamespace(cluster, service string) (*ssmNamespace, error) {
+	c, err := loadSSMConfig()
+	if err != nil {
+		return nil, err
+	}
+	return c.globalNamespace(cluster, service)
+}
+
+// namespace returns where the parameters of the service with the tags are kept
+func (c *ssmConfig) namespace(cluster, service string, tags map[string]string) (*ssmNamespace, error) {
+	override := c.service(cluster, service)
+
+	application := firstNonEmpty(tags[ssmApplicationTag], override.Application)
+	if application == "" {
+		var err error
+		if application, err = c.application(cluster, service); err != nil {
+			return nil, err
+		}
+	}
+	data := map[string]interface{}{"Cluster": cluster, "Service": service, "Application": application}
+
+	n := &ssmNamespace{Application: application}
+	var err error
+	if n.Path = firstNonEmpty(tags[ssmPathTag], override.Path); n.Path == "" {
+		if n.Path, err = renderSSMTemplate("path", firstNonEmpty(c.Path, defaultSSMPath), data); err != nil {
+			return nil, err
+		}
+	}
+	if n.KmsKey = firstNonEmpty(tags[ssmKmsKeyTag], override.KmsKey); n.KmsKey == "" {
+		if n.KmsKey, err = renderSSMTemplate("kms_key", firstNonEmpty(c.KmsKey, defaultSSMKmsKey), data); err != nil {
+			return nil, err
+		}
+	}
+	if n.Path, err = cleanSSMPath(n.Path); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// globalNamespace returns where the global parameters are kept, seen from the service
+func (c *ssmConfig) globalNamespace(cluster, service string) (*ssmNamespace, error) {
+	data := map[string]interface{}{"Cluster": cluster, "Service": service, "Application": ssmGlobalApplication}
+	path, err := renderSSMTemplate("global_path", firstNonEmpty(c.GlobalPath, c.Path, defaultSSMPath), data)
+	if err != nil {
+		return nil, err
+	}
+	kmsKey, err := renderSSMTemplate("kms_key", firstNonEmpty(c.KmsKey, defaultSSMKmsKey), data)
+	if err != nil {
+		return nil, err
+	}
+	if path, err = cleanSSMPath(path); err != nil {
+		return nil, err
+	}
+	return &ssmNamespace{Application: ssmGlobalApplication, Path: path, KmsKey: kmsKey}, nil
+}
+
+// applicationNamespace returns where the parameters of the application and the global
+// ones are kept without knowing its cluster and service. It fails if the templates of
+// the config need them.
+func (c *ssmConfig) applicationNamespace(application string) (*ssmNamespace, *ssmNamespace, error) {
+	render := func(application, path string) (*ssmNamespace, error) {
+		data := map[string]interface{}{"Application": application}
+		path, err := renderSSMTemplate("path", path, data)
+		if err != nil {
+			return nil, err
+		}
+		kmsKey, err := renderSSMTemplate("kms_key", firstNonEmpty(c.KmsKey, defaultSSMKmsKey), data)
+		if err != nil {
+			return nil, err
+		}
+		if path, err = cleanSSMPath(path); err != nil {
+			return nil, err
+		}
+		return &ssmNamespace{Application: application, Path: path, KmsKey: kmsKey}, nil
+	}
+
+	ns, err := render(application, firstNonEmpty(c.Path, defaultSSMPath))
+	if err != nil {
+		return nil, nil, helpers.Usagef("%v, name %s by cluster/service", err, application)
+	}
+	global, err := render(ssmGlobalApplication, firstNonEmpty(c.GlobalPath, c.Path, defaultSSMPath))
+	if err != nil {
+		return nil, nil, helpers.Usagef("%v, name %s by cluster/service", err, application)
+	}
+	return ns, global, nil
+}
+
+// service returns the entry of the service in the config, an empty one if it has none.
+// The keys of the config are not case sensitive.
+func (c *ssmConfig) service(cluster, service string) *ssmServiceConfig {
+	key := cluster + "/" + service
+	for k, s := range c.Services {
+		if strings.EqualFold(k, key) && s != nil {
+			return s
+		}
+	}
+	return &ssmServiceConfig{}
+}
+
+// application returns the application named by the first rule matching the service, or
+// the service name without the cluster and the -web or -worker suffix
+func (c *ssmConfig) application(cluster, service string) (string, error) {
+	for _, rule := range c.Applications {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return "", helpers.Usagef("invalid ssm config: match %s: %v", rule.Match, err)
+		}
+		match := re.FindStringSubmatch(service)
+		if match == nil {
+			continue
+		}
+		groups := make(map[string]string)
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				groups[name] = match[i]
+			}
+		}
+		data := map[string]interface{}{"Cluster": cluster, "Service": service, "Groups": groups}
+		application, err := renderSSMTemplate("application", rule.Application, data)
+		if err != nil {
+			return "", err
+		}
+		if application == "" {
+			return "", helpers.Usagef("invalid ssm config: the rule %s names no application for %s", rule.Match, service)
+		}
+		return application, nil
+	}
+	return ssmApplication(cluster, service), nil
+}
+
+// renderSSMTemplate renders the template of the ssm config with the data
+func renderSSMTemplate(name, text string, data map[string]interface{}) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", helpers.Usagef("invalid ssm config: %s: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", helpers.Usagef("invalid ssm config: %s: %v", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// cleanSSMPath makes sure the path is absolute and drops its trailing slash
+func cleanSSMPath(path string) (string, error) {
+	if !strings.HasPrefix(path, "/") || strings.Trim(path, "/") == "" {
+		return "", helpers.Usagef("invalid ssm config: the path %q has to be absolute, like /application/api", path)
+	}
+	return strings.TrimRight(path, "/"), nil
+}
+
+// firstNonEmpty returns the first of the values which is not empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
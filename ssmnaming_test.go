@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/blinkist/skipper/helpers"
+)
+
+// testSSMConfig names applications team-app by rule and keeps legacy-api of production
+// at its own path
+func testSSMConfig() *ssmConfig {
+	return &ssmConfig{
+		Path:   "/config/{{ .Cluster }}/{{ .Application }}",
+		KmsKey: "alias/{{ .Cluster }}",
+		Applications: []*ssmApplicationRule{
+			{Match: `^(?P<team>[a-z]+)-(?P<app>.+)-(web|worker)$`, Application: "{{ .Groups.team }}-{{ .Groups.app }}"},
+		},
+		Services: map[string]*ssmServiceConfig{
+			"Production/Legacy-Api": {Application: "api", Path: "/legacy/api/"},
+		},
+	}
+}
+
+func TestSSMNamespace(t *testing.T) {
+	tests := []struct {
+		config   *ssmConfig
+		cluster  string
+		service  string
+		tags     map[string]string
+		expected ssmNamespace
+	}{
+		{&ssmConfig{}, "production", "production-api-web", nil, ssmNamespace{"api", "/application/api", "alias/application/api"}},
+		{&ssmConfig{}, "production", "api-worker", nil, ssmNamespace{"api", "/application/api", "alias/application/api"}},
+		// the named groups of the rule
+		{testSSMConfig(), "production", "books-catalog-web", nil, ssmNamespace{"books-catalog", "/config/production/books-catalog", "alias/production"}},
+		// no rule matches
+		{testSSMConfig(), "staging", "staging-api", nil, ssmNamespace{"api", "/config/staging/api", "alias/staging"}},
+		// the entry of the service, whatever the case of its key
+		{testSSMConfig(), "production", "legacy-api", nil, ssmNamespace{"api", "/legacy/api", "alias/production"}},
+		{testSSMConfig(), "staging", "legacy-api", nil, ssmNamespace{"legacy-api", "/config/staging/legacy-api", "alias/staging"}},
+		// the tags take precedence over the entry and the rules
+		{testSSMConfig(), "production", "legacy-api", map[string]string{ssmApplicationTag: "shop"}, ssmNamespace{"shop", "/legacy/api", "alias/production"}},
+		{testSSMConfig(), "production", "legacy-api", map[string]string{ssmPathTag: "/tagged/"}, ssmNamespace{"api", "/tagged", "alias/production"}},
+		{testSSMConfig(), "production", "books-catalog-web", map[string]string{ssmApplicationTag: "shop", ssmKmsKeyTag: "alias/shop"}, ssmNamespace{"shop", "/config/production/shop", "alias/shop"}},
+	}
+	for _, test := range tests {
+		ns, err := test.config.namespace(test.cluster, test.service, test.tags)
+		if err != nil {
+			t.Errorf("%s/%s %v: %s", test.cluster, test.service, test.tags, err)
+			continue
+		}
+		if *ns != test.expected {
+			t.Errorf("%s/%s %v: expected %+v, got %+v", test.cluster, test.service, test.tags, test.expected, *ns)
+		}
+	}
+}
+
+func TestSSMNamespaceInvalidConfig(t *testing.T) {
+	tests := []*ssmConfig{
+		{Applications: []*ssmApplicationRule{{Match: "(web", Application: "api"}}},
+		{Applications: []*ssmApplicationRule{{Match: "web", Application: "{{ .Groups.team }}"}}},
+		{Applications: []*ssmApplicationRule{{Match: "web", Application: "{{ .Team }}"}}},
+		{Path: "config/{{ .Application }}"},
+		{Path: "/"},
+		{Path: "/config/{{ .Application"},
+	}
+	for _, c := range tests {
+		_, err := c.namespace("production", "production-web", nil)
+		if _, ok := err.(*helpers.UsageError); !ok {
+			t.Errorf("%+v: expected a usage error, got %v", c, err)
+		}
+	}
+}
+
+func TestGlobalSSMNamespace(t *testing.T) {
+	tests := []struct {
+		config   *ssmConfig
+		expected ssmNamespace
+	}{
+		{&ssmConfig{}, ssmNamespace{"global", "/application/global", "alias/application/global"}},
+		{testSSMConfig(), ssmNamespace{"global", "/config/production/global", "alias/production"}},
+		{&ssmConfig{Path: "/config/{{ .Application }}", GlobalPath: "/shared/{{ .Cluster }}/"}, ssmNamespace{"global", "/shared/production", "alias/application/global"}},
+	}
+	for _, test := range tests {
+		ns, err := test.config.globalNamespace("production", "legacy-api")
+		if err != nil {
+			t.Errorf("%+v: %s", test.config, err)
+			continue
+		}
+		if *ns != test.expected {
+			t.Errorf("%+v: expected %+v, got %+v", test.config, test.expected, *ns)
+		}
+	}
+}
+
+func TestCleanSSMPath(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/application/api":   "/application/api",
+		"/application/api/":  "/application/api",
+		"/application/api//": "/application/api",
+		"/api":               "/api",
+		"application/api":    "",
+		"/":                  "",
+		"//":                 "",
+		"":                   "",
+	} {
+		cleaned, err := cleanSSMPath(path)
+		if expected == "" {
+			if _, ok := err.(*helpers.UsageError); !ok {
+				t.Errorf("%q: expected a usage error, got %q, %v", path, cleaned, err)
+			}
+			continue
+		}
+		if err != nil || cleaned != expected {
+			t.Errorf("%q: expected %q, got %q, %v", path, expected, cleaned, err)
+		}
+	}
+}
+
+func TestResolveSSMNamespaceTags(t *testing.T) {
+	backend, ecs := newTestBackend(t)
+	if err := backend.TagService("production", "web", map[string]string{ssmApplicationTag: "shop"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ns, err := resolveSSMNamespace(ecs, "production", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns.Application != "shop" || ns.Path != "/application/shop" {
+		t.Errorf("expected the application of the tag, got %+v", *ns)
+	}
+}
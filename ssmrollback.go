@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/ssmclient"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/spf13/cobra"
+)
+
+// ssmTimeLayouts are the layouts --at is parsed with, in local time unless it has a zone
+var ssmTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+var (
+	argSSMVersion int64
+	argSSMAt      string
+)
+
+var ssmRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore SSM parameters to an earlier version",
+	Long: `
+Puts the value of an earlier version of a parameter of the service's application,
+or of the global ones with --global, as its new version with the type and KMS key
+of that version. The version is given by --version, or by --at, which restores
+the version the parameter had at that time.
+
+Without --name, --at restores every parameter of the application to its state at
+that time, deleting the ones created since unless --no-delete is set. Deleted
+parameters have no history and can not be restored. The changes are shown, with
+masked values unless --show-values is set, and applied once confirmed.
+
+  skipper ssm rollback production api --name LOG_LEVEL --version 3
+  skipper ssm rollback production api --at "2026-10-01 12:00" --dry-run
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if argSSMVersion != 0 && argSSMAt != "" {
+			helpers.Fatal(helpers.Usagef("--version and --at can not be combined"))
+		}
+		if argSSMVersion == 0 && argSSMAt == "" {
+			helpers.Fatal(helpers.Usagef("--version or --at is required"))
+		}
+		if argSSMVersion != 0 && argSSMName == "" {
+			helpers.Fatal(helpers.Usagef("--version needs --name"))
+		}
+		var at time.Time
+		if argSSMAt != "" {
+			var err error
+			if at, err = parseSSMTime(argSSMAt); err != nil {
+				helpers.Fatal(err)
+			}
+		}
+
+		ecs := ecsclient.New()
+		cluster, service := helpers.ServicePicker(ecs, args)
+		ns := pickSSMFileNamespace(ecs, cluster, service)
+		ssm := ssmclient.New()
+
+		var plan *ssmRestorePlan
+		var err error
+		if argSSMName != "" {
+			plan, err = planSSMParameterRestore(ssm, ns, argSSMName, argSSMVersion, at)
+		} else {
+			plan, err = planSSMRestore(ssm, ns, at, !argSSMNoDelete)
+		}
+		if err != nil {
+			helpers.Fatal(err)
+		}
+
+		fmt.Printf("Parameters of %s (%s):\n", ns.Application, ns.Path)
+		writeSSMChanges(os.Stdout, plan.changes, argSSMShowValues)
+		if argDryRun || len(plan.changes) == 0 {
+			return
+		}
+		if !helpers.GetYesNo(fmt.Sprintf("Apply %d changes to %s ?", len(plan.changes), ns.Path)) {
+			helpers.Fatal(helpers.ErrAborted)
+		}
+		if err := plan.apply(ssm, ns); err != nil {
+			helpers.Fatal(err)
+		}
+	},
+}
+
+// ssmRestorePlan are the changes restoring parameters and the versions they restore,
+// changes without a version are deletions
+type ssmRestorePlan struct {
+	changes  []*ssmChange
+	versions map[string]*ssmclient.Ssmkeypairhistory
+}
+
+// add records the change restoring the parameter to the version, or deleting it without
+// one, unless its latest version already has the same value and type
+func (p *ssmRestorePlan) add(name string, latest, version *ssmclient.Ssmkeypairhistory) {
+	if version == nil {
+		p.changes = append(p.changes, &ssmChange{Name: name, Old: latest.Value})
+		return
+	}
+	if aws.StringValue(latest.Value) == aws.StringValue(version.Value) && aws.StringValue(latest.Type) == aws.StringValue(version.Type) {
+		return
+	}
+	p.changes = append(p.changes, &ssmChange{Name: name, Old: latest.Value, New: version.Value})
+	p.versions[name] = version
+}
+
+// apply restores and deletes the parameters of the plan. It stops at the first failure.
+func (p *ssmRestorePlan) apply(ssm ssmclient.Client, ns *ssmNamespace) error {
+	for _, c := range p.changes {
+		name := c.Name
+		version, ok := p.versions[name]
+		if !ok {
+			if err := ssm.DeleteParameter(&ns.Path, &name); err != nil {
+				return helpers.Wrap(err, "could not delete %s", name)
+			}
+			fmt.Printf("Deleted %s\n", name)
+			continue
+		}
+		if err := ssm.RestoreParameter(&ns.Path, &name, version); err != nil {
+			return helpers.Wrap(err, "could not restore %s", name)
+		}
+		fmt.Printf("Restored %s to version %d\n", name, aws.Int64Value(version.Version))
+	}
+	return nil
+}
+
+// planSSMParameterRestore plans restoring one parameter to the version, or to the one it
+// had at the time if version is 0
+func planSSMParameterRestore(ssm ssmclient.Client, ns *ssmNamespace, name string, version int64, at time.Time) (*ssmRestorePlan, error) {
+	history, err := ssm.GetParameterHistory(&ns.Path, &name)
+	if err != nil {
+		return nil, helpers.Wrap(err, "could not get the history of %s", name)
+	}
+	if len(history) == 0 {
+		return nil, helpers.NotFoundf("%s has no versions", name)
+	}
+
+	var target *ssmclient.Ssmkeypairhistory
+	if version != 0 {
+		for _, v := range history {
+			if aws.Int64Value(v.Version) == version {
+				target = v
+			}
+		}
+		if target == nil {
+			return nil, helpers.NotFoundf("%s has no version %d, see ssm history", name, version)
+		}
+	} else if target = versionAt(history, at); target == nil {
+		return nil, helpers.NotFoundf("%s was created after %s", name, at.Format(time.RFC3339))
+	}
+
+	plan := &ssmRestorePlan{versions: make(map[string]*ssmclient.Ssmkeypairhistory)}
+	plan.add(name, latestVersion(history), target)
+	return plan, nil
+}
+
+// planSSMRestore plans restoring every parameter of the namespace to the version it had
+// at the time. Parameters created since are deleted with del.
+func planSSMRestore(ssm ssmclient.Client, ns *ssmNamespace, at time.Time, del bool) (*ssmRestorePlan, error) {
+	stored, err := storedSSMParameters(ssm, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ssmRestorePlan{versions: make(map[string]*ssmclient.Ssmkeypairhistory)}
+	for _, name := range sortedSSMNames(stored) {
+		history, err := ssm.GetParameterHistory(&ns.Path, &name)
+		if err != nil {
+			return nil, helpers.Wrap(err, "could not get the history of %s", name)
+		}
+		if len(history) == 0 {
+			continue
+		}
+		version := versionAt(history, at)
+		if version == nil && !del {
+			continue
+		}
+		plan.add(name, latestVersion(history), version)
+	}
+	return plan, nil
+}
+
+// versionAt returns the latest version modified at or before the time, nil if there is none
+func versionAt(history []*ssmclient.Ssmkeypairhistory, at time.Time) *ssmclient.Ssmkeypairhistory {
+	var found *ssmclient.Ssmkeypairhistory
+	for _, v := range history {
+		if v.LastModifiedDate == nil || v.LastModifiedDate.After(at) {
+			continue
+		}
+		if found == nil || aws.Int64Value(v.Version) > aws.Int64Value(found.Version) {
+			found = v
+		}
+	}
+	return found
+}
+
+// latestVersion returns the version with the highest number
+func latestVersion(history []*ssmclient.Ssmkeypairhistory) *ssmclient.Ssmkeypairhistory {
+	latest := history[0]
+	for _, v := range history[1:] {
+		if aws.Int64Value(v.Version) > aws.Int64Value(latest.Version) {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// parseSSMTime parses --at, like 2026-10-01T12:00:00Z or 2026-10-01 12:00 in local time
+func parseSSMTime(value string) (time.Time, error) {
+	for _, layout := range ssmTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, helpers.Usagef("--at %s: expected a time like 2026-10-01T12:00:00Z or 2026-10-01 12:00", value)
+}
+
+func init() {
+	ssmindexCmd.AddCommand(ssmRollbackCmd)
+
+	ssmRollbackCmd.Flags().StringVarP(&argSSMName, "name", "", "", "The name of the parameter, relative to the path of the application, every parameter with --at if it is not set")
+	ssmRollbackCmd.Flags().Int64VarP(&argSSMVersion, "version", "", 0, "The version to restore, see ssm history")
+	ssmRollbackCmd.Flags().StringVarP(&argSSMAt, "at", "", "", "Restore the versions of this time, like 2026-10-01T12:00:00Z or 2026-10-01 12:00 in local time")
+	ssmRollbackCmd.Flags().BoolVarP(&argSSMGlobal, "global", "", false, "Restore the global parameters instead of the ones of the application")
+	ssmRollbackCmd.Flags().BoolVarP(&argSSMNoDelete, "no-delete", "", false, "Keep the parameters created after --at")
+	ssmRollbackCmd.Flags().BoolVarP(&argSSMShowValues, "show-values", "", false, "Show the values instead of masking them")
+	ssmRollbackCmd.Flags().BoolVarP(&argDryRun, "dry-run", "", false, "Only show the changes")
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ecrclient"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/iamclient"
+	"github.com/blinkist/skipper/aws/ssmclient"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/spf13/cobra"
+)
+
+// secretActions are the actions a task execution role needs on the ARNs of secrets, by
+// the service of the ARN
+var secretActions = map[string]string{
+	"ssm":            "ssm:GetParameters",
+	"secretsmanager": "secretsmanager:GetSecretValue",
+}
+
+// secretName matches the names ECS accepts for the variables of secrets
+var secretName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var ssmSyncSecretsCmd = &cobra.Command{
+	Use:   "sync-secrets [cluster] [service]",
+	Short: "Read the SSM parameters of an application as ECS secrets",
+	Long: `
+Registers a new revision of the service's task definition whose container reads
+every parameter of the service's application, and the global ones unless
+--no-global is set, as a secret of the same name, and rolls the service once
+confirmed. Parameters of the application override global ones of the same name,
+secrets replace plain variables. Secrets pointing at parameters of these paths
+which no longer exist are removed, a task can not start with them. Parameters
+whose names are no valid variable names, like nested ones, are skipped.
+
+The task execution role is checked to be allowed to read the parameters with
+ssm:GetParameters. kms:Decrypt on their KMS key is not checked.
+
+  skipper ssm sync-secrets production api --container app --dry-run
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		separateProgress()
+		ecs := ecsclient.New()
+		cluster, service := helpers.ServicePicker(ecs, args)
+		namespaces := []*ssmNamespace{pickSSMNamespace(ecs, cluster, service)}
+		if !argSSMNoGlobal {
+			global, err := resolveGlobalSSMNamespace(cluster, service)
+			if err != nil {
+				helpers.Fatal(err)
+			}
+			namespaces = []*ssmNamespace{global, namespaces[0]}
+		}
+
+		rdi, err := planSecretSync(ecs, ssmclient.New(), cluster, service, namespaces)
+		if err != nil {
+			helpers.Fatal(err)
+		}
+		if err := updateService(ecs, ecrclient.New(), iamclient.New(), cluster, service, rdi); err != nil {
+			helpers.Fatal(err)
+		}
+	},
+}
+
+// planSecretSync returns the changes pointing the secrets of the service's container at
+// the parameters of the namespaces, the later ones overriding the earlier ones, and
+// removing its secrets of parameters of the namespaces which no longer exist
+func planSecretSync(ecs ecsclient.Client, ssm ssmclient.Client, cluster, service string, namespaces []*ssmNamespace) (*ecsclient.RegisterTaskDefinitionInput, error) {
+	secrets := make(map[string]string)
+	parameters := make(map[string]bool)
+	for _, ns := range namespaces {
+		list, err := ssm.GetParameters(&ns.Path)
+		if err != nil {
+			return nil, helpers.Wrap(err, "could not list the parameters of %s", ns.Application)
+		}
+		for _, p := range list {
+			fullName := aws.StringValue(p.Key)
+			parameters[fullName] = true
+			name := strings.TrimPrefix(fullName, ns.Prefix())
+			if !secretName.MatchString(name) {
+				fmt.Printf("Skipping %s, %s is no valid variable name\n", fullName, name)
+				continue
+			}
+			secrets[name] = fullName
+		}
+	}
+
+	serviceObj, err := ecs.FindService(&cluster, &service)
+	if err != nil {
+		return nil, helpers.Wrap(err, "could not find service %s %s", cluster, service)
+	}
+	container, err := updateContainer(ecs, serviceObj.TaskDefinition, !helpers.NonInteractive)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := ecs.GetContainerDefinitions(serviceObj.TaskDefinition)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := make(map[string]struct{})
+	for _, d := range defs {
+		if aws.StringValue(d.Name) != container {
+			continue
+		}
+		for _, s := range d.Secrets {
+			fullName := secretParameterName(aws.StringValue(s.ValueFrom))
+			if _, ok := secrets[aws.StringValue(s.Name)]; ok || parameters[fullName] {
+				continue
+			}
+			for _, ns := range namespaces {
+				if fullName != "" && strings.HasPrefix(fullName, ns.Prefix()) {
+					stale[aws.StringValue(s.Name)] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return &ecsclient.RegisterTaskDefinitionInput{
+		Container:    &container,
+		Secrets:      &secrets,
+		SecretUnsets: &stale,
+	}, nil
+}
+
+// parseSecrets parses NAME=valueFrom flags, the value is the path or ARN of an SSM
+// parameter or the ARN of a Secrets Manager secret
+func parseSecrets(flags []string) (map[string]string, error) {
+	secrets := make(map[string]string, len(flags))
+	for _, flag := range flags {
+		parts := strings.SplitN(flag, "=", 2)
+		if len(parts) != 2 || parts[1] == "" || !secretName.MatchString(parts[0]) {
+			return nil, helpers.Usagef("--secret %s: expected NAME=/path/of/the/parameter or NAME=arn", flag)
+		}
+		if !strings.HasPrefix(parts[1], "/") && !strings.HasPrefix(parts[1], "arn:") {
+			return nil, helpers.Usagef("--secret %s: the parameter has to be a path starting with / or an ARN", flag)
+		}
+		secrets[parts[0]] = parts[1]
+	}
+	return secrets, nil
+}
+
+// verifySecrets makes sure the task execution role of the task definition is allowed to
+// read the secrets the changes add or point elsewhere. The check is skipped with a
+// note if the policies can not be simulated.
+func verifySecrets(iam iamclient.Client, td *ecs.TaskDefinition, changes []*ecsclient.Change) error {
+	byAction := make(map[string][]string)
+	for _, c := range changes {
+		if c.Field != ecsclient.FieldSecret || c.New == nil {
+			continue
+		}
+		parts := strings.SplitN(*c.New, ":", 6)
+		if len(parts) != 6 || secretActions[parts[2]] == "" {
+			fmt.Printf("%s is no SSM or Secrets Manager ARN, skipping the check if it can be read\n", *c.New)
+			continue
+		}
+		action := secretActions[parts[2]]
+		byAction[action] = appendMissing(byAction[action], *c.New)
+	}
+	if len(byAction) == 0 {
+		return nil
+	}
+
+	role := executionRoleArn(td)
+	if role == "" {
+		return helpers.Usagef("%s has no task execution role, ECS needs one to read secrets", path.Base(aws.StringValue(td.TaskDefinitionArn)))
+	}
+	actions := make([]string, 0, len(byAction))
+	for action := range byAction {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	denied := make([]string, 0)
+	for _, action := range actions {
+		resources, err := iam.DeniedResources(role, action, byAction[action])
+		if err != nil {
+			fmt.Printf("Could not check if %s may read the secrets, skipping the check: %v\n", role, err)
+			return nil
+		}
+		for _, r := range resources {
+			denied = append(denied, fmt.Sprintf("%s on %s", action, r))
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("the task execution role %s is not allowed %s", role, strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// executionRoleArn returns the ARN of the task execution role, which may be given by its
+// name in the task definition
+func executionRoleArn(td *ecs.TaskDefinition) string {
+	role := aws.StringValue(td.ExecutionRoleArn)
+	if role == "" || strings.HasPrefix(role, "arn:") {
+		return role
+	}
+	parts := strings.SplitN(aws.StringValue(td.TaskDefinitionArn), ":", 6)
+	if len(parts) != 6 {
+		return role
+	}
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], role)
+}
+
+// secretParameterName returns the full name of the SSM parameter a secret is read from,
+// or "" if it is not read from one
+func secretParameterName(valueFrom string) string {
+	if strings.HasPrefix(valueFrom, "/") {
+		return valueFrom
+	}
+	parts := strings.SplitN(valueFrom, ":", 6)
+	if len(parts) != 6 || parts[2] != "ssm" || !strings.HasPrefix(parts[5], "parameter/") {
+		return ""
+	}
+	return strings.TrimPrefix(parts[5], "parameter")
+}
+
+// appendMissing appends s unless the values already hold it
+func appendMissing(values []string, s string) []string {
+	for _, v := range values {
+		if v == s {
+			return values
+		}
+	}
+	return append(values, s)
+}
+
+func init() {
+	ssmindexCmd.AddCommand(ssmSyncSecretsCmd)
+
+	ssmSyncSecretsCmd.Flags().StringVarP(&argUpdateContainer, "container", "c", "", "The container to read the secrets, asks if the task runs more than one")
+	ssmSyncSecretsCmd.Flags().BoolVarP(&argSSMNoGlobal, "no-global", "", false, "Only read the parameters of the application, without the global ones")
+	ssmSyncSecretsCmd.Flags().BoolVarP(&argDryRun, "dry-run", "", false, "Only show the changes to the task definition")
+	ssmSyncSecretsCmd.Flags().BoolVarP(&argNoRollback, "no-rollback", "", false, "Leave the service as it is if the deployment fails to become stable")
+}
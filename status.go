@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/blinkist/skipper/aws/appautoscalingclient"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/elbv2client"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var (
+	argStatusEvents   int
+	argStatusWatch    bool
+	argStatusInterval time.Duration
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status [cluster] [service]",
+	Short: "Show the deployments, tasks, target groups and events of a service",
+	Long: `
+Shows the deployments of a service with their task counts, the image and limits of
+each container, every task with its host, ports, uptime and health, the health of
+its tasks in the attached target groups, the auto scaling bounds and the last
+events of the service. --watch refreshes it until interrupted.
+
+  skipper status production api
+  skipper status production api --watch --interval 10s
+  skipper status production api --events 20 --output json
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if argStatusInterval <= 0 {
+			helpers.Fatal(helpers.Usagef("--interval must be positive"))
+		}
+
+		ecs := ecsclient.New()
+		cluster, service := helpers.ServicePicker(ecs, args)
+
+		if err := watchStatus(ecs, elbv2client.New(), appautoscalingclient.New(), cluster, service); err != nil {
+			helpers.Fatal(err)
+		}
+	},
+}
+
+// watchStatus prints the status of the service once, or every --interval with --watch.
+// Tables are redrawn in place on a terminal, JSON and YAML print one document per
+// refresh. Once the status was printed, failing to refresh it is reported on stderr and
+// retried.
+func watchStatus(ecs ecsclient.Client, elb elbv2client.Client, scaling appautoscalingclient.Client, cluster, service string) error {
+	redraw := argStatusWatch && !structuredOutput() && terminal.IsTerminal(int(os.Stdout.Fd()))
+	for refreshed := false; ; refreshed = true {
+		out, err := collectStatus(ecs, elb, scaling, cluster, service)
+		if err != nil && (!refreshed || !argStatusWatch) {
+			return err
+		}
+
+		if err != nil {
+			// stdout only carries documents, the last one stays on screen
+			fmt.Fprintf(os.Stderr, "[error] %s\n", err)
+		} else {
+			if redraw {
+				fmt.Print("\033[H\033[2J")
+				fmt.Printf("Every %s, updated %s (Ctrl-C to stop)\n\n", argStatusInterval, time.Now().Format("15:04:05"))
+			} else if refreshed && argOutput == outputYAML {
+				fmt.Println("---")
+			}
+			if err := printOutput(out, func() { printStatus(out) }); err != nil {
+				return err
+			}
+		}
+
+		if !argStatusWatch {
+			return nil
+		}
+		time.Sleep(argStatusInterval)
+	}
+}
+
+// collectStatus returns the state of the service with its tasks, its last --events
+// events, the health of its tasks in its target groups and its auto scaling bounds
+func collectStatus(ecs ecsclient.Client, elb elbv2client.Client, scaling appautoscalingclient.Client, cluster, service string) (*serviceOutput, error) {
+	serviceObj, err := ecs.FindService(&cluster, &service)
+	if err != nil {
+		return nil, helpers.Wrap(err, "could not find service %s %s", cluster, service)
+	}
+	task := path.Base(*serviceObj.TaskDefinition)
+	defs, err := ecs.GetContainerDefinitions(&task)
+	if err != nil {
+		return nil, helpers.Wrap(err, "could not get the containers of %s", task)
+	}
+	tasks, err := ecs.GetServiceTasks(&cluster, &service)
+	if err != nil {
+		return nil, helpers.Wrap(err, "could not get the tasks of %s", service)
+	}
+
+	out := newServiceOutput(cluster, serviceObj, defs, tasks)
+	for i, e := range serviceObj.Events {
+		if i == argStatusEvents {
+			break
+		}
+		out.Events = append(out.Events, &serviceEventOutput{CreatedAt: aws.TimeValue(e.CreatedAt), Message: aws.StringValue(e.Message)})
+	}
+
+	for _, lb := range serviceObj.LoadBalancers {
+		if lb.TargetGroupArn == nil {
+			continue
+		}
+		tg, err := targetGroupStatus(elb, lb, tasks)
+		if err != nil {
+			return nil, helpers.Wrap(err, "could not get the target health of %s", targetGroupName(*lb.TargetGroupArn))
+		}
+		out.TargetGroups = append(out.TargetGroups, tg)
+	}
+
+	bounds, err := scaling.ServiceBounds(cluster, service)
+	if err != nil {
+		return nil, helpers.Wrap(err, "could not get the auto scaling bounds of %s", service)
+	}
+	if bounds != nil {
+		out.Autoscaling = &autoscalingOutput{Min: bounds.Min, Max: bounds.Max}
+	}
+	return out, nil
+}
+
+// targetGroupStatus returns the state of the tasks in the target group of the load
+// balancer. Tasks which do not publish its port are left out.
+func targetGroupStatus(elb elbv2client.Client, lb *ecs.LoadBalancer, tasks []*ecsclient.TaskInfo) (*targetGroupOutput, error) {
+	out := &targetGroupOutput{
+		Arn:       aws.StringValue(lb.TargetGroupArn),
+		Container: aws.StringValue(lb.ContainerName),
+		Port:      aws.Int64Value(lb.ContainerPort),
+		Targets:   make([]*targetOutput, 0, len(tasks)),
+	}
+	targets := make([]elbv2client.Target, 0, len(tasks))
+	for _, ti := range tasks {
+		id, port, ok := ti.Target(lb)
+		if !ok {
+			continue
+		}
+		targets = append(targets, elbv2client.Target{ID: id, Port: port})
+		out.Targets = append(out.Targets, &targetOutput{Task: path.Base(*ti.TaskArn), ID: id, Port: port})
+	}
+	if len(targets) == 0 {
+		return out, nil
+	}
+
+	states, err := elb.TargetHealth(lb.TargetGroupArn, targets)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range targets {
+		out.Targets[i].State = states[t]
+		if out.Targets[i].State == "" {
+			out.Targets[i].State = elbv2.TargetHealthStateEnumUnused
+		}
+	}
+	return out, nil
+}
+
+// printStatus prints the status of the service for humans
+func printStatus(out *serviceOutput) {
+	whitebold := color.New(color.FgWhite, color.Bold).SprintFunc()
+	separator := "---------------------------------------------------------------------------------------"
+
+	fmt.Printf("Cluster:\t\t%s\n", out.Cluster)
+	fmt.Printf("Service:\t\t%s %s %s\n", whitebold(out.Name), out.Status, out.LaunchType)
+	fmt.Printf("Task Definition:\t%s\n", out.TaskDefinition)
+	fmt.Printf("Tasks:\t\t\t%d Desired, %d Pending, %d Running\n", out.Desired, out.Pending, out.Running)
+	if out.Autoscaling != nil {
+		fmt.Printf("Auto Scaling:\t\t%d to %d tasks\n", out.Autoscaling.Min, out.Autoscaling.Max)
+	} else {
+		fmt.Printf("Auto Scaling:\t\tnone\n")
+	}
+
+	fmt.Println("Deployments:")
+	for _, d := range out.Deployments {
+		fmt.Printf("  %s %s (%d Desired, %d Pending, %d Running) %s ago\n", d.TaskDefinition, strings.TrimSpace(d.Status+" "+d.RolloutState), d.Desired, d.Pending, d.Running, formatAge(d.CreatedAt))
+	}
+	fmt.Println(separator)
+
+	fmt.Println("Containers:")
+	for _, c := range out.Containers {
+		fmt.Printf("  %s: %s\n", whitebold(c.Name), c.Image)
+		fmt.Printf("    CPU %d, Soft Memory limit: %s, Hard memory limit: %s\n", c.CPU, formatLimit(c.SoftMemory), formatLimit(c.HardMemory))
+	}
+	fmt.Println(separator)
+
+	fmt.Println("Tasks:")
+	if len(out.Tasks) == 0 {
+		fmt.Println("  no tasks")
+	}
+	for _, t := range out.Tasks {
+		host := t.InstanceID
+		if host == "" {
+			host = t.LaunchType
+		}
+		uptime := "-"
+		if t.StartedAt != nil {
+			uptime = formatAge(*t.StartedAt)
+		}
+		fmt.Printf("  %s %s %s %s up %s %s\n", path.Base(t.Arn), t.TaskDefinition, host, t.IPAddress, uptime, colorHealth(t.Status, t.HealthStatus))
+		for _, c := range t.Containers {
+			fmt.Printf("    %s [%s] %s\n", c.Name, strings.Join(c.Endpoints, ","), colorHealth(c.Status, c.HealthStatus))
+		}
+	}
+
+	if len(out.TargetGroups) > 0 {
+		fmt.Println(separator)
+		fmt.Println("Target Groups:")
+		for _, tg := range out.TargetGroups {
+			fmt.Printf("  %s (%s:%d)\n", whitebold(targetGroupName(tg.Arn)), tg.Container, tg.Port)
+			for _, t := range tg.Targets {
+				fmt.Printf("    %s %s:%d %s\n", t.Task, t.ID, t.Port, colorHealth(t.State))
+			}
+		}
+	}
+
+	if len(out.Events) > 0 {
+		fmt.Println(separator)
+		fmt.Println("Events:")
+		for _, e := range out.Events {
+			fmt.Printf("  %s %s\n", e.CreatedAt.Local().Format("2006-01-02 15:04:05"), e.Message)
+		}
+	}
+}
+
+// colorHealth joins the states, coloring the healthy ones green and the unhealthy ones red
+func colorHealth(states ...string) string {
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	parts := make([]string, 0, len(states))
+	for _, s := range states {
+		switch strings.ToLower(s) {
+		case "":
+			continue
+		case "healthy", "running":
+			parts = append(parts, green(s))
+		case "unhealthy", "stopped", "draining":
+			parts = append(parts, red(s))
+		default:
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatAge returns how long ago t was, to the second
+func formatAge(t time.Time) string {
+	return time.Since(t).Round(time.Second).String()
+}
+
+// targetGroupName returns the name in a target group ARN like
+// arn:aws:elasticloadbalancing:eu-central-1:123456789012:targetgroup/api/6d0ecf831eec9f09
+func targetGroupName(arn string) string {
+	parts := strings.Split(arn, "/")
+	if len(parts) < 3 {
+		return arn
+	}
+	return parts[len(parts)-2]
+}
+
+func init() {
+	RootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().IntVarP(&argStatusEvents, "events", "e", 5, "How many of the last service events to show")
+	statusCmd.Flags().BoolVarP(&argStatusWatch, "watch", "w", false, "Refresh the status until interrupted")
+	statusCmd.Flags().DurationVarP(&argStatusInterval, "interval", "", 5*time.Second, "How often --watch refreshes the status")
+}
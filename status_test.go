@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/blinkist/skipper/aws/appautoscalingclient"
+	"github.com/blinkist/skipper/aws/elbv2client"
+)
+
+func TestCollectStatusPendingTasks(t *testing.T) {
+	defer testEnv(t)()
+	backend, ecs := newTestBackend(t)
+	serviceObj, err := ecs.FindService(aws.String("production"), aws.String("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.SetPending(*serviceObj.TaskDefinition)
+	if _, err := ecs.ScaleService("production", "web", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := collectStatus(ecs, elbv2client.NewWithClient(backend.ELBV2()), appautoscalingclient.NewWithClient(backend.ApplicationAutoScaling()), "production", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Running != 2 || out.Pending != 1 || len(out.Tasks) != 3 {
+		t.Fatalf("expected 2 running and 1 pending task, got %d running, %d pending and %d tasks", out.Running, out.Pending, len(out.Tasks))
+	}
+	statuses := make(map[string]int)
+	for _, task := range out.Tasks {
+		statuses[task.Status]++
+	}
+	if statuses["RUNNING"] != 2 || statuses["PENDING"] != 1 {
+		t.Errorf("expected the pending task to be listed with the running ones, got %v", statuses)
+	}
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/blinkist/skipper/aws/appautoscalingclient"
+	"github.com/blinkist/skipper/aws/cloudwatchlogsclient"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/elbv2client"
+	"github.com/blinkist/skipper/aws/ssmclient"
+	"github.com/blinkist/skipper/helpers"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// uiLogsSince is how far back tailing the logs of a task starts
+const uiLogsSince = 10 * time.Minute
+
+// Views of the ui, each one is a list the cursor moves in
+type uiView int
+
+const (
+	uiClusters uiView = iota
+	uiServices
+	uiService
+)
+
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Browse clusters, services and tasks in a terminal interface",
+	Long: `
+Opens a full screen interface to browse the clusters, their services and the
+tasks of a service with its deployments, target groups and events. Lists are
+loaded once and reloaded with r.
+
+  up/down, j/k   move
+  enter, right   open the cluster or service
+  left, esc      go back
+  r              reload
+  R              restart the service
+  s              list the SSM parameters of the service
+  e              exec into the selected task
+  l              tail the logs of the selected task
+  q, ctrl-c      quit
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if helpers.NonInteractive {
+			helpers.Fatal(helpers.Usagef("skipper ui can not run with --non-interactive or --yes"))
+		}
+		u := &ui{
+			ecs:      ecsclient.New(),
+			elb:      elbv2client.New(),
+			scaling:  appautoscalingclient.New(),
+			ssm:      ssmclient.New(),
+			logs:     cloudwatchlogsclient.New(),
+			services: make(map[string][]string),
+		}
+		if err := u.run(); err != nil {
+			helpers.Fatal(err)
+		}
+	},
+}
+
+// ui is the state of skipper ui
+type ui struct {
+	ecs     ecsclient.Client
+	elb     elbv2client.Client
+	scaling appautoscalingclient.Client
+	ssm     ssmclient.Client
+	logs    cloudwatchlogsclient.Client
+	term    *helpers.Terminal
+
+	view     uiView
+	clusters []string
+	// services are the names of the services of each loaded cluster
+	services map[string][]string
+	cluster  string
+	service  string
+	status   *serviceOutput
+	// cursor is the selected row of each view
+	cursor [3]int
+	// message is the outcome of the last action, or its error
+	message string
+}
+
+// run shows the clusters and handles key presses until the user quits
+func (u *ui) run() error {
+	term, err := helpers.OpenTerminal()
+	if err != nil {
+		return helpers.Wrap(err, "skipper ui needs a terminal")
+	}
+	u.term = term
+	defer term.Close()
+
+	if err := u.load(false); err != nil {
+		return err
+	}
+	for {
+		u.draw()
+		key, err := term.ReadKey()
+		if err != nil {
+			return err
+		}
+		u.message = ""
+		quit, err := u.handle(key)
+		if quit {
+			return nil
+		}
+		if err != nil {
+			u.message = color.RedString("[error] %s", err)
+		}
+	}
+}
+
+// load fetches the list of the current view unless it is loaded already or reload is set
+func (u *ui) load(reload bool) error {
+	switch u.view {
+	case uiClusters:
+		if u.clusters != nil && !reload {
+			return nil
+		}
+		clusters, err := u.ecs.GetClusterNames()
+		if err != nil {
+			return helpers.Wrap(err, "could not list clusters")
+		}
+		sort.Strings(clusters)
+		u.clusters = clusters
+	case uiServices:
+		if _, ok := u.services[u.cluster]; ok && !reload {
+			return nil
+		}
+		services, err := u.ecs.ListServices(&u.cluster)
+		if err != nil {
+			return helpers.Wrap(err, "could not list the services of %s", u.cluster)
+		}
+		if services == nil {
+			services = []string{}
+		}
+		sort.Strings(services)
+		u.services[u.cluster] = services
+	case uiService:
+		if u.status != nil && !reload {
+			return nil
+		}
+		status, err := collectStatus(u.ecs, u.elb, u.scaling, u.cluster, u.service)
+		if err != nil {
+			return err
+		}
+		u.status = status
+	}
+	u.clampCursor()
+	return nil
+}
+
+// rows returns how many rows the list of the current view has
+func (u *ui) rows() int {
+	switch u.view {
+	case uiClusters:
+		return len(u.clusters)
+	case uiServices:
+		return len(u.services[u.cluster])
+	case uiService:
+		if u.status != nil {
+			return len(u.status.Tasks)
+		}
+	}
+	return 0
+}
+
+func (u *ui) clampCursor() {
+	if c := &u.cursor[u.view]; *c >= u.rows() {
+		*c = u.rows() - 1
+	}
+	if u.cursor[u.view] < 0 {
+		u.cursor[u.view] = 0
+	}
+}
+
+// handle acts on a key press and reports whether the user quits
+func (u *ui) handle(key helpers.Key) (bool, error) {
+	_, height := u.term.Size()
+	switch key.Code {
+	case helpers.KeyInterrupt, helpers.KeyEOF:
+		return true, nil
+	case helpers.KeyUp:
+		u.cursor[u.view]--
+	case helpers.KeyDown:
+		u.cursor[u.view]++
+	case helpers.KeyPageUp:
+		u.cursor[u.view] -= height / 2
+	case helpers.KeyPageDown:
+		u.cursor[u.view] += height / 2
+	case helpers.KeyHome:
+		u.cursor[u.view] = 0
+	case helpers.KeyEnd:
+		u.cursor[u.view] = u.rows() - 1
+	case helpers.KeyEnter, helpers.KeyRight:
+		return false, u.open()
+	case helpers.KeyLeft, helpers.KeyEscape, helpers.KeyBackspace:
+		u.back()
+	case helpers.KeyRune:
+		return u.handleRune(key.Rune)
+	}
+	u.clampCursor()
+	return false, nil
+}
+
+// handleRune acts on the shortcut of a character
+func (u *ui) handleRune(r rune) (bool, error) {
+	switch r {
+	case 'q':
+		return true, nil
+	case 'k':
+		u.cursor[u.view]--
+		u.clampCursor()
+	case 'j':
+		u.cursor[u.view]++
+		u.clampCursor()
+	case 'h':
+		u.back()
+	case 'r':
+		return false, u.load(true)
+	case 'R':
+		return false, u.restart()
+	case 's':
+		return false, u.listSSM()
+	case 'e':
+		return false, u.exec()
+	case 'l':
+		return false, u.tailLogs()
+	}
+	return false, nil
+}
+
+// open shows the services of the selected cluster or the selected service
+func (u *ui) open() error {
+	if u.rows() == 0 {
+		return nil
+	}
+	switch u.view {
+	case uiClusters:
+		u.cluster = u.clusters[u.cursor[uiClusters]]
+		u.view = uiServices
+	case uiServices:
+		u.service = u.services[u.cluster][u.cursor[uiServices]]
+		u.status = nil
+		u.cursor[uiService] = 0
+		u.view = uiService
+	default:
+		return nil
+	}
+	if err := u.load(false); err != nil {
+		u.back()
+		return err
+	}
+	return nil
+}
+
+// back goes to the view above the current one
+func (u *ui) back() {
+	switch u.view {
+	case uiServices:
+		u.view = uiClusters
+	case uiService:
+		u.view = uiServices
+		u.status = nil
+	}
+}
+
+// selectedService returns the opened service, or the selected one in the list of services
+func (u *ui) selectedService() (string, bool) {
+	switch u.view {
+	case uiServices:
+		if u.rows() > 0 {
+			return u.services[u.cluster][u.cursor[uiServices]], true
+		}
+	case uiService:
+		return u.service, true
+	}
+	return "", false
+}
+
+// selectedTask returns the selected task of the opened service
+func (u *ui) selectedTask() (*ecsclient.TaskInfo, error) {
+	if u.view != uiService {
+		return nil, fmt.Errorf("open a service to choose one of its tasks")
+	}
+	if u.rows() == 0 {
+		return nil, helpers.NotFoundf("%s has no running tasks", u.service)
+	}
+	taskID := path.Base(u.status.Tasks[u.cursor[uiService]].Arn)
+	return SelectTask(u.ecs, u.cluster, u.service, taskID)
+}
+
+// suspend leaves the full screen view while action runs in the normal terminal, and
+// returns to it once a key is pressed
+func (u *ui) suspend(action func() error) error {
+	u.term.ExitFullScreen()
+	if err := u.term.Restore(); err != nil {
+		return err
+	}
+	if err := action(); helpers.ExitCode(err) == helpers.ExitAborted {
+		fmt.Println("aborted")
+	} else if err != nil {
+		fmt.Printf("[error] %s\n", err)
+	}
+	fmt.Print("\nPress any key to return to skipper ui")
+	if err := u.term.MakeRaw(); err != nil {
+		return err
+	}
+	_, err := u.term.ReadKey()
+	u.term.EnterFullScreen()
+	return err
+}
+
+// restart gracefully restarts the service once confirmed
+func (u *ui) restart() error {
+	service, ok := u.selectedService()
+	if !ok {
+		return nil
+	}
+	err := u.suspend(func() error {
+		if !helpers.GetYesNo(fmt.Sprintf("Restart %s in %s ?", service, u.cluster)) {
+			return helpers.ErrAborted
+		}
+		return restartService(u.ecs, u.cluster, service)
+	})
+	if err != nil {
+		return err
+	}
+	if u.view == uiService {
+		return u.load(true)
+	}
+	return nil
+}
+
+// listSSM prints the parameters of the service's application
+func (u *ui) listSSM() error {
+	service, ok := u.selectedService()
+	if !ok {
+		return nil
+	}
+	return u.suspend(func() error {
+		ns, err := resolveSSMNamespace(u.ecs, u.cluster, service)
+		if err != nil {
+			return err
+		}
+		global, err := resolveGlobalSSMNamespace(u.cluster, service)
+		if err != nil {
+			return err
+		}
+		return listSSM(u.ssm, global, ns)
+	})
+}
+
+// exec opens a shell in a container of the selected task through ECS Exec
+func (u *ui) exec() error {
+	ti, err := u.selectedTask()
+	if err != nil {
+		return err
+	}
+	return u.suspend(func() error {
+		ci, err := helpers.ContainerPicker(ti, "")
+		if err != nil {
+			return err
+		}
+		code, err := ExecInContainer(u.ecs, u.cluster, *ti.TaskArn, *ci.Name, argExecCommand, true)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n%s exited with code %d\n", argExecCommand, code)
+		return nil
+	})
+}
+
+// tailLogs follows the CloudWatch logs of a container of the selected task until a key
+// is pressed
+func (u *ui) tailLogs() error {
+	ti, err := u.selectedTask()
+	if err != nil {
+		return err
+	}
+
+	u.term.ExitFullScreen()
+	if err := u.term.Restore(); err != nil {
+		return err
+	}
+	defer func() {
+		u.term.MakeRaw()
+		u.term.EnterFullScreen()
+	}()
+
+	ci, err := helpers.ContainerPicker(ti, "")
+	if err != nil {
+		return err
+	}
+	if ci.AwsLogGroup == nil {
+		return fmt.Errorf("container %s does not log to CloudWatch Logs (log driver %s)", *ci.Name, aws.StringValue(ci.LogDriver))
+	}
+	taskID := path.Base(*ti.TaskArn)
+	stream := taskID
+	if prefix := aws.StringValue(ci.AwsLogPrefix); prefix != "" {
+		stream = path.Join(prefix, *ci.Name, taskID)
+	}
+
+	fmt.Printf("Logs of %s in task %s since %s, press any key to stop\n\n", *ci.Name, taskID, uiLogsSince)
+	if err := u.term.MakeRaw(); err != nil {
+		return err
+	}
+	pressed := make(chan struct{})
+	go func() {
+		u.term.ReadKey()
+		close(pressed)
+	}()
+
+	tail := u.logs.Tail(*ci.AwsLogGroup, stream, time.Now().Add(-uiLogsSince))
+	for {
+		select {
+		case event, ok := <-tail.Events:
+			if !ok {
+				<-pressed
+				return tail.Stop()
+			}
+			// the terminal is raw, lines have to return the carriage themselves
+			message := strings.Replace(strings.TrimRight(event.Message, "\n"), "\n", "\r\n", -1)
+			fmt.Printf("%s %s\r\n", event.Timestamp.Format("15:04:05"), message)
+		case <-pressed:
+			return tail.Stop()
+		}
+	}
+}
+
+// draw renders the current view
+func (u *ui) draw() {
+	_, height := u.term.Size()
+	whitebold := color.New(color.FgWhite, color.Bold).SprintFunc()
+
+	title := "skipper ui"
+	switch u.view {
+	case uiServices:
+		title += " > " + u.cluster
+	case uiService:
+		title += " > " + u.cluster + " > " + u.service
+	}
+	lines := []string{whitebold(title), ""}
+
+	help := "enter open  esc back  r reload  q quit"
+	switch u.view {
+	case uiServices:
+		help = "enter open  esc back  r reload  R restart  s ssm  q quit"
+	case uiService:
+		help = "esc back  r reload  R restart  s ssm  e exec  l logs  q quit"
+	}
+	footer := []string{"", help, u.message}
+
+	switch u.view {
+	case uiClusters:
+		lines = append(lines, u.list(u.clusters, height-len(lines)-len(footer))...)
+	case uiServices:
+		lines = append(lines, u.list(u.services[u.cluster], height-len(lines)-len(footer))...)
+	case uiService:
+		lines = append(lines, u.serviceLines(height-len(lines)-len(footer))...)
+	}
+
+	for len(lines) < height-len(footer) {
+		lines = append(lines, "")
+	}
+	u.term.Draw(append(lines, footer...))
+}
+
+// list returns the rows of the current view fitting height, scrolled to the cursor
+func (u *ui) list(rows []string, height int) []string {
+	if len(rows) == 0 {
+		return []string{"  nothing found"}
+	}
+	if height < 1 {
+		height = 1
+	}
+	cursor := u.cursor[u.view]
+	start := 0
+	if cursor >= height {
+		start = cursor - height + 1
+	}
+	end := start + height
+	if end > len(rows) {
+		end = len(rows)
+	}
+
+	selected := color.New(color.ReverseVideo).SprintFunc()
+	lines := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		if i == cursor {
+			lines = append(lines, selected("> "+rows[i]))
+		} else {
+			lines = append(lines, "  "+rows[i])
+		}
+	}
+	return lines
+}
+
+// serviceLines returns the status of the opened service with its tasks as the list
+func (u *ui) serviceLines(height int) []string {
+	out := u.status
+	lines := []string{
+		fmt.Sprintf("%s %s  Task Definition %s", out.Status, out.LaunchType, out.TaskDefinition),
+		fmt.Sprintf("%d Desired, %d Pending, %d Running", out.Desired, out.Pending, out.Running),
+	}
+	if out.Autoscaling != nil {
+		lines[1] += fmt.Sprintf("  Auto Scaling %d to %d tasks", out.Autoscaling.Min, out.Autoscaling.Max)
+	}
+
+	lines = append(lines, "", "Deployments:")
+	for _, d := range out.Deployments {
+		lines = append(lines, fmt.Sprintf("  %s %s (%d Desired, %d Pending, %d Running) %s ago", d.TaskDefinition, strings.TrimSpace(d.Status+" "+d.RolloutState), d.Desired, d.Pending, d.Running, formatAge(d.CreatedAt)))
+	}
+	lines = append(lines, "Containers:")
+	for _, c := range out.Containers {
+		lines = append(lines, fmt.Sprintf("  %s %s", c.Name, c.Image))
+	}
+	if len(out.TargetGroups) > 0 {
+		lines = append(lines, "Target Groups:")
+		for _, tg := range out.TargetGroups {
+			states := make(map[string]int)
+			for _, t := range tg.Targets {
+				states[t.State]++
+			}
+			names := make([]string, 0, len(states))
+			for state := range states {
+				names = append(names, state)
+			}
+			sort.Strings(names)
+			counts := make([]string, len(names))
+			for i, state := range names {
+				counts[i] = fmt.Sprintf("%d %s", states[state], colorHealth(state))
+			}
+			lines = append(lines, fmt.Sprintf("  %s (%s:%d) %s", targetGroupName(tg.Arn), tg.Container, tg.Port, strings.Join(counts, ", ")))
+		}
+	}
+
+	events := make([]string, 0, len(out.Events)+2)
+	if len(out.Events) > 0 {
+		events = append(events, "", "Events:")
+		for _, e := range out.Events {
+			events = append(events, fmt.Sprintf("  %s %s", e.CreatedAt.Local().Format("15:04:05"), e.Message))
+		}
+	}
+
+	tasks := make([]string, len(out.Tasks))
+	for i, t := range out.Tasks {
+		host := t.InstanceID
+		if host == "" {
+			host = t.LaunchType
+		}
+		uptime := "-"
+		if t.StartedAt != nil {
+			uptime = formatAge(*t.StartedAt)
+		}
+		containers := make([]string, len(t.Containers))
+		for j, c := range t.Containers {
+			containers[j] = fmt.Sprintf("%s [%s] %s", c.Name, strings.Join(c.Endpoints, ","), colorHealth(c.Status, c.HealthStatus))
+		}
+		tasks[i] = fmt.Sprintf("%s %s %s %s up %s %s  %s", path.Base(t.Arn), t.TaskDefinition, host, t.IPAddress, uptime, colorHealth(t.Status, t.HealthStatus), strings.Join(containers, "  "))
+	}
+
+	// the tasks get the room left, but at least three rows, events are cut first
+	lines = append(lines, "", "Tasks:")
+	room := height - len(lines) - len(events)
+	if room < 3 {
+		room = 3
+	}
+	if room > len(tasks) && len(tasks) > 0 {
+		room = len(tasks)
+	}
+	lines = append(lines, u.list(tasks, room)...)
+	return append(lines, events...)
+}
+
+func init() {
+	RootCmd.AddCommand(uiCmd)
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path"
 	"strings"
 
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ecrclient"
 	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/iamclient"
 	"github.com/blinkist/skipper/helpers"
 	"github.com/spf13/cobra"
 )
@@ -16,16 +22,34 @@ var (
 	argWait                   bool
 	argSets                   []string
 	argUnsets                 []string
+	argSecrets                []string
 	argTargetGroup            string
+	argDryRun                 bool
+	argUpdateContainer        string
 )
 
 var updateCmd = &cobra.Command{
-	Use:   "update",
+	Use:   "update [cluster] [service]",
 	Short: "update services",
-	Long:  "View current cluster or service deployment status",
+	Long: `
+Registers a new revision of the service's task definition with the changed
+environment, secrets, image or placement and updates the service to it once
+confirmed. New images in ECR are checked to exist and the task execution role to
+be allowed to read new secrets before anything is registered.
+
+  skipper update production api --container app --image_tag v1.2.3
+  skipper update production api --set LOG_LEVEL=debug --dry-run
+  skipper update production api --secret DATABASE_URL=/application/api/DATABASE_URL
+  skipper update production --match 'prod-books-*' --container app --image_tag v1.2.3
+  skipper update --tag team=content --set LOG_LEVEL=info
+`,
 	Run: func(cmd *cobra.Command, args []string) {
+		separateProgress()
 		ecs := ecsclient.New()
-		cluster, service := helpers.ServicePicker(ecs, args)
+		selector, err := serviceSelector()
+		if err != nil {
+			helpers.Fatal(err)
+		}
 
 		changes := make(map[string]string)
 		for _, change := range argSets {
@@ -43,10 +67,233 @@ var updateCmd = &cobra.Command{
 		for _, field := range argUnsets {
 			removes[field] = struct{}{}
 		}
-		ecs.UpdateService(&cluster, &service, nil, nil, true, &changes, &removes, &argTargetGroup)
+
+		rdi := &ecsclient.RegisterTaskDefinitionInput{
+			TargetGroup: &argTargetGroup,
+			Changes:     &changes,
+			Unsets:      &removes,
+		}
+		if len(argSecrets) > 0 {
+			secrets, err := parseSecrets(argSecrets)
+			if err != nil {
+				helpers.Fatal(err)
+			}
+			rdi.Secrets = &secrets
+		}
+		if argImageOverride != "" {
+			image := argImageOverride
+			if argImageTag != "" {
+				image = ecsclient.ReplaceImageTag(image, argImageTag)
+			}
+			rdi.Image = &image
+		} else if argImageTag != "" {
+			rdi.Tag = &argImageTag
+		}
+
+		if selector != nil {
+			if err := updateServices(ecs, ecrclient.New(), iamclient.New(), args, selector, rdi); err != nil {
+				helpers.Fatal(err)
+			}
+			return
+		}
+
+		cluster, service := helpers.ServicePicker(ecs, args)
+		if err := updateService(ecs, ecrclient.New(), iamclient.New(), cluster, service, rdi); err != nil {
+			helpers.Fatal(err)
+		}
 	},
 }
 
+// updatePlan is the new revision of a service's task definition
+type updatePlan struct {
+	cluster    string
+	service    string
+	serviceObj *ecs.Service
+	current    *ecs.TaskDefinition
+	proposed   *ecs.TaskDefinition
+	changes    []*ecsclient.Change
+}
+
+// unchanged reports whether the plan would deploy the running task definition. A task
+// definition override is deployed even if it is unchanged.
+func (p *updatePlan) unchanged() bool {
+	return len(p.changes) == 0 && *p.current.TaskDefinitionArn == *p.serviceObj.TaskDefinition
+}
+
+// updateService shows the changes rdi makes to the service's task definition and, unless
+// this is a dry run and once confirmed, registers them and updates the service
+func updateService(ecs ecsclient.Client, ecr ecrclient.Client, iam iamclient.Client, cluster, service string, rdi *ecsclient.RegisterTaskDefinitionInput) error {
+	plan, err := planUpdate(ecs, ecr, iam, cluster, service, rdi, true)
+	if err != nil {
+		return err
+	}
+	if argDryRun || plan.unchanged() {
+		return nil
+	}
+	if !helpers.GetYesNo(fmt.Sprintf("Register the changes and update %s ?", service)) {
+		return helpers.ErrAborted
+	}
+	return applyUpdate(ecs, plan)
+}
+
+// updateServices shows the changes rdi makes to the task definitions of all services of
+// the selector and, unless this is a dry run and once confirmed, updates the changed ones
+func updateServices(ecs ecsclient.Client, ecr ecrclient.Client, iam iamclient.Client, args []string, selector *helpers.ServiceSelector, rdi *ecsclient.RegisterTaskDefinitionInput) error {
+	if argTaskdefinitionOverride != "" {
+		return helpers.Usagef("--taskdefinition_override can not be combined with --match or --tag")
+	}
+	refs, err := selectServices(ecs, args, selector)
+	if err != nil {
+		return err
+	}
+
+	plans := make([]*updatePlan, 0, len(refs))
+	for _, ref := range refs {
+		// the container is picked per service
+		serviceRdi := *rdi
+		plan, err := planUpdate(ecs, ecr, iam, ref.Cluster, ref.Service, &serviceRdi, false)
+		if err != nil {
+			return helpers.Wrap(err, "%s", ref)
+		}
+		if plan.unchanged() {
+			fmt.Printf("%s is unchanged, skipping it\n", ref)
+			continue
+		}
+		plans = append(plans, plan)
+	}
+	if argDryRun || len(plans) == 0 {
+		return nil
+	}
+	if !helpers.GetYesNo(fmt.Sprintf("Register the changes and update these %d services ?", len(plans))) {
+		return helpers.ErrAborted
+	}
+
+	changed := make([]helpers.ServiceRef, len(plans))
+	byRef := make(map[helpers.ServiceRef]*updatePlan, len(plans))
+	for i, plan := range plans {
+		changed[i] = helpers.ServiceRef{Cluster: plan.cluster, Service: plan.service}
+		byRef[changed[i]] = plan
+	}
+	results := forEachService(changed, func(ref helpers.ServiceRef) (string, error) {
+		return "updated", applyUpdate(ecs, byRef[ref])
+	})
+	if failed := printSummary(results); failed > 0 {
+		return fmt.Errorf("%d of %d services failed to update", failed, len(results))
+	}
+	return nil
+}
+
+// planUpdate shows the changes rdi makes to the service's task definition and checks
+// their images exist and their secrets can be read. The container of a new image or
+// changed secrets is only asked for if interactive.
+func planUpdate(ecs ecsclient.Client, ecr ecrclient.Client, iam iamclient.Client, cluster, service string, rdi *ecsclient.RegisterTaskDefinitionInput, interactive bool) (*updatePlan, error) {
+	serviceObj, err := ecs.FindService(&cluster, &service)
+	if err != nil {
+		return nil, helpers.Wrap(err, "could not find service %s %s", cluster, service)
+	}
+
+	task := serviceObj.TaskDefinition
+	if argTaskdefinitionOverride != "" {
+		task = &argTaskdefinitionOverride
+	}
+
+	if rdi.Container == nil && (rdi.Image != nil || rdi.Tag != nil || rdi.Secrets != nil || rdi.SecretUnsets != nil) {
+		container, err := updateContainer(ecs, task, interactive)
+		if err != nil {
+			return nil, err
+		}
+		rdi.Container = &container
+	}
+
+	current, proposed, err := ecs.ProposeTaskDefinition(task, rdi)
+	if err != nil {
+		return nil, helpers.Wrap(err, "register task definition")
+	}
+
+	fmt.Printf("Cluster:\t\t%s\n", cluster)
+	fmt.Printf("Service:\t\t%s\n", service)
+	fmt.Printf("Task Definition:\t%s\n", path.Base(*current.TaskDefinitionArn))
+	fmt.Println("---------------------------------------------------------------------------------------")
+	changes := ecsclient.DiffTaskDefinitions(current, proposed)
+	ecsclient.WriteChanges(os.Stdout, changes)
+	fmt.Println("---------------------------------------------------------------------------------------")
+
+	if err := verifyImages(ecr, changes); err != nil {
+		return nil, err
+	}
+	if err := verifySecrets(iam, proposed, changes); err != nil {
+		return nil, err
+	}
+	return &updatePlan{
+		cluster:    cluster,
+		service:    service,
+		serviceObj: serviceObj,
+		current:    current,
+		proposed:   proposed,
+		changes:    changes,
+	}, nil
+}
+
+// applyUpdate registers the proposed task definition and rolls the service to it
+func applyUpdate(ecs ecsclient.Client, plan *updatePlan) error {
+	arn, err := ecs.RegisterTaskDefinitionRevision(plan.proposed)
+	if err != nil {
+		return helpers.Wrap(err, "register task definition")
+	}
+	fmt.Printf("Registered %s\n", path.Base(arn))
+
+	return rollout(ecs, plan.cluster, plan.service, *plan.serviceObj.TaskDefinition, arn)
+}
+
+// updateContainer returns the container whose image or secrets are updated, asking if the task
+// runs more than one, --container is not set and interactive
+func updateContainer(ecs ecsclient.Client, task *string, interactive bool) (string, error) {
+	defs, err := ecs.GetContainerDefinitions(task)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, len(defs))
+	for i, d := range defs {
+		names[i] = *d.Name
+	}
+	if argUpdateContainer == "" {
+		if !interactive && len(names) > 1 {
+			return "", helpers.Usagef("the task runs the containers %s, choose one with --container", strings.Join(names, ", "))
+		}
+		return helpers.ChooseOption(names, "container")
+	}
+	for _, name := range names {
+		if name == argUpdateContainer {
+			return name, nil
+		}
+	}
+	return "", helpers.NotFoundf("container %s not found, available containers: %s", argUpdateContainer, strings.Join(names, ", "))
+}
+
+// verifyImages makes sure every new ECR image of the changes has been pushed, images
+// in other registries are not checked
+func verifyImages(ecr ecrclient.Client, changes []*ecsclient.Change) error {
+	for _, c := range changes {
+		if c.Field != ecsclient.FieldImage || c.New == nil {
+			continue
+		}
+		image, ok := ecrclient.ParseImage(*c.New)
+		if !ok {
+			fmt.Printf("%s is not in ECR, skipping the check if it exists\n", *c.New)
+			continue
+		}
+		exists, err := ecr.ImageExists(image)
+		if err != nil {
+			return helpers.Wrap(err, "could not look up %s", *c.New)
+		}
+		if !exists {
+			return helpers.NotFoundf("image %s not found in ECR", *c.New)
+		}
+	}
+	return nil
+}
+
 func init() {
 	RootCmd.AddCommand(updateCmd)
 	updateCmd.Flags().StringVarP(&argImageOverride, "image_override", "i", "", "Override the image with our own image_url e.g. 1234.dkr.ecr.abc.amazonaws.com/image:latest")
@@ -54,7 +301,12 @@ func init() {
 	updateCmd.Flags().StringVarP(&argServiceType, "service_type", "", "web", "The name of the service")
 	updateCmd.Flags().StringVarP(&argTaskdefinitionOverride, "taskdefinition_override", "", "", "The name of the task definition, this overrides the default service definition.")
 	updateCmd.Flags().StringVarP(&argImageTag, "image_tag", "", "", "The image tag")
+	updateCmd.Flags().StringVarP(&argUpdateContainer, "container", "c", "", "The container to update the image or secrets of, asks if the task runs more than one")
 	updateCmd.Flags().StringVarP(&argTargetGroup, "targetGroup", "", "", "The placement targetGroup to use")
 	updateCmd.Flags().StringArrayVar(&argSets, "set", nil, "key=value to be updated (can be used multiple times)")
-	updateCmd.Flags().StringArrayVar(&argUnsets, "unset", nil, "key to be removed (can be used multiple times)")
+	updateCmd.Flags().StringArrayVar(&argUnsets, "unset", nil, "key to be removed, a variable or a secret (can be used multiple times)")
+	updateCmd.Flags().StringArrayVar(&argSecrets, "secret", nil, "NAME=/path/of/the/parameter or NAME=arn to read the variable from SSM or Secrets Manager (can be used multiple times)")
+	updateCmd.Flags().BoolVarP(&argDryRun, "dry-run", "", false, "Only show the changes to the task definition, only the values of variables named like secrets (TOKEN, PASSWORD...) are masked")
+	addSelectorFlags(updateCmd)
+	updateCmd.Flags().BoolVarP(&argNoRollback, "no-rollback", "", false, "Leave the service as it is if the deployment fails to become stable")
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/blinkist/skipper/aws/ecrclient"
+	"github.com/blinkist/skipper/aws/ecsclient"
+	"github.com/blinkist/skipper/aws/iamclient"
+	"github.com/blinkist/skipper/helpers"
+)
+
+func TestUpdateService(t *testing.T) {
+	defer testEnv(t)()
+	backend, ecs := newTestBackend(t)
+	argUpdateContainer = "app"
+	defer func() { argUpdateContainer = "" }()
+
+	changes := map[string]string{"LOG_LEVEL": "debug"}
+	rdi := &ecsclient.RegisterTaskDefinitionInput{Tag: aws.String("v2"), Changes: &changes}
+	if err := updateService(ecs, ecrclient.NewWithClient(backend.ECR()), iamclient.NewWithClient(backend.IAM()), "production", "web", rdi); err != nil {
+		t.Fatal(err)
+	}
+
+	serviceObj, err := ecs.FindService(aws.String("production"), aws.String("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Base(*serviceObj.TaskDefinition) != "web:2" {
+		t.Fatalf("expected the service to run web:2, got %s", *serviceObj.TaskDefinition)
+	}
+	defs, err := ecs.GetContainerDefinitions(serviceObj.TaskDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(*defs[0].Image, "/api:v2") || aws.StringValue(defs[0].Environment[0].Value) != "debug" {
+		t.Errorf("expected api:v2 with LOG_LEVEL=debug, got %s with %s", *defs[0].Image, defs[0].Environment)
+	}
+}
+
+func TestUpdateServiceMissingImage(t *testing.T) {
+	defer testEnv(t)()
+	backend, ecs := newTestBackend(t)
+	argUpdateContainer = "app"
+	defer func() { argUpdateContainer = "" }()
+
+	rdi := &ecsclient.RegisterTaskDefinitionInput{Tag: aws.String("v3")}
+	err := updateService(ecs, ecrclient.NewWithClient(backend.ECR()), iamclient.NewWithClient(backend.IAM()), "production", "web", rdi)
+	if helpers.ExitCode(err) != helpers.ExitNotFound {
+		t.Fatalf("expected the missing image to be not found, got %v", err)
+	}
+	revisions, err := ecs.ListTaskDefinitionRevisions(aws.String("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Errorf("expected nothing to be registered, got %v", revisions)
+	}
+}
+
+func TestUpdateServiceRollback(t *testing.T) {
+	defer testEnv(t)()
+	backend, ecs := newTestBackend(t)
+	argUpdateContainer = "app"
+	defer func() { argUpdateContainer = "" }()
+
+	// web:2 is the revision the update registers
+	backend.FailTaskDefinition("arn:aws:ecs:eu-central-1:123456789012:task-definition/web:2", "Essential container in task exited")
+	rdi := &ecsclient.RegisterTaskDefinitionInput{Tag: aws.String("v2")}
+	err := updateService(ecs, ecrclient.NewWithClient(backend.ECR()), iamclient.NewWithClient(backend.IAM()), "production", "web", rdi)
+	if err == nil || !strings.Contains(err.Error(), "rolled back to web:1") {
+		t.Fatalf("expected the failed deployment to be rolled back, got %v", err)
+	}
+
+	serviceObj, err := ecs.FindService(aws.String("production"), aws.String("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Base(*serviceObj.TaskDefinition) != "web:1" || *serviceObj.RunningCount != 2 {
+		t.Errorf("expected 2 tasks of web:1 to run again, got %d of %s", *serviceObj.RunningCount, *serviceObj.TaskDefinition)
+	}
+}
+
+func TestPlanUpdateSecretContainer(t *testing.T) {
+	defer testEnv(t)()
+	backend, client := newTestBackend(t)
+	role := "arn:aws:iam::123456789012:role/web-execution"
+	if _, err := backend.ECS().RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+		Family:           aws.String("web"),
+		ExecutionRoleArn: aws.String(role),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("app"), Image: aws.String("api:v1"), Memory: aws.Int64(128)},
+			{Name: aws.String("log"), Image: aws.String("fluentbit:v1"), Memory: aws.Int64(64)},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	argTaskdefinitionOverride = "web:2"
+	defer func() { argTaskdefinitionOverride, argUpdateContainer = "", "" }()
+	ecr, iam := ecrclient.NewWithClient(backend.ECR()), iamclient.NewWithClient(backend.IAM())
+	secrets := map[string]string{"DB_PASSWORD": "/application/api/DB_PASSWORD"}
+
+	_, err := planUpdate(client, ecr, iam, "production", "web", &ecsclient.RegisterTaskDefinitionInput{Secrets: &secrets}, false)
+	if helpers.ExitCode(err) != helpers.ExitUsage || !strings.Contains(err.Error(), "--container") {
+		t.Fatalf("expected the secret to need a container, got %v", err)
+	}
+
+	argUpdateContainer = "app"
+	backend.AllowPrincipal(role, "ssm:GetParameters", "arn:aws:ssm:eu-central-1:123456789012:parameter/application/api/*")
+	var plan *updatePlan
+	captureStdout(t, func() {
+		plan, err = planUpdate(client, ecr, iam, "production", "web", &ecsclient.RegisterTaskDefinitionInput{Secrets: &secrets}, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range plan.proposed.ContainerDefinitions {
+		if expected := *d.Name == "app"; (len(d.Secrets) == 1) != expected {
+			t.Errorf("expected only app to read DB_PASSWORD, %s has %d secrets", *d.Name, len(d.Secrets))
+		}
+	}
+}
+
+func TestUpdateServiceProgressJSON(t *testing.T) {
+	defer testEnv(t)()
+	backend, ecs := newTestBackend(t)
+	argUpdateContainer, argProgress = "app", progressJSON
+	defer func() { argUpdateContainer, argProgress, eventOutput = "", progressLive, os.Stdout }()
+
+	rdi := &ecsclient.RegisterTaskDefinitionInput{Tag: aws.String("v2")}
+	printed := captureStdout(t, func() {
+		// the diff and confirmation go to stderr
+		separateProgress()
+		if err := updateService(ecs, ecrclient.NewWithClient(backend.ECR()), iamclient.NewWithClient(backend.IAM()), "production", "web", rdi); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	lines := strings.Split(strings.TrimSpace(printed), "\n")
+	for _, line := range lines {
+		e := &ecsclient.Event{}
+		if err := json.Unmarshal([]byte(line), e); err != nil {
+			t.Fatalf("expected only events on stdout, got %q", line)
+		}
+	}
+	last := &ecsclient.Event{}
+	json.Unmarshal([]byte(lines[len(lines)-1]), last)
+	if last.Type != ecsclient.EventSteadyState {
+		t.Errorf("expected the last event to be %s, got %s", ecsclient.EventSteadyState, last.Type)
+	}
+}